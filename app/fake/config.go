@@ -0,0 +1,343 @@
+package fake
+
+import (
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+)
+
+// ConfigService returns settings from an in-memory map keyed by the same
+// environment variable names the real config service reads
+type ConfigService struct {
+	mutex  sync.Mutex
+	values map[string]string
+}
+
+func NewConfig(values map[string]string) *ConfigService {
+	defaults := map[string]string{
+		"RUN_TIME_ENV":               "test",
+		"API_PORT":                   "8080",
+		"DB_DRIVER":                  "fake",
+		"TRELLO_BASE_URL":            "https://api.trello.com/1",
+		"TRELLO_PROPERTIES_BOARD_ID": "properties-board",
+		"TRELLO_INHERITANCE_CONFINEMENTS_BOARD_ID": "inhconfs-board",
+		"TRELLO_SUPPORTIVE_DOCS_BOARD_ID":          "suppdocs-board",
+		"TRELLO_EXPENSES_BOARD_ID":                 "expenses-board",
+	}
+
+	for k, v := range values {
+		defaults[k] = v
+	}
+
+	return &ConfigService{
+		values: defaults,
+	}
+}
+
+// Set overrides a single setting
+func (svc *ConfigService) Set(key, value string) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	svc.values[key] = value
+}
+
+func (svc *ConfigService) get(key string) string {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return svc.values[key]
+}
+
+func (svc *ConfigService) getInt(key string, def int) int {
+	v, err := strconv.Atoi(svc.get(key))
+	if err != nil {
+		return def
+	}
+
+	return v
+}
+
+func (svc *ConfigService) getDuration(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(svc.get(key))
+	if err != nil {
+		return def
+	}
+
+	return v
+}
+
+var _ config.IService = (*ConfigService)(nil)
+
+func (svc *ConfigService) GetRuntimeEnvironment() string {
+	return svc.get("RUN_TIME_ENV")
+}
+
+func (svc *ConfigService) IsProduction() bool {
+	return svc.GetRuntimeEnvironment() == "prod"
+}
+
+func (svc *ConfigService) GetAPIPort() string {
+	return svc.get("API_PORT")
+}
+
+func (svc *ConfigService) IsOpenTelemetry() bool {
+	return svc.get("OPEN_TELEMETRY") == "true"
+}
+
+func (svc *ConfigService) GetTrelloPropertiesBoardID() string {
+	return svc.get("TRELLO_PROPERTIES_BOARD_ID")
+}
+
+func (svc *ConfigService) GetTrelloInheritanceConfinmentsBoardID() string {
+	return svc.get("TRELLO_INHERITANCE_CONFINEMENTS_BOARD_ID")
+}
+
+func (svc *ConfigService) GetTrelloSupportiveDocsBoardID() string {
+	return svc.get("TRELLO_SUPPORTIVE_DOCS_BOARD_ID")
+}
+
+func (svc *ConfigService) GetTrelloExpensesBoardID() string {
+	return svc.get("TRELLO_EXPENSES_BOARD_ID")
+}
+
+func (svc *ConfigService) GetDbDriver() string {
+	return svc.get("DB_DRIVER")
+}
+
+func (svc *ConfigService) GetDbDSN() string {
+	return svc.get("DB_DSN")
+}
+
+func (svc *ConfigService) GetDbMaxOpenConns() int {
+	return svc.getInt("DB_MAX_OPEN_CONNS", 10)
+}
+
+func (svc *ConfigService) GetDbMaxIdleConns() int {
+	return svc.getInt("DB_MAX_IDLE_CONNS", 5)
+}
+
+func (svc *ConfigService) GetDbConnMaxLifetime() time.Duration {
+	return svc.getDuration("DB_CONN_MAX_LIFETIME", 30*time.Minute)
+}
+
+func (svc *ConfigService) GetDbConnMaxIdleTime() time.Duration {
+	return svc.getDuration("DB_CONN_MAX_IDLE_TIME", 5*time.Minute)
+}
+
+func (svc *ConfigService) GetDbConnectRetries() int {
+	return svc.getInt("DB_CONNECT_RETRIES", 1)
+}
+
+func (svc *ConfigService) GetDbConnectRetryDelay() time.Duration {
+	return svc.getDuration("DB_CONNECT_RETRY_DELAY", time.Millisecond)
+}
+
+func (svc *ConfigService) GetTrelloAPIKey() string {
+	return svc.get("TRELLO_API_KEY")
+}
+
+func (svc *ConfigService) GetTrelloToken() string {
+	return svc.get("TRELLO_TOKEN")
+}
+
+func (svc *ConfigService) GetTrelloReadToken() string {
+	return svc.get("TRELLO_TOKEN_READ")
+}
+
+func (svc *ConfigService) GetTrelloBaseURL() string {
+	return svc.get("TRELLO_BASE_URL")
+}
+
+func (svc *ConfigService) GetDropboxAccessToken() string {
+	return svc.get("DROPBOX_ACCESS_TOKEN")
+}
+
+func (svc *ConfigService) GetDropboxUploadPath() string {
+	return svc.get("DROPBOX_UPLOAD_PATH")
+}
+
+func (svc *ConfigService) GetStorageBucket() string {
+	return svc.get("STORAGE_BUCKET")
+}
+
+func (svc *ConfigService) GetStorageRegion() string {
+	return svc.get("STORAGE_REGION")
+}
+
+func (svc *ConfigService) GetStorageBackend() string {
+	if svc.get("STORAGE_BACKEND") == "" {
+		return "s3"
+	}
+
+	return svc.get("STORAGE_BACKEND")
+}
+
+func (svc *ConfigService) GetStorageRoot() string {
+	return svc.get("STORAGE_ROOT")
+}
+
+func (svc *ConfigService) GetStorageBaseURL() string {
+	return strings.TrimSuffix(svc.get("STORAGE_BASE_URL"), "/")
+}
+
+func (svc *ConfigService) GetStorageEndpoint() string {
+	return strings.TrimSuffix(svc.get("STORAGE_ENDPOINT"), "/")
+}
+
+func (svc *ConfigService) IsStoragePathStyle() bool {
+	return svc.get("STORAGE_PATH_STYLE") == "true"
+}
+
+func (svc *ConfigService) GetStorageAccessKeyID() string {
+	return svc.get("STORAGE_ACCESS_KEY_ID")
+}
+
+func (svc *ConfigService) GetStorageSecretAccessKey() string {
+	return svc.get("STORAGE_SECRET_ACCESS_KEY")
+}
+
+func (svc *ConfigService) GetStorageClass() string {
+	return svc.get("STORAGE_CLASS")
+}
+
+func (svc *ConfigService) GetStorageSSE() string {
+	return svc.get("STORAGE_SSE")
+}
+
+func (svc *ConfigService) GetStorageSSEKMSKeyID() string {
+	return svc.get("STORAGE_SSE_KMS_KEY_ID")
+}
+
+func (svc *ConfigService) GetSignedURLTTL() time.Duration {
+	return svc.getDuration("STORAGE_SIGNED_URL_TTL", 5*time.Minute)
+}
+
+func (svc *ConfigService) GetStorageSigningSecret() string {
+	return svc.get("STORAGE_SIGNING_SECRET")
+}
+
+func (svc *ConfigService) GetDownloadURLTTL() time.Duration {
+	return svc.getDuration("DOWNLOAD_URL_TTL", time.Hour)
+}
+
+func (svc *ConfigService) GetDownloadSigningSecret() string {
+	return svc.get("DOWNLOAD_SIGNING_SECRET")
+}
+
+func (svc *ConfigService) GetBackupPath() string {
+	return svc.get("BACKUP_PATH")
+}
+
+func (svc *ConfigService) GetResetTokenSecret() string {
+	return svc.get("RESET_TOKEN_SECRET")
+}
+
+func (svc *ConfigService) GetErrorsRetention() time.Duration {
+	return svc.getDuration("ERRORS_RETENTION", 0)
+}
+
+func (svc *ConfigService) GetQueueWorkers(jobType string) int {
+	return svc.getInt("QUEUE_WORKERS_"+strings.ToUpper(jobType), 1)
+}
+
+func (svc *ConfigService) GetQueuePollInterval() time.Duration {
+	return svc.getDuration("QUEUE_POLL_INTERVAL", 10*time.Millisecond)
+}
+
+func (svc *ConfigService) GetJobHeartbeatInterval() time.Duration {
+	return svc.getDuration("JOB_HEARTBEAT_INTERVAL", 10*time.Millisecond)
+}
+
+func (svc *ConfigService) GetJobHeartbeatTimeout() time.Duration {
+	return svc.getDuration("JOB_HEARTBEAT_TIMEOUT", time.Minute)
+}
+
+func (svc *ConfigService) GetJobMaxAttempts() int {
+	return svc.getInt("JOB_MAX_ATTEMPTS", 3)
+}
+
+func (svc *ConfigService) GetJobProgressInterval() time.Duration {
+	return svc.getDuration("JOB_PROGRESS_INTERVAL", 0)
+}
+
+// GetCardRetryAttempts does not retry by default so tests see every injected failure
+func (svc *ConfigService) GetCardRetryAttempts() int {
+	return svc.getInt("CARD_RETRY_ATTEMPTS", 1)
+}
+
+func (svc *ConfigService) GetCardRetryBackoff() time.Duration {
+	return svc.getDuration("CARD_RETRY_BACKOFF", time.Millisecond)
+}
+
+func (svc *ConfigService) GetJobMaxDuration(jobType string, def time.Duration) time.Duration {
+	return svc.getDuration("JOB_MAX_DURATION_"+strings.ToUpper(jobType), def)
+}
+
+// GetCardTimeout is off by default so slow test machines do not time jobs out
+func (svc *ConfigService) GetCardTimeout() time.Duration {
+	return svc.getDuration("CARD_TIMEOUT", 0)
+}
+
+func (svc *ConfigService) GetHTTPTimeout() time.Duration {
+	return svc.getDuration("HTTP_TIMEOUT", 5*time.Second)
+}
+
+// GetUploadPartSize is read in bytes and not clamped so tests can stream
+// in tiny parts
+func (svc *ConfigService) GetUploadPartSize() int64 {
+	return int64(svc.getInt("UPLOAD_PART_SIZE", 8<<20))
+}
+
+func (svc *ConfigService) GetSchedule(jobType string) string {
+	return svc.get("SCHEDULE_" + strings.ToUpper(jobType))
+}
+
+func (svc *ConfigService) GetScheduleTimeZone() string {
+	if svc.get("SCHEDULE_TIMEZONE") == "" {
+		return "UTC"
+	}
+
+	return svc.get("SCHEDULE_TIMEZONE")
+}
+
+func (svc *ConfigService) GetScheduleCatchUp() string {
+	if svc.get("SCHEDULE_CATCH_UP") == "" {
+		return "once"
+	}
+
+	return svc.get("SCHEDULE_CATCH_UP")
+}
+
+func (svc *ConfigService) GetSchedulePollInterval() time.Duration {
+	return svc.getDuration("SCHEDULE_POLL_INTERVAL", 10*time.Millisecond)
+}
+
+func (svc *ConfigService) GetPropertiesExcelUpdateWebhook() string {
+	return svc.get("PROPERTIES_EXCEL_UPDATE_WEBHOOK")
+}
+
+func (svc *ConfigService) GetPropertiesNotionUpdateWebhook() string {
+	return svc.get("PROPERTIES_NOTION_UPDATE_WEBHOOK")
+}
+
+func (svc *ConfigService) GetInhConfinmentsExcelUpdateWebhook() string {
+	return svc.get("INH_CONFINMENTS_EXCEL_UPDATE_WEBHOOK")
+}
+
+func (svc *ConfigService) GetInhConfinmentsNotionUpdateWebhook() string {
+	return svc.get("INH_CONFINMENTS_NOTION_UPDATE_WEBHOOK")
+}
+
+func (svc *ConfigService) GetSupportiveDocsExcelUpdateWebhook() string {
+	return svc.get("SUPPORTIVE_DOCS_EXCEL_UPDATE_WEBHOOK")
+}
+
+func (svc *ConfigService) GetSupportiveDocsNotionUpdateWebhook() string {
+	return svc.get("SUPPORTIVE_DOCS_NOTION_UPDATE_WEBHOOK")
+}
+
+func (svc *ConfigService) GetPipelineNotifyWebhook() string {
+	return svc.get("PIPELINE_NOTIFY_WEBHOOK")
+}
@@ -0,0 +1,1559 @@
+package fake
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+// DataService keeps all entities in memory. It is safe for concurrent use.
+type DataService struct {
+	*Faults
+
+	ConfigSvc config.IService
+
+	mutex       sync.Mutex
+	nextID      int64
+	properties  []data.Property
+	inhconfs    []data.InheritanceConfinment
+	docs        []data.SupportiveDoc
+	attachments []data.Attachment
+	jobs        []data.Job
+	schedules   map[data.JobType]data.Schedule
+	runs        []data.PipelineRun
+	deadLetters []data.DeadLetter
+	apiKeys     map[string]time.Time
+	adminKeys   map[string]bool
+	errors      []data.Error
+}
+
+func NewData(cfgsvc config.IService) *DataService {
+	return &DataService{
+		Faults:    NewFaults(),
+		ConfigSvc: cfgsvc,
+		schedules: map[data.JobType]data.Schedule{},
+		apiKeys:   map[string]time.Time{},
+		adminKeys: map[string]bool{},
+	}
+}
+
+var _ data.IService = (*DataService)(nil)
+
+func (svc *DataService) id() int64 {
+	svc.nextID++
+	return svc.nextID
+}
+
+// Properties returns a copy of the stored properties
+func (svc *DataService) Properties() []data.Property {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return append([]data.Property{}, svc.properties...)
+}
+
+// InheritanceConfinments returns a copy of the stored inheritance confinments
+func (svc *DataService) InheritanceConfinments() []data.InheritanceConfinment {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return append([]data.InheritanceConfinment{}, svc.inhconfs...)
+}
+
+// SupportiveDocs returns a copy of the stored supportive docs
+func (svc *DataService) SupportiveDocs() []data.SupportiveDoc {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return append([]data.SupportiveDoc{}, svc.docs...)
+}
+
+// Attachments returns a copy of the stored attachments
+func (svc *DataService) Attachments() []data.Attachment {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return append([]data.Attachment{}, svc.attachments...)
+}
+
+// Errors returns a copy of the stored errors
+func (svc *DataService) Errors() []data.Error {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return append([]data.Error{}, svc.errors...)
+}
+
+func (svc *DataService) Ping(_ context.Context) error {
+	return svc.hit("Ping")
+}
+
+func (svc *DataService) Stats() sql.DBStats {
+	return sql.DBStats{}
+}
+
+func (svc *DataService) Finalize() {
+}
+
+func (svc *DataService) CountResetRows(scope data.ResetScope) (map[string]int64, error) {
+	if err := svc.hit("CountResetRows"); err != nil {
+		return map[string]int64{}, err
+	}
+
+	if err := data.ValidateResetScope(scope); err != nil {
+		return map[string]int64{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	return svc.resetCounts(scope), nil
+}
+
+func (svc *DataService) ResetFactory(scope data.ResetScope, snapshot io.Writer) (map[string]int64, error) {
+	if err := svc.hit("ResetFactory"); err != nil {
+		return map[string]int64{}, err
+	}
+
+	if err := data.ValidateResetScope(scope); err != nil {
+		return map[string]int64{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	counts := svc.resetCounts(scope)
+	tables := map[data.ResetEntity]interface{}{}
+	for _, entity := range scope.Entities {
+		tables[entity] = svc.resetRows(entity, scope.BoardID)
+	}
+
+	err := json.NewEncoder(snapshot).Encode(map[string]interface{}{
+		"scope":  scope,
+		"tables": tables,
+	})
+	if err != nil {
+		return counts, err
+	}
+
+	keep := func(boardID string) bool {
+		return scope.BoardID != "" && boardID != scope.BoardID
+	}
+
+	// The attachments of the cards go with them
+	removed := svc.resetCards(scope)
+	svc.attachments = filter(svc.attachments, func(a data.Attachment) bool { return !removed[a.EntityType][a.CardID] })
+
+	for _, entity := range scope.Entities {
+		switch entity {
+		case data.ResetEntityProperties:
+			svc.properties = filter(svc.properties, func(p data.Property) bool { return keep(p.BoardID) })
+		case data.ResetEntityInheritanceConfinments:
+			svc.inhconfs = filter(svc.inhconfs, func(p data.InheritanceConfinment) bool { return keep(p.BoardID) })
+		case data.ResetEntitySupportiveDocs:
+			svc.docs = filter(svc.docs, func(p data.SupportiveDoc) bool { return keep(p.BoardID) })
+		case data.ResetEntityAttachments:
+			svc.attachments = nil
+		case data.ResetEntityJobs:
+			svc.jobs = nil
+		case data.ResetEntityErrors:
+			svc.errors = nil
+		case data.ResetEntityDeadLetters:
+			svc.deadLetters = nil
+		case data.ResetEntityPipelines:
+			svc.runs = nil
+		}
+	}
+
+	return counts, nil
+}
+
+// resetCounts returns the rows each table would lose, the attachments of
+// the removed cards and the steps of the removed runs included
+func (svc *DataService) resetCounts(scope data.ResetScope) map[string]int64 {
+	counts := map[string]int64{}
+	attachments := false
+	for _, entity := range scope.Entities {
+		rows := svc.resetRows(entity, scope.BoardID)
+		counts[data.ResetTable(entity)] += int64(len(rows))
+		attachments = attachments || entity == data.ResetEntityAttachments
+
+		for _, row := range rows {
+			if run, ok := row.(data.PipelineRun); ok {
+				counts["pipeline_steps"] += int64(len(run.Steps))
+			}
+		}
+	}
+
+	// Attachments in scope are already counted in full
+	if !attachments {
+		removed := svc.resetCards(scope)
+		for _, a := range svc.attachments {
+			if removed[a.EntityType][a.CardID] {
+				counts["attachments"]++
+			}
+		}
+	}
+
+	return counts
+}
+
+// resetCards returns the cards a reset removes by entity type
+func (svc *DataService) resetCards(scope data.ResetScope) map[data.EntityType]map[string]bool {
+	removed := map[data.EntityType]map[string]bool{}
+	for _, entity := range scope.Entities {
+		for _, row := range svc.resetRows(entity, scope.BoardID) {
+			entityType, cardID := resetCard(row)
+			if entityType == "" {
+				continue
+			}
+			if removed[entityType] == nil {
+				removed[entityType] = map[string]bool{}
+			}
+			removed[entityType][cardID] = true
+		}
+	}
+
+	return removed
+}
+
+// resetCard returns the entity type and card ID of a card row
+func resetCard(row interface{}) (data.EntityType, string) {
+	switch p := row.(type) {
+	case data.Property:
+		return data.EntityTypeProperties, p.CardID
+	case data.InheritanceConfinment:
+		return data.EntityTypeInheritanceConfinments, p.CardID
+	case data.SupportiveDoc:
+		return data.EntityTypeSupportiveDocs, p.CardID
+	}
+
+	return "", ""
+}
+
+// resetRows returns the rows of an entity that a reset would remove
+func (svc *DataService) resetRows(entity data.ResetEntity, boardID string) []interface{} {
+	rows := []interface{}{}
+	matches := func(b string) bool {
+		return boardID == "" || b == boardID
+	}
+
+	switch entity {
+	case data.ResetEntityProperties:
+		for _, p := range svc.properties {
+			if matches(p.BoardID) {
+				rows = append(rows, p)
+			}
+		}
+	case data.ResetEntityInheritanceConfinments:
+		for _, p := range svc.inhconfs {
+			if matches(p.BoardID) {
+				rows = append(rows, p)
+			}
+		}
+	case data.ResetEntitySupportiveDocs:
+		for _, p := range svc.docs {
+			if matches(p.BoardID) {
+				rows = append(rows, p)
+			}
+		}
+	case data.ResetEntityAttachments:
+		for _, p := range svc.attachments {
+			rows = append(rows, p)
+		}
+	case data.ResetEntityJobs:
+		for _, p := range svc.jobs {
+			rows = append(rows, p)
+		}
+	case data.ResetEntityErrors:
+		for _, p := range svc.errors {
+			rows = append(rows, p)
+		}
+	case data.ResetEntityDeadLetters:
+		for _, p := range svc.deadLetters {
+			rows = append(rows, p)
+		}
+	case data.ResetEntityPipelines:
+		for _, p := range svc.runs {
+			rows = append(rows, p)
+		}
+	}
+
+	return rows
+}
+
+func (svc *DataService) NewProperty(prop data.Property) (data.UpsertOutcome, int64, error) {
+	if err := svc.hit("NewProperty"); err != nil {
+		return "", -1, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	prop.UpdatedAt = time.Now()
+	for i, p := range svc.properties {
+		if p.BoardID == prop.BoardID && p.CardID == prop.CardID {
+			prop.ID = p.ID
+			if p.SameContent(prop) {
+				return data.UpsertUnchanged, prop.ID, nil
+			}
+
+			svc.properties[i] = prop
+			return data.UpsertUpdated, prop.ID, nil
+		}
+	}
+
+	prop.ID = svc.id()
+	svc.properties = append(svc.properties, prop)
+	return data.UpsertInserted, prop.ID, nil
+}
+
+func (svc *DataService) UpdateProperty(prop *data.Property) error {
+	if err := svc.hit("UpdateProperty"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, p := range svc.properties {
+		if p.BoardID == prop.BoardID && p.CardID == prop.CardID {
+			prop.ID = p.ID
+			prop.UpdatedAt = time.Now()
+			svc.properties[i] = *prop
+			return nil
+		}
+	}
+
+	return fmt.Errorf("card ID %s does not exist", prop.CardID)
+}
+
+func (svc *DataService) RetrieveProperties(page, pageSize int, _, _ string) ([]data.Property, error) {
+	if err := svc.hit("RetrieveProperties"); err != nil {
+		return []data.Property{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	results := append([]data.Property{}, paginate(svc.properties, page, pageSize)...)
+	for i := range results {
+		results[i].Files = svc.files(data.EntityTypeProperties, results[i].CardID)
+	}
+	return results, nil
+}
+
+func (svc *DataService) NewInheritanceConfinment(inh data.InheritanceConfinment) (data.UpsertOutcome, int64, error) {
+	if err := svc.hit("NewInheritanceConfinment"); err != nil {
+		return "", -1, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	inh.UpdatedAt = time.Now()
+	for i, p := range svc.inhconfs {
+		if p.BoardID == inh.BoardID && p.CardID == inh.CardID {
+			inh.ID = p.ID
+			if p.SameContent(inh) {
+				return data.UpsertUnchanged, inh.ID, nil
+			}
+
+			svc.inhconfs[i] = inh
+			return data.UpsertUpdated, inh.ID, nil
+		}
+	}
+
+	inh.ID = svc.id()
+	svc.inhconfs = append(svc.inhconfs, inh)
+	return data.UpsertInserted, inh.ID, nil
+}
+
+func (svc *DataService) UpdateInheritanceConfinment(inh *data.InheritanceConfinment) error {
+	if err := svc.hit("UpdateInheritanceConfinment"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, p := range svc.inhconfs {
+		if p.BoardID == inh.BoardID && p.CardID == inh.CardID {
+			inh.ID = p.ID
+			inh.UpdatedAt = time.Now()
+			svc.inhconfs[i] = *inh
+			return nil
+		}
+	}
+
+	return fmt.Errorf("card ID %s does not exist", inh.CardID)
+}
+
+func (svc *DataService) RetrieveInheritanceConfinments(page, pageSize int, _, _ string) ([]data.InheritanceConfinment, error) {
+	if err := svc.hit("RetrieveInheritanceConfinments"); err != nil {
+		return []data.InheritanceConfinment{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	results := append([]data.InheritanceConfinment{}, paginate(svc.inhconfs, page, pageSize)...)
+	for i := range results {
+		results[i].Files = svc.files(data.EntityTypeInheritanceConfinments, results[i].CardID)
+	}
+	return results, nil
+}
+
+func (svc *DataService) NewSupportiveDoc(doc data.SupportiveDoc) (data.UpsertOutcome, int64, error) {
+	if err := svc.hit("NewSupportiveDoc"); err != nil {
+		return "", -1, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	doc.UpdatedAt = time.Now()
+	for i, p := range svc.docs {
+		if p.BoardID == doc.BoardID && p.CardID == doc.CardID {
+			doc.ID = p.ID
+			if p.SameContent(doc) {
+				return data.UpsertUnchanged, doc.ID, nil
+			}
+
+			svc.docs[i] = doc
+			return data.UpsertUpdated, doc.ID, nil
+		}
+	}
+
+	doc.ID = svc.id()
+	svc.docs = append(svc.docs, doc)
+	return data.UpsertInserted, doc.ID, nil
+}
+
+func (svc *DataService) UpdateSupportiveDoc(doc *data.SupportiveDoc) error {
+	if err := svc.hit("UpdateSupportiveDoc"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, p := range svc.docs {
+		if p.BoardID == doc.BoardID && p.CardID == doc.CardID {
+			doc.ID = p.ID
+			doc.UpdatedAt = time.Now()
+			svc.docs[i] = *doc
+			return nil
+		}
+	}
+
+	return fmt.Errorf("card ID %s does not exist", doc.CardID)
+}
+
+func (svc *DataService) RetrieveSupportiveDocs(page, pageSize int, _, _ string) ([]data.SupportiveDoc, error) {
+	if err := svc.hit("RetrieveSupportiveDocs"); err != nil {
+		return []data.SupportiveDoc{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	results := append([]data.SupportiveDoc{}, paginate(svc.docs, page, pageSize)...)
+	for i := range results {
+		results[i].Files = svc.files(data.EntityTypeSupportiveDocs, results[i].CardID)
+	}
+	return results, nil
+}
+
+func (svc *DataService) NewAttachment(att data.Attachment) (int64, error) {
+	if err := svc.hit("NewAttachment"); err != nil {
+		return -1, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	if att.Status == "" {
+		att.Status = data.AttachmentStatusPending
+	}
+	att.UpdatedAt = time.Now()
+	for i, a := range svc.attachments {
+		if a.EntityType == att.EntityType && a.CardID == att.CardID && a.TrelloAttachmentID == att.TrelloAttachmentID {
+			a.TrelloURL = att.TrelloURL
+			a.Name = att.Name
+			a.MimeType = att.MimeType
+			if a.Status != data.AttachmentStatusMirrored {
+				a.StorageKey = att.StorageKey
+			}
+			a.UpdatedAt = att.UpdatedAt
+			svc.attachments[i] = a
+			return a.ID, nil
+		}
+	}
+
+	att.ID = svc.id()
+	svc.attachments = append(svc.attachments, att)
+	return att.ID, nil
+}
+
+func (svc *DataService) UpdateAttachment(att *data.Attachment) error {
+	if err := svc.hit("UpdateAttachment"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, a := range svc.attachments {
+		if a.ID == att.ID {
+			att.UpdatedAt = time.Now()
+			svc.attachments[i] = *att
+			return nil
+		}
+	}
+
+	return fmt.Errorf("attachment ID %d does not exist", att.ID)
+}
+
+func (svc *DataService) RetrievePendingAttachments(pageSize int) ([]data.Attachment, error) {
+	if err := svc.hit("RetrievePendingAttachments"); err != nil {
+		return []data.Attachment{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	pending := filter(svc.attachments, func(a data.Attachment) bool {
+		return a.Status == data.AttachmentStatusPending
+	})
+	if len(pending) > pageSize {
+		pending = pending[:pageSize]
+	}
+
+	return pending, nil
+}
+
+func (svc *DataService) RetrieveAttachmentByID(id int64) (data.Attachment, error) {
+	if err := svc.hit("RetrieveAttachmentByID"); err != nil {
+		return data.Attachment{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for _, a := range svc.attachments {
+		if a.ID == id {
+			return a, nil
+		}
+	}
+
+	return data.Attachment{}, fmt.Errorf("Attachment ID %d does not exist", id)
+}
+
+// files returns the attachments of a card. The caller must hold the mutex.
+func (svc *DataService) files(entityType data.EntityType, cardID string) []data.Attachment {
+	return filter(svc.attachments, func(a data.Attachment) bool {
+		return a.EntityType == entityType && a.CardID == cardID
+	})
+}
+
+func (svc *DataService) NewJob(job data.Job) (int64, error) {
+	if err := svc.hit("NewJob"); err != nil {
+		return -1, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	job.ID = svc.id()
+	svc.jobs = append(svc.jobs, job)
+	return job.ID, nil
+}
+
+func (svc *DataService) UpdateJob(job *data.Job) error {
+	if err := svc.hit("UpdateJob"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	// Like updatejob.sql, only the state, counters, completion and report are updated
+	for i, j := range svc.jobs {
+		if j.ID == job.ID {
+			j.State = job.State
+			j.Cards = job.Cards
+			j.Errors = job.Errors
+			j.Inserted = job.Inserted
+			j.Updated = job.Updated
+			j.Unchanged = job.Unchanged
+			j.Failed = job.Failed
+			j.CompletedAt = job.CompletedAt
+			j.Report = job.Report
+			svc.jobs[i] = j
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Job ID %d does not exist", job.ID)
+}
+
+func (svc *DataService) FinishJob(job *data.Job) error {
+	if err := svc.hit("FinishJob"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	// Like finishJob, only the worker holding the claim may write the job
+	for i, j := range svc.jobs {
+		if j.ID == job.ID && j.WorkerID == job.WorkerID && (j.State == data.JobStateRunning || j.State == data.JobStateCancelling) {
+			j.State = job.State
+			j.Cards = job.Cards
+			j.Errors = job.Errors
+			j.Inserted = job.Inserted
+			j.Updated = job.Updated
+			j.Unchanged = job.Unchanged
+			j.Failed = job.Failed
+			j.CompletedAt = job.CompletedAt
+			j.Report = job.Report
+			svc.jobs[i] = j
+			return nil
+		}
+	}
+
+	return data.ErrJobNotClaimed
+}
+
+func (svc *DataService) RetrieveJobByID(id int64) (data.Job, error) {
+	if err := svc.hit("RetrieveJobByID"); err != nil {
+		return data.Job{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for _, j := range svc.jobs {
+		if j.ID == id {
+			return j, nil
+		}
+	}
+
+	return data.Job{}, fmt.Errorf("Job ID %d does not exist", id)
+}
+
+func (svc *DataService) RetrieveJobs(filter data.JobFilter, page, pageSize int) ([]data.Job, error) {
+	if err := svc.hit("RetrieveJobs"); err != nil {
+		return []data.Job{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	// Newest first like the database implementations
+	jobs := []data.Job{}
+	for i := len(svc.jobs) - 1; i >= 0; i-- {
+		if matchesJob(svc.jobs[i], filter) {
+			jobs = append(jobs, svc.jobs[i])
+		}
+	}
+
+	return paginate(jobs, page, pageSize), nil
+}
+
+func (svc *DataService) RetrieveJobStats(filter data.JobFilter) ([]data.JobStats, error) {
+	if err := svc.hit("RetrieveJobStats"); err != nil {
+		return []data.JobStats{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	jobs := []data.Job{}
+	for _, j := range svc.jobs {
+		if matchesJob(j, filter) {
+			jobs = append(jobs, j)
+		}
+	}
+
+	return data.NewJobStats(jobs), nil
+}
+
+func matchesJob(j data.Job, filter data.JobFilter) bool {
+	switch {
+	case filter.Type != "" && j.Type != filter.Type:
+		return false
+	case filter.State != "" && j.State != filter.State:
+		return false
+	case !filter.From.IsZero() && j.StartedAt.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !j.StartedAt.Before(filter.To):
+		return false
+	}
+
+	return true
+}
+
+func (svc *DataService) IsPendingJobsByType(jobType data.JobType) (bool, error) {
+	if err := svc.hit("IsPendingJobsByType"); err != nil {
+		return false, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for _, j := range svc.jobs {
+		if j.Type == jobType && (j.State == data.JobStateQueued || j.State == data.JobStateRunning || j.State == data.JobStateCancelling) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// AdmitJob checks the limit and inserts the job under the same lock
+func (svc *DataService) AdmitJob(job data.Job, limit int) (int64, data.Job, error) {
+	if err := svc.hit("AdmitJob"); err != nil {
+		return -1, data.Job{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	active := svc.activeJobs(job.Type)
+	if len(active) >= limit {
+		return -1, active[0], data.ErrJobLimitReached
+	}
+
+	job.ID = svc.id()
+	svc.jobs = append(svc.jobs, job)
+	return job.ID, data.Job{}, nil
+}
+
+// activeJobs returns the queued or running jobs of a type, latest first.
+// The caller holds the mutex.
+func (svc *DataService) activeJobs(jobType data.JobType) []data.Job {
+	active := []data.Job{}
+	for i := len(svc.jobs) - 1; i >= 0; i-- {
+		j := svc.jobs[i]
+		if j.Type == jobType && (j.State == data.JobStateQueued || j.State == data.JobStateRunning || j.State == data.JobStateCancelling) {
+			active = append(active, j)
+		}
+	}
+
+	return active
+}
+
+func (svc *DataService) ClaimJob(jobType data.JobType, workerID string) (data.Job, bool, error) {
+	if err := svc.hit("ClaimJob"); err != nil {
+		return data.Job{}, false, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, j := range svc.jobs {
+		if j.Type == jobType && j.State == data.JobStateQueued {
+			now := time.Now()
+			svc.jobs[i].State = data.JobStateRunning
+			svc.jobs[i].WorkerID = workerID
+			svc.jobs[i].HeartbeatAt = &now
+			svc.jobs[i].Attempts++
+			return svc.jobs[i], true, nil
+		}
+	}
+
+	return data.Job{}, false, nil
+}
+
+func (svc *DataService) HeartbeatJob(id int64, workerID string) (data.JobState, error) {
+	if err := svc.hit("HeartbeatJob"); err != nil {
+		return "", err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, j := range svc.jobs {
+		if j.ID == id && j.WorkerID == workerID && (j.State == data.JobStateRunning || j.State == data.JobStateCancelling) {
+			now := time.Now()
+			svc.jobs[i].HeartbeatAt = &now
+			return j.State, nil
+		}
+	}
+
+	return "", data.ErrJobNotClaimed
+}
+
+func (svc *DataService) CancelJob(id int64, cancelledBy, reason string) (data.Job, error) {
+	if err := svc.hit("CancelJob"); err != nil {
+		return data.Job{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, j := range svc.jobs {
+		if j.ID != id {
+			continue
+		}
+
+		switch j.State {
+		case data.JobStateQueued:
+			now := time.Now()
+			j.State = data.JobStateCancelled
+			j.CompletedAt = &now
+		case data.JobStateRunning:
+			j.State = data.JobStateCancelling
+		default:
+			return j, data.ErrJobNotCancellable
+		}
+
+		j.CancelledBy = cancelledBy
+		j.CancelReason = reason
+		svc.jobs[i] = j
+		return j, nil
+	}
+
+	return data.Job{}, fmt.Errorf("Job ID %d does not exist", id)
+}
+
+func (svc *DataService) UpdateJobProgress(id int64, progress data.JobProgress) error {
+	if err := svc.hit("UpdateJobProgress"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, j := range svc.jobs {
+		if j.ID == id {
+			now := time.Now()
+			svc.jobs[i].Cards = progress.Total
+			svc.jobs[i].Processed = progress.Processed
+			svc.jobs[i].Failed = progress.Failed
+			svc.jobs[i].CurrentCard = progress.CurrentCard
+			svc.jobs[i].ProgressAt = &now
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Job ID %d does not exist", id)
+}
+
+func (svc *DataService) ReapStaleJobs(staleBefore time.Time, maxAttempts int) ([]data.Job, error) {
+	if err := svc.hit("ReapStaleJobs"); err != nil {
+		return []data.Job{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	reaped := []data.Job{}
+	for i, j := range svc.jobs {
+		if (j.State != data.JobStateRunning && j.State != data.JobStateCancelling) ||
+			(j.HeartbeatAt != nil && !j.HeartbeatAt.Before(staleBefore)) {
+			continue
+		}
+
+		now := time.Now()
+		switch {
+		case j.State == data.JobStateCancelling:
+			j.State = data.JobStateCancelled
+			j.CompletedAt = &now
+		case j.Attempts >= maxAttempts:
+			j.State = data.JobStateFailed
+			j.CompletedAt = &now
+		default:
+			j.State = data.JobStateQueued
+			j.CompletedAt = nil
+		}
+		j.WorkerID = ""
+
+		svc.jobs[i] = j
+		reaped = append(reaped, j)
+	}
+
+	return reaped, nil
+}
+
+func (svc *DataService) RetrieveSchedules() ([]data.Schedule, error) {
+	if err := svc.hit("RetrieveSchedules"); err != nil {
+		return []data.Schedule{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	schedules := []data.Schedule{}
+	for _, schedule := range svc.schedules {
+		schedules = append(schedules, schedule)
+	}
+
+	sort.Slice(schedules, func(i, j int) bool {
+		return schedules[i].NextFireAt.Before(schedules[j].NextFireAt)
+	})
+
+	return schedules, nil
+}
+
+func (svc *DataService) SaveSchedule(schedule data.Schedule) error {
+	if err := svc.hit("SaveSchedule"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	// The last fire time is kept like the upsert does
+	schedule.LastFiredAt = svc.schedules[schedule.JobType].LastFiredAt
+	schedule.UpdatedAt = time.Now()
+	svc.schedules[schedule.JobType] = schedule
+	return nil
+}
+
+func (svc *DataService) DeleteSchedule(jobType data.JobType) error {
+	if err := svc.hit("DeleteSchedule"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	delete(svc.schedules, jobType)
+	return nil
+}
+
+func (svc *DataService) AdvanceSchedule(jobType data.JobType, due, next time.Time, firedAt *time.Time) (bool, error) {
+	if err := svc.hit("AdvanceSchedule"); err != nil {
+		return false, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	schedule, ok := svc.schedules[jobType]
+	if !ok || !schedule.NextFireAt.Equal(due) {
+		return false, nil
+	}
+
+	schedule.NextFireAt = next
+	if firedAt != nil {
+		schedule.LastFiredAt = firedAt
+	}
+	schedule.UpdatedAt = time.Now()
+	svc.schedules[jobType] = schedule
+	return true, nil
+}
+
+func (svc *DataService) NewPipelineRun(run data.PipelineRun) (int64, error) {
+	if err := svc.hit("NewPipelineRun"); err != nil {
+		return -1, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i := len(svc.runs) - 1; i >= 0; i-- {
+		if svc.runs[i].Pipeline == run.Pipeline && svc.runs[i].State == data.PipelineStateRunning {
+			return svc.runs[i].ID, data.ErrPipelineRunning
+		}
+	}
+
+	run.ID = svc.id()
+	run.Steps = append([]data.PipelineStep{}, run.Steps...)
+	for i := range run.Steps {
+		run.Steps[i].RunID = run.ID
+		run.Steps[i].UpdatedAt = time.Now()
+	}
+	svc.runs = append(svc.runs, run)
+	return run.ID, nil
+}
+
+func (svc *DataService) RetrievePipelineRunByID(id int64) (data.PipelineRun, error) {
+	if err := svc.hit("RetrievePipelineRunByID"); err != nil {
+		return data.PipelineRun{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for _, run := range svc.runs {
+		if run.ID == id {
+			return copyRun(run), nil
+		}
+	}
+
+	return data.PipelineRun{}, fmt.Errorf("Pipeline run ID %d does not exist", id)
+}
+
+func (svc *DataService) RetrievePipelineRuns(filter data.PipelineRunFilter, page, pageSize int) ([]data.PipelineRun, error) {
+	if err := svc.hit("RetrievePipelineRuns"); err != nil {
+		return []data.PipelineRun{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	// Newest first like the database implementations
+	runs := []data.PipelineRun{}
+	for i := len(svc.runs) - 1; i >= 0; i-- {
+		run := svc.runs[i]
+		if (filter.Pipeline == "" || run.Pipeline == filter.Pipeline) && (filter.State == "" || run.State == filter.State) {
+			runs = append(runs, copyRun(run))
+		}
+	}
+
+	return paginate(runs, page, pageSize), nil
+}
+
+func (svc *DataService) StartPipelineStep(runID int64, jobType data.JobType, job data.Job) (int64, bool, error) {
+	if err := svc.hit("StartPipelineStep"); err != nil {
+		return -1, false, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	step := svc.step(runID, jobType)
+	if step == nil || step.State != data.StepStatePending || len(svc.activeJobs(jobType)) > 0 {
+		return -1, false, nil
+	}
+
+	job.ID = svc.id()
+	svc.jobs = append(svc.jobs, job)
+	step.State = data.StepStateRunning
+	step.JobID = &job.ID
+	step.UpdatedAt = time.Now()
+	return job.ID, true, nil
+}
+
+func (svc *DataService) UpdatePipelineStep(runID int64, jobType data.JobType, from, to data.StepState) (bool, error) {
+	if err := svc.hit("UpdatePipelineStep"); err != nil {
+		return false, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	step := svc.step(runID, jobType)
+	if step == nil || step.State != from {
+		return false, nil
+	}
+
+	step.State = to
+	step.UpdatedAt = time.Now()
+	return true, nil
+}
+
+func (svc *DataService) FinishPipelineRun(id int64, state data.PipelineState) (bool, error) {
+	if err := svc.hit("FinishPipelineRun"); err != nil {
+		return false, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, run := range svc.runs {
+		if run.ID == id && run.State == data.PipelineStateRunning {
+			now := time.Now()
+			svc.runs[i].State = state
+			svc.runs[i].CompletedAt = &now
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+func (svc *DataService) SaveDeadLetter(dl data.DeadLetter) (int64, error) {
+	if err := svc.hit("SaveDeadLetter"); err != nil {
+		return -1, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	now := time.Now()
+	for i, d := range svc.deadLetters {
+		if d.EntityType == dl.EntityType && d.CardID == dl.CardID && d.Operation == dl.Operation &&
+			d.ItemKey == dl.ItemKey && d.State == data.DeadLetterStatePending {
+			svc.deadLetters[i].JobID = dl.JobID
+			svc.deadLetters[i].Payload = dl.Payload
+			svc.deadLetters[i].Error = dl.Error
+			svc.deadLetters[i].Attempts += dl.Attempts
+			svc.deadLetters[i].UpdatedAt = now
+			return d.ID, nil
+		}
+	}
+
+	dl.ID = svc.id()
+	dl.State = data.DeadLetterStatePending
+	dl.CreatedAt = now
+	dl.UpdatedAt = now
+	dl.ResolvedAt = nil
+	svc.deadLetters = append(svc.deadLetters, dl)
+	return dl.ID, nil
+}
+
+func (svc *DataService) RetrieveDeadLetterByID(id int64) (data.DeadLetter, error) {
+	if err := svc.hit("RetrieveDeadLetterByID"); err != nil {
+		return data.DeadLetter{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for _, dl := range svc.deadLetters {
+		if dl.ID == id {
+			return dl, nil
+		}
+	}
+
+	return data.DeadLetter{}, fmt.Errorf("Dead letter ID %d does not exist", id)
+}
+
+func (svc *DataService) RetrieveDeadLetters(filter data.DeadLetterFilter, page, pageSize int) ([]data.DeadLetter, error) {
+	if err := svc.hit("RetrieveDeadLetters"); err != nil {
+		return []data.DeadLetter{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	// Oldest first like the database implementations
+	dls := []data.DeadLetter{}
+	for _, dl := range svc.deadLetters {
+		if matchesDeadLetter(dl, filter) {
+			dls = append(dls, dl)
+		}
+	}
+
+	return paginate(dls, page, pageSize), nil
+}
+
+func matchesDeadLetter(dl data.DeadLetter, filter data.DeadLetterFilter) bool {
+	switch {
+	case filter.JobID != 0 && dl.JobID != filter.JobID:
+		return false
+	case filter.EntityType != "" && dl.EntityType != filter.EntityType:
+		return false
+	case filter.CardID != "" && dl.CardID != filter.CardID:
+		return false
+	case filter.Operation != "" && dl.Operation != filter.Operation:
+		return false
+	case filter.State != "" && dl.State != filter.State:
+		return false
+	}
+
+	return true
+}
+
+func (svc *DataService) UpdateDeadLetter(dl *data.DeadLetter) error {
+	if err := svc.hit("UpdateDeadLetter"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	for i, d := range svc.deadLetters {
+		if d.ID == dl.ID {
+			dl.UpdatedAt = time.Now()
+			d.Error = dl.Error
+			d.Attempts = dl.Attempts
+			d.State = dl.State
+			d.UpdatedAt = dl.UpdatedAt
+			d.ResolvedAt = dl.ResolvedAt
+			svc.deadLetters[i] = d
+			return nil
+		}
+	}
+
+	return fmt.Errorf("Dead letter ID %d does not exist", dl.ID)
+}
+
+func (svc *DataService) ResolveDeadLetters(entityType data.EntityType, cardID string, operation data.DeadLetterOperation, itemKey string) (int64, error) {
+	if err := svc.hit("ResolveDeadLetters"); err != nil {
+		return 0, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	var resolved int64
+	for i, dl := range svc.deadLetters {
+		if dl.EntityType == entityType && dl.CardID == cardID && dl.Operation == operation &&
+			dl.ItemKey == itemKey && dl.State == data.DeadLetterStatePending {
+			now := time.Now()
+			svc.deadLetters[i].State = data.DeadLetterStateResolved
+			svc.deadLetters[i].UpdatedAt = now
+			svc.deadLetters[i].ResolvedAt = &now
+			resolved++
+		}
+	}
+
+	return resolved, nil
+}
+
+// DeadLetters returns a copy of the stored dead letters
+func (svc *DataService) DeadLetters() []data.DeadLetter {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return append([]data.DeadLetter{}, svc.deadLetters...)
+}
+
+// step finds a stored step. The caller must hold the mutex.
+func (svc *DataService) step(runID int64, jobType data.JobType) *data.PipelineStep {
+	for i := range svc.runs {
+		if svc.runs[i].ID != runID {
+			continue
+		}
+
+		for j := range svc.runs[i].Steps {
+			if svc.runs[i].Steps[j].JobType == jobType {
+				return &svc.runs[i].Steps[j]
+			}
+		}
+	}
+
+	return nil
+}
+
+func copyRun(run data.PipelineRun) data.PipelineRun {
+	run.Steps = append([]data.PipelineStep{}, run.Steps...)
+	return run
+}
+
+func (svc *DataService) RetrieveOwnerTotals() ([]data.OwnerTotal, error) {
+	if err := svc.hit("RetrieveOwnerTotals"); err != nil {
+		return []data.OwnerTotal{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	totals := map[string]*data.OwnerTotal{}
+	for _, p := range svc.properties {
+		t, ok := totals[p.Owner]
+		if !ok {
+			t = &data.OwnerTotal{Owner: p.Owner}
+			totals[p.Owner] = t
+		}
+		t.Properties++
+		t.Area += p.Area
+		t.Shares += p.Shares
+	}
+
+	result := []data.OwnerTotal{}
+	for _, t := range totals {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Area > result[j].Area })
+	return result, nil
+}
+
+func (svc *DataService) RetrieveStatusTypeCounts() ([]data.StatusTypeCount, error) {
+	if err := svc.hit("RetrieveStatusTypeCounts"); err != nil {
+		return []data.StatusTypeCount{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	counts := map[[2]string]int64{}
+	for _, p := range svc.properties {
+		counts[[2]string{p.Status, p.Type}]++
+	}
+
+	result := []data.StatusTypeCount{}
+	for k, v := range counts {
+		result = append(result, data.StatusTypeCount{Status: k[0], Type: k[1], Properties: v})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Status == result[j].Status {
+			return result[i].Type < result[j].Type
+		}
+		return result[i].Status < result[j].Status
+	})
+	return result, nil
+}
+
+func (svc *DataService) RetrieveOrganizedBreakdown() ([]data.OrganizedBreakdown, error) {
+	if err := svc.hit("RetrieveOrganizedBreakdown"); err != nil {
+		return []data.OrganizedBreakdown{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	breakdown := map[bool]*data.OrganizedBreakdown{}
+	for _, p := range svc.properties {
+		b, ok := breakdown[p.Organized]
+		if !ok {
+			b = &data.OrganizedBreakdown{Organized: p.Organized}
+			breakdown[p.Organized] = b
+		}
+		b.Properties++
+		b.Area += p.Area
+		b.Shares += p.Shares
+	}
+
+	result := []data.OrganizedBreakdown{}
+	for _, organized := range []bool{true, false} {
+		if b, ok := breakdown[organized]; ok {
+			result = append(result, *b)
+		}
+	}
+	return result, nil
+}
+
+func (svc *DataService) RetrieveEffectProperties() ([]data.Property, error) {
+	if err := svc.hit("RetrieveEffectProperties"); err != nil {
+		return []data.Property{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	result := []data.Property{}
+	for _, p := range svc.properties {
+		if p.Effects {
+			result = append(result, p)
+		}
+	}
+	return result, nil
+}
+
+func (svc *DataService) RetrieveGenerationCounts() ([]data.GenerationCount, error) {
+	if err := svc.hit("RetrieveGenerationCounts"); err != nil {
+		return []data.GenerationCount{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	counts := map[int64]int64{}
+	for _, p := range svc.inhconfs {
+		counts[p.Generation]++
+	}
+
+	result := []data.GenerationCount{}
+	for k, v := range counts {
+		result = append(result, data.GenerationCount{Generation: k, Records: v})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Generation < result[j].Generation })
+	return result, nil
+}
+
+func (svc *DataService) RetrieveCategoryCounts() ([]data.CategoryCount, error) {
+	if err := svc.hit("RetrieveCategoryCounts"); err != nil {
+		return []data.CategoryCount{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	counts := map[string]int64{}
+	for _, p := range svc.docs {
+		counts[p.Category]++
+	}
+
+	result := []data.CategoryCount{}
+	for k, v := range counts {
+		result = append(result, data.CategoryCount{Category: k, Docs: v})
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Category < result[j].Category })
+	return result, nil
+}
+
+func (svc *DataService) NewAPIKey(key string) error {
+	if err := svc.hit("NewAPIKey"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	svc.apiKeys[key] = time.Now().AddDate(1, 0, 0)
+	return nil
+}
+
+func (svc *DataService) IsAPIKeyValid(key string) (bool, error) {
+	if err := svc.hit("IsAPIKeyValid"); err != nil {
+		return false, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	expiresAt, ok := svc.apiKeys[key]
+	if !ok || expiresAt.Before(time.Now()) {
+		return false, fmt.Errorf("APP KEY %s is not valid", key)
+	}
+
+	return true, nil
+}
+
+// NewAdminAPIKey stores a key that is also allowed to call admin endpoints
+func (svc *DataService) NewAdminAPIKey(key string) error {
+	err := svc.NewAPIKey(key)
+	if err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	svc.adminKeys[key] = true
+	return nil
+}
+
+func (svc *DataService) IsAdminAPIKeyValid(key string) (bool, error) {
+	if err := svc.hit("IsAdminAPIKeyValid"); err != nil {
+		return false, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	expiresAt, ok := svc.apiKeys[key]
+	return ok && svc.adminKeys[key] && expiresAt.After(time.Now()), nil
+}
+
+func (svc *DataService) NewError(e data.Error) error {
+	if err := svc.hit("NewError"); err != nil {
+		return err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	if e.Severity == "" {
+		e.Severity = data.ErrorSeverityError
+	}
+
+	if e.Class == "" {
+		e.Class = data.ErrorClassInternal
+	}
+	e.ID = svc.id()
+	e.OccurredAt = time.Now()
+	svc.errors = append(svc.errors, e)
+	return nil
+}
+
+func (svc *DataService) RetrieveErrors(filter data.ErrorFilter, page, pageSize int) ([]data.Error, error) {
+	if err := svc.hit("RetrieveErrors"); err != nil {
+		return []data.Error{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	// Newest first like the database implementations
+	errs := []data.Error{}
+	for i := len(svc.errors) - 1; i >= 0; i-- {
+		if matchesError(svc.errors[i], filter) {
+			errs = append(errs, svc.errors[i])
+		}
+	}
+
+	return paginate(errs, page, pageSize), nil
+}
+
+func (svc *DataService) RetrieveErrorClassCounts(filter data.ErrorFilter) ([]data.ErrorClassCount, error) {
+	if err := svc.hit("RetrieveErrorClassCounts"); err != nil {
+		return []data.ErrorClassCount{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	byClass := map[data.ErrorClass]int64{}
+	for _, e := range svc.errors {
+		if matchesError(e, filter) {
+			byClass[e.Class]++
+		}
+	}
+
+	counts := []data.ErrorClassCount{}
+	for class, count := range byClass {
+		counts = append(counts, data.ErrorClassCount{Class: class, Count: count})
+	}
+
+	sort.Slice(counts, func(i, j int) bool {
+		if counts[i].Count == counts[j].Count {
+			return counts[i].Class < counts[j].Class
+		}
+		return counts[i].Count > counts[j].Count
+	})
+
+	return counts, nil
+}
+
+func (svc *DataService) PurgeErrors(before time.Time) (int64, error) {
+	if err := svc.hit("PurgeErrors"); err != nil {
+		return 0, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	kept := filter(svc.errors, func(e data.Error) bool {
+		return !e.OccurredAt.Before(before)
+	})
+	purged := int64(len(svc.errors) - len(kept))
+	svc.errors = kept
+	return purged, nil
+}
+
+func matchesError(e data.Error, filter data.ErrorFilter) bool {
+	switch {
+	case filter.JobID != 0 && (e.JobID == nil || *e.JobID != filter.JobID):
+		return false
+	case filter.CardID != "" && e.CardID != filter.CardID:
+		return false
+	case filter.EntityType != "" && e.EntityType != filter.EntityType:
+		return false
+	case filter.Severity != "" && e.Severity != filter.Severity:
+		return false
+	case filter.Class != "" && e.Class != filter.Class:
+		return false
+	case filter.Source != "" && e.Source != filter.Source:
+		return false
+	case !filter.From.IsZero() && e.OccurredAt.Before(filter.From):
+		return false
+	case !filter.To.IsZero() && !e.OccurredAt.Before(filter.To):
+		return false
+	}
+
+	return true
+}
+
+func paginate[T any](items []T, page, pageSize int) []T {
+	result := []T{}
+	if page < 1 || pageSize <= 0 {
+		return result
+	}
+
+	start := (page - 1) * pageSize
+	if start >= len(items) {
+		return result
+	}
+
+	end := start + pageSize
+	if end > len(items) {
+		end = len(items)
+	}
+
+	return append(result, items[start:end]...)
+}
+
+func filter[T any](items []T, keep func(T) bool) []T {
+	result := []T{}
+	for _, item := range items {
+		if keep(item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
@@ -0,0 +1,75 @@
+package fake
+
+import (
+	"sync"
+	"time"
+)
+
+type fault struct {
+	nth   int
+	err   error
+	delay time.Duration
+}
+
+// Faults counts calls per method and injects failures or delays into them.
+// Method names are the interface method names i.e. `NewProperty`.
+type Faults struct {
+	mutex  sync.Mutex
+	calls  map[string]int
+	faults map[string][]fault
+}
+
+func NewFaults() *Faults {
+	return &Faults{
+		calls:  map[string]int{},
+		faults: map[string][]fault{},
+	}
+}
+
+// FailNth fails the nth call (1-based) of a method with the given error
+func (f *Faults) FailNth(method string, nth int, err error) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults[method] = append(f.faults[method], fault{nth: nth, err: err})
+}
+
+// FailAlways fails every call of a method with the given error
+func (f *Faults) FailAlways(method string, err error) {
+	f.FailNth(method, 0, err)
+}
+
+// Delay slows down every call of a method by the given duration
+func (f *Faults) Delay(method string, delay time.Duration) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	f.faults[method] = append(f.faults[method], fault{delay: delay})
+}
+
+// Calls returns the number of times a method was called
+func (f *Faults) Calls(method string) int {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+	return f.calls[method]
+}
+
+// hit records a call and returns the injected error if any
+func (f *Faults) hit(method string) error {
+	f.mutex.Lock()
+	f.calls[method]++
+	call := f.calls[method]
+	faults := f.faults[method]
+	f.mutex.Unlock()
+
+	var err error
+	for _, flt := range faults {
+		if flt.delay > 0 {
+			time.Sleep(flt.delay)
+		}
+
+		if flt.err != nil && (flt.nth == 0 || flt.nth == call) && err == nil {
+			err = flt.err
+		}
+	}
+
+	return err
+}
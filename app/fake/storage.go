@@ -0,0 +1,74 @@
+package fake
+
+import (
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/storage"
+)
+
+// StorageService keeps uploaded objects in memory keyed by `folder/identifier`
+type StorageService struct {
+	*Faults
+
+	mutex   sync.Mutex
+	objects map[string][]byte
+}
+
+func NewStorage() *StorageService {
+	return &StorageService{
+		Faults:  NewFaults(),
+		objects: map[string][]byte{},
+	}
+}
+
+var _ storage.IService = (*StorageService)(nil)
+
+// Objects returns a copy of the uploaded objects
+func (svc *StorageService) Objects() map[string][]byte {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+
+	objects := map[string][]byte{}
+	for k, v := range svc.objects {
+		objects[k] = v
+	}
+	return objects
+}
+
+func (svc *StorageService) Upload(body io.Reader, size int64, folder, identifier string) (string, error) {
+	if err := svc.hit("Upload"); err != nil {
+		return "", err
+	}
+
+	content, err := io.ReadAll(body)
+	if err != nil {
+		return "", err
+	}
+	if size >= 0 && int64(len(content)) != size {
+		return "", fmt.Errorf("read %d bytes, expected %d", len(content), size)
+	}
+
+	key := fmt.Sprintf("%s/%s", folder, identifier)
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	svc.objects[key] = content
+
+	return fmt.Sprintf("mem://%s", key), nil
+}
+
+func (svc *StorageService) SignedURL(key string, ttl time.Duration) (string, error) {
+	if err := svc.hit("SignedURL"); err != nil {
+		return "", err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	if _, ok := svc.objects[key]; !ok {
+		return "", fmt.Errorf("object %s does not exist", key)
+	}
+
+	return fmt.Sprintf("mem://%s?expires=%d", key, time.Now().Add(ttl).Unix()), nil
+}
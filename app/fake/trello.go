@@ -0,0 +1,110 @@
+package fake
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/khaledhikmat/tr-extractor/service/trello"
+)
+
+// TrelloService serves cards and attachment contents from memory
+type TrelloService struct {
+	*Faults
+
+	mutex       sync.Mutex
+	properties  []trello.TRProperty
+	inhconfs    []trello.TRInheritanceConfinement
+	docs        []trello.TRSupportiveDoc
+	lists       []trello.TRList
+	attachments map[string][]byte
+}
+
+// NewTrello creates a Trello fake that serves attachment contents from memory
+func NewTrello() *TrelloService {
+	return &TrelloService{
+		Faults:      NewFaults(),
+		attachments: map[string][]byte{},
+	}
+}
+
+var _ trello.IService = (*TrelloService)(nil)
+
+func (svc *TrelloService) AddProperties(props ...trello.TRProperty) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	svc.properties = append(svc.properties, props...)
+}
+
+func (svc *TrelloService) AddInheritanceConfinments(inhs ...trello.TRInheritanceConfinement) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	svc.inhconfs = append(svc.inhconfs, inhs...)
+}
+
+func (svc *TrelloService) AddSupportiveDocs(docs ...trello.TRSupportiveDoc) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	svc.docs = append(svc.docs, docs...)
+}
+
+// AddLists adds the board lists the list filter is resolved against
+func (svc *TrelloService) AddLists(lists ...trello.TRList) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	svc.lists = append(svc.lists, lists...)
+}
+
+// AddAttachment registers the contents served for an attachment URL
+func (svc *TrelloService) AddAttachment(url string, content []byte) {
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	svc.attachments[url] = content
+}
+
+func (svc *TrelloService) RetrieveProperties(_ int, filter trello.CardFilter) ([]trello.TRProperty, error) {
+	if err := svc.hit("RetrieveProperties"); err != nil {
+		return []trello.TRProperty{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return trello.FilterCards(append([]trello.TRProperty{}, svc.properties...), filter, svc.lists)
+}
+
+func (svc *TrelloService) RetrieveInheritanceConfinments(_ int, filter trello.CardFilter) ([]trello.TRInheritanceConfinement, error) {
+	if err := svc.hit("RetrieveInheritanceConfinments"); err != nil {
+		return []trello.TRInheritanceConfinement{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return trello.FilterCards(append([]trello.TRInheritanceConfinement{}, svc.inhconfs...), filter, svc.lists)
+}
+
+func (svc *TrelloService) RetrieveSupportiveDocs(_ int, filter trello.CardFilter) ([]trello.TRSupportiveDoc, error) {
+	if err := svc.hit("RetrieveSupportiveDocs"); err != nil {
+		return []trello.TRSupportiveDoc{}, err
+	}
+
+	svc.mutex.Lock()
+	defer svc.mutex.Unlock()
+	return trello.FilterCards(append([]trello.TRSupportiveDoc{}, svc.docs...), filter, svc.lists)
+}
+
+func (svc *TrelloService) DownloadAttachment(_ context.Context, url string) (io.ReadCloser, int64, error) {
+	if err := svc.hit("DownloadAttachment"); err != nil {
+		return nil, 0, err
+	}
+
+	svc.mutex.Lock()
+	content, ok := svc.attachments[url]
+	svc.mutex.Unlock()
+	if !ok {
+		return nil, 0, fmt.Errorf("API error 404: attachment %s not found", url)
+	}
+
+	return io.NopCloser(bytes.NewReader(content)), int64(len(content)), nil
+}
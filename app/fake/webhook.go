@@ -0,0 +1,30 @@
+package fake
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+)
+
+// Webhook is an automation webhook endpoint that counts notifications
+type Webhook struct {
+	*httptest.Server
+
+	hits atomic.Int64
+}
+
+// NewWebhook starts a webhook endpoint that responds with the given status
+// code. Call Close when done.
+func NewWebhook(status int) *Webhook {
+	wh := &Webhook{}
+	wh.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		wh.hits.Add(1)
+		w.WriteHeader(status)
+	}))
+	return wh
+}
+
+// Hits returns the number of notifications received
+func (wh *Webhook) Hits() int64 {
+	return wh.hits.Load()
+}
@@ -0,0 +1,138 @@
+package job
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"mime"
+	"path"
+	"strings"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/storage"
+	"github.com/khaledhikmat/tr-extractor/service/trello"
+)
+
+// NewAttachment converts a Trello card attachment to a pending attachment.
+// The storage key is the entity type folder followed by the attachment ID,
+// a human readable postfix and the extension of the Trello URL.
+func NewAttachment(entityType data.EntityType, cardID, postfix string, tratt trello.TRAttachment) data.Attachment {
+	return data.Attachment{
+		EntityType:         entityType,
+		CardID:             cardID,
+		TrelloAttachmentID: tratt.ID,
+		TrelloURL:          tratt.URL,
+		Name:               tratt.Name,
+		MimeType:           tratt.MimeType,
+		Size:               tratt.Bytes,
+		StorageKey:         fmt.Sprintf("%s/%s-%s%s", entityType, tratt.ID, postfix, path.Ext(tratt.URL)),
+		Status:             data.AttachmentStatusPending,
+	}
+}
+
+// NormalizeString makes a name safe to use in a storage key
+func NormalizeString(input string) string {
+	lower := strings.ToLower(input)
+	normalized := strings.ReplaceAll(lower, " ", "_")
+	return normalized
+}
+
+// Mirror streams the attachment from Trello to storage under its storage
+// key. Nothing is written to disk and only one upload part is held in
+// memory. The size and checksum are computed while streaming and progress
+// is reported as bytes are sent if progress is not nil. On failure, it also
+// returns the class of the dependency that failed.
+func Mirror(ctx context.Context,
+	attachment *data.Attachment,
+	trlsvc trello.IService,
+	storagesvc storage.IService,
+	progress func(sent, total int64)) (data.ErrorClass, error) {
+	if attachment.StorageKey == "" {
+		return data.ErrorClassInternal, fmt.Errorf("attachment %d has no storage key", attachment.ID)
+	}
+
+	// Open the attachment on Trello
+	var body io.ReadCloser
+	var size int64
+	err := traceTrello(ctx, "download", true, func() error {
+		var err error
+		body, size, err = trlsvc.DownloadAttachment(ctx, attachment.TrelloURL)
+		return err
+	})
+	if err != nil {
+		return data.ErrorClassTrello, err
+	}
+	defer body.Close()
+
+	if attachment.MimeType == "" {
+		attachment.MimeType = mime.TypeByExtension(path.Ext(attachment.StorageKey))
+	}
+
+	// Pipe the download into the upload
+	folder, identifier := path.Split(attachment.StorageKey)
+	_, op := startOperation(ctx, "storage.upload", true,
+		attribute.String("storage.key", attachment.StorageKey),
+		attribute.Int64("storage.bytes", size),
+	)
+	stream := &transfer{
+		body:     body,
+		hash:     sha256.New(),
+		total:    size,
+		op:       op,
+		progress: progress,
+	}
+	cloudURL, err := storagesvc.Upload(stream, size, strings.TrimSuffix(folder, "/"), identifier)
+	if err == nil && size >= 0 && stream.sent != size {
+		err = fmt.Errorf("%w: read %d of %d bytes", io.ErrUnexpectedEOF, stream.sent, size)
+		stream.err = err
+	}
+	op.end(err)
+	if stream.err != nil {
+		// The download broke off, storage is not to blame
+		return data.ErrorClassTrello, stream.err
+	}
+	if err != nil {
+		return data.ErrorClassStorage, err
+	}
+	attachment.Size = stream.sent
+	attachment.Checksum = hex.EncodeToString(stream.hash.Sum(nil))
+	attachment.StorageURL = cloudURL
+	uploadBytesCounter.Add(ctx, stream.sent, metric.WithAttributes(jobTypeAttr(ctx)))
+
+	return "", nil
+}
+
+// transfer is the download as the upload reads it. It hashes and counts the
+// bytes on the way and keeps the download error apart from storage errors.
+type transfer struct {
+	body     io.Reader
+	hash     hash.Hash
+	sent     int64
+	total    int64
+	err      error
+	op       *operation
+	progress func(sent, total int64)
+}
+
+func (t *transfer) Read(p []byte) (int, error) {
+	n, err := t.body.Read(p)
+	if n > 0 {
+		t.hash.Write(p[:n])
+		t.sent += int64(n)
+		t.op.touch()
+		if t.progress != nil {
+			t.progress(t.sent, t.total)
+		}
+	}
+	if err != nil && err != io.EOF {
+		t.err = err
+	}
+
+	return n, err
+}
@@ -2,103 +2,81 @@ package jobattachments
 
 import (
 	"context"
-	"fmt"
 	"log/slog"
-	"strings"
 	"time"
 
-	"github.com/khaledhikmat/tr-extractor/service/config"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
 	"github.com/khaledhikmat/tr-extractor/service/data"
 	"github.com/khaledhikmat/tr-extractor/service/lgr"
-	"github.com/khaledhikmat/tr-extractor/service/storage"
-	"github.com/khaledhikmat/tr-extractor/service/trello"
 )
 
+func init() {
+	jobb.Register(jobb.Definition{
+		Type:        data.JobTypeAttachments,
+		Description: "Mirrors the pending card attachments to storage",
+		Concurrency: 1,
+		DryRun:      true,
+	}, Processor)
+}
+
 func Processor(ctx context.Context,
 	jobID int64,
-	pageSize int,
-	errorStream chan error,
-	cfgsvc config.IService,
-	datasvc data.IService,
-	trlsvc trello.IService,
-	storagesvc storage.IService) {
-
-	// Update job state to running
-	job, err := datasvc.RetrieveJobByID(jobID)
-	if err != nil {
-		errorStream <- err
-		return
-	}
-	job.State = data.JobStateRunning
-	err = datasvc.UpdateJob(&job)
+	options jobb.SyncOptions,
+	deps jobb.Deps) {
+
+	// The queue already moved the job to running when it claimed it
+	job, err := deps.Data.RetrieveJobByID(jobID)
 	if err != nil {
-		errorStream <- err
+		deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
 		return
 	}
 
+	pageSize := options.PageSizeOf(job)
 	errors := 0
-	attachments := []string{}
+	attachments := []data.Attachment{}
 	finalState := data.JobStateCompleted
+	// Mirrored attachments are reported as inserted
+	mirrored := 0
+	failed := 0
+	progress := jobb.NewProgress(jobID, deps.ErrorStream, deps.Config, deps.Data)
+	// A dry run lists the attachments it would mirror and writes nothing
+	var dryrun *jobb.DryRun
+	if job.DryRun {
+		dryrun = jobb.NewDryRun()
+	}
 
 	defer func() {
+		// Save the last progress before the final counts
+		progress.Flush()
+
+		if dryrun != nil {
+			job.Report = dryrun.Report()
+		}
+
 		// Update job state to completed
 		now := time.Now()
 		job.State = finalState
 		job.Cards = int64(len(attachments))
 		job.Errors = int64(errors)
+		job.Inserted = int64(mirrored)
+		job.Failed = int64(failed)
 		job.CompletedAt = &now
-		err = datasvc.UpdateJob(&job)
+		err = deps.Data.FinishJob(&job)
 		if err != nil {
-			errorStream <- err
+			deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
 			return
 		}
 	}()
 
-	// Retrieve property attachments from the database
-	propatts, err := datasvc.RetrievePropertyAttachments(pageSize)
+	// Retrieve the attachments that are not mirrored yet
+	attachments, err = deps.Data.RetrievePendingAttachments(pageSize)
 	if err != nil {
-		errorStream <- err
+		deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
 		return
 	}
-	attachments = append(attachments, propatts...)
-
-	// Retrieve inheritance confinment attachments from the database
-	inhatts, err := datasvc.RetrieveInheritanceConfinmentAttachments(pageSize)
-	if err != nil {
-		errorStream <- err
-		return
-	}
-	attachments = append(attachments, inhatts...)
-
-	// Retrieve supportive doc attachments from the database
-	docatts, err := datasvc.RetrieveSupportiveDocAttachments(pageSize)
-	if err != nil {
-		errorStream <- err
-		return
-	}
-	attachments = append(attachments, docatts...)
-
-	// Insert/update property attachments into the database
-	for _, attachmentURL := range attachments {
-
-		// TODO: This should not happen!!!
-		if attachmentURL == "" {
-			continue
-		}
-
-		parts := strings.SplitN(attachmentURL, "|", 3)
-		if len(parts) != 3 {
-			errorStream <- fmt.Errorf("%s. URL is not constructed properly. No '|' found in the input string", attachmentURL)
-			errors++
-			continue
-		}
-
-		// In order to add some context to URLs, I appended property name to the URL
-		// after the pipe character
-		attachmentURL = parts[0]
-		attachmentFolder := parts[1]
-		attachmentPostfix := parts[2]
+	progress.Discovered(len(attachments))
 
+	for _, attachment := range attachments {
 		// If the context is cancelled, exit the loop
 		// But execute the defer block first
 		select {
@@ -107,42 +85,52 @@ func Processor(ctx context.Context,
 			return
 		default:
 		}
+		progress.Start(attachment.Name)
 
-		// If the attachment is already uploaded, skip it
-		uploaded, err := datasvc.IsAttachmentMapped(attachmentURL)
-		if err != nil {
-			errorStream <- err
-			errors++
+		if dryrun != nil {
+			dryrun.Attachment(attachment, nil)
+			mirrored++
+			progress.Done(false)
 			continue
 		}
 
-		if uploaded {
-			continue
-		}
-
-		// Download the attachment from Trello
-		localPath, attachmentID, extension, err := trlsvc.DownloadAttachment(attachmentURL)
+		var class data.ErrorClass
+		attempts, err := jobb.Retry(ctx, deps.Config, func() error {
+			var err error
+			class, err = jobb.Mirror(ctx, &attachment, deps.Trello, deps.Storage, func(sent, total int64) {
+				progress.Transfer(attachment.Name, sent, total)
+			})
+			return err
+		})
 		if err != nil {
-			errorStream <- err
+			deps.ErrorStream <- jobb.CardError(jobID, attachment.EntityType, attachment.CardID, class, err)
 			errors++
-			continue
+			failed++
+			attachment.Status = data.AttachmentStatusFailed
+
+			// Keep the attachment so it can be replayed before the next run
+			err = jobb.SaveDeadLetter(deps.Data, jobID, attachment.EntityType, attachment.CardID, attachment.TrelloAttachmentID, data.DeadLetterOperationMirror, attachment, attempts, err)
+			if err != nil {
+				deps.ErrorStream <- jobb.CardError(jobID, attachment.EntityType, attachment.CardID, data.ErrorClassDatabase, err)
+				errors++
+			}
+		} else {
+			mirrored++
+			attachment.Status = data.AttachmentStatusMirrored
+
+			_, err = deps.Data.ResolveDeadLetters(attachment.EntityType, attachment.CardID, data.DeadLetterOperationMirror, attachment.TrelloAttachmentID)
+			if err != nil {
+				deps.ErrorStream <- jobb.CardError(jobID, attachment.EntityType, attachment.CardID, data.ErrorClassDatabase, err)
+				errors++
+			}
 		}
 
-		// Upload to Cloud Storage
-		cloudURL, err := storagesvc.Upload(localPath, attachmentFolder, fmt.Sprintf("%s-%s%s", attachmentID, attachmentPostfix, extension))
+		err = deps.Data.UpdateAttachment(&attachment)
 		if err != nil {
-			errorStream <- err
+			deps.ErrorStream <- jobb.CardError(jobID, attachment.EntityType, attachment.CardID, data.ErrorClassDatabase, err)
 			errors++
-			continue
-		}
-
-		// Map attachment to Cloud URL
-		err = datasvc.MapAttachment(attachmentURL, cloudURL)
-		if err != nil {
-			errorStream <- err
-			errors++
-			continue
 		}
+		progress.Done(attachment.Status == data.AttachmentStatusFailed)
 	}
 
 	lgr.Logger.Debug("jobattachments.Processor",
@@ -0,0 +1,262 @@
+package jobattachments
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/trello"
+)
+
+const (
+	deedURL   = "https://trello.com/1/cards/c1/attachments/a1/download/deed.pdf"
+	mapURL    = "https://trello.com/1/cards/c2/attachments/a2/download/map.png"
+	letterURL = "https://trello.com/1/cards/c3/attachments/a3/download/letter.pdf"
+)
+
+// markAttachment sets the status of the attachment of a card
+func markAttachment(datasvc *fake.DataService, cardID string, status data.AttachmentStatus) {
+	for _, att := range datasvc.Attachments() {
+		if att.CardID == cardID {
+			att.Status = status
+			_ = datasvc.UpdateAttachment(&att)
+		}
+	}
+}
+
+func TestProcessor(t *testing.T) {
+	tests := []struct {
+		name         string
+		setup        func(datasvc *fake.DataService, trsvc *fake.TrelloService, storagesvc *fake.StorageService)
+		cancel       bool
+		pageSize     int
+		wantState    data.JobState
+		wantCards    int64
+		wantErrors   int64
+		wantUploads  int
+		wantMirrored int
+		wantFailed   int
+		wantStream   int
+	}{
+		{
+			name:         "mirrors pending attachments",
+			wantState:    data.JobStateCompleted,
+			wantCards:    3,
+			wantUploads:  3,
+			wantMirrored: 3,
+		},
+		{
+			name: "skips mirrored attachments",
+			setup: func(datasvc *fake.DataService, _ *fake.TrelloService, _ *fake.StorageService) {
+				markAttachment(datasvc, "c1", data.AttachmentStatusMirrored)
+			},
+			wantState:    data.JobStateCompleted,
+			wantCards:    2,
+			wantUploads:  2,
+			wantMirrored: 3,
+		},
+		{
+			name: "leaves failed attachments to the dead letters",
+			setup: func(datasvc *fake.DataService, _ *fake.TrelloService, _ *fake.StorageService) {
+				markAttachment(datasvc, "c2", data.AttachmentStatusFailed)
+			},
+			wantState:    data.JobStateCompleted,
+			wantCards:    2,
+			wantUploads:  2,
+			wantMirrored: 2,
+			wantFailed:   1,
+		},
+		{
+			name:         "mirrors a page of attachments",
+			pageSize:     2,
+			wantState:    data.JobStateCompleted,
+			wantCards:    2,
+			wantUploads:  2,
+			wantMirrored: 2,
+		},
+		{
+			name: "marks download errors as failed",
+			setup: func(_ *fake.DataService, trsvc *fake.TrelloService, _ *fake.StorageService) {
+				trsvc.FailNth("DownloadAttachment", 1, errors.New("trello down"))
+			},
+			wantState:    data.JobStateCompleted,
+			wantCards:    3,
+			wantErrors:   1,
+			wantUploads:  2,
+			wantMirrored: 2,
+			wantFailed:   1,
+			wantStream:   1,
+		},
+		{
+			name: "marks upload errors as failed",
+			setup: func(_ *fake.DataService, _ *fake.TrelloService, storagesvc *fake.StorageService) {
+				storagesvc.FailAlways("Upload", errors.New("bucket missing"))
+			},
+			wantState:  data.JobStateCompleted,
+			wantCards:  3,
+			wantErrors: 3,
+			wantFailed: 3,
+			wantStream: 3,
+		},
+		{
+			name: "stops when attachments cannot be listed",
+			setup: func(datasvc *fake.DataService, _ *fake.TrelloService, _ *fake.StorageService) {
+				datasvc.FailAlways("RetrievePendingAttachments", errors.New("db down"))
+			},
+			wantState:  data.JobStateCompleted,
+			wantStream: 1,
+		},
+		{
+			name:      "stops when cancelled",
+			cancel:    true,
+			wantState: data.JobStateCancelled,
+			wantCards: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgsvc := fake.NewConfig(nil)
+			datasvc := fake.NewData(cfgsvc)
+			trsvc := fake.NewTrello()
+			storagesvc := fake.NewStorage()
+
+			_, _ = datasvc.NewAttachment(jobb.NewAttachment(data.EntityTypeProperties, "c1", "old_town_lot_7", trello.TRAttachment{ID: "a1", Name: "deed.pdf", URL: deedURL}))
+			_, _ = datasvc.NewAttachment(jobb.NewAttachment(data.EntityTypeInheritanceConfinments, "c2", "2_heirs", trello.TRAttachment{ID: "a2", Name: "map.png", URL: mapURL}))
+			_, _ = datasvc.NewAttachment(jobb.NewAttachment(data.EntityTypeSupportiveDocs, "c3", "court_letter", trello.TRAttachment{ID: "a3", Name: "letter.pdf", URL: letterURL}))
+			trsvc.AddAttachment(deedURL, []byte("deed"))
+			trsvc.AddAttachment(mapURL, []byte("map"))
+			trsvc.AddAttachment(letterURL, []byte("letter"))
+
+			if tt.setup != nil {
+				tt.setup(datasvc, trsvc, storagesvc)
+			}
+
+			jobID, err := datasvc.NewJob(data.Job{
+				Type:      data.JobTypeAttachments,
+				State:     data.JobStateRunning,
+				StartedAt: time.Now(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			pageSize := tt.pageSize
+			if pageSize == 0 {
+				pageSize = 50
+			}
+
+			errorStream := make(chan error, 10)
+			Processor(ctx, jobID, jobb.SyncOptions{PageSize: pageSize}, jobb.Deps{ErrorStream: errorStream, Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: storagesvc})
+			close(errorStream)
+
+			job, err := datasvc.RetrieveJobByID(jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if job.State != tt.wantState {
+				t.Errorf("state = %s, want %s", job.State, tt.wantState)
+			}
+
+			if job.Cards != tt.wantCards {
+				t.Errorf("cards = %d, want %d", job.Cards, tt.wantCards)
+			}
+
+			if job.Errors != tt.wantErrors {
+				t.Errorf("errors = %d, want %d", job.Errors, tt.wantErrors)
+			}
+
+			if uploads := len(storagesvc.Objects()); uploads != tt.wantUploads {
+				t.Errorf("uploads = %d, want %d", uploads, tt.wantUploads)
+			}
+
+			mirrored, failed := 0, 0
+			for _, att := range datasvc.Attachments() {
+				switch att.Status {
+				case data.AttachmentStatusMirrored:
+					mirrored++
+				case data.AttachmentStatusFailed:
+					failed++
+				}
+			}
+
+			if mirrored != tt.wantMirrored {
+				t.Errorf("mirrored = %d, want %d", mirrored, tt.wantMirrored)
+			}
+
+			if failed != tt.wantFailed {
+				t.Errorf("failed = %d, want %d", failed, tt.wantFailed)
+			}
+
+			if streamed := len(errorStream); streamed != tt.wantStream {
+				t.Errorf("streamed errors = %d, want %d", streamed, tt.wantStream)
+			}
+		})
+	}
+}
+
+func TestProcessorRecordsChecksumAndKey(t *testing.T) {
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+	trsvc := fake.NewTrello()
+	storagesvc := fake.NewStorage()
+
+	_, _ = datasvc.NewAttachment(jobb.NewAttachment(data.EntityTypeProperties, "c1", "old_town_lot_7", trello.TRAttachment{ID: "a1", Name: "deed.pdf", URL: deedURL}))
+	trsvc.AddAttachment(deedURL, []byte("deed"))
+
+	jobID, _ := datasvc.NewJob(data.Job{Type: data.JobTypeAttachments, State: data.JobStateRunning, StartedAt: time.Now()})
+	errorStream := make(chan error, 10)
+	Processor(context.Background(), jobID, jobb.SyncOptions{PageSize: 50}, jobb.Deps{ErrorStream: errorStream, Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: storagesvc})
+
+	att := datasvc.Attachments()[0]
+	if att.StorageKey != "properties/a1-old_town_lot_7.pdf" || att.StorageURL != "mem://properties/a1-old_town_lot_7.pdf" {
+		t.Errorf("unexpected storage key %s and URL %s", att.StorageKey, att.StorageURL)
+	}
+
+	// sha256 of "deed"
+	if att.Size != 4 || att.Checksum != "df75f3ea1d63370ba642bde84f53668817f063ac887beb86b8593d78cf5642b9" {
+		t.Errorf("unexpected size %d and checksum %s", att.Size, att.Checksum)
+	}
+
+	if att.MimeType != "application/pdf" {
+		t.Errorf("mime type = %s, want application/pdf", att.MimeType)
+	}
+}
+
+func TestProcessorDryRun(t *testing.T) {
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+	trsvc := fake.NewTrello()
+	storagesvc := fake.NewStorage()
+
+	_, _ = datasvc.NewAttachment(jobb.NewAttachment(data.EntityTypeProperties, "c1", "old_town_lot_7", trello.TRAttachment{ID: "a1", Name: "deed.pdf", URL: deedURL}))
+	trsvc.AddAttachment(deedURL, []byte("deed"))
+
+	jobID, _ := datasvc.NewJob(data.Job{Type: data.JobTypeAttachments, State: data.JobStateRunning, StartedAt: time.Now(), DryRun: true})
+	Processor(context.Background(), jobID, jobb.SyncOptions{PageSize: 50}, jobb.Deps{ErrorStream: make(chan error, 10), Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: storagesvc})
+
+	job, _ := datasvc.RetrieveJobByID(jobID)
+	if job.Report == nil || len(job.Report.Uploads) != 1 || job.Report.Uploads[0].StorageKey != "properties/a1-old_town_lot_7.pdf" {
+		t.Fatalf("unexpected report %+v", job.Report)
+	}
+
+	if job.Inserted != 1 {
+		t.Errorf("inserted = %d, want 1", job.Inserted)
+	}
+
+	// Nothing was downloaded, uploaded or updated
+	if trsvc.Calls("DownloadAttachment") != 0 || len(storagesvc.Objects()) != 0 || datasvc.Attachments()[0].Status != data.AttachmentStatusPending {
+		t.Error("expected the dry run to write nothing")
+	}
+}
@@ -0,0 +1,128 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/storage"
+	"github.com/khaledhikmat/tr-extractor/service/trello"
+)
+
+// ErrDeadLetterResolved is returned when replaying a dead letter that is no longer pending
+var ErrDeadLetterResolved = errors.New("dead letter is already resolved")
+
+// SaveDeadLetter records a card operation that still failed after its
+// retries. The payload is what a replay needs to run the operation again.
+func SaveDeadLetter(datasvc data.IService,
+	jobID int64,
+	entityType data.EntityType,
+	cardID, itemKey string,
+	operation data.DeadLetterOperation,
+	payload interface{},
+	attempts int,
+	cause error) error {
+	b, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	_, err = datasvc.SaveDeadLetter(data.DeadLetter{
+		JobID:      jobID,
+		EntityType: entityType,
+		CardID:     cardID,
+		ItemKey:    itemKey,
+		Operation:  operation,
+		Payload:    string(b),
+		Error:      cause.Error(),
+		Attempts:   attempts,
+	})
+	return err
+}
+
+// Replay runs the operation of a pending dead letter again with the
+// configured retries. The dead letter is resolved on success. Otherwise
+// its attempts and error are updated and the error is returned.
+func Replay(ctx context.Context,
+	dl *data.DeadLetter,
+	cfgsvc config.IService,
+	datasvc data.IService,
+	trsvc trello.IService,
+	storagesvc storage.IService) error {
+	if dl.State != data.DeadLetterStatePending {
+		return ErrDeadLetterResolved
+	}
+
+	fn, err := replayer(ctx, dl, datasvc, trsvc, storagesvc)
+	if err != nil {
+		return err
+	}
+
+	attempts, err := Retry(ctx, cfgsvc, fn)
+	dl.Attempts += attempts
+	if err != nil {
+		dl.Error = err.Error()
+		uerr := datasvc.UpdateDeadLetter(dl)
+		if uerr != nil {
+			return uerr
+		}
+		return err
+	}
+
+	now := time.Now()
+	dl.State = data.DeadLetterStateResolved
+	dl.ResolvedAt = &now
+	return datasvc.UpdateDeadLetter(dl)
+}
+
+// replayer decodes the payload once and returns the operation to retry
+func replayer(ctx context.Context,
+	dl *data.DeadLetter,
+	datasvc data.IService,
+	trsvc trello.IService,
+	storagesvc storage.IService) (func() error, error) {
+	switch {
+	case dl.Operation == data.DeadLetterOperationUpsert && dl.EntityType == data.EntityTypeProperties:
+		var prop data.Property
+		err := json.Unmarshal([]byte(dl.Payload), &prop)
+		return func() error {
+			_, _, err := datasvc.NewProperty(prop)
+			return err
+		}, err
+
+	case dl.Operation == data.DeadLetterOperationUpsert && dl.EntityType == data.EntityTypeInheritanceConfinments:
+		var inh data.InheritanceConfinment
+		err := json.Unmarshal([]byte(dl.Payload), &inh)
+		return func() error {
+			_, _, err := datasvc.NewInheritanceConfinment(inh)
+			return err
+		}, err
+
+	case dl.Operation == data.DeadLetterOperationUpsert && dl.EntityType == data.EntityTypeSupportiveDocs:
+		var doc data.SupportiveDoc
+		err := json.Unmarshal([]byte(dl.Payload), &doc)
+		return func() error {
+			_, _, err := datasvc.NewSupportiveDoc(doc)
+			return err
+		}, err
+
+	case dl.Operation == data.DeadLetterOperationMirror:
+		var attachment data.Attachment
+		err := json.Unmarshal([]byte(dl.Payload), &attachment)
+		return func() error {
+			_, err := Mirror(ctx, &attachment, trsvc, storagesvc, nil)
+			if err != nil {
+				return err
+			}
+
+			attachment.Status = data.AttachmentStatusMirrored
+			return datasvc.UpdateAttachment(&attachment)
+		}, err
+	}
+
+	return nil, fmt.Errorf("dead letter %d has an unknown %s operation on %s", dl.ID, dl.Operation, dl.EntityType)
+}
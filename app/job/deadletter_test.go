@@ -0,0 +1,142 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestRetry(t *testing.T) {
+	tests := []struct {
+		name         string
+		failures     int
+		wantAttempts int
+		wantErr      bool
+	}{
+		{name: "succeeds at once", wantAttempts: 1},
+		{name: "recovers after failures", failures: 2, wantAttempts: 3},
+		{name: "gives up", failures: 5, wantAttempts: 3, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgsvc := fake.NewConfig(map[string]string{
+				"CARD_RETRY_ATTEMPTS": "3",
+			})
+
+			calls := 0
+			attempts, err := Retry(context.Background(), cfgsvc, func() error {
+				calls++
+				if calls <= tt.failures {
+					return errors.New("db down")
+				}
+				return nil
+			})
+
+			if attempts != tt.wantAttempts || calls != tt.wantAttempts {
+				t.Fatalf("expected %d attempts, got %d in %d calls", tt.wantAttempts, attempts, calls)
+			}
+
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
+
+func TestRetryStopsWhenCancelled(t *testing.T) {
+	cfgsvc := fake.NewConfig(map[string]string{
+		"CARD_RETRY_ATTEMPTS": "3",
+		"CARD_RETRY_BACKOFF":  "1h",
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+
+	attempts, err := Retry(ctx, cfgsvc, func() error {
+		return errors.New("db down")
+	})
+	if attempts != 1 || err == nil {
+		t.Fatalf("expected a single failed attempt, got %d and %v", attempts, err)
+	}
+}
+
+func TestReplay(t *testing.T) {
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+	trsvc := fake.NewTrello()
+	storagesvc := fake.NewStorage()
+
+	err := SaveDeadLetter(datasvc, 1, data.EntityTypeProperties, "card", "", data.DeadLetterOperationUpsert,
+		data.Property{CardID: "card", Name: "Lot 1"}, 3, errors.New("db down"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := "https://trello.com/1/cards/card/attachments/att/download/deed.pdf"
+	trsvc.AddAttachment(url, []byte("deed"))
+	attachment := data.Attachment{
+		EntityType:         data.EntityTypeProperties,
+		CardID:             "card",
+		TrelloAttachmentID: "att",
+		TrelloURL:          url,
+		StorageKey:         "properties/att-lot_1.pdf",
+		Status:             data.AttachmentStatusPending,
+	}
+	attachment.ID, _ = datasvc.NewAttachment(attachment)
+	err = SaveDeadLetter(datasvc, 1, data.EntityTypeProperties, "card", "att", data.DeadLetterOperationMirror,
+		attachment, 3, errors.New("storage down"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dls, _ := datasvc.RetrieveDeadLetters(data.DeadLetterFilter{}, 1, 10)
+	if len(dls) != 2 {
+		t.Fatalf("expected 2 dead letters, got %+v", dls)
+	}
+
+	// A replay that fails again keeps the dead letter pending
+	storagesvc.FailNth("Upload", 1, errors.New("storage still down"))
+	mirror := dls[1]
+	err = Replay(context.Background(), &mirror, cfgsvc, datasvc, trsvc, storagesvc)
+	if err == nil {
+		t.Fatal("expected the replay to fail")
+	}
+
+	saved, _ := datasvc.RetrieveDeadLetterByID(mirror.ID)
+	if saved.State != data.DeadLetterStatePending || saved.Attempts != 4 || saved.Error != "storage still down" {
+		t.Fatalf("unexpected dead letter %+v", saved)
+	}
+
+	for i := range dls {
+		if err := Replay(context.Background(), &dls[i], cfgsvc, datasvc, trsvc, storagesvc); err != nil {
+			t.Fatal(err)
+		}
+
+		saved, _ := datasvc.RetrieveDeadLetterByID(dls[i].ID)
+		if saved.State != data.DeadLetterStateResolved || saved.ResolvedAt == nil {
+			t.Fatalf("expected dead letter %d to be resolved, got %+v", dls[i].ID, saved)
+		}
+	}
+
+	if props := datasvc.Properties(); len(props) != 1 || props[0].Name != "Lot 1" {
+		t.Fatalf("expected the property to be upserted, got %+v", props)
+	}
+
+	if atts := datasvc.Attachments(); len(atts) != 1 || atts[0].Status != data.AttachmentStatusMirrored || atts[0].Checksum == "" {
+		t.Fatalf("expected the attachment to be mirrored, got %+v", atts)
+	}
+
+	if content := storagesvc.Objects()["properties/att-lot_1.pdf"]; string(content) != "deed" {
+		t.Fatalf("expected the attachment to be mirrored, got %q", content)
+	}
+
+	// Resolved dead letters are not replayed again
+	err = Replay(context.Background(), &dls[0], cfgsvc, datasvc, trsvc, storagesvc)
+	if !errors.Is(err, ErrDeadLetterResolved) {
+		t.Fatalf("expected the dead letter to be resolved, got %v", err)
+	}
+}
@@ -0,0 +1,142 @@
+package jobdeadletters
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"time"
+
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+const (
+	// defaultLimit is the number of dead letters replayed when the options do not say
+	defaultLimit = 50
+)
+
+func init() {
+	jobb.Register(jobb.Definition{
+		Type:        data.JobTypeDeadLetters,
+		Description: "Replays the pending dead letters, oldest first",
+		Concurrency: 1,
+		MaxDuration: time.Hour,
+	}, Processor)
+}
+
+// Processor replays the pending dead letters that match the options. A
+// dead letter that fails again stays pending with its attempts updated.
+func Processor(ctx context.Context,
+	jobID int64,
+	options jobb.DeadLetterOptions,
+	deps jobb.Deps) {
+
+	// The queue already moved the job to running when it claimed it
+	job, err := deps.Data.RetrieveJobByID(jobID)
+	if err != nil {
+		deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
+		return
+	}
+
+	limit := options.Limit
+	if limit <= 0 {
+		limit = defaultLimit
+	}
+
+	errors := 0
+	dls := []data.DeadLetter{}
+	finalState := data.JobStateCompleted
+	// Resolved dead letters are reported as updated
+	resolved := 0
+	failed := 0
+	progress := jobb.NewProgress(jobID, deps.ErrorStream, deps.Config, deps.Data)
+
+	defer func() {
+		// Save the last progress before the final counts
+		progress.Flush()
+
+		now := time.Now()
+		job.State = finalState
+		job.Cards = int64(len(dls))
+		job.Errors = int64(errors)
+		job.Updated = int64(resolved)
+		job.Failed = int64(failed)
+		job.CompletedAt = &now
+		err = deps.Data.FinishJob(&job)
+		if err != nil {
+			deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
+			return
+		}
+	}()
+
+	dls, err = pendingDeadLetters(deps.Data, options, limit)
+	if err != nil {
+		deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
+		finalState = data.JobStateFailed
+		return
+	}
+	progress.Discovered(len(dls))
+
+	for i := range dls {
+		// If the context is cancelled, exit the loop. What was replayed stays replayed.
+		select {
+		case <-ctx.Done():
+			finalState = data.JobStateCancelled
+			return
+		default:
+		}
+		progress.Start(fmt.Sprintf("dead letter %d", dls[i].ID))
+
+		err = jobb.Replay(ctx, &dls[i], deps.Config, deps.Data, deps.Trello, deps.Storage)
+		if err != nil {
+			deps.ErrorStream <- jobb.CardError(jobID, dls[i].EntityType, dls[i].CardID, classOf(dls[i]), err)
+			errors++
+			failed++
+			progress.Done(true)
+			continue
+		}
+
+		resolved++
+		progress.Done(false)
+	}
+
+	lgr.Logger.Debug("jobdeadletters.Processor",
+		slog.String("event", "done"),
+		slog.Int("resolved", resolved),
+		slog.Int("failed", failed),
+	)
+}
+
+// pendingDeadLetters returns the pending dead letters the options select.
+// A single dead letter that is no longer pending selects nothing.
+func pendingDeadLetters(datasvc data.IService, options jobb.DeadLetterOptions, limit int) ([]data.DeadLetter, error) {
+	if options.ID == 0 {
+		return datasvc.RetrieveDeadLetters(data.DeadLetterFilter{
+			JobID:      options.JobID,
+			EntityType: options.EntityType,
+			Operation:  options.Operation,
+			State:      data.DeadLetterStatePending,
+		}, 1, limit)
+	}
+
+	dl, err := datasvc.RetrieveDeadLetterByID(options.ID)
+	if err != nil {
+		return []data.DeadLetter{}, err
+	}
+
+	if dl.State != data.DeadLetterStatePending {
+		return []data.DeadLetter{}, nil
+	}
+
+	return []data.DeadLetter{dl}, nil
+}
+
+// classOf tells which dependency a replayed operation failed on
+func classOf(dl data.DeadLetter) data.ErrorClass {
+	if dl.Operation == data.DeadLetterOperationMirror {
+		return data.ErrorClassStorage
+	}
+
+	return data.ErrorClassDatabase
+}
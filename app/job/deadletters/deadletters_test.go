@@ -0,0 +1,154 @@
+package jobdeadletters
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := []struct {
+		name         string
+		options      jobb.DeadLetterOptions
+		setup        func(datasvc *fake.DataService)
+		cancelled    bool
+		wantState    data.JobState
+		wantCards    int64
+		wantResolved int64
+		wantFailed   int64
+		wantPending  int
+	}{
+		{
+			name:         "replays the pending dead letters",
+			wantState:    data.JobStateCompleted,
+			wantCards:    3,
+			wantResolved: 3,
+		},
+		{
+			name:         "filters by entity type",
+			options:      jobb.DeadLetterOptions{EntityType: data.EntityTypeSupportiveDocs},
+			wantState:    data.JobStateCompleted,
+			wantCards:    1,
+			wantResolved: 1,
+			wantPending:  2,
+		},
+		{
+			name:         "replays up to the limit",
+			options:      jobb.DeadLetterOptions{Limit: 2},
+			wantState:    data.JobStateCompleted,
+			wantCards:    2,
+			wantResolved: 2,
+			wantPending:  1,
+		},
+		{
+			name:         "replays a single dead letter",
+			options:      jobb.DeadLetterOptions{ID: 2},
+			wantState:    data.JobStateCompleted,
+			wantCards:    1,
+			wantResolved: 1,
+			wantPending:  2,
+		},
+		{
+			name: "skips a dead letter that is no longer pending",
+			setup: func(datasvc *fake.DataService) {
+				dl, _ := datasvc.RetrieveDeadLetterByID(2)
+				dl.State = data.DeadLetterStateResolved
+				_ = datasvc.UpdateDeadLetter(&dl)
+			},
+			options:     jobb.DeadLetterOptions{ID: 2},
+			wantState:   data.JobStateCompleted,
+			wantPending: 2,
+		},
+		{
+			name: "keeps the dead letters that fail again",
+			setup: func(datasvc *fake.DataService) {
+				datasvc.FailAlways("NewProperty", errors.New("db down"))
+			},
+			wantState:    data.JobStateCompleted,
+			wantCards:    3,
+			wantResolved: 1,
+			wantFailed:   2,
+			wantPending:  2,
+		},
+		{
+			name:        "stops when cancelled",
+			cancelled:   true,
+			wantState:   data.JobStateCancelled,
+			wantCards:   3,
+			wantPending: 3,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgsvc := fake.NewConfig(map[string]string{
+				"CARD_RETRY_ATTEMPTS": "1",
+			})
+			datasvc := fake.NewData(cfgsvc)
+
+			for _, card := range []string{"a", "b"} {
+				err := jobb.SaveDeadLetter(datasvc, 1, data.EntityTypeProperties, card, "", data.DeadLetterOperationUpsert,
+					data.Property{CardID: card, Name: "Lot " + card}, 3, errors.New("db down"))
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			err := jobb.SaveDeadLetter(datasvc, 1, data.EntityTypeSupportiveDocs, "c", "", data.DeadLetterOperationUpsert,
+				data.SupportiveDoc{CardID: "c", Title: "Deed"}, 3, errors.New("db down"))
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if tt.setup != nil {
+				tt.setup(datasvc)
+			}
+
+			jobID, err := datasvc.NewJob(data.Job{
+				Type:      data.JobTypeDeadLetters,
+				State:     data.JobStateRunning,
+				StartedAt: time.Now(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancelled {
+				cancel()
+			}
+
+			errorStream := make(chan error, 10)
+			Processor(ctx, jobID, tt.options, jobb.Deps{ErrorStream: errorStream, Config: cfgsvc, Data: datasvc, Trello: fake.NewTrello(), Storage: fake.NewStorage()})
+			close(errorStream)
+
+			job, err := datasvc.RetrieveJobByID(jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if job.State != tt.wantState || job.Cards != tt.wantCards || job.Updated != tt.wantResolved || job.Failed != tt.wantFailed {
+				t.Errorf("job = %+v, want %s with %d cards, %d resolved and %d failed", job, tt.wantState, tt.wantCards, tt.wantResolved, tt.wantFailed)
+			}
+
+			if job.Errors != tt.wantFailed || int64(len(errorStream)) != tt.wantFailed {
+				t.Errorf("errors = %d, streamed = %d, want %d", job.Errors, len(errorStream), tt.wantFailed)
+			}
+
+			pending := 0
+			for _, dl := range datasvc.DeadLetters() {
+				if dl.State == data.DeadLetterStatePending {
+					pending++
+				}
+			}
+			if pending != tt.wantPending {
+				t.Errorf("pending dead letters = %d, want %d", pending, tt.wantPending)
+			}
+		})
+	}
+}
@@ -0,0 +1,130 @@
+package job
+
+import (
+	"sort"
+
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+const (
+	// dryRunPageSize is the page size used to load the stored cards
+	dryRunPageSize = 100
+)
+
+// DryRun collects what a sync job would do without writing anything.
+// It is not safe for concurrent use.
+type DryRun struct {
+	report   data.DryRunReport
+	stored   map[string]string
+	seen     map[string]bool
+	complete bool
+}
+
+func NewDryRun() *DryRun {
+	return &DryRun{
+		report: data.DryRunReport{
+			Inserts:   []data.CardChange{},
+			Updates:   []data.CardChange{},
+			Archivals: []data.CardChange{},
+			Uploads:   []data.AttachmentUpload{},
+		},
+		stored: map[string]string{},
+		seen:   map[string]bool{},
+	}
+}
+
+// RetrieveAll pages through a retrieve function until a page comes back short
+func RetrieveAll[T any](retrieve func(page, pageSize int) ([]T, error)) ([]T, error) {
+	all := []T{}
+	for page := 1; ; page++ {
+		items, err := retrieve(page, dryRunPageSize)
+		if err != nil {
+			return all, err
+		}
+
+		all = append(all, items...)
+		if len(items) < dryRunPageSize {
+			return all, nil
+		}
+	}
+}
+
+// Stored registers a stored card. It is reported as an archival unless
+// the sync sees it.
+func (d *DryRun) Stored(cardID, name string) {
+	d.stored[cardID] = name
+}
+
+// Card records what the upsert of a card would do. The diffs of a card
+// that is not stored yet are ignored.
+func (d *DryRun) Card(cardID, name string, isStored bool, diffs []data.FieldDiff) data.UpsertOutcome {
+	d.seen[cardID] = true
+
+	change := data.CardChange{
+		CardID: cardID,
+		Name:   name,
+	}
+
+	switch {
+	case !isStored:
+		d.report.Inserts = append(d.report.Inserts, change)
+		return data.UpsertInserted
+	case len(diffs) > 0:
+		change.Fields = diffs
+		d.report.Updates = append(d.report.Updates, change)
+		return data.UpsertUpdated
+	}
+
+	return data.UpsertUnchanged
+}
+
+// Attachment records an attachment that would be mirrored unless one of
+// the stored files of its card already mirrored it
+func (d *DryRun) Attachment(attachment data.Attachment, files []data.Attachment) {
+	for _, file := range files {
+		if file.TrelloAttachmentID == attachment.TrelloAttachmentID && file.Status == data.AttachmentStatusMirrored {
+			return
+		}
+	}
+
+	d.report.Uploads = append(d.report.Uploads, data.AttachmentUpload{
+		EntityType:         attachment.EntityType,
+		CardID:             attachment.CardID,
+		TrelloAttachmentID: attachment.TrelloAttachmentID,
+		Name:               attachment.Name,
+		StorageKey:         attachment.StorageKey,
+	})
+}
+
+// Complete tells that every card was seen, so the stored cards that were
+// not are archivals
+func (d *DryRun) Complete() {
+	d.complete = true
+}
+
+// Report returns what the dry run found so far
+func (d *DryRun) Report() *data.DryRunReport {
+	report := d.report
+	report.Archivals = []data.CardChange{}
+	if !d.complete {
+		return &report
+	}
+
+	for cardID, name := range d.stored {
+		if d.seen[cardID] {
+			continue
+		}
+
+		report.Archivals = append(report.Archivals, data.CardChange{
+			CardID: cardID,
+			Name:   name,
+		})
+	}
+
+	// Map order is random, keep the report stable
+	sort.Slice(report.Archivals, func(i, j int) bool {
+		return report.Archivals[i].CardID < report.Archivals[j].CardID
+	})
+
+	return &report
+}
@@ -0,0 +1,77 @@
+package job
+
+import (
+	"errors"
+
+	"github.com/mdobak/go-xerrors"
+
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+// Error links a processing error to the job and, if any, the card it
+// happened on. Processors send it on the error stream so the error record
+// can be stored with its linkage.
+type Error struct {
+	JobID      int64
+	CardID     string
+	EntityType data.EntityType
+	Class      data.ErrorClass
+	Severity   data.ErrorSeverity
+	Err        error
+}
+
+func (e *Error) Error() string {
+	return e.Err.Error()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+// JobError wraps an error that affects the whole job
+func JobError(jobID int64, class data.ErrorClass, severity data.ErrorSeverity, err error) error {
+	return &Error{
+		JobID:    jobID,
+		Class:    class,
+		Severity: severity,
+		Err:      xerrors.WithStackTrace(err, 1),
+	}
+}
+
+// CardError wraps an error that affects a single card of the job
+func CardError(jobID int64, entityType data.EntityType, cardID string, class data.ErrorClass, err error) error {
+	return &Error{
+		JobID:      jobID,
+		CardID:     cardID,
+		EntityType: entityType,
+		Class:      class,
+		Severity:   data.ErrorSeverityError,
+		Err:        xerrors.WithStackTrace(err, 1),
+	}
+}
+
+// ErrorRecord converts an error received on the error stream to an error
+// record. Job errors keep their linkage; other errors are attributed to source.
+func ErrorRecord(source string, err error) data.Error {
+	record := data.Error{
+		Source:   source,
+		Body:     err.Error(),
+		Severity: data.ErrorSeverityError,
+		Class:    data.ErrorClassInternal,
+		Stack:    lgr.Stack(err),
+	}
+
+	var jobErr *Error
+	if errors.As(err, &jobErr) {
+		jobID := jobErr.JobID
+		record.Source = "job"
+		record.JobID = &jobID
+		record.CardID = jobErr.CardID
+		record.EntityType = jobErr.EntityType
+		record.Class = jobErr.Class
+		record.Severity = jobErr.Severity
+	}
+
+	return record
+}
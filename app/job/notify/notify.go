@@ -0,0 +1,62 @@
+package jobnotify
+
+import (
+	"context"
+	"log/slog"
+	"time"
+
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+func init() {
+	jobb.Register(jobb.Definition{
+		Type:        data.JobTypeNotify,
+		Description: "Posts to the pipeline notification webhook",
+		Concurrency: 1,
+		MaxDuration: 5 * time.Minute,
+	}, Processor)
+}
+
+// Processor posts to the pipeline notification webhook. It runs as the
+// last step of a pipeline to tell the automation that the syncs are done.
+func Processor(ctx context.Context,
+	jobID int64,
+	_ jobb.NoOptions,
+	deps jobb.Deps) {
+
+	// The queue already moved the job to running when it claimed it
+	job, err := deps.Data.RetrieveJobByID(jobID)
+	if err != nil {
+		deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
+		return
+	}
+
+	errors := 0
+	finalState := data.JobStateCompleted
+
+	defer func() {
+		now := time.Now()
+		job.State = finalState
+		job.Errors = int64(errors)
+		job.CompletedAt = &now
+		err = deps.Data.FinishJob(&job)
+		if err != nil {
+			deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
+			return
+		}
+	}()
+
+	lgr.Logger.Debug("jobnotify.Processor",
+		slog.String("webhookUrl", deps.Config.GetPipelineNotifyWebhook()),
+	)
+
+	// A notification that did not go out fails the step
+	err = jobb.PostToAutomationWebhook(ctx, deps.Config.GetPipelineNotifyWebhook())
+	if err != nil {
+		deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassWebhook, data.ErrorSeverityError, err)
+		errors++
+		finalState = data.JobStateFailed
+	}
+}
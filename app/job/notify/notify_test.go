@@ -0,0 +1,94 @@
+package jobnotify
+
+import (
+	"context"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := []struct {
+		name          string
+		webhookStatus int
+		noWebhook     bool
+		wantState     data.JobState
+		wantErrors    int64
+		wantHits      int64
+	}{
+		{
+			name:          "notifies",
+			webhookStatus: http.StatusOK,
+			wantState:     data.JobStateCompleted,
+			wantHits:      1,
+		},
+		{
+			name:          "fails when the webhook fails",
+			webhookStatus: http.StatusInternalServerError,
+			wantState:     data.JobStateFailed,
+			wantErrors:    1,
+			wantHits:      1,
+		},
+		{
+			name:       "fails without a webhook",
+			noWebhook:  true,
+			wantState:  data.JobStateFailed,
+			wantErrors: 1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := fake.NewWebhook(tt.webhookStatus)
+			defer webhook.Close()
+
+			url := webhook.URL
+			if tt.noWebhook {
+				url = ""
+			}
+
+			cfgsvc := fake.NewConfig(map[string]string{
+				"PIPELINE_NOTIFY_WEBHOOK": url,
+			})
+			datasvc := fake.NewData(cfgsvc)
+
+			jobID, err := datasvc.NewJob(data.Job{
+				Type:      data.JobTypeNotify,
+				State:     data.JobStateRunning,
+				StartedAt: time.Now(),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			errorStream := make(chan error, 10)
+			Processor(context.Background(), jobID, jobb.NoOptions{}, jobb.Deps{ErrorStream: errorStream, Config: cfgsvc, Data: datasvc, Trello: fake.NewTrello(), Storage: fake.NewStorage()})
+			close(errorStream)
+
+			job, err := datasvc.RetrieveJobByID(jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if job.State != tt.wantState {
+				t.Errorf("state = %s, want %s", job.State, tt.wantState)
+			}
+
+			if job.Errors != tt.wantErrors || int64(len(errorStream)) != tt.wantErrors {
+				t.Errorf("errors = %d, streamed = %d, want %d", job.Errors, len(errorStream), tt.wantErrors)
+			}
+
+			if job.CompletedAt == nil {
+				t.Error("completedAt is not set")
+			}
+
+			if hits := webhook.Hits(); hits != tt.wantHits {
+				t.Errorf("webhook hits = %d, want %d", hits, tt.wantHits)
+			}
+		})
+	}
+}
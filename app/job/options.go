@@ -0,0 +1,100 @@
+package job
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/trello"
+)
+
+const (
+	// MaxPageSize caps the page size a job or a listing may ask for
+	MaxPageSize = 1000
+)
+
+// NoOptions is the options type of jobs that do not take any
+type NoOptions struct{}
+
+// SyncOptions are the options of the jobs that page through Trello or the database
+type SyncOptions struct {
+	PageSize int `json:"pageSize,omitempty" description:"Page size of the Trello and database requests. Defaults to the s query parameter or 50."`
+}
+
+func (o SyncOptions) Validate() error {
+	if o.PageSize < 0 || o.PageSize > MaxPageSize {
+		return fmt.Errorf("pageSize must be between 0 (default) and %d", MaxPageSize)
+	}
+
+	return nil
+}
+
+// PageSizeOf returns the page size option or, if it is not set, the page
+// size the job was submitted with
+func (o SyncOptions) PageSizeOf(job data.Job) int {
+	if o.PageSize > 0 {
+		return o.PageSize
+	}
+
+	return job.PageSize
+}
+
+// CardOptions are the options of the board syncs. The card options narrow
+// a sync to some cards of the board.
+type CardOptions struct {
+	SyncOptions
+	Cards []string `json:"cards,omitempty" description:"IDs or short links of the cards to sync. All cards of the board by default."`
+	Label string   `json:"label,omitempty" description:"Name or ID of a label. Only the cards with the label are synced."`
+	List  string   `json:"list,omitempty" description:"Name or ID of a list. Only the cards of the list are synced."`
+}
+
+func (o CardOptions) Validate() error {
+	err := o.SyncOptions.Validate()
+	if err != nil {
+		return err
+	}
+
+	if len(o.Cards) > MaxPageSize {
+		return fmt.Errorf("cards must not list more than %d cards", MaxPageSize)
+	}
+
+	for _, card := range o.Cards {
+		if strings.TrimSpace(card) == "" {
+			return fmt.Errorf("cards must not contain empty IDs")
+		}
+	}
+
+	return nil
+}
+
+// Filter returns the card options as a Trello filter
+func (o CardOptions) Filter() trello.CardFilter {
+	return trello.CardFilter{
+		Cards: o.Cards,
+		Label: strings.TrimSpace(o.Label),
+		List:  strings.TrimSpace(o.List),
+	}
+}
+
+// Targeted tells whether the sync covers only some cards of the board
+func (o CardOptions) Targeted() bool {
+	return !o.Filter().IsZero()
+}
+
+// DeadLetterOptions select the pending dead letters a replay job retries.
+// Zero values do not filter.
+type DeadLetterOptions struct {
+	ID         int64                    `json:"id,omitempty" description:"Only the dead letter with the ID."`
+	JobID      int64                    `json:"jobId,omitempty" description:"Only the dead letters of the job."`
+	EntityType data.EntityType          `json:"entityType,omitempty" description:"Only the dead letters of the entity type."`
+	Operation  data.DeadLetterOperation `json:"operation,omitempty" description:"Only the dead letters of the operation."`
+	Limit      int                      `json:"limit,omitempty" description:"Number of dead letters to replay, oldest first. Defaults to 50."`
+}
+
+func (o DeadLetterOptions) Validate() error {
+	if o.Limit < 0 || o.Limit > MaxPageSize {
+		return fmt.Errorf("limit must be between 0 (default) and %d", MaxPageSize)
+	}
+
+	return nil
+}
@@ -0,0 +1,36 @@
+package job
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestOptionsValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		options optionsValidator
+		wantErr string
+	}{
+		{name: "default page size", options: SyncOptions{}},
+		{name: "smallest page size", options: SyncOptions{PageSize: 1}},
+		{name: "largest page size", options: SyncOptions{PageSize: MaxPageSize}},
+		{name: "page size over the max", options: SyncOptions{PageSize: MaxPageSize + 1}, wantErr: "pageSize must be between 0 (default) and 1000"},
+		{name: "negative page size", options: SyncOptions{PageSize: -1}, wantErr: "pageSize must be between 0 (default) and 1000"},
+		{name: "card options check the page size", options: CardOptions{SyncOptions: SyncOptions{PageSize: MaxPageSize + 1}}, wantErr: "pageSize must be between"},
+		{name: "default limit", options: DeadLetterOptions{}},
+		{name: "limit over the max", options: DeadLetterOptions{Limit: MaxPageSize + 1}, wantErr: "limit must be between 0 (default) and 1000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.options.Validate()
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
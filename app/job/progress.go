@@ -0,0 +1,86 @@
+package job
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+// Progress tracks how far a job got. Updates are persisted at most once
+// per interval so large boards do not flood the database. It is not safe
+// for concurrent use.
+type Progress struct {
+	jobID       int64
+	errorStream chan error
+	datasvc     data.IService
+	interval    time.Duration
+	savedAt     time.Time
+	progress    data.JobProgress
+}
+
+func NewProgress(jobID int64,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService) *Progress {
+	return &Progress{
+		jobID:       jobID,
+		errorStream: errorStream,
+		datasvc:     datasvc,
+		interval:    cfgsvc.GetJobProgressInterval(),
+	}
+}
+
+// Discovered records the number of cards to process and saves right away
+func (p *Progress) Discovered(total int) {
+	p.progress.Total = int64(total)
+	p.Flush()
+}
+
+// Start records the card being processed
+func (p *Progress) Start(card string) {
+	p.progress.CurrentCard = card
+	p.save()
+}
+
+// Transfer records how much of the current attachment was streamed. It
+// shows in the current card as i.e. `deed.pdf (12.0/48.0 MiB)`.
+func (p *Progress) Transfer(name string, sent, total int64) {
+	if total > 0 {
+		p.progress.CurrentCard = fmt.Sprintf("%s (%.1f/%.1f MiB)", name, mebibytes(sent), mebibytes(total))
+	} else {
+		p.progress.CurrentCard = fmt.Sprintf("%s (%.1f MiB)", name, mebibytes(sent))
+	}
+	p.save()
+}
+
+func mebibytes(n int64) float64 {
+	return float64(n) / (1 << 20)
+}
+
+// Done counts the current card as processed
+func (p *Progress) Done(failed bool) {
+	p.progress.Processed++
+	if failed {
+		p.progress.Failed++
+	}
+	p.save()
+}
+
+// Flush saves the progress regardless of the interval
+func (p *Progress) Flush() {
+	p.savedAt = time.Now()
+	err := p.datasvc.UpdateJobProgress(p.jobID, p.progress)
+	if err != nil {
+		p.errorStream <- JobError(p.jobID, data.ErrorClassDatabase, data.ErrorSeverityWarning, err)
+	}
+}
+
+func (p *Progress) save() {
+	if time.Since(p.savedAt) < p.interval {
+		return
+	}
+
+	p.Flush()
+}
@@ -0,0 +1,34 @@
+package job
+
+import (
+	"testing"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestProgressIsThrottled(t *testing.T) {
+	cfgsvc := fake.NewConfig(map[string]string{
+		"JOB_PROGRESS_INTERVAL": "1h",
+	})
+	datasvc := fake.NewData(cfgsvc)
+	jobID, _ := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateRunning})
+
+	progress := NewProgress(jobID, make(chan error, 1), cfgsvc, datasvc)
+	progress.Discovered(2)
+	for _, card := range []string{"Lot 1", "Lot 2"} {
+		progress.Start(card)
+		progress.Done(card == "Lot 2")
+	}
+
+	// Only the discovery was saved within the interval
+	if calls := datasvc.Calls("UpdateJobProgress"); calls != 1 {
+		t.Fatalf("expected 1 saved update, got %d", calls)
+	}
+
+	progress.Flush()
+	job, _ := datasvc.RetrieveJobByID(jobID)
+	if job.Cards != 2 || job.Processed != 2 || job.Failed != 1 || job.CurrentCard != "Lot 2" {
+		t.Fatalf("unexpected progress %+v", job)
+	}
+}
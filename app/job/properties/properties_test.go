@@ -0,0 +1,476 @@
+package jobproperties
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/trello"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := []struct {
+		name          string
+		cards         int
+		setup         func(datasvc *fake.DataService, trsvc *fake.TrelloService)
+		cancel        bool
+		webhookStatus int
+		wantState     data.JobState
+		wantCards     int64
+		wantErrors    int64
+		wantStored    int
+		wantHits      int64
+		wantStream    int
+	}{
+		{
+			name:          "completes and notifies",
+			cards:         3,
+			webhookStatus: http.StatusOK,
+			wantState:     data.JobStateCompleted,
+			wantCards:     3,
+			wantStored:    3,
+			wantHits:      1,
+		},
+		{
+			name:  "counts upsert errors",
+			cards: 3,
+			setup: func(datasvc *fake.DataService, _ *fake.TrelloService) {
+				datasvc.FailNth("NewProperty", 2, errors.New("db down"))
+			},
+			webhookStatus: http.StatusOK,
+			wantState:     data.JobStateCompleted,
+			wantCards:     3,
+			wantErrors:    1,
+			wantStored:    2,
+			wantHits:      1,
+			wantStream:    1,
+		},
+		{
+			name:  "fails when the board cannot be fetched",
+			cards: 3,
+			setup: func(_ *fake.DataService, trsvc *fake.TrelloService) {
+				trsvc.FailAlways("RetrieveProperties", errors.New("trello down"))
+			},
+			webhookStatus: http.StatusOK,
+			wantState:     data.JobStateFailed,
+			wantErrors:    1,
+			wantStream:    1,
+		},
+		{
+			name:          "stops when cancelled",
+			cards:         3,
+			cancel:        true,
+			webhookStatus: http.StatusOK,
+			wantState:     data.JobStateCancelled,
+			wantCards:     3,
+		},
+		{
+			name:          "reports webhook failures",
+			cards:         1,
+			webhookStatus: http.StatusInternalServerError,
+			wantState:     data.JobStateCompleted,
+			wantCards:     1,
+			wantStored:    1,
+			wantHits:      1,
+			wantStream:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := fake.NewWebhook(tt.webhookStatus)
+			defer webhook.Close()
+
+			cfgsvc := fake.NewConfig(map[string]string{
+				"PROPERTIES_NOTION_UPDATE_WEBHOOK": webhook.URL,
+			})
+			datasvc := fake.NewData(cfgsvc)
+			trsvc := fake.NewTrello()
+
+			for i := 0; i < tt.cards; i++ {
+				trsvc.AddProperties(trello.TRProperty{
+					ID:          string(rune('a' + i)),
+					Name:        "Property",
+					Owner:       "Family",
+					Area:        100,
+					Attachments: []trello.TRAttachment{{ID: "att", Name: "deed.pdf", URL: "https://trello.com/1/cards/c/attachments/att/download/deed.pdf"}},
+				})
+			}
+
+			if tt.setup != nil {
+				tt.setup(datasvc, trsvc)
+			}
+
+			jobID, err := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateRunning, StartedAt: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			errorStream := make(chan error, 10)
+			Processor(ctx, jobID, jobb.CardOptions{SyncOptions: jobb.SyncOptions{PageSize: 50}}, jobb.Deps{ErrorStream: errorStream, Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: fake.NewStorage()})
+			close(errorStream)
+
+			job, err := datasvc.RetrieveJobByID(jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if job.State != tt.wantState || job.Cards != tt.wantCards || job.Errors != tt.wantErrors || job.CompletedAt == nil {
+				t.Errorf("job = %+v, want %s with %d cards and %d errors", job, tt.wantState, tt.wantCards, tt.wantErrors)
+			}
+
+			stored := datasvc.Properties()
+			if len(stored) != tt.wantStored {
+				t.Fatalf("stored = %d, want %d", len(stored), tt.wantStored)
+			}
+
+			// The card fields and attachments are stored with the property
+			for _, prop := range stored {
+				if prop.Owner != "Family" || prop.Area != 100 || len(prop.Attachments) != 1 {
+					t.Errorf("stored property = %+v", prop)
+				}
+			}
+			if recorded := len(datasvc.Attachments()); recorded != tt.wantStored {
+				t.Errorf("recorded attachments = %d, want %d", recorded, tt.wantStored)
+			}
+
+			if hits := webhook.Hits(); hits != tt.wantHits {
+				t.Errorf("webhook hits = %d, want %d", hits, tt.wantHits)
+			}
+
+			if streamed := len(errorStream); streamed != tt.wantStream {
+				t.Errorf("streamed errors = %d, want %d", streamed, tt.wantStream)
+			}
+
+			// Streamed errors must be linked to the job
+			for err := range errorStream {
+				record := jobb.ErrorRecord("test", err)
+				if record.JobID == nil || *record.JobID != jobID || record.Class == data.ErrorClassInternal || record.Stack == "" {
+					t.Errorf("unexpected error record %+v", record)
+				}
+			}
+		})
+	}
+}
+
+func TestProcessorOutcomes(t *testing.T) {
+	webhook := fake.NewWebhook(http.StatusOK)
+	defer webhook.Close()
+
+	cfgsvc := fake.NewConfig(map[string]string{
+		"PROPERTIES_NOTION_UPDATE_WEBHOOK": webhook.URL,
+	})
+	datasvc := fake.NewData(cfgsvc)
+	trsvc := fake.NewTrello()
+	storagesvc := fake.NewStorage()
+
+	trsvc.AddProperties(
+		trello.TRProperty{ID: "a", Name: "Lot 1", Area: 100},
+		trello.TRProperty{ID: "b", Name: "Lot 2", Area: 200},
+	)
+
+	run := func() data.Job {
+		jobID, err := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateRunning, StartedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		Processor(context.Background(), jobID, jobb.CardOptions{SyncOptions: jobb.SyncOptions{PageSize: 50}}, jobb.Deps{ErrorStream: make(chan error, 10), Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: storagesvc})
+
+		job, err := datasvc.RetrieveJobByID(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+
+	job := run()
+	if job.Inserted != 2 || job.Updated != 0 || job.Unchanged != 0 || job.Failed != 0 {
+		t.Errorf("first run = %+v, want 2 inserted", job)
+	}
+
+	// Nothing changed on the board
+	job = run()
+	if job.Inserted != 0 || job.Updated != 0 || job.Unchanged != 2 {
+		t.Errorf("second run = %+v, want 2 unchanged", job)
+	}
+}
+
+func TestProcessorProgress(t *testing.T) {
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+	trsvc := fake.NewTrello()
+
+	trsvc.AddProperties(
+		trello.TRProperty{ID: "a", Name: "Lot 1"},
+		trello.TRProperty{ID: "b", Name: "Lot 2"},
+		trello.TRProperty{ID: "c", Name: "Lot 3"},
+	)
+	datasvc.FailNth("NewProperty", 2, errors.New("db down"))
+
+	jobID, err := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateRunning, StartedAt: time.Now()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Processor(context.Background(), jobID, jobb.CardOptions{SyncOptions: jobb.SyncOptions{PageSize: 50}}, jobb.Deps{ErrorStream: make(chan error, 10), Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: fake.NewStorage()})
+
+	job, err := datasvc.RetrieveJobByID(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.Cards != 3 || job.Processed != 3 || job.Failed != 1 || job.CurrentCard != "Lot 3" || job.ProgressAt == nil {
+		t.Errorf("progress = %+v, want 3 processed with 1 failed", job)
+	}
+}
+
+func TestProcessorDeadLetters(t *testing.T) {
+	cfgsvc := fake.NewConfig(map[string]string{
+		"CARD_RETRY_ATTEMPTS": "3",
+	})
+	datasvc := fake.NewData(cfgsvc)
+	trsvc := fake.NewTrello()
+
+	trsvc.AddProperties(
+		trello.TRProperty{ID: "a", Name: "Lot 1"},
+		trello.TRProperty{ID: "b", Name: "Lot 2"},
+	)
+
+	run := func() data.Job {
+		jobID, err := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateRunning, StartedAt: time.Now()})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		Processor(context.Background(), jobID, jobb.CardOptions{SyncOptions: jobb.SyncOptions{PageSize: 50}}, jobb.Deps{ErrorStream: make(chan error, 10), Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: fake.NewStorage()})
+
+		job, err := datasvc.RetrieveJobByID(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return job
+	}
+
+	// A transient failure is retried. Card b always fails.
+	datasvc.FailNth("NewProperty", 1, errors.New("db blip"))
+	for call := 3; call <= 5; call++ {
+		datasvc.FailNth("NewProperty", call, errors.New("db down"))
+	}
+
+	job := run()
+	if job.Errors != 1 || job.Failed != 1 || job.Inserted != 1 {
+		t.Fatalf("first run = %+v, want 1 inserted and 1 failed", job)
+	}
+
+	dls := datasvc.DeadLetters()
+	if len(dls) != 1 || dls[0].CardID != "b" || dls[0].JobID != job.ID || dls[0].Attempts != 3 || dls[0].State != data.DeadLetterStatePending {
+		t.Fatalf("expected a pending dead letter for card b, got %+v", dls)
+	}
+
+	// The next successful sync resolves it
+	job = run()
+	if job.Errors != 0 {
+		t.Fatalf("second run = %+v, want no errors", job)
+	}
+
+	dls = datasvc.DeadLetters()
+	if len(dls) != 1 || dls[0].State != data.DeadLetterStateResolved || dls[0].ResolvedAt == nil {
+		t.Fatalf("expected the dead letter to be resolved, got %+v", dls)
+	}
+}
+
+func TestProcessorDryRun(t *testing.T) {
+	webhook := fake.NewWebhook(http.StatusOK)
+	defer webhook.Close()
+
+	cfgsvc := fake.NewConfig(map[string]string{
+		"PROPERTIES_NOTION_UPDATE_WEBHOOK": webhook.URL,
+	})
+	datasvc := fake.NewData(cfgsvc)
+	trsvc := fake.NewTrello()
+	storagesvc := fake.NewStorage()
+
+	boardID := cfgsvc.GetTrelloPropertiesBoardID()
+	for _, prop := range []data.Property{
+		{BoardID: boardID, CardID: "a", Name: "Lot 1", Area: 100},
+		{BoardID: boardID, CardID: "b", Name: "Lot 2", Area: 200},
+		{BoardID: boardID, CardID: "d", Name: "Lot 4", Area: 400},
+	} {
+		if _, _, err := datasvc.NewProperty(prop); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	trsvc.AddProperties(
+		trello.TRProperty{ID: "a", Name: "Lot 1", Area: 100},
+		trello.TRProperty{ID: "b", Name: "Lot 2", Area: 250},
+		trello.TRProperty{
+			ID:   "c",
+			Name: "Lot 3",
+			Attachments: []trello.TRAttachment{
+				{ID: "att", Name: "deed.pdf", URL: "https://trello.com/1/cards/c/attachments/att/download/deed.pdf"},
+			},
+		},
+	)
+
+	jobID, err := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateRunning, StartedAt: time.Now(), DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	Processor(context.Background(), jobID, jobb.CardOptions{SyncOptions: jobb.SyncOptions{PageSize: 50}}, jobb.Deps{ErrorStream: make(chan error, 10), Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: storagesvc})
+
+	job, err := datasvc.RetrieveJobByID(jobID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.State != data.JobStateCompleted || job.Inserted != 1 || job.Updated != 1 || job.Unchanged != 1 {
+		t.Fatalf("job = %+v, want 1 inserted, 1 updated and 1 unchanged", job)
+	}
+
+	report := job.Report
+	if report == nil {
+		t.Fatal("expected a report")
+	}
+
+	if len(report.Inserts) != 1 || report.Inserts[0].CardID != "c" {
+		t.Errorf("inserts = %+v, want card c", report.Inserts)
+	}
+
+	if len(report.Updates) != 1 || report.Updates[0].CardID != "b" || len(report.Updates[0].Fields) != 1 || report.Updates[0].Fields[0].Field != "area" {
+		t.Errorf("updates = %+v, want the area of card b", report.Updates)
+	}
+
+	if len(report.Archivals) != 1 || report.Archivals[0].CardID != "d" {
+		t.Errorf("archivals = %+v, want card d", report.Archivals)
+	}
+
+	if len(report.Uploads) != 1 || report.Uploads[0].TrelloAttachmentID != "att" || report.Uploads[0].StorageKey == "" {
+		t.Errorf("uploads = %+v, want the attachment of card c", report.Uploads)
+	}
+
+	// Nothing was written
+	props := datasvc.Properties()
+	if len(props) != 3 || props[1].Area != 200 {
+		t.Errorf("properties = %+v, want them unchanged", props)
+	}
+
+	if len(datasvc.Attachments()) != 0 || len(storagesvc.Objects()) != 0 {
+		t.Error("expected no attachments to be recorded or uploaded")
+	}
+
+	if hits := webhook.Hits(); hits != 0 {
+		t.Errorf("webhook hits = %d, want 0", hits)
+	}
+}
+
+func TestProcessorTargeted(t *testing.T) {
+	webhook := fake.NewWebhook(http.StatusOK)
+	defer webhook.Close()
+
+	cfgsvc := fake.NewConfig(map[string]string{
+		"PROPERTIES_NOTION_UPDATE_WEBHOOK": webhook.URL,
+	})
+	datasvc := fake.NewData(cfgsvc)
+	trsvc := fake.NewTrello()
+
+	trsvc.AddLists(
+		trello.TRList{ID: "l1", Name: "Registered"},
+		trello.TRList{ID: "l2", Name: "Pending"},
+	)
+	trsvc.AddProperties(
+		trello.TRProperty{ID: "a", ShortLink: "sa", IDList: "l1", Name: "Lot 1", Labels: []trello.TRLabel{{ID: "g", Name: "Grove"}}},
+		trello.TRProperty{ID: "b", ShortLink: "sb", IDList: "l2", Name: "Lot 2", Labels: []trello.TRLabel{{ID: "g", Name: "Grove"}}},
+		trello.TRProperty{ID: "c", ShortLink: "sc", IDList: "l2", Name: "Lot 3"},
+	)
+
+	// Card d is stored but no longer on the board
+	if _, _, err := datasvc.NewProperty(data.Property{BoardID: cfgsvc.GetTrelloPropertiesBoardID(), CardID: "d", Name: "Lot 4"}); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		options    jobb.CardOptions
+		dryRun     bool
+		wantCards  []string
+		wantErrors int64
+		wantFailed bool
+	}{
+		{name: "card IDs and short links", options: jobb.CardOptions{Cards: []string{"a", "sc"}}, wantCards: []string{"a", "c"}},
+		{name: "label", options: jobb.CardOptions{Label: "grove"}, wantCards: []string{"a", "b"}},
+		{name: "list", options: jobb.CardOptions{List: "Pending"}, wantCards: []string{"b", "c"}},
+		{name: "label and list", options: jobb.CardOptions{Label: "g", List: "l2"}, wantCards: []string{"b"}},
+		{name: "unknown card", options: jobb.CardOptions{Cards: []string{"a", "zz"}}, wantErrors: 1, wantFailed: true},
+		{name: "unknown list", options: jobb.CardOptions{List: "Archived"}, wantErrors: 1, wantFailed: true},
+		{name: "dry run", options: jobb.CardOptions{Cards: []string{"b"}}, dryRun: true, wantCards: []string{"b"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			datasvc := datasvc
+			if !tt.dryRun {
+				datasvc = fake.NewData(cfgsvc)
+			}
+			hits := webhook.Hits()
+
+			jobID, err := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateRunning, StartedAt: time.Now(), DryRun: tt.dryRun})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			Processor(context.Background(), jobID, tt.options, jobb.Deps{ErrorStream: make(chan error, 10), Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: fake.NewStorage()})
+
+			job, err := datasvc.RetrieveJobByID(jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if job.Cards != int64(len(tt.wantCards)) || job.Errors != tt.wantErrors {
+				t.Fatalf("job = %+v, want %d cards and %d errors", job, len(tt.wantCards), tt.wantErrors)
+			}
+
+			if tt.dryRun {
+				// The rest of the board was not looked at so nothing is archived
+				if job.Report == nil || len(job.Report.Inserts) != 1 || job.Report.Inserts[0].CardID != "b" || len(job.Report.Archivals) != 0 {
+					t.Fatalf("report = %+v, want card b inserted and no archivals", job.Report)
+				}
+				return
+			}
+
+			stored := []string{}
+			for _, prop := range datasvc.Properties() {
+				stored = append(stored, prop.CardID)
+			}
+			if strings.Join(stored, ",") != strings.Join(tt.wantCards, ",") {
+				t.Errorf("stored = %v, want %v", stored, tt.wantCards)
+			}
+
+			// The automations are notified as after a full sync, unless the
+			// cards could not be fetched
+			if tt.wantFailed {
+				if job.State != data.JobStateFailed || webhook.Hits() != hits {
+					t.Errorf("job state = %s and %d webhook hits, want failed and none", job.State, webhook.Hits()-hits)
+				}
+				return
+			}
+			if webhook.Hits() != hits+1 {
+				t.Error("expected the webhook to be notified")
+			}
+		})
+	}
+}
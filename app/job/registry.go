@@ -0,0 +1,284 @@
+package job
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/storage"
+	"github.com/khaledhikmat/tr-extractor/service/trello"
+)
+
+// Deps bundles the error stream and the services a job may use
+type Deps struct {
+	ErrorStream chan error
+	Config      config.IService
+	Data        data.IService
+	Trello      trello.IService
+	Storage     storage.IService
+}
+
+// Handler runs a claimed job of a registered type with its decoded options
+type Handler[O any] func(ctx context.Context, jobID int64, options O, deps Deps)
+
+// Processor runs a claimed job. It is what the queue workers call.
+type Processor func(ctx context.Context, job data.Job, deps Deps)
+
+// Definition describes a job type in the registry
+type Definition struct {
+	Type        data.JobType `json:"type"`
+	Description string       `json:"description"`
+	// Concurrency is the number of jobs of the type that may be queued or
+	// running at once. It defaults to 1.
+	Concurrency int  `json:"concurrency"`
+	DryRun      bool `json:"dryRun"`
+	// MaxDuration is how long a job of the type may run before the watchdog
+	// times it out. It defaults to DefaultMaxDuration and is overridden by
+	// `JOB_MAX_DURATION_<TYPE>`.
+	MaxDuration time.Duration `json:"-"`
+	// Schema is the JSON schema of the options. It is derived from the
+	// options type when the job type is registered.
+	Schema json.RawMessage `json:"schema"`
+}
+
+// optionsValidator is implemented by options that check more than their fields
+type optionsValidator interface {
+	Validate() error
+}
+
+type registration struct {
+	definition Definition
+	decode     func(raw data.JobOptions) (interface{}, error)
+	processor  Processor
+}
+
+var (
+	registryMutex sync.RWMutex
+	registry      = map[data.JobType]registration{}
+)
+
+// Register adds a job type to the registry. Job packages call it from their
+// init function. It panics on a duplicate type so the binary fails to start.
+func Register[O any](def Definition, handler Handler[O]) {
+	if def.Concurrency <= 0 {
+		def.Concurrency = 1
+	}
+	if def.MaxDuration <= 0 {
+		def.MaxDuration = DefaultMaxDuration
+	}
+	def.Schema = optionsSchema(reflect.TypeOf((*O)(nil)).Elem())
+
+	decode := func(raw data.JobOptions) (interface{}, error) {
+		return decodeOptions[O](raw)
+	}
+
+	processor := func(ctx context.Context, job data.Job, deps Deps) {
+		// Every run is a root span. Its errors are counted by class on the way out.
+		started := time.Now()
+		ctx, span := startRun(ctx, job)
+		errorStream, drain := countErrors(ctx, deps.ErrorStream)
+		deps.ErrorStream = errorStream
+		ctx, stop := watch(ctx, job.ID,
+			deps.Config.GetJobMaxDuration(string(def.Type), def.MaxDuration),
+			deps.Config.GetCardTimeout(),
+			errorStream)
+		defer func() {
+			stop()
+			final, err := deps.Data.RetrieveJobByID(job.ID)
+			if err != nil {
+				final = job
+			}
+
+			// The handler saw a cancelled context. Keep its counts but record why.
+			// A job another worker claimed since is not this run's to record.
+			if TimedOut(ctx) && final.WorkerID == job.WorkerID && (final.State == data.JobStateCancelled || final.State == data.JobStateCompleted) {
+				final.State = data.JobStateTimedOut
+				err = deps.Data.UpdateJob(&final)
+				if err != nil {
+					errorStream <- JobError(job.ID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
+				}
+			}
+
+			drain()
+			endRun(ctx, span, final, started)
+		}()
+
+		options, err := decodeOptions[O](job.Options)
+		if err != nil {
+			// Options are validated at submission so this is a job stored by an older release
+			deps.ErrorStream <- JobError(job.ID, data.ErrorClassInternal, data.ErrorSeverityCritical, err)
+			now := time.Now()
+			job.State = data.JobStateFailed
+			job.CompletedAt = &now
+			err = deps.Data.FinishJob(&job)
+			if err != nil {
+				deps.ErrorStream <- JobError(job.ID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
+			}
+			return
+		}
+
+		handler(ctx, job.ID, options, deps)
+	}
+
+	registryMutex.Lock()
+	defer registryMutex.Unlock()
+
+	if _, ok := registry[def.Type]; ok {
+		panic(fmt.Sprintf("job type %s is already registered", def.Type))
+	}
+
+	registry[def.Type] = registration{
+		definition: def,
+		decode:     decode,
+		processor:  processor,
+	}
+}
+
+// Lookup returns the definition of a registered job type
+func Lookup(jobType data.JobType) (Definition, bool) {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	reg, ok := registry[jobType]
+	return reg.definition, ok
+}
+
+// Definitions returns the registered job types ordered by type
+func Definitions() []Definition {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	defs := []Definition{}
+	for _, reg := range registry {
+		defs = append(defs, reg.definition)
+	}
+	sort.Slice(defs, func(i, j int) bool { return defs[i].Type < defs[j].Type })
+
+	return defs
+}
+
+// Processors returns the processor of every registered job type
+func Processors() map[data.JobType]Processor {
+	registryMutex.RLock()
+	defer registryMutex.RUnlock()
+
+	procs := map[data.JobType]Processor{}
+	for jobType, reg := range registry {
+		procs[jobType] = reg.processor
+	}
+
+	return procs
+}
+
+// ValidateOptions decodes the submitted options of a job type and rejects
+// unknown fields. It returns the options as they will be stored.
+func ValidateOptions(jobType data.JobType, raw data.JobOptions) (data.JobOptions, error) {
+	registryMutex.RLock()
+	reg, ok := registry[jobType]
+	registryMutex.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("job type %s is not registered", jobType)
+	}
+
+	options, err := reg.decode(raw)
+	if err != nil {
+		return nil, err
+	}
+
+	b, err := json.Marshal(options)
+	if err != nil {
+		return nil, err
+	}
+
+	return data.JobOptions(b), nil
+}
+
+func decodeOptions[O any](raw data.JobOptions) (O, error) {
+	var options O
+	if len(bytes.TrimSpace(raw)) == 0 {
+		raw = data.JobOptions("{}")
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(raw))
+	decoder.DisallowUnknownFields()
+	err := decoder.Decode(&options)
+	if err != nil {
+		return options, fmt.Errorf("invalid options: %w", err)
+	}
+
+	if v, ok := any(options).(optionsValidator); ok {
+		err = v.Validate()
+		if err != nil {
+			return options, fmt.Errorf("invalid options: %w", err)
+		}
+	}
+
+	return options, nil
+}
+
+// optionsSchema describes an options struct as a JSON schema. Field names
+// come from the `json` tag and descriptions from the `description` tag.
+func optionsSchema(t reflect.Type) json.RawMessage {
+	properties := map[string]interface{}{}
+	schemaProperties(t, properties)
+
+	b, _ := json.Marshal(map[string]interface{}{
+		"type":                 "object",
+		"properties":           properties,
+		"additionalProperties": false,
+	})
+	return b
+}
+
+// schemaProperties adds the fields of a struct to the schema properties. The
+// fields of embedded structs are promoted as they are in JSON.
+func schemaProperties(t reflect.Type, properties map[string]interface{}) {
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if field.Anonymous && name == "" && field.Type.Kind() == reflect.Struct {
+			schemaProperties(field.Type, properties)
+			continue
+		}
+		if !field.IsExported() || name == "-" {
+			continue
+		}
+		if name == "" {
+			name = field.Name
+		}
+
+		property := map[string]interface{}{
+			"type": schemaType(field.Type.Kind()),
+		}
+		if description := field.Tag.Get("description"); description != "" {
+			property["description"] = description
+		}
+		properties[name] = property
+	}
+}
+
+func schemaType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.Slice, reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+
+	return "string"
+}
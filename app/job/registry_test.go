@@ -0,0 +1,140 @@
+package job
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+type testOptions struct {
+	Board string `json:"board" description:"Board to sync"`
+	Limit int    `json:"limit"`
+}
+
+func (o testOptions) Validate() error {
+	if o.Limit < 0 {
+		return errors.New("limit must not be negative")
+	}
+	return nil
+}
+
+func TestRegistry(t *testing.T) {
+	jobType := data.JobType("registry-test")
+	received := make(chan testOptions, 1)
+	Register(Definition{Type: jobType, Description: "test"}, func(_ context.Context, _ int64, options testOptions, _ Deps) {
+		received <- options
+	})
+
+	def, ok := Lookup(jobType)
+	if !ok || def.Concurrency != 1 {
+		t.Fatalf("expected the type to be registered with a concurrency of 1, got %+v", def)
+	}
+
+	var schema struct {
+		Properties           map[string]map[string]string `json:"properties"`
+		AdditionalProperties bool                         `json:"additionalProperties"`
+	}
+	if err := json.Unmarshal(def.Schema, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	if schema.AdditionalProperties || schema.Properties["board"]["type"] != "string" || schema.Properties["board"]["description"] != "Board to sync" || schema.Properties["limit"]["type"] != "integer" {
+		t.Fatalf("unexpected schema %s", def.Schema)
+	}
+
+	tests := []struct {
+		name    string
+		options string
+		want    string
+		wantErr bool
+	}{
+		{name: "no options", options: "", want: `{"board":"","limit":0}`},
+		{name: "known options", options: `{"board": "b1", "limit": 5}`, want: `{"board":"b1","limit":5}`},
+		{name: "unknown option", options: `{"boards": "b1"}`, wantErr: true},
+		{name: "wrong type", options: `{"limit": "five"}`, wantErr: true},
+		{name: "invalid value", options: `{"limit": -1}`, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			options, err := ValidateOptions(jobType, data.JobOptions(tt.options))
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if err == nil && string(options) != tt.want {
+				t.Fatalf("options = %s, want %s", options, tt.want)
+			}
+		})
+	}
+
+	if _, err := ValidateOptions("unknown", nil); err == nil {
+		t.Fatal("expected an unknown job type")
+	}
+
+	// The processor hands the decoded options to the handler
+	cfgsvc := fake.NewConfig(nil)
+	deps := Deps{ErrorStream: make(chan error, 1), Config: cfgsvc, Data: fake.NewData(cfgsvc)}
+	Processors()[jobType](context.Background(), data.Job{Type: jobType, Options: data.JobOptions(`{"board": "b1"}`)}, deps)
+	if options := <-received; options.Board != "b1" {
+		t.Fatalf("unexpected options %+v", options)
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected a duplicate registration to panic")
+		}
+	}()
+	Register(Definition{Type: jobType}, func(context.Context, int64, NoOptions, Deps) {})
+}
+
+func TestProcessorFailsOnInvalidOptions(t *testing.T) {
+	jobType := data.JobType("registry-invalid-test")
+	Register(Definition{Type: jobType}, func(context.Context, int64, NoOptions, Deps) {
+		t.Fatal("the handler must not run")
+	})
+
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+	jobID, _ := datasvc.NewJob(data.Job{Type: jobType, State: data.JobStateRunning, Options: data.JobOptions(`{"stale": true}`)})
+	job, _ := datasvc.RetrieveJobByID(jobID)
+
+	errorStream := make(chan error, 1)
+	Processors()[jobType](context.Background(), job, Deps{ErrorStream: errorStream, Config: cfgsvc, Data: datasvc})
+
+	job, _ = datasvc.RetrieveJobByID(jobID)
+	if job.State != data.JobStateFailed || job.CompletedAt == nil || len(errorStream) != 1 {
+		t.Fatalf("expected the job to fail, got %+v", job)
+	}
+}
+
+func TestCardOptions(t *testing.T) {
+	jobType := data.JobType("registry-cards-test")
+	Register(Definition{Type: jobType}, func(context.Context, int64, CardOptions, Deps) {})
+
+	def, _ := Lookup(jobType)
+	var schema struct {
+		Properties map[string]map[string]string `json:"properties"`
+	}
+	if err := json.Unmarshal(def.Schema, &schema); err != nil {
+		t.Fatal(err)
+	}
+
+	// The embedded page size is promoted like it is in JSON
+	if schema.Properties["pageSize"]["type"] != "integer" || schema.Properties["cards"]["type"] != "array" || schema.Properties["SyncOptions"] != nil {
+		t.Fatalf("unexpected schema %s", def.Schema)
+	}
+
+	options, err := ValidateOptions(jobType, data.JobOptions(`{"pageSize": 10, "cards": ["abc"], "list": "Pending"}`))
+	if err != nil || string(options) != `{"pageSize":10,"cards":["abc"],"list":"Pending"}` {
+		t.Fatalf("unexpected options %s: %v", options, err)
+	}
+
+	if _, err := ValidateOptions(jobType, data.JobOptions(`{"cards": [" "]}`)); err == nil {
+		t.Fatal("expected an empty card ID to be rejected")
+	}
+}
@@ -0,0 +1,39 @@
+package job
+
+import (
+	"context"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+)
+
+const (
+	// maxRetryBackoff caps the doubling delay between retries
+	maxRetryBackoff = 30 * time.Second
+)
+
+// Retry calls fn until it succeeds, the configured attempts per card are
+// used up or the context is cancelled. The delay doubles after every
+// failure. It returns the number of attempts and the last error.
+func Retry(ctx context.Context, cfgsvc config.IService, fn func() error) (int, error) {
+	attempts := cfgsvc.GetCardRetryAttempts()
+	backoff := cfgsvc.GetCardRetryBackoff()
+
+	for attempt := 1; ; attempt++ {
+		err := fn()
+		if err == nil || attempt >= attempts {
+			return attempt, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return attempt, err
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if backoff > maxRetryBackoff {
+			backoff = maxRetryBackoff
+		}
+	}
+}
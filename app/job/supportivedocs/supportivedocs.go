@@ -2,65 +2,114 @@ package jobsupportivedocs
 
 import (
 	"context"
+	"fmt"
 	"log/slog"
 	"time"
 
 	jobb "github.com/khaledhikmat/tr-extractor/job"
-	"github.com/khaledhikmat/tr-extractor/service/config"
 	"github.com/khaledhikmat/tr-extractor/service/data"
 	"github.com/khaledhikmat/tr-extractor/service/lgr"
-	"github.com/khaledhikmat/tr-extractor/service/storage"
 	"github.com/khaledhikmat/tr-extractor/service/trello"
 	"github.com/khaledhikmat/tr-extractor/utils"
 )
 
+func init() {
+	jobb.Register(jobb.Definition{
+		Type:        data.JobTypeSupportiveDocs,
+		Description: "Syncs the cards of the supportive docs board",
+		Concurrency: 1,
+		DryRun:      true,
+		MaxDuration: 30 * time.Minute,
+	}, Processor)
+}
+
 func Processor(ctx context.Context,
 	jobID int64,
-	pageSize int,
-	errorStream chan error,
-	cfgsvc config.IService,
-	datasvc data.IService,
-	trsvc trello.IService,
-	_ storage.IService) {
-
-	// Update job state to running
-	job, err := datasvc.RetrieveJobByID(jobID)
-	if err != nil {
-		errorStream <- err
-		return
-	}
-	job.State = data.JobStateRunning
-	err = datasvc.UpdateJob(&job)
+	options jobb.CardOptions,
+	deps jobb.Deps) {
+
+	// The queue already moved the job to running when it claimed it
+	job, err := deps.Data.RetrieveJobByID(jobID)
 	if err != nil {
-		errorStream <- err
+		deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
 		return
 	}
 
+	pageSize := options.PageSizeOf(job)
 	errors := 0
 	trprops := []trello.TRSupportiveDoc{}
 	finalState := data.JobStateCompleted
-	boardID := cfgsvc.GetTrelloSupportiveDocsBoardID()
+	outcomes := map[data.UpsertOutcome]int64{}
+	failed := 0
+	boardID := deps.Config.GetTrelloSupportiveDocsBoardID()
+	progress := jobb.NewProgress(jobID, deps.ErrorStream, deps.Config, deps.Data)
+	// A dry run compares the cards with the stored ones and writes nothing
+	var dryrun *jobb.DryRun
+	stored := map[string]data.SupportiveDoc{}
 
 	defer func() {
+		// Save the last progress before the final counts
+		progress.Flush()
+
+		if dryrun != nil {
+			job.Report = dryrun.Report()
+		}
+
 		// Update job state to completed
 		now := time.Now()
 		job.State = finalState
 		job.Cards = int64(len(trprops))
 		job.Errors = int64(errors)
+		job.Inserted = outcomes[data.UpsertInserted]
+		job.Updated = outcomes[data.UpsertUpdated]
+		job.Unchanged = outcomes[data.UpsertUnchanged]
+		job.Failed = int64(failed)
 		job.CompletedAt = &now
-		err = datasvc.UpdateJob(&job)
+		err = deps.Data.FinishJob(&job)
 		if err != nil {
-			errorStream <- err
+			deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
 			return
 		}
 	}()
 
+	if job.DryRun {
+		dryrun = jobb.NewDryRun()
+		items, err := jobb.RetrieveAll(func(page, pageSize int) ([]data.SupportiveDoc, error) {
+			return deps.Data.RetrieveSupportiveDocs(page, pageSize, "updated_at", "asc")
+		})
+		if err != nil {
+			deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityCritical, err)
+			errors++
+			finalState = data.JobStateFailed
+			return
+		}
+
+		for _, item := range items {
+			stored[item.CardID] = item
+			dryrun.Stored(item.CardID, item.Name)
+		}
+	}
+
 	// Retrieve supportive docs from Trello
-	trprops, err = trsvc.RetrieveSupportiveDocs(pageSize)
+	err = jobb.TraceFetch(ctx, func() error {
+		var err error
+		trprops, err = deps.Trello.RetrieveSupportiveDocs(pageSize, options.Filter())
+		return err
+	})
 	if err != nil {
-		errorStream <- err
+		deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassTrello, data.ErrorSeverityCritical, err)
 		errors++
+		// Without the board there is nothing to sync, and a pipeline must
+		// not go on with stale data
+		finalState = data.JobStateFailed
+		return
+	}
+
+	if dryrun != nil && !options.Targeted() {
+		// A targeted sync does not see the whole board so it cannot tell archivals
+		dryrun.Complete()
 	}
+	progress.Discovered(len(trprops))
 
 	// Insert/update inhconfs into the database
 	for _, trprop := range trprops {
@@ -73,6 +122,7 @@ func Processor(ctx context.Context,
 			return
 		default:
 		}
+		progress.Start(trprop.Name)
 
 		// If Trello's last activity date is zero, use the current time
 		updatedAt := time.Now()
@@ -103,34 +153,84 @@ func Processor(ctx context.Context,
 			UpdatedAt: updatedAt,
 		}
 
+		postfix := fmt.Sprintf("%s_%s", jobb.NormalizeString(trprop.Category), jobb.NormalizeString(trprop.Name))
+		if dryrun != nil {
+			item, isStored := stored[prop.CardID]
+			outcomes[dryrun.Card(prop.CardID, prop.Name, isStored, item.Diff(prop))]++
+			for _, tratt := range trprop.Attachments {
+				dryrun.Attachment(jobb.NewAttachment(data.EntityTypeSupportiveDocs, trprop.ID, postfix, tratt), item.Files)
+			}
+			progress.Done(false)
+			continue
+		}
+
 		// Insert or update the supportive doc into the database
-		_, _, err := datasvc.NewSupportiveDoc(prop)
+		var outcome data.UpsertOutcome
+		attempts, err := jobb.Retry(ctx, deps.Config, func() error {
+			return jobb.TraceUpsert(ctx, data.EntityTypeSupportiveDocs, prop.CardID, func() error {
+				var err error
+				outcome, _, err = deps.Data.NewSupportiveDoc(prop)
+				return err
+			})
+		})
 		if err != nil {
-			errorStream <- err
+			deps.ErrorStream <- jobb.CardError(jobID, data.EntityTypeSupportiveDocs, trprop.ID, data.ErrorClassDatabase, err)
 			errors++
+			failed++
+
+			// Keep the card so it can be replayed before the next run
+			err = jobb.SaveDeadLetter(deps.Data, jobID, data.EntityTypeSupportiveDocs, trprop.ID, "", data.DeadLetterOperationUpsert, prop, attempts, err)
+			if err != nil {
+				deps.ErrorStream <- jobb.CardError(jobID, data.EntityTypeSupportiveDocs, trprop.ID, data.ErrorClassDatabase, err)
+				errors++
+			}
+			progress.Done(true)
 			continue
 		}
+		outcomes[outcome]++
+
+		// A stale dead letter must not overwrite what was just stored
+		_, err = deps.Data.ResolveDeadLetters(data.EntityTypeSupportiveDocs, trprop.ID, data.DeadLetterOperationUpsert, "")
+		if err != nil {
+			deps.ErrorStream <- jobb.CardError(jobID, data.EntityTypeSupportiveDocs, trprop.ID, data.ErrorClassDatabase, err)
+			errors++
+		}
+
+		// Record the card attachments so the attachments job can mirror them
+		for _, tratt := range trprop.Attachments {
+			_, err = deps.Data.NewAttachment(jobb.NewAttachment(data.EntityTypeSupportiveDocs, trprop.ID, postfix, tratt))
+			if err != nil {
+				deps.ErrorStream <- jobb.CardError(jobID, data.EntityTypeSupportiveDocs, trprop.ID, data.ErrorClassDatabase, err)
+				errors++
+			}
+		}
+		progress.Done(false)
 	}
 
 	lgr.Logger.Debug("jobsupportivedocs.Processor",
 		slog.String("event", "done"),
 	)
 
+	// A dry run does not trigger the automations
+	if dryrun != nil {
+		return
+	}
+
 	// Notify the automation webhook to trigger
 	// lgr.Logger.Debug("supportivedocsconfs.Processor",
-	// 	slog.String("webhookUrl", cfgsvc.GetSupportiveDocsExcelUpdateWebhook()),
+	// 	slog.String("webhookUrl", deps.Config.GetSupportiveDocsExcelUpdateWebhook()),
 	// )
-	// err = jobb.PostToAutomationWebhook(cfgsvc.GetSupportiveDocsExcelUpdateWebhook())
+	// err = jobb.PostToAutomationWebhook(ctx, deps.Config.GetSupportiveDocsExcelUpdateWebhook())
 	// if err != nil {
-	// 	errorStream <- err
+	// 	deps.ErrorStream <- err
 	// }
 
 	// Notify the automation webhook to trigger
 	lgr.Logger.Debug("jobsupportivedocs.Processor",
-		slog.String("webhookUrl", cfgsvc.GetSupportiveDocsNotionUpdateWebhook()),
+		slog.String("webhookUrl", deps.Config.GetSupportiveDocsNotionUpdateWebhook()),
 	)
-	err = jobb.PostToAutomationWebhook(cfgsvc.GetSupportiveDocsNotionUpdateWebhook())
+	err = jobb.PostToAutomationWebhook(ctx, deps.Config.GetSupportiveDocsNotionUpdateWebhook())
 	if err != nil {
-		errorStream <- err
+		deps.ErrorStream <- jobb.JobError(jobID, data.ErrorClassWebhook, data.ErrorSeverityWarning, err)
 	}
 }
@@ -0,0 +1,164 @@
+package jobsupportivedocs
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/trello"
+)
+
+func TestProcessor(t *testing.T) {
+	tests := []struct {
+		name          string
+		cards         int
+		setup         func(datasvc *fake.DataService, trsvc *fake.TrelloService)
+		cancel        bool
+		webhookStatus int
+		wantState     data.JobState
+		wantCards     int64
+		wantErrors    int64
+		wantStored    int
+		wantHits      int64
+		wantStream    int
+	}{
+		{
+			name:          "completes and notifies",
+			cards:         3,
+			webhookStatus: http.StatusOK,
+			wantState:     data.JobStateCompleted,
+			wantCards:     3,
+			wantStored:    3,
+			wantHits:      1,
+		},
+		{
+			name:  "counts upsert errors",
+			cards: 3,
+			setup: func(datasvc *fake.DataService, _ *fake.TrelloService) {
+				datasvc.FailNth("NewSupportiveDoc", 2, errors.New("db down"))
+			},
+			webhookStatus: http.StatusOK,
+			wantState:     data.JobStateCompleted,
+			wantCards:     3,
+			wantErrors:    1,
+			wantStored:    2,
+			wantHits:      1,
+			wantStream:    1,
+		},
+		{
+			name:  "fails when the board cannot be fetched",
+			cards: 3,
+			setup: func(_ *fake.DataService, trsvc *fake.TrelloService) {
+				trsvc.FailAlways("RetrieveSupportiveDocs", errors.New("trello down"))
+			},
+			webhookStatus: http.StatusOK,
+			wantState:     data.JobStateFailed,
+			wantErrors:    1,
+			wantStream:    1,
+		},
+		{
+			name:          "stops when cancelled",
+			cards:         3,
+			cancel:        true,
+			webhookStatus: http.StatusOK,
+			wantState:     data.JobStateCancelled,
+			wantCards:     3,
+		},
+		{
+			name:          "reports webhook failures",
+			cards:         1,
+			webhookStatus: http.StatusInternalServerError,
+			wantState:     data.JobStateCompleted,
+			wantCards:     1,
+			wantStored:    1,
+			wantHits:      1,
+			wantStream:    1,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			webhook := fake.NewWebhook(tt.webhookStatus)
+			defer webhook.Close()
+
+			cfgsvc := fake.NewConfig(map[string]string{
+				"SUPPORTIVE_DOCS_NOTION_UPDATE_WEBHOOK": webhook.URL,
+			})
+			datasvc := fake.NewData(cfgsvc)
+			trsvc := fake.NewTrello()
+
+			for i := 0; i < tt.cards; i++ {
+				trsvc.AddSupportiveDocs(trello.TRSupportiveDoc{
+					ID:          string(rune('a' + i)),
+					Name:        "Deed",
+					Category:    "Deeds",
+					Attachments: []trello.TRAttachment{{ID: "att", Name: "deed.pdf", URL: "https://trello.com/1/cards/c/attachments/att/download/deed.pdf"}},
+				})
+			}
+
+			if tt.setup != nil {
+				tt.setup(datasvc, trsvc)
+			}
+
+			jobID, err := datasvc.NewJob(data.Job{Type: data.JobTypeSupportiveDocs, State: data.JobStateRunning, StartedAt: time.Now()})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				cancel()
+			}
+
+			errorStream := make(chan error, 10)
+			Processor(ctx, jobID, jobb.CardOptions{SyncOptions: jobb.SyncOptions{PageSize: 50}}, jobb.Deps{ErrorStream: errorStream, Config: cfgsvc, Data: datasvc, Trello: trsvc, Storage: fake.NewStorage()})
+			close(errorStream)
+
+			job, err := datasvc.RetrieveJobByID(jobID)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if job.State != tt.wantState || job.Cards != tt.wantCards || job.Errors != tt.wantErrors || job.CompletedAt == nil {
+				t.Errorf("job = %+v, want %s with %d cards and %d errors", job, tt.wantState, tt.wantCards, tt.wantErrors)
+			}
+
+			stored := datasvc.SupportiveDocs()
+			if len(stored) != tt.wantStored {
+				t.Fatalf("stored = %d, want %d", len(stored), tt.wantStored)
+			}
+
+			// The card fields and attachments are stored with the supportive doc
+			for _, doc := range stored {
+				if doc.Category != "Deeds" || len(doc.Attachments) != 1 {
+					t.Errorf("stored supportive doc = %+v", doc)
+				}
+			}
+			if recorded := len(datasvc.Attachments()); recorded != tt.wantStored {
+				t.Errorf("recorded attachments = %d, want %d", recorded, tt.wantStored)
+			}
+
+			if hits := webhook.Hits(); hits != tt.wantHits {
+				t.Errorf("webhook hits = %d, want %d", hits, tt.wantHits)
+			}
+
+			if streamed := len(errorStream); streamed != tt.wantStream {
+				t.Errorf("streamed errors = %d, want %d", streamed, tt.wantStream)
+			}
+
+			// Streamed errors must be linked to the job
+			for err := range errorStream {
+				record := jobb.ErrorRecord("test", err)
+				if record.JobID == nil || *record.JobID != jobID || record.Class == data.ErrorClassInternal || record.Stack == "" {
+					t.Errorf("unexpected error record %+v", record)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,230 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/mdobak/go-xerrors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	"go.opentelemetry.io/otel/metric"
+	"go.opentelemetry.io/otel/trace"
+
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+var (
+	tracer = otel.Tracer(fmt.Sprintf("tr.extractor.%s.job", os.Getenv("APP_NAME")))
+	meter  = otel.Meter(fmt.Sprintf("tr.extractor.%s.job", os.Getenv("APP_NAME")))
+
+	durationHistogram      metric.Float64Histogram
+	cardsCounter           metric.Int64Counter
+	errorsCounter          metric.Int64Counter
+	trelloLatencyHistogram metric.Float64Histogram
+	uploadBytesCounter     metric.Int64Counter
+)
+
+func init() {
+	prefix := fmt.Sprintf("tr.extractor.%s.job", os.Getenv("APP_NAME"))
+
+	var err error
+	durationHistogram, err = meter.Float64Histogram(prefix+".duration",
+		metric.WithDescription("The duration of a job run"),
+		metric.WithUnit("s"),
+	)
+	logInstrumentError("creating histogram", err)
+
+	cardsCounter, err = meter.Int64Counter(prefix+".cards",
+		metric.WithDescription("The number of cards processed by jobs"),
+		metric.WithUnit("1"),
+	)
+	logInstrumentError("creating counter", err)
+
+	errorsCounter, err = meter.Int64Counter(prefix+".errors",
+		metric.WithDescription("The number of job errors by class"),
+		metric.WithUnit("1"),
+	)
+	logInstrumentError("creating counter", err)
+
+	trelloLatencyHistogram, err = meter.Float64Histogram(prefix+".trello.latency",
+		metric.WithDescription("The latency of the Trello requests made by jobs"),
+		metric.WithUnit("s"),
+	)
+	logInstrumentError("creating histogram", err)
+
+	uploadBytesCounter, err = meter.Int64Counter(prefix+".upload.bytes",
+		metric.WithDescription("The number of bytes uploaded to storage by jobs"),
+		metric.WithUnit("By"),
+	)
+	logInstrumentError("creating counter", err)
+}
+
+func logInstrumentError(msg string, err error) {
+	if err != nil {
+		lgr.Logger.Error(
+			msg,
+			slog.Any("error", xerrors.New(err.Error())),
+		)
+	}
+}
+
+type jobTypeKey struct{}
+
+// withJobType labels the telemetry recorded under the context with the job type
+func withJobType(ctx context.Context, jobType data.JobType) context.Context {
+	return context.WithValue(ctx, jobTypeKey{}, jobType)
+}
+
+func jobTypeAttr(ctx context.Context) attribute.KeyValue {
+	jobType, _ := ctx.Value(jobTypeKey{}).(data.JobType)
+	return attribute.String("job.type", string(jobType))
+}
+
+// startRun starts the root span of a job run. Runs are not part of the trace
+// of whoever enqueued them since they may run much later on another replica.
+func startRun(ctx context.Context, job data.Job) (context.Context, trace.Span) {
+	ctx = withJobType(ctx, job.Type)
+	return tracer.Start(ctx, "job.run",
+		trace.WithNewRoot(),
+		trace.WithSpanKind(trace.SpanKindConsumer),
+		trace.WithAttributes(
+			jobTypeAttr(ctx),
+			attribute.Int64("job.id", job.ID),
+			attribute.Int("job.attempt", job.Attempts),
+			attribute.Bool("job.dry_run", job.DryRun),
+		),
+	)
+}
+
+// endRun records the outcome of a job run and ends its root span
+func endRun(ctx context.Context, span trace.Span, job data.Job, started time.Time) {
+	attrs := metric.WithAttributes(jobTypeAttr(ctx), attribute.String("job.state", string(job.State)))
+	durationHistogram.Record(ctx, time.Since(started).Seconds(), attrs)
+	cardsCounter.Add(ctx, job.Processed, metric.WithAttributes(jobTypeAttr(ctx)))
+
+	span.SetAttributes(
+		attribute.String("job.state", string(job.State)),
+		attribute.Int64("job.cards", job.Cards),
+		attribute.Int64("job.processed", job.Processed),
+		attribute.Int64("job.errors", job.Errors),
+	)
+	if job.State == data.JobStateFailed || job.State == data.JobStateTimedOut {
+		span.SetStatus(codes.Error, "job "+string(job.State))
+	}
+	span.End()
+}
+
+// countErrors returns an error stream that counts the errors of a job run by
+// class before passing them on. Call the returned function once the run is
+// over to drain it.
+func countErrors(ctx context.Context, errorStream chan error) (chan error, func()) {
+	errs := make(chan error)
+	done := make(chan struct{})
+
+	go func() {
+		defer close(done)
+		for err := range errs {
+			class, severity := data.ErrorClassInternal, data.ErrorSeverityError
+			var jobErr *Error
+			if errors.As(err, &jobErr) {
+				class, severity = jobErr.Class, jobErr.Severity
+			}
+
+			errorsCounter.Add(ctx, 1, metric.WithAttributes(
+				jobTypeAttr(ctx),
+				attribute.String("error.class", string(class)),
+				attribute.String("error.severity", string(severity)),
+			))
+			trace.SpanFromContext(ctx).AddEvent("error", trace.WithAttributes(
+				attribute.String("error.class", string(class)),
+				attribute.String("error.message", err.Error()),
+			))
+			errorStream <- err
+		}
+	}()
+
+	return errs, func() {
+		close(errs)
+		<-done
+	}
+}
+
+// operation is a child span of the job run for a card fetch, a database
+// upsert or a storage upload. Card operations are watched for timeouts.
+type operation struct {
+	name    string
+	card    bool
+	started time.Time
+	// active is when the operation last made progress. It is guarded by
+	// the watchdog.
+	active time.Time
+	span   trace.Span
+	dog    *watchdog
+}
+
+// startOperation starts a child span of the job run. End it with end.
+func startOperation(ctx context.Context, name string, card bool, attrs ...attribute.KeyValue) (context.Context, *operation) {
+	ctx, span := tracer.Start(ctx, name, trace.WithAttributes(append(attrs, jobTypeAttr(ctx))...))
+	op := &operation{
+		name:    name,
+		card:    card,
+		started: time.Now(),
+		span:    span,
+		dog:     watchdogOf(ctx),
+	}
+	op.active = op.started
+	op.dog.begin(op)
+
+	return ctx, op
+}
+
+// touch tells the watchdog that a long operation, i.e. a transfer, is still
+// making progress so the card timeout starts over
+func (op *operation) touch() {
+	op.dog.touch(op)
+}
+
+// end marks the span as failed if err is not nil and ends it
+func (op *operation) end(err error) {
+	op.dog.end(op)
+	if err != nil {
+		op.span.RecordError(err)
+		op.span.SetStatus(codes.Error, err.Error())
+	}
+	op.span.End()
+}
+
+// TraceFetch runs the Trello request that fetches a whole board in a child
+// span and records its latency. It is bounded by the job duration only.
+func TraceFetch(ctx context.Context, fn func() error) error {
+	return traceTrello(ctx, "fetch", false, fn)
+}
+
+func traceTrello(ctx context.Context, operation string, card bool, fn func() error) error {
+	_, op := startOperation(ctx, "trello."+operation, card)
+	err := fn()
+	trelloLatencyHistogram.Record(ctx, time.Since(op.started).Seconds(), metric.WithAttributes(
+		jobTypeAttr(ctx),
+		attribute.String("trello.operation", operation),
+		attribute.Bool("error", err != nil),
+	))
+	op.end(err)
+	return err
+}
+
+// TraceUpsert runs a database upsert of a card in a child span
+func TraceUpsert(ctx context.Context, entityType data.EntityType, cardID string, fn func() error) error {
+	_, op := startOperation(ctx, "data.upsert", true,
+		attribute.String("entity.type", string(entityType)),
+		attribute.String("card.id", cardID),
+	)
+	err := fn()
+	op.end(err)
+	return err
+}
@@ -0,0 +1,99 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	sdkmetric "go.opentelemetry.io/otel/sdk/metric"
+	"go.opentelemetry.io/otel/sdk/metric/metricdata"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestTelemetry(t *testing.T) {
+	spans := tracetest.NewSpanRecorder()
+	otel.SetTracerProvider(sdktrace.NewTracerProvider(sdktrace.WithSpanProcessor(spans)))
+	reader := sdkmetric.NewManualReader()
+	otel.SetMeterProvider(sdkmetric.NewMeterProvider(sdkmetric.WithReader(reader)))
+
+	jobType := data.JobType("telemetry-test")
+	Register(Definition{Type: jobType}, func(ctx context.Context, jobID int64, _ NoOptions, deps Deps) {
+		_ = TraceFetch(ctx, func() error { return nil })
+		_ = TraceUpsert(ctx, data.EntityTypeProperties, "c1", func() error { return errors.New("boom") })
+		deps.ErrorStream <- CardError(jobID, data.EntityTypeProperties, "c1", data.ErrorClassDatabase, errors.New("boom"))
+
+		_ = deps.Data.UpdateJobProgress(jobID, data.JobProgress{Total: 2, Processed: 2, Failed: 1})
+		job, _ := deps.Data.RetrieveJobByID(jobID)
+		job.State = data.JobStateCompleted
+		_ = deps.Data.UpdateJob(&job)
+	})
+
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+	jobID, _ := datasvc.NewJob(data.Job{Type: jobType, State: data.JobStateRunning})
+	job, _ := datasvc.RetrieveJobByID(jobID)
+
+	errorStream := make(chan error, 1)
+	Processors()[jobType](context.Background(), job, Deps{ErrorStream: errorStream, Config: cfgsvc, Data: datasvc})
+	if len(errorStream) != 1 {
+		t.Fatalf("expected the error to be passed on, got %d", len(errorStream))
+	}
+
+	// The run is a root span and the requests are its children
+	ended := spans.Ended()
+	names := map[string]sdktrace.ReadOnlySpan{}
+	for _, span := range ended {
+		names[span.Name()] = span
+	}
+	run, ok := names["job.run"]
+	if !ok || run.Parent().IsValid() {
+		t.Fatalf("expected a root job.run span, got %d spans", len(ended))
+	}
+	for _, name := range []string{"trello.fetch", "data.upsert"} {
+		span, ok := names[name]
+		if !ok || span.Parent().SpanID() != run.SpanContext().SpanID() {
+			t.Fatalf("expected %s to be a child of the run", name)
+		}
+	}
+
+	var rm metricdata.ResourceMetrics
+	if err := reader.Collect(context.Background(), &rm); err != nil {
+		t.Fatal(err)
+	}
+
+	sums := map[string]int64{}
+	histograms := map[string]uint64{}
+	for _, sm := range rm.ScopeMetrics {
+		for _, m := range sm.Metrics {
+			switch d := m.Data.(type) {
+			case metricdata.Sum[int64]:
+				for _, dp := range d.DataPoints {
+					if v, _ := dp.Attributes.Value("job.type"); v.AsString() == string(jobType) {
+						sums[m.Name] += dp.Value
+					}
+				}
+			case metricdata.Histogram[float64]:
+				for _, dp := range d.DataPoints {
+					if v, _ := dp.Attributes.Value("job.type"); v.AsString() == string(jobType) {
+						histograms[m.Name] += dp.Count
+					}
+				}
+			}
+		}
+	}
+
+	prefix := fmt.Sprintf("tr.extractor.%s.job", os.Getenv("APP_NAME"))
+	if sums[prefix+".cards"] != 2 || sums[prefix+".errors"] != 1 {
+		t.Fatalf("unexpected counters %v", sums)
+	}
+	if histograms[prefix+".duration"] != 1 || histograms[prefix+".trello.latency"] != 1 {
+		t.Fatalf("unexpected histograms %v", histograms)
+	}
+}
@@ -5,31 +5,22 @@ import (
 	"fmt"
 	"net/http"
 	"strings"
+	"time"
+)
 
-	"github.com/khaledhikmat/tr-extractor/service/config"
-	"github.com/khaledhikmat/tr-extractor/service/data"
-	"github.com/khaledhikmat/tr-extractor/service/storage"
-	"github.com/khaledhikmat/tr-extractor/service/trello"
+const (
+	// webhookTimeout bounds the automation webhook calls
+	webhookTimeout = 30 * time.Second
 )
 
-// Signature of job processors
-type Processor func(ctx context.Context,
-	jobId int64,
-	pageSize int,
-	errorStream chan error,
-	cfgsvc config.IService,
-	datasvc data.IService,
-	trsvc trello.IService,
-	storagesvc storage.IService)
-
-func PostToAutomationWebhook(url string) error {
+func PostToAutomationWebhook(ctx context.Context, url string) error {
 	if url == "" {
 		return fmt.Errorf("postToAutomationWebhook - automation webhook URL is empty")
 	}
 
 	// Provide a dummy payload
 	payload := ""
-	req, err := http.NewRequest("POST", url, strings.NewReader(payload))
+	req, err := http.NewRequestWithContext(ctx, "POST", url, strings.NewReader(payload))
 	if err != nil {
 		return fmt.Errorf("postToAutomationWebhook - could not create request: %w", err)
 	}
@@ -38,7 +29,7 @@ func PostToAutomationWebhook(url string) error {
 	req.Header.Set("Content-Type", "text/plain")
 
 	// Execute the request
-	client := &http.Client{}
+	client := &http.Client{Timeout: webhookTimeout}
 	resp, err := client.Do(req)
 	if err != nil {
 		return fmt.Errorf("postToAutomationWebhook - request failed: %w", err)
@@ -0,0 +1,199 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"sync"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+const (
+	// DefaultMaxDuration is the limit of job types registered without one
+	DefaultMaxDuration = time.Hour
+
+	minWatchdogInterval = 10 * time.Millisecond
+	maxWatchdogInterval = 5 * time.Second
+)
+
+// ErrJobTimedOut is the cause of a job context cancelled by the watchdog
+var ErrJobTimedOut = errors.New("job timed out")
+
+// TimedOut tells whether the watchdog stopped the job of the context
+func TimedOut(ctx context.Context) bool {
+	return errors.Is(context.Cause(ctx), ErrJobTimedOut)
+}
+
+// watchdog cancels a job that runs past its maximum duration or whose card
+// operation runs past the card timeout. Card operations only observe the
+// context between cards so a hung Trello or storage call ends when its HTTP
+// timeout fires. The data service calls take no context and are bounded by
+// neither.
+type watchdog struct {
+	mutex       sync.Mutex
+	jobID       int64
+	cardTimeout time.Duration
+	cancel      context.CancelCauseFunc
+	errorStream chan error
+	operations  map[*operation]struct{}
+}
+
+type watchdogKey struct{}
+
+func watchdogOf(ctx context.Context) *watchdog {
+	dog, _ := ctx.Value(watchdogKey{}).(*watchdog)
+	return dog
+}
+
+// watch returns the job context guarded by a watchdog. Zero durations are
+// not enforced. Call the returned function once the job is over.
+func watch(ctx context.Context,
+	jobID int64,
+	maxDuration, cardTimeout time.Duration,
+	errorStream chan error) (context.Context, func()) {
+	stopTimeout := func() {}
+	if maxDuration > 0 {
+		ctx, stopTimeout = context.WithTimeoutCause(ctx, maxDuration,
+			fmt.Errorf("%w: it ran longer than %s", ErrJobTimedOut, maxDuration))
+	}
+
+	ctx, cancel := context.WithCancelCause(ctx)
+	dog := &watchdog{
+		jobID:       jobID,
+		cardTimeout: cardTimeout,
+		cancel:      cancel,
+		errorStream: errorStream,
+		operations:  map[*operation]struct{}{},
+	}
+	ctx = context.WithValue(ctx, watchdogKey{}, dog)
+
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		dog.run(ctx, done)
+	}()
+
+	return ctx, func() {
+		close(done)
+		wg.Wait()
+		cancel(nil)
+		stopTimeout()
+	}
+}
+
+func (w *watchdog) run(ctx context.Context, done chan struct{}) {
+	var tick <-chan time.Time
+	if w.cardTimeout > 0 {
+		interval := min(max(w.cardTimeout/4, minWatchdogInterval), maxWatchdogInterval)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-done:
+			return
+		case <-ctx.Done():
+			// The job ran past its maximum duration
+			if TimedOut(ctx) {
+				w.report(context.Cause(ctx), w.running())
+			}
+			return
+		case <-tick:
+		}
+
+		stuck := w.stuck()
+		if stuck == nil {
+			continue
+		}
+
+		err := fmt.Errorf("%w: %s ran longer than the %s card timeout", ErrJobTimedOut, stuck.name, w.cardTimeout)
+		w.report(err, stuck)
+		w.cancel(err)
+		return
+	}
+}
+
+// report logs the operation the job was stuck on and records the timeout
+func (w *watchdog) report(err error, op *operation) {
+	attrs := []any{
+		slog.String("event", "timedout"),
+		slog.Int64("job", w.jobID),
+		slog.String("cause", err.Error()),
+	}
+	if op != nil {
+		attrs = append(attrs,
+			slog.String("operation", op.name),
+			slog.Duration("elapsed", time.Since(op.started)),
+		)
+	}
+	lgr.Logger.Warn("job.watchdog", attrs...)
+
+	w.errorStream <- JobError(w.jobID, data.ErrorClassTimeout, data.ErrorSeverityError, err)
+}
+
+// stuck returns a card operation that made no progress for the card timeout
+func (w *watchdog) stuck() *operation {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	for op := range w.operations {
+		if op.card && time.Since(op.active) > w.cardTimeout {
+			return op
+		}
+	}
+
+	return nil
+}
+
+// running returns the oldest operation still running
+func (w *watchdog) running() *operation {
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+
+	var oldest *operation
+	for op := range w.operations {
+		if oldest == nil || op.started.Before(oldest.started) {
+			oldest = op
+		}
+	}
+
+	return oldest
+}
+
+func (w *watchdog) begin(op *operation) {
+	if w == nil {
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	w.operations[op] = struct{}{}
+}
+
+func (w *watchdog) touch(op *operation) {
+	if w == nil {
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	op.active = time.Now()
+}
+
+func (w *watchdog) end(op *operation) {
+	if w == nil {
+		return
+	}
+
+	w.mutex.Lock()
+	defer w.mutex.Unlock()
+	delete(w.operations, op)
+}
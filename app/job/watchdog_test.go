@@ -0,0 +1,138 @@
+package job
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestWatchdog(t *testing.T) {
+	tests := []struct {
+		name      string
+		config    map[string]string
+		hang      time.Duration
+		cancel    bool
+		wantState data.JobState
+		wantCause string
+	}{
+		{
+			name:      "stuck card operation",
+			config:    map[string]string{"CARD_TIMEOUT": "20ms"},
+			hang:      200 * time.Millisecond,
+			wantState: data.JobStateTimedOut,
+			wantCause: "data.upsert ran longer than the 20ms card timeout",
+		},
+		{
+			name:      "max duration",
+			config:    map[string]string{"JOB_MAX_DURATION_WATCHDOG-MAX-DURATION": "50ms"},
+			wantState: data.JobStateTimedOut,
+			wantCause: "it ran longer than 50ms",
+		},
+		{
+			name:      "cancelled",
+			cancel:    true,
+			wantState: data.JobStateCancelled,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			jobType := data.JobType("watchdog-" + strings.ReplaceAll(tt.name, " ", "-"))
+			Register(Definition{Type: jobType}, func(ctx context.Context, jobID int64, _ NoOptions, deps Deps) {
+				job, _ := deps.Data.RetrieveJobByID(jobID)
+				defer func() {
+					job.State = data.JobStateCancelled
+					_ = deps.Data.UpdateJob(&job)
+				}()
+
+				// The first card goes through, the second one hangs
+				_ = TraceUpsert(ctx, data.EntityTypeProperties, "c1", func() error { return nil })
+				_ = deps.Data.UpdateJobProgress(jobID, data.JobProgress{Total: 3, Processed: 1})
+				_ = TraceUpsert(ctx, data.EntityTypeProperties, "c2", func() error {
+					time.Sleep(tt.hang)
+					return nil
+				})
+
+				select {
+				case <-ctx.Done():
+				case <-time.After(5 * time.Second):
+					t.Error("expected the job to be stopped")
+				}
+			})
+
+			cfgsvc := fake.NewConfig(tt.config)
+			datasvc := fake.NewData(cfgsvc)
+			jobID, _ := datasvc.NewJob(data.Job{Type: jobType, State: data.JobStateRunning})
+			job, _ := datasvc.RetrieveJobByID(jobID)
+
+			ctx, cancel := context.WithCancel(context.Background())
+			defer cancel()
+			if tt.cancel {
+				go func() {
+					time.Sleep(20 * time.Millisecond)
+					cancel()
+				}()
+			}
+
+			errorStream := make(chan error, 10)
+			Processors()[jobType](ctx, job, Deps{ErrorStream: errorStream, Config: cfgsvc, Data: datasvc})
+
+			job, _ = datasvc.RetrieveJobByID(jobID)
+			if job.State != tt.wantState || job.Processed != 1 {
+				t.Fatalf("expected a %s job with its counts, got %+v", tt.wantState, job)
+			}
+
+			if tt.wantCause == "" {
+				if len(errorStream) != 0 {
+					t.Fatalf("unexpected error %v", <-errorStream)
+				}
+				return
+			}
+
+			if len(errorStream) != 1 {
+				t.Fatalf("expected the timeout to be reported once, got %d errors", len(errorStream))
+			}
+			err := <-errorStream
+			var jobErr *Error
+			if !errors.As(err, &jobErr) || jobErr.Class != data.ErrorClassTimeout || !errors.Is(err, ErrJobTimedOut) || !strings.Contains(err.Error(), tt.wantCause) {
+				t.Fatalf("unexpected timeout error %v", err)
+			}
+		})
+	}
+}
+
+func TestWatchdogTransferProgress(t *testing.T) {
+	errorStream := make(chan error, 10)
+	ctx, stop := watch(context.Background(), 1, 0, 30*time.Millisecond, errorStream)
+
+	// A transfer that keeps making progress outlives the card timeout
+	_, op := startOperation(ctx, "storage.upload", true)
+	for i := 0; i < 10; i++ {
+		time.Sleep(10 * time.Millisecond)
+		op.touch()
+	}
+	op.end(nil)
+
+	if ctx.Err() != nil || len(errorStream) != 0 {
+		t.Fatalf("expected the transfer to go on, got %v", context.Cause(ctx))
+	}
+
+	// One that stalls does not
+	_, op = startOperation(ctx, "storage.upload", true)
+	select {
+	case <-ctx.Done():
+	case <-time.After(5 * time.Second):
+		t.Fatal("expected the stalled transfer to time out")
+	}
+	op.end(ctx.Err())
+	stop()
+
+	if !TimedOut(ctx) || len(errorStream) != 1 {
+		t.Fatalf("expected a timeout, got %v", context.Cause(ctx))
+	}
+}
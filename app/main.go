@@ -19,6 +19,8 @@ import (
 	"go.opentelemetry.io/otel/sdk/trace"
 	nooptrace "go.opentelemetry.io/otel/trace/noop"
 
+	"github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/queue"
 	"github.com/khaledhikmat/tr-extractor/server"
 	"github.com/khaledhikmat/tr-extractor/service/config"
 	"github.com/khaledhikmat/tr-extractor/service/data"
@@ -61,13 +63,9 @@ func main() {
 		}
 	}
 
-	// Create Services
 	configSvc := config.New()
-	dataSvc := data.New(configSvc)
-	trelloSvc := trello.New(configSvc)
-	storageSvc := storage.NewS3(canxCtx, configSvc)
 
-	// Setup OpenTelemetry
+	// Setup OpenTelemetry before the services so they can register instruments
 	shutdown, err := setupOpenTelemetry(rootCtx, configSvc)
 	if err != nil {
 		lgr.Logger.Error(
@@ -86,10 +84,45 @@ func main() {
 		}
 	}()
 
+	// Create Services
+	// The database is connected and pinged at startup (with retries)
+	var dataSvc data.IService
+	if configSvc.GetDbDriver() == "sqlite" {
+		dataSvc, err = data.NewSQLite(canxCtx, configSvc)
+	} else {
+		dataSvc, err = data.New(canxCtx, configSvc)
+	}
+	if err != nil {
+		lgr.Logger.Error(
+			"connecting to database",
+			slog.Any("error", xerrors.New(err.Error())),
+		)
+		return
+	}
+	// Close the pool once the shutdown waiting period is over
+	defer dataSvc.Finalize()
+
+	trelloSvc := trello.New(configSvc)
+	storageSvc, err := storage.New(canxCtx, configSvc)
+	if err != nil {
+		lgr.Logger.Error(
+			"creating storage",
+			slog.String("backend", configSvc.GetStorageBackend()),
+			slog.Any("error", xerrors.New(err.Error())),
+		)
+		return
+	}
+
 	// Create an error stream
 	errorStream := make(chan error)
 	defer close(errorStream)
 
+	// Run the job queue workers
+	go queue.Run(canxCtx, errorStream, configSvc, dataSvc, trelloSvc, storageSvc)
+
+	// Enqueue the scheduled jobs
+	go queue.Schedule(canxCtx, errorStream, configSvc, dataSvc)
+
 	// Run the http server
 	go func() {
 		err = server.Run(canxCtx, errorStream, configSvc, dataSvc, trelloSvc, storageSvc)
@@ -107,7 +140,7 @@ func main() {
 			goto resume
 		case e := <-errorStream:
 			// Add error table to the database
-			err := dataSvc.NewError("main", e.Error())
+			err := dataSvc.NewError(job.ErrorRecord("main", e))
 			if err != nil {
 				lgr.Logger.Error(
 					"error saving error to database",
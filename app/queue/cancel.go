@@ -0,0 +1,38 @@
+package queue
+
+import (
+	"context"
+	"sync"
+)
+
+var (
+	activeMutex sync.Mutex
+	active      = map[int64]context.CancelFunc{}
+)
+
+func track(jobID int64, cancel context.CancelFunc) {
+	activeMutex.Lock()
+	defer activeMutex.Unlock()
+	active[jobID] = cancel
+}
+
+func untrack(jobID int64) {
+	activeMutex.Lock()
+	defer activeMutex.Unlock()
+	delete(active, jobID)
+}
+
+// Cancel stops a job right away if it runs on this replica. Jobs running
+// elsewhere stop at their next heartbeat once they find the `cancelling` state.
+// It returns whether the job was running here.
+func Cancel(jobID int64) bool {
+	activeMutex.Lock()
+	defer activeMutex.Unlock()
+
+	cancel, ok := active[jobID]
+	if ok {
+		cancel()
+	}
+
+	return ok
+}
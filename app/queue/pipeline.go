@@ -0,0 +1,303 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"time"
+
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+var (
+	// ErrPipelineNotFound is returned when starting a pipeline that is not defined
+	ErrPipelineNotFound = errors.New("pipeline is not defined")
+	// ErrPipelineRunning is returned when starting a pipeline that has a run in progress
+	ErrPipelineRunning = data.ErrPipelineRunning
+)
+
+// Step runs a job of its type once the steps it depends on finished.
+// OnFailure tells what happens to the rest of the pipeline if it fails.
+type Step struct {
+	JobType   data.JobType       `json:"jobType"`
+	DependsOn []data.JobType     `json:"dependsOn"`
+	OnFailure data.FailurePolicy `json:"onFailure"`
+}
+
+// Pipeline is a set of steps. Steps without dependencies start together.
+type Pipeline struct {
+	Description string `json:"description"`
+	Steps       []Step `json:"steps"`
+}
+
+// Pipelines maps each pipeline name to its definition
+var Pipelines = map[string]Pipeline{
+	"daily": {
+		Description: "Sync the boards, mirror their attachments and notify the automation",
+		Steps: []Step{
+			{JobType: data.JobTypeProperties, OnFailure: data.FailurePolicyStop},
+			{JobType: data.JobTypeInheitanceConfinments, OnFailure: data.FailurePolicyStop},
+			{JobType: data.JobTypeSupportiveDocs, OnFailure: data.FailurePolicyStop},
+			{
+				JobType:   data.JobTypeAttachments,
+				DependsOn: []data.JobType{data.JobTypeProperties, data.JobTypeInheitanceConfinments, data.JobTypeSupportiveDocs},
+				OnFailure: data.FailurePolicyContinue,
+			},
+			{
+				JobType:   data.JobTypeNotify,
+				DependsOn: []data.JobType{data.JobTypeAttachments},
+				OnFailure: data.FailurePolicyStop,
+			},
+		},
+	},
+}
+
+// StartPipeline records a pipeline run. Its steps are enqueued as their
+// dependencies finish. If the pipeline is already running, the ID of the
+// run in progress is returned with ErrPipelineRunning.
+func StartPipeline(name, triggeredBy string, datasvc data.IService) (int64, error) {
+	pipeline, ok := Pipelines[name]
+	if !ok {
+		return -1, ErrPipelineNotFound
+	}
+
+	err := validatePipeline(pipeline)
+	if err != nil {
+		return -1, fmt.Errorf("pipeline %s is invalid: %w", name, err)
+	}
+
+	run := data.PipelineRun{
+		Pipeline:    name,
+		State:       data.PipelineStateRunning,
+		TriggeredBy: triggeredBy,
+		StartedAt:   time.Now(),
+	}
+	for _, step := range pipeline.Steps {
+		run.Steps = append(run.Steps, data.PipelineStep{
+			JobType:   step.JobType,
+			DependsOn: append(data.JobTypes{}, step.DependsOn...),
+			OnFailure: step.OnFailure,
+			State:     data.StepStatePending,
+		})
+	}
+
+	id, err := datasvc.NewPipelineRun(run)
+	if errors.Is(err, data.ErrPipelineRunning) {
+		return id, ErrPipelineRunning
+	}
+	if err != nil {
+		return -1, fmt.Errorf("new pipeline run produced %s", err.Error())
+	}
+
+	return id, nil
+}
+
+// validatePipeline makes sure every step has a processor and only depends
+// on steps listed before it, which also rules out cycles
+func validatePipeline(pipeline Pipeline) error {
+	if len(pipeline.Steps) == 0 {
+		return errors.New("it has no steps")
+	}
+
+	seen := map[data.JobType]bool{}
+	for _, step := range pipeline.Steps {
+		if _, ok := jobb.Lookup(step.JobType); !ok {
+			return fmt.Errorf("job type %s does not have a processor", step.JobType)
+		}
+
+		if seen[step.JobType] {
+			return fmt.Errorf("job type %s is listed twice", step.JobType)
+		}
+
+		if step.OnFailure != data.FailurePolicyStop && step.OnFailure != data.FailurePolicyContinue {
+			return fmt.Errorf("job type %s has an invalid failure policy %s", step.JobType, step.OnFailure)
+		}
+
+		for _, dep := range step.DependsOn {
+			if !seen[dep] {
+				return fmt.Errorf("job type %s depends on %s which is not listed before it", step.JobType, dep)
+			}
+		}
+
+		seen[step.JobType] = true
+	}
+
+	return nil
+}
+
+// advance moves the running pipelines forward on every poll until the
+// context is cancelled. Every replica runs it. A step is only enqueued
+// by the replica that moves it out of pending.
+func advance(ctx context.Context,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService) {
+	ticker := time.NewTicker(cfgsvc.GetQueuePollInterval())
+	defer ticker.Stop()
+
+	for {
+		advancePipelines(errorStream, datasvc)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func advancePipelines(errorStream chan error, datasvc data.IService) {
+	// Only a few pipelines are defined so a single page holds the running ones
+	runs, err := datasvc.RetrievePipelineRuns(data.PipelineRunFilter{State: data.PipelineStateRunning}, 1, 100)
+	if err != nil {
+		errorStream <- fmt.Errorf("retrieving pipeline runs produced %w", err)
+		return
+	}
+
+	for _, run := range runs {
+		err = advancePipeline(run, datasvc)
+		if err != nil {
+			errorStream <- fmt.Errorf("advancing pipeline run %d produced %w", run.ID, err)
+		}
+	}
+}
+
+// advancePipeline records the steps whose job finished, enqueues the
+// steps whose dependencies finished and completes the run once every
+// step finished. A failed step with the stop policy skips the pending
+// steps and fails the run. Steps that are already running are left to finish.
+func advancePipeline(run data.PipelineRun, datasvc data.IService) error {
+	steps := map[data.JobType]*data.PipelineStep{}
+	for i := range run.Steps {
+		step := &run.Steps[i]
+		steps[step.JobType] = step
+
+		if step.State != data.StepStateRunning || step.JobID == nil {
+			continue
+		}
+
+		job, err := datasvc.RetrieveJobByID(*step.JobID)
+		if err != nil {
+			return err
+		}
+
+		if !job.State.Finished() {
+			continue
+		}
+
+		state := data.StepStateCompleted
+		if job.State != data.JobStateCompleted {
+			state = data.StepStateFailed
+		}
+
+		err = setStepState(run.ID, step, state, datasvc)
+		if err != nil {
+			return err
+		}
+	}
+
+	stopped := false
+	for _, step := range run.Steps {
+		if step.State == data.StepStateFailed && step.OnFailure == data.FailurePolicyStop {
+			stopped = true
+		}
+	}
+
+	for i := range run.Steps {
+		step := &run.Steps[i]
+		if step.State != data.StepStatePending {
+			continue
+		}
+
+		if stopped {
+			err := setStepState(run.ID, step, data.StepStateSkipped, datasvc)
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		ready := true
+		for _, dep := range step.DependsOn {
+			if s, ok := steps[dep]; ok && !s.State.Finished() {
+				ready = false
+			}
+		}
+		if !ready {
+			continue
+		}
+
+		// Wait for a job of the same type started outside the pipeline
+		isPending, err := datasvc.IsPendingJobsByType(step.JobType)
+		if err != nil {
+			return err
+		}
+		if isPending {
+			continue
+		}
+
+		id, started, err := datasvc.StartPipelineStep(run.ID, step.JobType, queued(data.Job{Type: step.JobType}, DefaultPageSize))
+		if err != nil {
+			return err
+		}
+
+		// Another replica started it
+		if !started {
+			continue
+		}
+
+		step.State = data.StepStateRunning
+		step.JobID = &id
+		lgr.Logger.Info("queue.advancePipeline",
+			slog.String("event", "started"),
+			slog.Int64("run", run.ID),
+			slog.String("step", string(step.JobType)),
+			slog.Int64("job", id),
+		)
+	}
+
+	for _, step := range run.Steps {
+		if !step.State.Finished() {
+			return nil
+		}
+	}
+
+	state := data.PipelineStateCompleted
+	if stopped {
+		state = data.PipelineStateFailed
+	}
+
+	finished, err := datasvc.FinishPipelineRun(run.ID, state)
+	if err != nil {
+		return err
+	}
+
+	if finished {
+		lgr.Logger.Info("queue.advancePipeline",
+			slog.String("event", string(state)),
+			slog.Int64("run", run.ID),
+			slog.String("pipeline", run.Pipeline),
+		)
+	}
+
+	return nil
+}
+
+// setStepState moves a step out of its current state. If another replica
+// moved it first, its new state is picked up at the next poll.
+func setStepState(runID int64, step *data.PipelineStep, state data.StepState, datasvc data.IService) error {
+	updated, err := datasvc.UpdatePipelineStep(runID, step.JobType, step.State, state)
+	if err != nil {
+		return err
+	}
+
+	if updated {
+		step.State = state
+	}
+
+	return nil
+}
@@ -0,0 +1,297 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+// recorder builds processors that finish their job in the given state and
+// records the order the job types ran in
+type recorder struct {
+	mutex sync.Mutex
+	order []data.JobType
+}
+
+func (r *recorder) processor(state data.JobState) jobb.Processor {
+	return func(_ context.Context, job data.Job, deps jobb.Deps) {
+		r.mutex.Lock()
+		r.order = append(r.order, job.Type)
+		r.mutex.Unlock()
+
+		now := time.Now()
+		job.State = state
+		job.CompletedAt = &now
+		_ = deps.Data.UpdateJob(&job)
+	}
+}
+
+func (r *recorder) ran() []data.JobType {
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+	return append([]data.JobType{}, r.order...)
+}
+
+func waitForRun(t *testing.T, datasvc data.IService, runID int64) data.PipelineRun {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		run, err := datasvc.RetrievePipelineRunByID(runID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if run.State != data.PipelineStateRunning {
+			return run
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("pipeline run %d never finished", runID)
+	return data.PipelineRun{}
+}
+
+func TestPipelinesAreValid(t *testing.T) {
+	for name, pipeline := range Pipelines {
+		if err := validatePipeline(pipeline); err != nil {
+			t.Errorf("pipeline %s: %v", name, err)
+		}
+	}
+}
+
+func TestValidatePipeline(t *testing.T) {
+	tests := []struct {
+		name  string
+		steps []Step
+	}{
+		{
+			name: "unknown job type",
+			steps: []Step{
+				{JobType: "unknown", OnFailure: data.FailurePolicyStop},
+			},
+		},
+		{
+			name: "dependency listed after the step",
+			steps: []Step{
+				{JobType: data.JobTypeAttachments, DependsOn: []data.JobType{data.JobTypeProperties}, OnFailure: data.FailurePolicyStop},
+				{JobType: data.JobTypeProperties, OnFailure: data.FailurePolicyStop},
+			},
+		},
+		{
+			name: "missing failure policy",
+			steps: []Step{
+				{JobType: data.JobTypeProperties},
+			},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePipeline(Pipeline{Steps: tt.steps}); err == nil {
+				t.Fatal("expected the pipeline to be invalid")
+			}
+		})
+	}
+}
+
+func TestPipelineRun(t *testing.T) {
+	tests := []struct {
+		name        string
+		failed      data.JobType
+		wantState   data.PipelineState
+		wantSkipped []data.JobType
+		wantRan     int
+	}{
+		{
+			name:      "runs the steps after their dependencies",
+			wantState: data.PipelineStateCompleted,
+			wantRan:   5,
+		},
+		{
+			name:        "stops when a step fails",
+			failed:      data.JobTypeProperties,
+			wantState:   data.PipelineStateFailed,
+			wantSkipped: []data.JobType{data.JobTypeAttachments, data.JobTypeNotify},
+			wantRan:     3,
+		},
+		{
+			name:      "continues past a step that may fail",
+			failed:    data.JobTypeAttachments,
+			wantState: data.PipelineStateCompleted,
+			wantRan:   5,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgsvc := fake.NewConfig(nil)
+			datasvc := fake.NewData(cfgsvc)
+
+			rec := &recorder{}
+			procs := map[data.JobType]jobb.Processor{}
+			for _, step := range Pipelines["daily"].Steps {
+				state := data.JobStateCompleted
+				if step.JobType == tt.failed {
+					state = data.JobStateFailed
+				}
+				procs[step.JobType] = rec.processor(state)
+			}
+
+			runID, err := StartPipeline("daily", "ops", datasvc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			stop := startQueue(procs, cfgsvc, datasvc)
+			run := waitForRun(t, datasvc, runID)
+			if errs := stop(); len(errs) != 0 {
+				t.Fatalf("unexpected errors %v", errs)
+			}
+
+			if run.State != tt.wantState || run.CompletedAt == nil {
+				t.Fatalf("expected the run to be %s, got %+v", tt.wantState, run)
+			}
+
+			ran := rec.ran()
+			if len(ran) != tt.wantRan {
+				t.Fatalf("expected %d steps to run, got %v", tt.wantRan, ran)
+			}
+
+			// The entity syncs run first, the attachments after them and the notification last
+			for i, jobType := range ran {
+				switch {
+				case i < 3 && (jobType == data.JobTypeAttachments || jobType == data.JobTypeNotify):
+					t.Fatalf("%s ran before its dependencies: %v", jobType, ran)
+				case i == 3 && jobType != data.JobTypeAttachments:
+					t.Fatalf("expected attachments to run fourth: %v", ran)
+				case i == 4 && jobType != data.JobTypeNotify:
+					t.Fatalf("expected notify to run last: %v", ran)
+				}
+			}
+
+			skipped := []data.JobType{}
+			for _, step := range run.Steps {
+				if step.State == data.StepStateSkipped {
+					skipped = append(skipped, step.JobType)
+					continue
+				}
+
+				if step.JobID == nil {
+					t.Fatalf("expected step %s to have a job", step.JobType)
+				}
+			}
+
+			if len(skipped) != len(tt.wantSkipped) {
+				t.Fatalf("expected %v to be skipped, got %v", tt.wantSkipped, skipped)
+			}
+			for i := range skipped {
+				if skipped[i] != tt.wantSkipped[i] {
+					t.Fatalf("expected %v to be skipped, got %v", tt.wantSkipped, skipped)
+				}
+			}
+		})
+	}
+}
+
+func TestStartPipeline(t *testing.T) {
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+
+	_, err := StartPipeline("weekly", "ops", datasvc)
+	if !errors.Is(err, ErrPipelineNotFound) {
+		t.Fatalf("expected an unknown pipeline, got %v", err)
+	}
+
+	first, err := StartPipeline("daily", "ops", datasvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	running, err := StartPipeline("daily", "ops", datasvc)
+	if !errors.Is(err, ErrPipelineRunning) || running != first {
+		t.Fatalf("expected run %d to be in progress, got %d and %v", first, running, err)
+	}
+}
+
+func TestStartPipelineConcurrently(t *testing.T) {
+	datasvc := fake.NewData(fake.NewConfig(nil))
+
+	// Two replicas start the pipeline at the same time
+	var wg sync.WaitGroup
+	errs := make(chan error, 5)
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := StartPipeline("daily", "ops", datasvc)
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	started := 0
+	for err := range errs {
+		if err == nil {
+			started++
+		} else if !errors.Is(err, ErrPipelineRunning) {
+			t.Fatal(err)
+		}
+	}
+
+	runs, _ := datasvc.RetrievePipelineRuns(data.PipelineRunFilter{Pipeline: "daily"}, 1, 10)
+	if started != 1 || len(runs) != 1 {
+		t.Fatalf("expected a single run, got %d started and %d runs", started, len(runs))
+	}
+}
+
+func TestAdvancePipelineWaitsForPendingJob(t *testing.T) {
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+
+	// A properties job submitted outside the pipeline is still running
+	outside, _ := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateRunning})
+
+	runID, err := StartPipeline("daily", "ops", datasvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	errorStream, errs := drain()
+	advancePipelines(errorStream, datasvc)
+
+	run, _ := datasvc.RetrievePipelineRunByID(runID)
+	for _, step := range run.Steps {
+		want := data.StepStatePending
+		if step.JobType == data.JobTypeInheitanceConfinments || step.JobType == data.JobTypeSupportiveDocs {
+			want = data.StepStateRunning
+		}
+
+		if step.State != want {
+			t.Fatalf("expected step %s to be %s, got %s", step.JobType, want, step.State)
+		}
+	}
+
+	// Once it finishes, the pipeline starts its own properties job
+	job, _ := datasvc.RetrieveJobByID(outside)
+	job.State = data.JobStateCompleted
+	_ = datasvc.UpdateJob(&job)
+	advancePipelines(errorStream, datasvc)
+
+	run, _ = datasvc.RetrievePipelineRunByID(runID)
+	if run.Steps[0].State != data.StepStateRunning || run.Steps[0].JobID == nil || *run.Steps[0].JobID == outside {
+		t.Fatalf("expected the pipeline to start its own job, got %+v", run.Steps[0])
+	}
+
+	if e := errs(); len(e) != 0 {
+		t.Fatalf("unexpected errors %v", e)
+	}
+}
@@ -0,0 +1,318 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log/slog"
+	"os"
+	"sync"
+	"time"
+
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	// The job packages register their job types
+	_ "github.com/khaledhikmat/tr-extractor/job/attachments"
+	_ "github.com/khaledhikmat/tr-extractor/job/deadletters"
+	_ "github.com/khaledhikmat/tr-extractor/job/inhconfs"
+	_ "github.com/khaledhikmat/tr-extractor/job/notify"
+	_ "github.com/khaledhikmat/tr-extractor/job/properties"
+	_ "github.com/khaledhikmat/tr-extractor/job/supportivedocs"
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+	"github.com/khaledhikmat/tr-extractor/service/storage"
+	"github.com/khaledhikmat/tr-extractor/service/trello"
+)
+
+const (
+	// DefaultPageSize is the Trello page size of jobs submitted without one
+	DefaultPageSize = 50
+)
+
+// Enqueue only records the job. One of the queue workers claims and runs it.
+func Enqueue(job data.Job,
+	pageSize int,
+	datasvc data.IService) (int64, error) {
+	// Validate the job type is registered and takes the options
+	def, ok := jobb.Lookup(job.Type)
+	if !ok {
+		return -1, fmt.Errorf("job type %s does not have a processor", job.Type)
+	}
+
+	if job.DryRun && !def.DryRun {
+		return -1, fmt.Errorf("job type %s does not support dry runs", job.Type)
+	}
+
+	options, err := jobb.ValidateOptions(job.Type, job.Options)
+	if err != nil {
+		return -1, fmt.Errorf("job type %s: %s", job.Type, err.Error())
+	}
+	job.Options = options
+
+	// The limit check and the insert are atomic across replicas
+	id, active, err := datasvc.AdmitJob(queued(job, pageSize), def.Concurrency)
+	if errors.Is(err, data.ErrJobLimitReached) {
+		return -1, &LimitError{
+			JobType: job.Type,
+			Limit:   def.Concurrency,
+			Active:  active,
+		}
+	}
+	if err != nil {
+		return -1, fmt.Errorf("new job produced %s", err.Error())
+	}
+
+	return id, nil
+}
+
+// LimitError is returned by Enqueue when the job type is at its concurrency
+// limit. Active is the latest queued or running job of the type.
+type LimitError struct {
+	JobType data.JobType
+	Limit   int
+	Active  data.Job
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("job type %s is at its limit of %d pending jobs: job %d is %s", e.JobType, e.Limit, e.Active.ID, e.Active.State)
+}
+
+func (e *LimitError) Unwrap() error {
+	return data.ErrJobLimitReached
+}
+
+// queued forces the initial state of a job about to be enqueued
+func queued(job data.Job, pageSize int) data.Job {
+	job.State = data.JobStateQueued
+	job.StartedAt = time.Now()
+	job.PageSize = pageSize
+	job.Attempts = 0
+	job.WorkerID = ""
+	job.HeartbeatAt = nil
+	job.Report = nil
+	return job
+}
+
+// Run starts the workers of every job type, the reaper and the pipelines and blocks
+// until the context is cancelled and all workers have exited.
+// Jobs are only enqueued in the database so any replica may run them.
+func Run(ctx context.Context,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService,
+	trsvc trello.IService,
+	storagesvc storage.IService) {
+	run(ctx, jobb.Processors(), errorStream, cfgsvc, datasvc, trsvc, storagesvc)
+}
+
+func run(ctx context.Context,
+	procs map[data.JobType]jobb.Processor,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService,
+	trsvc trello.IService,
+	storagesvc storage.IService) {
+	host, _ := os.Hostname()
+
+	var wg sync.WaitGroup
+	for jobType, proc := range procs {
+		for i := 0; i < cfgsvc.GetQueueWorkers(string(jobType)); i++ {
+			workerID := fmt.Sprintf("%s-%d/%s-%d", host, os.Getpid(), jobType, i)
+
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				work(ctx, jobType, workerID, proc, errorStream, cfgsvc, datasvc, trsvc, storagesvc)
+			}()
+		}
+	}
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		reap(ctx, errorStream, cfgsvc, datasvc)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		advance(ctx, errorStream, cfgsvc, datasvc)
+	}()
+
+	wg.Wait()
+}
+
+// work claims and runs jobs of a type until the context is cancelled.
+// It drains the queue before waiting for the next poll.
+func work(ctx context.Context,
+	jobType data.JobType,
+	workerID string,
+	proc jobb.Processor,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService,
+	trsvc trello.IService,
+	storagesvc storage.IService) {
+	ticker := time.NewTicker(cfgsvc.GetQueuePollInterval())
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			job, ok, err := datasvc.ClaimJob(jobType, workerID)
+			if err != nil {
+				errorStream <- fmt.Errorf("claiming %s job produced %w", jobType, err)
+				break
+			}
+
+			if !ok {
+				break
+			}
+
+			lgr.Logger.Info("queue.work",
+				slog.String("event", "claimed"),
+				slog.Int64("job", job.ID),
+				slog.String("worker", workerID),
+				slog.Int("attempt", job.Attempts),
+			)
+
+			// Each job gets its own context so it can be cancelled alone
+			jobCtx, cancel := context.WithCancel(ctx)
+			track(job.ID, cancel)
+			stop := heartbeat(jobCtx, job.ID, workerID, cancel, errorStream, cfgsvc, datasvc)
+			proc(jobCtx, job, jobb.Deps{
+				ErrorStream: errorStream,
+				Config:      cfgsvc,
+				Data:        datasvc,
+				Trello:      trsvc,
+				Storage:     storagesvc,
+			})
+			stop()
+			untrack(job.ID)
+			cancel()
+
+			if ctx.Err() != nil {
+				requeue(job.ID, errorStream, datasvc)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// heartbeat keeps the job claimed until the returned function is called.
+// It cancels the job once it finds it was asked to stop on another replica.
+func heartbeat(ctx context.Context,
+	jobID int64,
+	workerID string,
+	cancel context.CancelFunc,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService) func() {
+	done := make(chan struct{})
+	var wg sync.WaitGroup
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+
+		ticker := time.NewTicker(cfgsvc.GetJobHeartbeatInterval())
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-done:
+				return
+			case <-ticker.C:
+			}
+
+			state, err := datasvc.HeartbeatJob(jobID, workerID)
+			if errors.Is(err, data.ErrJobNotClaimed) {
+				// The reaper gave the job away. There is nothing left to keep alive.
+				// Stop it so it does not run twice along with the next attempt.
+				errorStream <- jobb.JobError(jobID, data.ErrorClassInternal, data.ErrorSeverityWarning,
+					fmt.Errorf("worker %s lost its claim on the job", workerID))
+				cancel()
+				return
+			}
+			if err != nil {
+				errorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityWarning, err)
+				continue
+			}
+
+			if state == data.JobStateCancelling {
+				cancel()
+				return
+			}
+		}
+	}()
+
+	return func() {
+		close(done)
+		wg.Wait()
+	}
+}
+
+// requeue puts a job interrupted by a shutdown back in the queue so the
+// next replica resumes it instead of leaving it cancelled
+func requeue(jobID int64, errorStream chan error, datasvc data.IService) {
+	job, err := datasvc.RetrieveJobByID(jobID)
+	if err != nil {
+		errorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityError, err)
+		return
+	}
+
+	// Jobs cancelled on purpose stay cancelled
+	if job.State != data.JobStateCancelled || job.CancelledBy != "" {
+		return
+	}
+
+	job.State = data.JobStateQueued
+	job.CompletedAt = nil
+	err = datasvc.UpdateJob(&job)
+	if err != nil {
+		errorStream <- jobb.JobError(jobID, data.ErrorClassDatabase, data.ErrorSeverityError, err)
+	}
+}
+
+// reap requeues or fails running jobs whose worker stopped sending
+// heartbeats (i.e. the container was killed mid-run)
+func reap(ctx context.Context,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService) {
+	ticker := time.NewTicker(cfgsvc.GetJobHeartbeatInterval())
+	defer ticker.Stop()
+
+	for {
+		jobs, err := datasvc.ReapStaleJobs(time.Now().Add(-cfgsvc.GetJobHeartbeatTimeout()), cfgsvc.GetJobMaxAttempts())
+		if err != nil {
+			errorStream <- fmt.Errorf("reaping stale jobs produced %w", err)
+		}
+
+		for _, job := range jobs {
+			if job.State == data.JobStateFailed {
+				errorStream <- jobb.JobError(job.ID, data.ErrorClassInternal, data.ErrorSeverityCritical,
+					fmt.Errorf("job was abandoned after %d attempts", job.Attempts))
+				continue
+			}
+
+			lgr.Logger.Info("queue.reap",
+				slog.String("event", "requeued"),
+				slog.Int64("job", job.ID),
+				slog.Int("attempts", job.Attempts),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,342 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+// complete is a processor that finishes its job right away
+func complete(_ context.Context, job data.Job, deps jobb.Deps) {
+	now := time.Now()
+	job.State = data.JobStateCompleted
+	job.CompletedAt = &now
+	_ = deps.Data.UpdateJob(&job)
+}
+
+// drain collects the errors sent on the stream until the returned function is called
+func drain() (chan error, func() []error) {
+	errorStream := make(chan error)
+	var errs []error
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		for err := range errorStream {
+			errs = append(errs, err)
+		}
+	}()
+
+	return errorStream, func() []error {
+		close(errorStream)
+		wg.Wait()
+		return errs
+	}
+}
+
+// startQueue runs the queue until the returned function is called and
+// collects everything sent on the error stream
+func startQueue(procs map[data.JobType]jobb.Processor, cfgsvc config.IService, datasvc data.IService) func() []error {
+	ctx, cancel := context.WithCancel(context.Background())
+	errorStream, errs := drain()
+
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		run(ctx, procs, errorStream, cfgsvc, datasvc, fake.NewTrello(), fake.NewStorage())
+	}()
+
+	return func() []error {
+		cancel()
+		<-done
+		return errs()
+	}
+}
+
+func waitForState(t *testing.T, datasvc data.IService, jobID int64, state data.JobState) data.Job {
+	t.Helper()
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		job, err := datasvc.RetrieveJobByID(jobID)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if job.State == state {
+			return job
+		}
+
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	t.Fatalf("job %d never reached %s", jobID, state)
+	return data.Job{}
+}
+
+func TestRunProcessesQueuedJobs(t *testing.T) {
+	cfgsvc := fake.NewConfig(map[string]string{
+		"QUEUE_WORKERS_PROPERTIES": "2",
+	})
+	datasvc := fake.NewData(cfgsvc)
+
+	ids := []int64{}
+	for _, jobType := range []data.JobType{data.JobTypeProperties, data.JobTypeProperties, data.JobTypeAttachments} {
+		id, _ := datasvc.NewJob(data.Job{Type: jobType, State: data.JobStateQueued, PageSize: 10})
+		ids = append(ids, id)
+	}
+
+	stop := startQueue(map[data.JobType]jobb.Processor{
+		data.JobTypeProperties:  complete,
+		data.JobTypeAttachments: complete,
+	}, cfgsvc, datasvc)
+
+	for _, id := range ids {
+		job := waitForState(t, datasvc, id, data.JobStateCompleted)
+		if job.Attempts != 1 || job.WorkerID == "" {
+			t.Fatalf("expected job %d to be claimed once, got %+v", id, job)
+		}
+	}
+
+	if errs := stop(); len(errs) != 0 {
+		t.Fatalf("unexpected errors %v", errs)
+	}
+}
+
+func TestEnqueue(t *testing.T) {
+	tests := []struct {
+		name    string
+		job     data.Job
+		wantErr bool
+	}{
+		{name: "unknown type", job: data.Job{Type: "unknown"}, wantErr: true},
+		{name: "options", job: data.Job{Type: data.JobTypeProperties, Options: data.JobOptions(`{"pageSize": 20}`)}},
+		{name: "unknown option", job: data.Job{Type: data.JobTypeProperties, Options: data.JobOptions(`{"size": 20}`)}, wantErr: true},
+		{name: "invalid option", job: data.Job{Type: data.JobTypeProperties, Options: data.JobOptions(`{"pageSize": 5000}`)}, wantErr: true},
+		{name: "dry run", job: data.Job{Type: data.JobTypeAttachments, DryRun: true}},
+		{name: "dry run not supported", job: data.Job{Type: data.JobTypeNotify, DryRun: true}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgsvc := fake.NewConfig(nil)
+			datasvc := fake.NewData(cfgsvc)
+
+			id, err := Enqueue(tt.job, DefaultPageSize, datasvc)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if err != nil {
+				return
+			}
+
+			job, _ := datasvc.RetrieveJobByID(id)
+			if job.State != data.JobStateQueued || job.PageSize != DefaultPageSize || len(job.Options) == 0 {
+				t.Fatalf("unexpected job %+v", job)
+			}
+
+			// The job type is at its concurrency limit
+			_, err = Enqueue(tt.job, DefaultPageSize, datasvc)
+			var limitErr *LimitError
+			if !errors.As(err, &limitErr) || limitErr.Active.ID != id {
+				t.Fatalf("expected the second job to be rejected in favor of %d, got %v", id, err)
+			}
+		})
+	}
+}
+
+func TestRunReapsStaleJobs(t *testing.T) {
+	cfgsvc := fake.NewConfig(map[string]string{
+		"JOB_HEARTBEAT_TIMEOUT": "1m",
+		"JOB_MAX_ATTEMPTS":      "2",
+	})
+	datasvc := fake.NewData(cfgsvc)
+
+	// Both jobs were claimed by a container that died an hour ago
+	stale := time.Now().Add(-time.Hour)
+	retried, _ := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateRunning, Attempts: 1, WorkerID: "gone", HeartbeatAt: &stale})
+	abandoned, _ := datasvc.NewJob(data.Job{Type: data.JobTypeAttachments, State: data.JobStateRunning, Attempts: 2, WorkerID: "gone", HeartbeatAt: &stale})
+
+	stop := startQueue(map[data.JobType]jobb.Processor{
+		data.JobTypeProperties: complete,
+	}, cfgsvc, datasvc)
+
+	job := waitForState(t, datasvc, retried, data.JobStateCompleted)
+	if job.Attempts != 2 {
+		t.Fatalf("expected the job to be retried once, got %d attempts", job.Attempts)
+	}
+
+	job = waitForState(t, datasvc, abandoned, data.JobStateFailed)
+	if job.CompletedAt == nil {
+		t.Fatal("expected the failed job to be completed")
+	}
+
+	errs := stop()
+	if len(errs) != 1 {
+		t.Fatalf("expected the failed job to be reported, got %v", errs)
+	}
+
+	if e, ok := errs[0].(*jobb.Error); !ok || e.JobID != abandoned || e.Severity != data.ErrorSeverityCritical {
+		t.Fatalf("unexpected error %#v", errs[0])
+	}
+}
+
+func TestRunRequeuesOnShutdown(t *testing.T) {
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+
+	id, _ := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateQueued})
+
+	// The processor runs until the queue is shut down, like a long sync
+	running := make(chan struct{})
+	stop := startQueue(map[data.JobType]jobb.Processor{
+		data.JobTypeProperties: func(ctx context.Context, job data.Job, _ jobb.Deps) {
+			close(running)
+			<-ctx.Done()
+			now := time.Now()
+			job.State = data.JobStateCancelled
+			job.CompletedAt = &now
+			_ = datasvc.UpdateJob(&job)
+		},
+	}, cfgsvc, datasvc)
+
+	<-running
+	stop()
+
+	job, err := datasvc.RetrieveJobByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.State != data.JobStateQueued || job.CompletedAt != nil {
+		t.Fatalf("expected the interrupted job to be queued again, got %+v", job)
+	}
+}
+
+func TestRunStopsJobOnLostClaim(t *testing.T) {
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+
+	id, _ := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateQueued})
+
+	// The first attempt runs until it is stopped. The next one completes.
+	running := make(chan struct{})
+	stopped := make(chan error, 1)
+	var runs atomic.Int32
+	stop := startQueue(map[data.JobType]jobb.Processor{
+		data.JobTypeProperties: func(ctx context.Context, job data.Job, deps jobb.Deps) {
+			if runs.Add(1) > 1 {
+				complete(ctx, job, deps)
+				return
+			}
+
+			close(running)
+			<-ctx.Done()
+			now := time.Now()
+			job.State = data.JobStateCancelled
+			job.CompletedAt = &now
+			stopped <- deps.Data.FinishJob(&job)
+		},
+	}, cfgsvc, datasvc)
+	defer stop()
+
+	<-running
+	// The reaper of another replica takes the job from the worker
+	if _, err := datasvc.ReapStaleJobs(time.Now().Add(time.Hour), 5); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case err := <-stopped:
+		if !errors.Is(err, data.ErrJobNotClaimed) {
+			t.Fatalf("expected the stale worker not to write the job, got %v", err)
+		}
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the job to be stopped once its claim was lost")
+	}
+
+	job := waitForState(t, datasvc, id, data.JobStateCompleted)
+	if job.Attempts != 2 {
+		t.Fatalf("expected the next attempt to complete, got %+v", job)
+	}
+}
+
+func TestRunCancelsJob(t *testing.T) {
+	tests := []struct {
+		name  string
+		local bool
+	}{
+		{
+			name:  "on this replica",
+			local: true,
+		},
+		{
+			name: "on another replica",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgsvc := fake.NewConfig(nil)
+			datasvc := fake.NewData(cfgsvc)
+
+			id, _ := datasvc.NewJob(data.Job{Type: data.JobTypeProperties, State: data.JobStateQueued})
+
+			// The processor handles one card every few milliseconds until it is cancelled
+			running := make(chan struct{})
+			stop := startQueue(map[data.JobType]jobb.Processor{
+				data.JobTypeProperties: func(ctx context.Context, job data.Job, _ jobb.Deps) {
+					var once sync.Once
+
+					for {
+						select {
+						case <-ctx.Done():
+							now := time.Now()
+							job.State = data.JobStateCancelled
+							job.CompletedAt = &now
+							_ = datasvc.UpdateJob(&job)
+							return
+						case <-time.After(time.Millisecond):
+							job.Cards++
+							once.Do(func() { close(running) })
+						}
+					}
+				},
+			}, cfgsvc, datasvc)
+			defer stop()
+
+			<-running
+			job, err := datasvc.CancelJob(id, "ops", "testing")
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if job.State != data.JobStateCancelling {
+				t.Fatalf("expected the job to be cancelling, got %s", job.State)
+			}
+
+			// Without a local cancel, the heartbeat finds the cancelling state
+			if tt.local && !Cancel(id) {
+				t.Fatal("expected the job to run on this replica")
+			}
+
+			job = waitForState(t, datasvc, id, data.JobStateCancelled)
+			if job.Cards == 0 || job.CancelledBy != "ops" {
+				t.Fatalf("expected partial counts and who cancelled, got %+v", job)
+			}
+
+			if Cancel(id) {
+				t.Fatal("expected the job to no longer be tracked")
+			}
+		})
+	}
+}
@@ -0,0 +1,209 @@
+package queue
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strings"
+	"time"
+	_ "time/tzdata" // The container image may not ship the zone database
+
+	"github.com/robfig/cron/v3"
+
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+const (
+	// A schedule found due later than this after its fire time (on top of the
+	// poll interval) was missed and follows the catch-up policy
+	misfireGrace = time.Minute
+)
+
+// Schedule enqueues jobs on the cron expressions configured per job type
+// until the context is cancelled. Every replica runs it but a schedule only
+// fires on the replica that advances it first.
+func Schedule(ctx context.Context,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService) {
+	ticker := time.NewTicker(cfgsvc.GetSchedulePollInterval())
+	defer ticker.Stop()
+
+	var crons map[data.JobType]cron.Schedule
+	for {
+		// A sync that fails, i.e. on a database blip at boot, is tried
+		// again on the next tick
+		if crons == nil {
+			var err error
+			crons, err = syncSchedules(time.Now(), errorStream, cfgsvc, datasvc)
+			if err != nil {
+				errorStream <- fmt.Errorf("syncing schedules produced %w", err)
+			} else if len(crons) == 0 {
+				return
+			}
+		}
+
+		if crons != nil {
+			fireSchedules(time.Now(), crons, errorStream, cfgsvc, datasvc)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// syncSchedules stores the configured schedules and removes the ones no
+// longer configured. The next fire time is only reset when a definition
+// changes so runs missed during downtime can still be detected.
+func syncSchedules(now time.Time,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService) (map[data.JobType]cron.Schedule, error) {
+	stored, err := datasvc.RetrieveSchedules()
+	if err != nil {
+		return nil, err
+	}
+
+	existing := map[data.JobType]data.Schedule{}
+	for _, schedule := range stored {
+		existing[schedule.JobType] = schedule
+	}
+
+	jobTypes := []data.JobType{}
+	for _, def := range jobb.Definitions() {
+		jobTypes = append(jobTypes, def.Type)
+	}
+
+	crons := map[data.JobType]cron.Schedule{}
+	for _, jobType := range jobTypes {
+		expr := strings.TrimSpace(cfgsvc.GetSchedule(string(jobType)))
+		current, ok := existing[jobType]
+		if expr == "" {
+			if ok {
+				err = datasvc.DeleteSchedule(jobType)
+				if err != nil {
+					return nil, err
+				}
+			}
+			continue
+		}
+
+		schedule, sched, err := parseSchedule(jobType, expr, cfgsvc)
+		if err != nil {
+			errorStream <- err
+			continue
+		}
+		crons[jobType] = sched
+
+		if ok && current.Cron == schedule.Cron && current.TimeZone == schedule.TimeZone && current.CatchUp == schedule.CatchUp {
+			continue
+		}
+
+		schedule.NextFireAt = sched.Next(now)
+		err = datasvc.SaveSchedule(schedule)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return crons, nil
+}
+
+// parseSchedule accepts standard 5-field expressions and descriptors such
+// as `@daily`. A `CRON_TZ=` prefix overrides the configured time zone.
+func parseSchedule(jobType data.JobType, expr string, cfgsvc config.IService) (data.Schedule, cron.Schedule, error) {
+	timeZone := cfgsvc.GetScheduleTimeZone()
+	if strings.HasPrefix(expr, "CRON_TZ=") {
+		prefix, rest, _ := strings.Cut(expr, " ")
+		timeZone = strings.TrimPrefix(prefix, "CRON_TZ=")
+		expr = strings.TrimSpace(rest)
+	}
+
+	_, err := time.LoadLocation(timeZone)
+	if err != nil {
+		return data.Schedule{}, nil, fmt.Errorf("schedule of %s has an invalid time zone %s: %w", jobType, timeZone, err)
+	}
+
+	sched, err := cron.ParseStandard("CRON_TZ=" + timeZone + " " + expr)
+	if err != nil {
+		return data.Schedule{}, nil, fmt.Errorf("schedule of %s has an invalid cron expression %s: %w", jobType, expr, err)
+	}
+
+	catchUp := data.CatchUpPolicy(cfgsvc.GetScheduleCatchUp())
+	if catchUp != data.CatchUpOnce && catchUp != data.CatchUpSkip {
+		return data.Schedule{}, nil, fmt.Errorf("schedule of %s has an invalid catch-up policy %s", jobType, catchUp)
+	}
+
+	return data.Schedule{
+		JobType:  jobType,
+		Cron:     expr,
+		TimeZone: timeZone,
+		CatchUp:  catchUp,
+	}, sched, nil
+}
+
+// fireSchedules enqueues a job for every due schedule this replica manages
+// to advance. A missed run is fired once or skipped per the catch-up policy.
+func fireSchedules(now time.Time,
+	crons map[data.JobType]cron.Schedule,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService) {
+	schedules, err := datasvc.RetrieveSchedules()
+	if err != nil {
+		errorStream <- fmt.Errorf("retrieving schedules produced %w", err)
+		return
+	}
+
+	for _, schedule := range schedules {
+		sched, ok := crons[schedule.JobType]
+		if !ok || schedule.NextFireAt.After(now) {
+			continue
+		}
+
+		missed := now.Sub(schedule.NextFireAt) > cfgsvc.GetSchedulePollInterval()+misfireGrace
+		var firedAt *time.Time
+		if !missed || schedule.CatchUp == data.CatchUpOnce {
+			firedAt = &now
+		}
+
+		advanced, err := datasvc.AdvanceSchedule(schedule.JobType, schedule.NextFireAt, sched.Next(now), firedAt)
+		if err != nil {
+			errorStream <- fmt.Errorf("advancing the %s schedule produced %w", schedule.JobType, err)
+			continue
+		}
+
+		// Another replica fired it
+		if !advanced {
+			continue
+		}
+
+		if firedAt == nil {
+			lgr.Logger.Info("queue.fireSchedules",
+				slog.String("event", "skipped"),
+				slog.String("type", string(schedule.JobType)),
+				slog.Time("due", schedule.NextFireAt),
+			)
+			continue
+		}
+
+		id, err := Enqueue(data.Job{Type: schedule.JobType}, DefaultPageSize, datasvc)
+		if err != nil {
+			errorStream <- fmt.Errorf("scheduled %s job produced %w", schedule.JobType, err)
+			continue
+		}
+
+		lgr.Logger.Info("queue.fireSchedules",
+			slog.String("event", "fired"),
+			slog.String("type", string(schedule.JobType)),
+			slog.Int64("job", id),
+			slog.Bool("catchUp", missed),
+		)
+	}
+}
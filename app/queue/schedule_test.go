@@ -0,0 +1,193 @@
+package queue
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/fake"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestScheduleFiresOnTime(t *testing.T) {
+	cfgsvc := fake.NewConfig(map[string]string{
+		"SCHEDULE_PROPERTIES": "0 7 * * *",
+		"SCHEDULE_TIMEZONE":   "Asia/Amman",
+	})
+	datasvc := fake.NewData(cfgsvc)
+	errorStream, errs := drain()
+
+	amman, _ := time.LoadLocation("Asia/Amman")
+	now := time.Date(2025, 3, 1, 6, 0, 0, 0, amman)
+	crons, err := syncSchedules(now, errorStream, cfgsvc, datasvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, _ := datasvc.RetrieveSchedules()
+	if len(schedules) != 1 || !schedules[0].NextFireAt.Equal(time.Date(2025, 3, 1, 7, 0, 0, 0, amman)) {
+		t.Fatalf("unexpected schedules %+v", schedules)
+	}
+
+	// Not due yet
+	fireSchedules(now.Add(59*time.Minute), crons, errorStream, cfgsvc, datasvc)
+	jobs, _ := datasvc.RetrieveJobs(data.JobFilter{}, 1, 10)
+	if len(jobs) != 0 {
+		t.Fatalf("expected no jobs before 7 AM, got %d", len(jobs))
+	}
+
+	// Two replicas see the schedule due at the same time
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			fireSchedules(now.Add(time.Hour+time.Second), crons, errorStream, cfgsvc, datasvc)
+		}()
+	}
+	wg.Wait()
+
+	jobs, _ = datasvc.RetrieveJobs(data.JobFilter{}, 1, 10)
+	if len(jobs) != 1 || jobs[0].Type != data.JobTypeProperties || jobs[0].PageSize != DefaultPageSize {
+		t.Fatalf("expected a single properties job, got %+v", jobs)
+	}
+
+	schedules, _ = datasvc.RetrieveSchedules()
+	if schedules[0].LastFiredAt == nil || !schedules[0].NextFireAt.Equal(time.Date(2025, 3, 2, 7, 0, 0, 0, amman)) {
+		t.Fatalf("expected the schedule to move to the next day, got %+v", schedules[0])
+	}
+
+	if e := errs(); len(e) != 0 {
+		t.Fatalf("unexpected errors %v", e)
+	}
+}
+
+func TestScheduleCatchUp(t *testing.T) {
+	tests := []struct {
+		name     string
+		catchUp  string
+		wantJobs int
+	}{
+		{
+			name:     "fires a missed run once",
+			catchUp:  "once",
+			wantJobs: 1,
+		},
+		{
+			name:     "skips missed runs",
+			catchUp:  "skip",
+			wantJobs: 0,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfgsvc := fake.NewConfig(map[string]string{
+				"SCHEDULE_ATTACHMENTS": "0 * * * *",
+				"SCHEDULE_CATCH_UP":    tt.catchUp,
+			})
+			datasvc := fake.NewData(cfgsvc)
+			errorStream, errs := drain()
+
+			now := time.Date(2025, 3, 1, 5, 30, 0, 0, time.UTC)
+			_, err := syncSchedules(now, errorStream, cfgsvc, datasvc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			// The replica comes back after several hourly runs were missed
+			restarted := now.Add(4 * time.Hour)
+			crons, err := syncSchedules(restarted, errorStream, cfgsvc, datasvc)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			fireSchedules(restarted, crons, errorStream, cfgsvc, datasvc)
+
+			jobs, _ := datasvc.RetrieveJobs(data.JobFilter{}, 1, 10)
+			if len(jobs) != tt.wantJobs {
+				t.Fatalf("expected %d jobs, got %d", tt.wantJobs, len(jobs))
+			}
+
+			schedules, _ := datasvc.RetrieveSchedules()
+			if !schedules[0].NextFireAt.Equal(time.Date(2025, 3, 1, 10, 0, 0, 0, time.UTC)) {
+				t.Fatalf("expected the schedule to resume at 10:00, got %s", schedules[0].NextFireAt)
+			}
+
+			if e := errs(); len(e) != 0 {
+				t.Fatalf("unexpected errors %v", e)
+			}
+		})
+	}
+}
+
+func TestSyncSchedules(t *testing.T) {
+	cfgsvc := fake.NewConfig(map[string]string{
+		"SCHEDULE_PROPERTIES":     "CRON_TZ=Asia/Amman 0 7 * * *",
+		"SCHEDULE_SUPPORTIVEDOCS": "not a cron",
+	})
+	datasvc := fake.NewData(cfgsvc)
+	_ = datasvc.SaveSchedule(data.Schedule{JobType: data.JobTypeAttachments, Cron: "0 6 * * *"})
+	errorStream, errs := drain()
+
+	crons, err := syncSchedules(time.Now(), errorStream, cfgsvc, datasvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(crons) != 1 {
+		t.Fatalf("expected only the properties schedule, got %v", crons)
+	}
+
+	schedules, _ := datasvc.RetrieveSchedules()
+	if len(schedules) != 1 || schedules[0].TimeZone != "Asia/Amman" || schedules[0].Cron != "0 7 * * *" {
+		t.Fatalf("expected the unconfigured schedule to be removed, got %+v", schedules)
+	}
+
+	if e := errs(); len(e) != 1 {
+		t.Fatalf("expected the invalid expression to be reported, got %v", e)
+	}
+}
+
+func TestScheduleRetriesFailedSync(t *testing.T) {
+	cfgsvc := fake.NewConfig(map[string]string{
+		"SCHEDULE_PROPERTIES": "0 7 * * *",
+	})
+	datasvc := fake.NewData(cfgsvc)
+	datasvc.FailNth("RetrieveSchedules", 1, errors.New("db down"))
+	errorStream := make(chan error, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		Schedule(ctx, errorStream, cfgsvc, datasvc)
+	}()
+
+	// Wait for the failed sync before reading the schedules
+	select {
+	case <-errorStream:
+	case <-time.After(2 * time.Second):
+		t.Fatal("expected the failed sync to be reported")
+	}
+
+	deadline := time.Now().Add(2 * time.Second)
+	for {
+		schedules, _ := datasvc.RetrieveSchedules()
+		if len(schedules) == 1 {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatal("expected the schedules to be synced on a later tick")
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	cancel()
+	<-done
+	if len(errorStream) != 0 {
+		t.Fatalf("unexpected errors %v", <-errorStream)
+	}
+}
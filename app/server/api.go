@@ -2,32 +2,34 @@ package server
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io"
 	"strconv"
 	"time"
 
 	"github.com/gin-gonic/gin"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
 	"github.com/khaledhikmat/tr-extractor/service/config"
 	"github.com/khaledhikmat/tr-extractor/service/data"
 	"github.com/khaledhikmat/tr-extractor/service/storage"
 	"github.com/khaledhikmat/tr-extractor/service/trello"
 
-	"github.com/khaledhikmat/tr-extractor/job"
-	jobattachments "github.com/khaledhikmat/tr-extractor/job/attachments"
-	jobinhconfs "github.com/khaledhikmat/tr-extractor/job/inhconfs"
-	jobprops "github.com/khaledhikmat/tr-extractor/job/properties"
-	jobdocs "github.com/khaledhikmat/tr-extractor/job/supportivedocs"
+	"github.com/khaledhikmat/tr-extractor/queue"
 )
 
 const (
 	version = "1.0.0"
+
+	// maxJobWait caps the `wait` of job requests
+	maxJobWait = 2 * time.Minute
+	// jobWaitPollInterval is how often a waiting request reads the job
+	jobWaitPollInterval = 500 * time.Millisecond
 )
 
-var jobProcs = map[data.JobType]job.Processor{
-	data.JobTypeProperties:            jobprops.Processor,
-	data.JobTypeAttachments:           jobattachments.Processor,
-	data.JobTypeInheitanceConfinments: jobinhconfs.Processor,
-	data.JobTypeSupportiveDocs:        jobdocs.Processor,
+type cancelRequest struct {
+	CancelledBy string `json:"cancelledBy"`
+	Reason      string `json:"reason"`
 }
 
 func apiRoutes(ctx context.Context,
@@ -36,7 +38,8 @@ func apiRoutes(ctx context.Context,
 	cfgsvc config.IService,
 	datasvc data.IService,
 	trsvc trello.IService,
-	storagesvc storage.IService) {
+	storagesvc storage.IService,
+	signer *downloadSigner) {
 
 	r.GET("/ping", func(c *gin.Context) {
 		c.JSON(200, gin.H{
@@ -44,25 +47,29 @@ func apiRoutes(ctx context.Context,
 		})
 	})
 
-	r.POST("/admins/reset", func(c *gin.Context) {
-		_ = isPermitted(c, datasvc)
-		if 1 == 1 {
-			c.JSON(403, gin.H{
-				"message": "Invalid or missing API key or not alllowed",
-			})
-			return
-		}
+	r.GET("/health", func(c *gin.Context) {
+		pingCtx, cancel := context.WithTimeout(c.Request.Context(), 2*time.Second)
+		defer cancel()
 
-		err := datasvc.ResetFactory()
+		status := 200
+		database := "up"
+		err := datasvc.Ping(pingCtx)
 		if err != nil {
-			c.JSON(400, gin.H{
-				"message": fmt.Sprintf("reset factory produced %s", err.Error()),
-			})
-			return
-		}
-
-		c.JSON(200, gin.H{
-			"data": nil,
+			status = 503
+			database = err.Error()
+		}
+
+		stats := datasvc.Stats()
+		c.JSON(status, gin.H{
+			"database": database,
+			"pool": gin.H{
+				"maxOpen":      stats.MaxOpenConnections,
+				"open":         stats.OpenConnections,
+				"inUse":        stats.InUse,
+				"idle":         stats.Idle,
+				"waitCount":    stats.WaitCount,
+				"waitDuration": stats.WaitDuration.String(),
+			},
 		})
 	})
 
@@ -104,6 +111,10 @@ func apiRoutes(ctx context.Context,
 			return
 		}
 
+		for i := range props {
+			withDownloadURLs(c, cfgsvc, signer, props[i].Files)
+		}
+
 		c.JSON(200, gin.H{
 			"data": props,
 		})
@@ -146,6 +157,10 @@ func apiRoutes(ctx context.Context,
 			return
 		}
 
+		for i := range props {
+			withDownloadURLs(c, cfgsvc, signer, props[i].Files)
+		}
+
 		c.JSON(200, gin.H{
 			"data": props,
 		})
@@ -188,6 +203,10 @@ func apiRoutes(ctx context.Context,
 			return
 		}
 
+		for i := range props {
+			withDownloadURLs(c, cfgsvc, signer, props[i].Files)
+		}
+
 		c.JSON(200, gin.H{
 			"data": props,
 		})
@@ -202,15 +221,70 @@ func apiRoutes(ctx context.Context,
 			return
 		}
 
+		// Without a job ID, list the jobs filtered by type, state and start date
 		jobID := c.Query("i")
 		if jobID == "" {
+			filter := data.JobFilter{
+				Type:  data.JobType(c.Query("type")),
+				State: data.JobState(c.Query("state")),
+			}
+
+			var err error
+			filter.From, err = queryTime(c, "from")
+			if err == nil {
+				filter.To, err = queryTime(c, "to")
+			}
+			if err != nil {
+				c.JSON(400, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			page, pageSize, err := queryPaging(c)
+			if err != nil {
+				c.JSON(400, gin.H{
+					"message": err.Error(),
+				})
+				return
+			}
+
+			jobs, err := datasvc.RetrieveJobs(filter, page, pageSize)
+			if err != nil {
+				c.JSON(400, gin.H{
+					"message": fmt.Sprintf("retrieve jobs produced %s", err.Error()),
+				})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"data": jobs,
+			})
+			return
+		}
+
+		id, e := strconv.ParseInt(jobID, 10, 64)
+		if e != nil {
 			c.JSON(400, gin.H{
-				"message": "job ID is required",
+				"message": "job ID could not be parsed",
 			})
 			return
 		}
 
-		id, e := strconv.Atoi(jobID)
+		jobResponse(c, datasvc, id)
+	})
+
+	// A single job. With `wait`, block until the job finishes or the wait is over.
+	r.GET("/jobs/:id", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		id, e := strconv.ParseInt(c.Param("id"), 10, 64)
 		if e != nil {
 			c.JSON(400, gin.H{
 				"message": "job ID could not be parsed",
@@ -218,16 +292,59 @@ func apiRoutes(ctx context.Context,
 			return
 		}
 
-		job, err := datasvc.RetrieveJobByID(int64(id))
+		jobResponse(c, datasvc, id)
+	})
+
+	r.GET("/jobs/stats", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		filter := data.JobFilter{
+			Type: data.JobType(c.Query("type")),
+		}
+
+		var err error
+		filter.From, err = queryTime(c, "from")
+		if err == nil {
+			filter.To, err = queryTime(c, "to")
+		}
 		if err != nil {
 			c.JSON(400, gin.H{
-				"message": fmt.Sprintf("retrieve job produced %s", err.Error()),
+				"message": err.Error(),
+			})
+			return
+		}
+
+		stats, err := datasvc.RetrieveJobStats(filter)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("retrieve job stats produced %s", err.Error()),
 			})
 			return
 		}
 
 		c.JSON(200, gin.H{
-			"data": job,
+			"data": stats,
+		})
+	})
+
+	// The registered job types with their option schemas and limits
+	r.GET("/jobs/types", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": jobb.Definitions(),
 		})
 	})
 
@@ -257,19 +374,113 @@ func apiRoutes(ctx context.Context,
 
 		pageSize, e := strconv.Atoi(c.Query("s"))
 		if e != nil {
-			pageSize = 50
+			pageSize = queue.DefaultPageSize
 		}
 
-		id, err := processJob(ctx, job, pageSize, true, errorStream, cfgsvc, datasvc, trsvc, storagesvc)
+		wait, err := queryWait(c)
 		if err != nil {
 			c.JSON(400, gin.H{
-				"message": fmt.Sprintf("process job produced %s", err.Error()),
+				"message": err.Error(),
 			})
 			return
 		}
 
+		id, err := queue.Enqueue(job, pageSize, datasvc)
+		var limitErr *queue.LimitError
+		if errors.As(err, &limitErr) {
+			// Point to the job the caller most likely meant to start
+			c.Header("Location", jobURL(limitErr.Active.ID))
+			c.JSON(409, gin.H{
+				"message": limitErr.Error(),
+				"data":    limitErr.Active,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("enqueue job produced %s", err.Error()),
+			})
+			return
+		}
+		c.Header("Location", jobURL(id))
+
+		if wait == 0 {
+			c.JSON(200, gin.H{
+				"data": id,
+			})
+			return
+		}
+
+		// Block until the job finishes. A job still going when the wait is
+		// over is returned with 202 so the caller polls its Location.
+		finished, err := waitForJob(c.Request.Context(), datasvc, id, wait)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("retrieve job produced %s", err.Error()),
+			})
+			return
+		}
+
+		status := 200
+		if !finished.State.Finished() {
+			status = 202
+		}
+		c.JSON(status, gin.H{
+			"data": finished,
+		})
+	})
+
+	// Cancel a queued job or ask a running job to stop at its next card
+	r.POST("/jobs/:id/cancel", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		id, e := strconv.ParseInt(c.Param("id"), 10, 64)
+		if e != nil {
+			c.JSON(400, gin.H{
+				"message": "job ID could not be parsed",
+			})
+			return
+		}
+
+		// The body is optional
+		var req cancelRequest
+		if err := c.ShouldBindJSON(&req); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("invalid cancel request: %s", err.Error()),
+			})
+			return
+		}
+
+		if req.CancelledBy == "" {
+			req.CancelledBy = maskAPIKey(c.GetHeader("api-key"))
+		}
+
+		job, err := datasvc.CancelJob(id, req.CancelledBy, req.Reason)
+		if errors.Is(err, data.ErrJobNotCancellable) {
+			c.JSON(409, gin.H{
+				"message": fmt.Sprintf("job %d is %s", id, job.State),
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("cancel job produced %s", err.Error()),
+			})
+			return
+		}
+
+		if job.State == data.JobStateCancelling {
+			queue.Cancel(id)
+		}
+
 		c.JSON(200, gin.H{
-			"data": id, // TODO: Return a status URL
+			"data": job,
 		})
 	})
 
@@ -290,8 +501,7 @@ func apiRoutes(ctx context.Context,
 			return
 		}
 
-		// Force an initial state
-		err := datasvc.NewError(thisError.Source, thisError.Body)
+		err := datasvc.NewError(thisError)
 		if err != nil {
 			c.JSON(400, gin.H{
 				"message": fmt.Sprintf("new error produced %s", err.Error()),
@@ -305,48 +515,84 @@ func apiRoutes(ctx context.Context,
 	})
 }
 
-func processJob(ctx context.Context,
-	job data.Job,
-	pageSize int,
-	async bool,
-	errorStream chan error,
-	cfgsvc config.IService,
-	datasvc data.IService,
-	trsvc trello.IService,
-	storagesvc storage.IService) (int64, error) {
-	fmt.Printf("Processing job %s\n", job.Type)
-	// Validate there is a processor for the job type
-	proc, ok := jobProcs[job.Type]
-	if !ok {
-		return -1, fmt.Errorf("job type %s does not have a processor", job.Type)
+// jobResponse writes the job, waiting for it to finish if the request has a `wait`
+func jobResponse(c *gin.Context, datasvc data.IService, id int64) {
+	wait, err := queryWait(c)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": err.Error(),
+		})
+		return
 	}
 
-	// Check to make sure there is no existing job for the same type and channel
-	isPending, err := datasvc.IsPendingJobsByType(job.Type)
+	job, err := waitForJob(c.Request.Context(), datasvc, id, wait)
 	if err != nil {
-		return -1, fmt.Errorf("is pending jobs by type and channel produced %s", err.Error())
+		c.JSON(400, gin.H{
+			"message": fmt.Sprintf("retrieve job produced %s", err.Error()),
+		})
+		return
+	}
+
+	c.JSON(200, gin.H{
+		"data": job,
+	})
+}
+
+// queryWait parses the `wait` duration (i.e. `30s`). It is capped so a
+// request does not hold a connection for too long.
+func queryWait(c *gin.Context) (time.Duration, error) {
+	value := c.Query("wait")
+	if value == "" {
+		return 0, nil
 	}
-	if isPending {
-		return -1, fmt.Errorf("job type %s is already pending", job.Type)
+
+	wait, err := time.ParseDuration(value)
+	if err != nil || wait < 0 {
+		return 0, fmt.Errorf("wait %s could not be parsed", value)
 	}
 
-	// Force an initial state
-	job.State = data.JobStateQueued
-	job.StartedAt = time.Now()
-	id, err := datasvc.NewJob(job)
-	if err != nil {
-		return -1, fmt.Errorf("new job produced %s", err.Error())
+	if wait > maxJobWait {
+		wait = maxJobWait
 	}
 
-	if async {
-		// Start the job processor asynchronously
-		go proc(ctx, id, pageSize, errorStream, cfgsvc, datasvc, trsvc, storagesvc)
-	} else {
-		// Start the job processor synchronously
-		proc(ctx, id, pageSize, errorStream, cfgsvc, datasvc, trsvc, storagesvc)
+	return wait, nil
+}
+
+// waitForJob polls the job until it finishes, the wait is over or the
+// request goes away. It returns the last job it read. The job is read
+// from the database since it may run on any replica.
+func waitForJob(ctx context.Context, datasvc data.IService, id int64, wait time.Duration) (data.Job, error) {
+	job, err := datasvc.RetrieveJobByID(id)
+	if err != nil || wait == 0 {
+		return job, err
 	}
 
-	return id, nil
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	ticker := time.NewTicker(jobWaitPollInterval)
+	defer ticker.Stop()
+
+	for !job.State.Finished() {
+		select {
+		case <-ctx.Done():
+			return job, nil
+		case <-timer.C:
+			return job, nil
+		case <-ticker.C:
+		}
+
+		job, err = datasvc.RetrieveJobByID(id)
+		if err != nil {
+			return job, err
+		}
+	}
+
+	return job, nil
+}
+
+// jobURL is the status URL of a job
+func jobURL(id int64) string {
+	return fmt.Sprintf("/jobs/%d", id)
 }
 
 func isPermitted(c *gin.Context, datasvc data.IService) bool {
@@ -366,3 +612,12 @@ func isPermitted(c *gin.Context, datasvc data.IService) bool {
 
 	return true
 }
+
+// maskAPIKey identifies the caller without storing the whole key
+func maskAPIKey(apiKey string) string {
+	if len(apiKey) <= 4 {
+		return "api-key"
+	}
+
+	return "api-key:..." + apiKey[len(apiKey)-4:]
+}
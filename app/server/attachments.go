@@ -0,0 +1,173 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/storage"
+)
+
+// downloadSigner signs the download links of attachments so a browser can
+// follow them without an API key. A link is bound to its attachment ID and
+// expires after the TTL.
+type downloadSigner struct {
+	secret []byte
+	ttl    time.Duration
+}
+
+// newDownloadSigner returns nil without a secret. A per-process secret would
+// fail links minted on another replica or before a restart.
+func newDownloadSigner(cfgsvc config.IService) *downloadSigner {
+	secret := []byte(cfgsvc.GetDownloadSigningSecret())
+	if len(secret) == 0 {
+		return nil
+	}
+
+	return &downloadSigner{
+		secret: secret,
+		ttl:    cfgsvc.GetDownloadURLTTL(),
+	}
+}
+
+// url returns the signed download link of an attachment
+func (s *downloadSigner) url(baseURL string, id int64) string {
+	expires := strconv.FormatInt(time.Now().Add(s.ttl).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {hex.EncodeToString(s.mac(strconv.FormatInt(id, 10), expires))},
+	}
+
+	return fmt.Sprintf("%s/attachments/%d/download?%s", baseURL, id, query.Encode())
+}
+
+// verify checks that the query of a download link was signed for the
+// attachment ID and has not expired
+func (s *downloadSigner) verify(id string, query url.Values) error {
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry %s", expires)
+	}
+
+	if time.Now().Unix() > unix {
+		return errors.New("download link expired")
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || !hmac.Equal(signature, s.mac(id, expires)) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+func (s *downloadSigner) mac(id, expires string) []byte {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(id + "\n" + expires))
+	return mac.Sum(nil)
+}
+
+// attachmentRoutes serves the downloads of mirrored attachments. The API
+// hands out signed links to this route instead of storage URLs so the
+// storage can stay private.
+func attachmentRoutes(r *gin.Engine, cfgsvc config.IService, datasvc data.IService, storagesvc storage.IService, signer *downloadSigner) {
+	r.GET("/attachments/:id/download", func(c *gin.Context) {
+		if signer == nil {
+			c.JSON(503, gin.H{
+				"message": "attachment downloads are disabled: DOWNLOAD_SIGNING_SECRET is not set",
+			})
+			return
+		}
+
+		isPermitted := isDownloadPermitted(c, datasvc, signer)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		id, e := strconv.ParseInt(c.Param("id"), 10, 64)
+		if e != nil {
+			c.JSON(400, gin.H{
+				"message": "attachment ID could not be parsed",
+			})
+			return
+		}
+
+		// The filesystem backend can only hand out `file://` URLs without a base URL
+		if cfgsvc.GetStorageBackend() == "filesystem" && cfgsvc.GetStorageBaseURL() == "" {
+			c.JSON(501, gin.H{
+				"message": "attachment downloads from the filesystem backend need STORAGE_BASE_URL",
+			})
+			return
+		}
+
+		att, err := datasvc.RetrieveAttachmentByID(id)
+		if err != nil {
+			c.JSON(404, gin.H{
+				"message": fmt.Sprintf("retrieve attachment produced %s", err.Error()),
+			})
+			return
+		}
+
+		if att.Status != data.AttachmentStatusMirrored {
+			c.JSON(409, gin.H{
+				"message": fmt.Sprintf("attachment %d is %s and not mirrored yet", id, att.Status),
+			})
+			return
+		}
+
+		signedURL, err := storagesvc.SignedURL(att.StorageKey, cfgsvc.GetSignedURLTTL())
+		if err != nil {
+			c.JSON(502, gin.H{
+				"message": fmt.Sprintf("sign attachment URL produced %s", err.Error()),
+			})
+			return
+		}
+
+		// The signed URL expires so the redirect must not be cached
+		c.Header("Cache-Control", "no-store")
+		c.Redirect(302, signedURL)
+	})
+}
+
+// isDownloadPermitted lets a download through with a signed link since a
+// browser following a link cannot send the `api-key` header
+func isDownloadPermitted(c *gin.Context, datasvc data.IService, signer *downloadSigner) bool {
+	if c.Query("signature") != "" && signer.verify(c.Param("id"), c.Request.URL.Query()) == nil {
+		return true
+	}
+
+	return isPermitted(c, datasvc)
+}
+
+// withDownloadURLs replaces the storage URLs of the mirrored files with
+// their signed download links. Without a signer, downloads are disabled and
+// the files carry no links.
+func withDownloadURLs(c *gin.Context, cfgsvc config.IService, signer *downloadSigner, files []data.Attachment) {
+	baseURL := cfgsvc.GetStorageBaseURL()
+	if baseURL == "" {
+		scheme := "http"
+		if c.Request.TLS != nil {
+			scheme = "https"
+		}
+		baseURL = fmt.Sprintf("%s://%s", scheme, c.Request.Host)
+	}
+
+	for i := range files {
+		files[i].StorageURL = ""
+		if signer != nil && files[i].Status == data.AttachmentStatusMirrored {
+			files[i].DownloadURL = signer.url(baseURL, files[i].ID)
+		}
+	}
+}
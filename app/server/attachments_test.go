@@ -0,0 +1,172 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/fake"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestDownloadSigner(t *testing.T) {
+	signer := &downloadSigner{secret: []byte("secret"), ttl: time.Minute}
+	link, err := url.Parse(signer.url("http://localhost:8080", 42))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if link.Path != "/attachments/42/download" {
+		t.Fatalf("path = %s, want /attachments/42/download", link.Path)
+	}
+
+	expired := &downloadSigner{secret: []byte("secret"), ttl: -time.Minute}
+	expiredLink, _ := url.Parse(expired.url("http://localhost:8080", 42))
+
+	tests := []struct {
+		name    string
+		signer  *downloadSigner
+		id      string
+		query   url.Values
+		wantErr string
+	}{
+		{name: "valid", id: "42", query: link.Query()},
+		{name: "other attachment", id: "43", query: link.Query(), wantErr: "invalid signature"},
+		{name: "other secret", signer: &downloadSigner{secret: []byte("other")}, id: "42", query: link.Query(), wantErr: "invalid signature"},
+		{name: "extended expiry", id: "42", query: url.Values{"expires": {"99999999999"}, "signature": {link.Query().Get("signature")}}, wantErr: "invalid signature"},
+		{name: "expired", id: "42", query: expiredLink.Query(), wantErr: "expired"},
+		{name: "malformed", id: "42", query: url.Values{"signature": {"abc"}}, wantErr: "invalid expiry"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := signer
+			if tt.signer != nil {
+				s = tt.signer
+			}
+
+			err := s.verify(tt.id, tt.query)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestAttachmentDownload(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	newRouter := func(cfgsvc *fake.ConfigService) (*gin.Engine, *downloadSigner, int64) {
+		datasvc := fake.NewData(cfgsvc)
+		_ = datasvc.NewAPIKey("k1")
+		storagesvc := fake.NewStorage()
+		key, _ := storagesvc.Upload(strings.NewReader("deed"), 4, "properties", "deed.pdf")
+		id, err := datasvc.NewAttachment(data.Attachment{
+			EntityType: data.EntityTypeProperties,
+			CardID:     "card",
+			StorageKey: "properties/deed.pdf",
+			StorageURL: key,
+			Status:     data.AttachmentStatusMirrored,
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		signer := newDownloadSigner(cfgsvc)
+		r := gin.New()
+		attachmentRoutes(r, cfgsvc, datasvc, storagesvc, signer)
+		return r, signer, id
+	}
+
+	download := func(r *gin.Engine, target, apiKey string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, target, nil)
+		if apiKey != "" {
+			req.Header.Set("api-key", apiKey)
+		}
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	r, signer, id := newRouter(fake.NewConfig(map[string]string{"DOWNLOAD_SIGNING_SECRET": "secret"}))
+	link := signer.url("", id)
+	path := fmt.Sprintf("/attachments/%d/download", id)
+
+	tests := []struct {
+		name       string
+		target     string
+		apiKey     string
+		wantStatus int
+	}{
+		{name: "signed link", target: link, wantStatus: 302},
+		{name: "api key header", target: path, apiKey: "k1", wantStatus: 302},
+		{name: "api key query", target: path + "?api-key=k1", wantStatus: 403},
+		{name: "link of another attachment", target: strings.Replace(link, path, fmt.Sprintf("/attachments/%d/download", id+1), 1), wantStatus: 403},
+		{name: "no key", target: path, wantStatus: 403},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := download(r, tt.target, tt.apiKey)
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if w.Code == 302 && !strings.HasPrefix(w.Header().Get("Location"), "mem://properties/deed.pdf") {
+				t.Errorf("location = %q, want the signed storage URL", w.Header().Get("Location"))
+			}
+		})
+	}
+
+	// Without a base URL the filesystem backend has nothing to redirect to
+	r, _, id = newRouter(fake.NewConfig(map[string]string{"DOWNLOAD_SIGNING_SECRET": "secret", "STORAGE_BACKEND": "filesystem"}))
+	if w := download(r, fmt.Sprintf("/attachments/%d/download", id), "k1"); w.Code != 501 {
+		t.Fatalf("status = %d, want 501: %s", w.Code, w.Body.String())
+	}
+
+	// Without a secret shared by the replicas, downloads are disabled
+	r, _, id = newRouter(fake.NewConfig(nil))
+	if w := download(r, fmt.Sprintf("/attachments/%d/download", id), "k1"); w.Code != 503 {
+		t.Fatalf("status = %d, want 503: %s", w.Code, w.Body.String())
+	}
+}
+
+func TestWithDownloadURLs(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfgsvc := fake.NewConfig(map[string]string{"STORAGE_BASE_URL": "https://tr.example.com/", "DOWNLOAD_SIGNING_SECRET": "secret"})
+	signer := newDownloadSigner(cfgsvc)
+
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest(http.MethodGet, "/properties", nil)
+
+	files := []data.Attachment{
+		{ID: 1, StorageURL: "s3://bucket/a", Status: data.AttachmentStatusMirrored},
+		{ID: 2, StorageURL: "", Status: data.AttachmentStatusPending},
+	}
+	withDownloadURLs(c, cfgsvc, signer, files)
+
+	link, err := url.Parse(files[0].DownloadURL)
+	if err != nil || link.Host != "tr.example.com" || link.Path != "/attachments/1/download" || signer.verify("1", link.Query()) != nil {
+		t.Fatalf("download URL = %q, want a signed link of attachment 1", files[0].DownloadURL)
+	}
+
+	if files[0].StorageURL != "" || files[1].DownloadURL != "" {
+		t.Fatalf("files = %+v, want the storage URL cleared and no link for the pending file", files)
+	}
+
+	// Without a signer, no links are handed out
+	files = []data.Attachment{{ID: 1, StorageURL: "s3://bucket/a", Status: data.AttachmentStatusMirrored}}
+	withDownloadURLs(c, cfgsvc, nil, files)
+	if files[0].StorageURL != "" || files[0].DownloadURL != "" {
+		t.Fatalf("files = %+v, want neither URL", files)
+	}
+}
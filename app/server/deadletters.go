@@ -0,0 +1,196 @@
+package server
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/queue"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func deadLetterRoutes(r *gin.Engine, datasvc data.IService) {
+	// List dead letters filtered by job, entity, card, operation and state
+	r.GET("/deadletters", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		filter := data.DeadLetterFilter{
+			EntityType: data.EntityType(c.Query("entityType")),
+			CardID:     c.Query("cardId"),
+			Operation:  data.DeadLetterOperation(c.Query("operation")),
+			State:      data.DeadLetterState(c.Query("state")),
+		}
+
+		if jobID := c.Query("jobId"); jobID != "" {
+			id, e := strconv.ParseInt(jobID, 10, 64)
+			if e != nil {
+				c.JSON(400, gin.H{
+					"message": "job ID could not be parsed",
+				})
+				return
+			}
+			filter.JobID = id
+		}
+
+		page, pageSize, err := queryPaging(c)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		dls, err := datasvc.RetrieveDeadLetters(filter, page, pageSize)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("retrieve dead letters produced %s", err.Error()),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": dls,
+		})
+	})
+
+	r.GET("/deadletters/:id", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		id, e := strconv.ParseInt(c.Param("id"), 10, 64)
+		if e != nil {
+			c.JSON(400, gin.H{
+				"message": "dead letter ID could not be parsed",
+			})
+			return
+		}
+
+		dl, err := datasvc.RetrieveDeadLetterByID(id)
+		if err != nil {
+			c.JSON(404, gin.H{
+				"message": fmt.Sprintf("retrieve dead letter produced %s", err.Error()),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": dl,
+		})
+	})
+
+	// Enqueue a job that replays a pending dead letter. The replay job runs
+	// one at a time so a dead letter is never replayed twice at once.
+	r.POST("/deadletters/:id/retry", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		id, e := strconv.ParseInt(c.Param("id"), 10, 64)
+		if e != nil {
+			c.JSON(400, gin.H{
+				"message": "dead letter ID could not be parsed",
+			})
+			return
+		}
+
+		dl, err := datasvc.RetrieveDeadLetterByID(id)
+		if err != nil {
+			c.JSON(404, gin.H{
+				"message": fmt.Sprintf("retrieve dead letter produced %s", err.Error()),
+			})
+			return
+		}
+
+		if dl.State != data.DeadLetterStatePending {
+			c.JSON(409, gin.H{
+				"message": fmt.Sprintf("dead letter %d is %s", id, dl.State),
+			})
+			return
+		}
+
+		enqueueReplay(c, datasvc, jobb.DeadLetterOptions{ID: id})
+	})
+
+	// Enqueue a job that replays the pending dead letters that match the
+	// optional body, oldest first. The caller polls the job's Location.
+	r.POST("/deadletters/retry", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		// The body is optional. Unknown fields are rejected so a misspelled
+		// filter does not widen the replay to every dead letter.
+		var options jobb.DeadLetterOptions
+		decoder := json.NewDecoder(c.Request.Body)
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&options); err != nil && !errors.Is(err, io.EOF) {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("invalid retry request: %s", err.Error()),
+			})
+			return
+		}
+
+		enqueueReplay(c, datasvc, options)
+	})
+}
+
+// enqueueReplay enqueues a dead letter replay job and answers with its
+// Location, or with the replay job already pending
+func enqueueReplay(c *gin.Context, datasvc data.IService, options jobb.DeadLetterOptions) {
+	b, err := json.Marshal(options)
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": fmt.Sprintf("invalid retry request: %s", err.Error()),
+		})
+		return
+	}
+
+	id, err := queue.Enqueue(data.Job{
+		Type:    data.JobTypeDeadLetters,
+		Options: data.JobOptions(b),
+	}, queue.DefaultPageSize, datasvc)
+	var limitErr *queue.LimitError
+	if errors.As(err, &limitErr) {
+		// A replay is already queued or running
+		c.Header("Location", jobURL(limitErr.Active.ID))
+		c.JSON(409, gin.H{
+			"message": limitErr.Error(),
+			"data":    limitErr.Active,
+		})
+		return
+	}
+	if err != nil {
+		c.JSON(400, gin.H{
+			"message": fmt.Sprintf("enqueue job produced %s", err.Error()),
+		})
+		return
+	}
+
+	c.Header("Location", jobURL(id))
+	c.JSON(202, gin.H{
+		"data": id,
+	})
+}
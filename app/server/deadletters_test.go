@@ -0,0 +1,123 @@
+package server
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/fake"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestBulkRetryEnqueuesJob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+	_ = datasvc.NewAPIKey("k1")
+
+	r := gin.New()
+	deadLetterRoutes(r, datasvc)
+
+	retry := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/deadletters/retry", strings.NewReader(body))
+		req.Header.Set("api-key", "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := retry(`{"limit": -1}`); w.Code != 400 {
+		t.Fatalf("status = %d, want 400: %s", w.Code, w.Body.String())
+	}
+
+	if w := retry(`{"entity": "attachments"}`); w.Code != 400 {
+		t.Fatalf("status = %d, want 400 for an unknown field: %s", w.Code, w.Body.String())
+	}
+
+	w := retry(`{"entityType": "attachments", "limit": 20}`)
+	if w.Code != 202 {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body.String())
+	}
+
+	jobs, err := datasvc.RetrieveJobs(data.JobFilter{}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Type != data.JobTypeDeadLetters || jobs[0].State != data.JobStateQueued {
+		t.Fatalf("jobs = %+v, want a queued dead letters job", jobs)
+	}
+	if location := w.Header().Get("Location"); location != jobURL(jobs[0].ID) {
+		t.Errorf("location = %q, want %q", location, jobURL(jobs[0].ID))
+	}
+
+	options, err := jobb.ValidateOptions(data.JobTypeDeadLetters, jobs[0].Options)
+	if err != nil || string(options) != `{"entityType":"attachments","limit":20}` {
+		t.Errorf("options = %s, %v", options, err)
+	}
+
+	// Only one replay may be pending at a time
+	w = retry("")
+	if w.Code != 409 || w.Header().Get("Location") != jobURL(jobs[0].ID) {
+		t.Fatalf("status = %d, location = %q, want 409 to the queued job", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRetryEnqueuesJob(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfgsvc := fake.NewConfig(nil)
+	datasvc := fake.NewData(cfgsvc)
+	_ = datasvc.NewAPIKey("k1")
+
+	pending, _ := datasvc.SaveDeadLetter(data.DeadLetter{EntityType: data.EntityTypeProperties, CardID: "a", Operation: data.DeadLetterOperationUpsert})
+	resolved, _ := datasvc.SaveDeadLetter(data.DeadLetter{EntityType: data.EntityTypeProperties, CardID: "b", Operation: data.DeadLetterOperationUpsert})
+	dl, _ := datasvc.RetrieveDeadLetterByID(resolved)
+	dl.State = data.DeadLetterStateResolved
+	if err := datasvc.UpdateDeadLetter(&dl); err != nil {
+		t.Fatal(err)
+	}
+
+	r := gin.New()
+	deadLetterRoutes(r, datasvc)
+
+	retry := func(id int64) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, fmt.Sprintf("/deadletters/%d/retry", id), nil)
+		req.Header.Set("api-key", "k1")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := retry(99); w.Code != 404 {
+		t.Fatalf("status = %d, want 404: %s", w.Code, w.Body.String())
+	}
+
+	if w := retry(resolved); w.Code != 409 {
+		t.Fatalf("status = %d, want 409: %s", w.Code, w.Body.String())
+	}
+
+	w := retry(pending)
+	if w.Code != 202 {
+		t.Fatalf("status = %d, want 202: %s", w.Code, w.Body.String())
+	}
+
+	jobs, err := datasvc.RetrieveJobs(data.JobFilter{}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) != 1 || jobs[0].Type != data.JobTypeDeadLetters || w.Header().Get("Location") != jobURL(jobs[0].ID) {
+		t.Fatalf("jobs = %+v, location = %q, want a queued dead letters job", jobs, w.Header().Get("Location"))
+	}
+
+	if string(jobs[0].Options) != fmt.Sprintf(`{"id":%d}`, pending) {
+		t.Errorf("options = %s, want the dead letter ID", jobs[0].Options)
+	}
+
+	// A replay that is already pending is not started twice
+	if w := retry(pending); w.Code != 409 || w.Header().Get("Location") != jobURL(jobs[0].ID) {
+		t.Fatalf("status = %d, location = %q, want 409 to the queued job", w.Code, w.Header().Get("Location"))
+	}
+}
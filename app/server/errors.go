@@ -0,0 +1,219 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	jobb "github.com/khaledhikmat/tr-extractor/job"
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+const (
+	errorsPurgeInterval = time.Hour
+)
+
+func errorRoutes(r *gin.Engine, datasvc data.IService) {
+	// List errors or, with `g=class`, count them by class
+	r.GET("/errors", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		filter, err := errorFilter(c)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		if c.Query("g") == "class" {
+			counts, err := datasvc.RetrieveErrorClassCounts(filter)
+			if err != nil {
+				c.JSON(400, gin.H{
+					"message": fmt.Sprintf("retrieve error class counts produced %s", err.Error()),
+				})
+				return
+			}
+
+			c.JSON(200, gin.H{
+				"data": counts,
+			})
+			return
+		}
+
+		page, pageSize, err := queryPaging(c)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		errs, err := datasvc.RetrieveErrors(filter, page, pageSize)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("retrieve errors produced %s", err.Error()),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": errs,
+		})
+	})
+
+	r.GET("/jobs/:id/errors", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		id, e := strconv.ParseInt(c.Param("id"), 10, 64)
+		if e != nil {
+			c.JSON(400, gin.H{
+				"message": "job ID could not be parsed",
+			})
+			return
+		}
+
+		page, pageSize, err := queryPaging(c)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		errs, err := datasvc.RetrieveErrors(data.ErrorFilter{JobID: id}, page, pageSize)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("retrieve job errors produced %s", err.Error()),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": errs,
+		})
+	})
+}
+
+// errorFilter builds the filter from the query string:
+// job, card, entity, severity, class, source, from and to.
+// Dates are either RFC3339 timestamps or `2006-01-02`.
+func errorFilter(c *gin.Context) (data.ErrorFilter, error) {
+	filter := data.ErrorFilter{
+		CardID:     c.Query("card"),
+		EntityType: data.EntityType(c.Query("entity")),
+		Severity:   data.ErrorSeverity(c.Query("severity")),
+		Class:      data.ErrorClass(c.Query("class")),
+		Source:     c.Query("source"),
+	}
+
+	if c.Query("job") != "" {
+		id, err := strconv.ParseInt(c.Query("job"), 10, 64)
+		if err != nil {
+			return filter, fmt.Errorf("job ID could not be parsed")
+		}
+		filter.JobID = id
+	}
+
+	var err error
+	filter.From, err = queryTime(c, "from")
+	if err != nil {
+		return filter, err
+	}
+
+	filter.To, err = queryTime(c, "to")
+	if err != nil {
+		return filter, err
+	}
+
+	return filter, nil
+}
+
+func queryTime(c *gin.Context, key string) (time.Time, error) {
+	value := c.Query(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+
+	t, err := time.Parse(time.RFC3339, value)
+	if err == nil {
+		return t, nil
+	}
+
+	t, err = time.Parse("2006-01-02", value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%s could not be parsed as a date", key)
+	}
+
+	return t, nil
+}
+
+// queryPaging reads the page and page size of a listing. The page size is
+// capped like the page size of a job so a caller cannot load a whole table.
+func queryPaging(c *gin.Context) (int, int, error) {
+	page, e := strconv.Atoi(c.Query("p"))
+	if e != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, e := strconv.Atoi(c.Query("s"))
+	if e != nil || pageSize < 1 {
+		pageSize = 50
+	}
+
+	if pageSize > jobb.MaxPageSize {
+		return page, pageSize, fmt.Errorf("page size must not be more than %d", jobb.MaxPageSize)
+	}
+
+	return page, pageSize, nil
+}
+
+// purgeErrors deletes errors older than the retention period until the
+// context is cancelled
+func purgeErrors(ctx context.Context,
+	errorStream chan error,
+	cfgsvc config.IService,
+	datasvc data.IService) {
+	retention := cfgsvc.GetErrorsRetention()
+	if retention <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(errorsPurgeInterval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := datasvc.PurgeErrors(time.Now().Add(-retention))
+		if err != nil {
+			errorStream <- fmt.Errorf("purging errors: %w", err)
+		} else if purged > 0 {
+			lgr.Logger.Info("server.purgeErrors",
+				slog.Int64("purged", purged),
+				slog.Duration("retention", retention),
+			)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,48 @@
+package server
+
+import (
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestQueryPaging(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	tests := []struct {
+		name         string
+		query        string
+		wantPage     int
+		wantPageSize int
+		wantErr      bool
+	}{
+		{name: "defaults", query: "", wantPage: 1, wantPageSize: 50},
+		{name: "invalid values fall back", query: "?p=0&s=abc", wantPage: 1, wantPageSize: 50},
+		{name: "largest page size", query: "?p=2&s=1000", wantPage: 2, wantPageSize: 1000},
+		{name: "page size over the max", query: "?s=1001", wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c, _ := gin.CreateTestContext(httptest.NewRecorder())
+			c.Request = httptest.NewRequest("GET", "/errors"+tt.query, nil)
+
+			page, pageSize, err := queryPaging(c)
+			if tt.wantErr {
+				if err == nil {
+					t.Fatal("expected an error")
+				}
+				return
+			}
+
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if page != tt.wantPage || pageSize != tt.wantPageSize {
+				t.Fatalf("got page %d size %d, want %d %d", page, pageSize, tt.wantPage, tt.wantPageSize)
+			}
+		})
+	}
+}
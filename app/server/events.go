@@ -0,0 +1,108 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+const (
+	jobEventsPollInterval = time.Second
+	jobEventsKeepAlive    = 15 * time.Second
+)
+
+// jobProgress is the part of a job that, when changed, is worth an event
+type jobProgress struct {
+	state       data.JobState
+	cards       int64
+	processed   int64
+	failed      int64
+	errors      int64
+	currentCard string
+}
+
+func progressOf(job data.Job) jobProgress {
+	return jobProgress{
+		state:       job.State,
+		cards:       job.Cards,
+		processed:   job.Processed,
+		failed:      job.Failed,
+		errors:      job.Errors,
+		currentCard: job.CurrentCard,
+	}
+}
+
+func eventRoutes(r *gin.Engine, datasvc data.IService) {
+	// Stream the job progress as server-sent events until the job finishes.
+	// The job is read from the database so it may run on any replica.
+	r.GET("/jobs/:id/events", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		id, e := strconv.ParseInt(c.Param("id"), 10, 64)
+		if e != nil {
+			c.JSON(400, gin.H{
+				"message": "job ID could not be parsed",
+			})
+			return
+		}
+
+		_, err := datasvc.RetrieveJobByID(id)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("retrieve job produced %s", err.Error()),
+			})
+			return
+		}
+
+		c.Header("Cache-Control", "no-cache")
+		c.Header("X-Accel-Buffering", "no")
+
+		ticker := time.NewTicker(jobEventsPollInterval)
+		defer ticker.Stop()
+
+		var last *jobProgress
+		sentAt := time.Now()
+		c.Stream(func(w io.Writer) bool {
+			job, err := datasvc.RetrieveJobByID(id)
+			if err != nil {
+				c.SSEvent("error", gin.H{
+					"message": fmt.Sprintf("retrieve job produced %s", err.Error()),
+				})
+				return false
+			}
+
+			if job.State.Finished() {
+				c.SSEvent("done", job)
+				return false
+			}
+
+			progress := progressOf(job)
+			if last == nil || *last != progress {
+				c.SSEvent("progress", job)
+				last = &progress
+				sentAt = time.Now()
+			} else if time.Since(sentAt) > jobEventsKeepAlive {
+				// Comments keep proxies from closing an idle stream
+				_, _ = io.WriteString(w, ": keep-alive\n\n")
+				sentAt = time.Now()
+			}
+
+			select {
+			case <-c.Request.Context().Done():
+				return false
+			case <-ticker.C:
+				return true
+			}
+		})
+	})
+}
@@ -0,0 +1,62 @@
+package server
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+	"github.com/khaledhikmat/tr-extractor/service/storage"
+)
+
+// fileRoutes serves the files of the filesystem backend to callers with an
+// API key or a signed URL. They are only routed when it is the selected
+// backend.
+func fileRoutes(r *gin.Engine, cfgsvc config.IService, datasvc data.IService, storagesvc storage.IService) {
+	if cfgsvc.GetStorageBackend() != "filesystem" {
+		return
+	}
+
+	// http.Dir keeps the paths under the root
+	root := http.Dir(cfgsvc.GetStorageRoot())
+
+	r.GET(storage.FilesRoute+"/*key", func(c *gin.Context) {
+		isPermitted := isSignedFile(c, storagesvc) || isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		f, err := root.Open(c.Param("key"))
+		if err != nil {
+			c.JSON(404, gin.H{
+				"message": "file not found",
+			})
+			return
+		}
+		defer f.Close()
+
+		// Folders are not listed
+		stat, err := f.Stat()
+		if err != nil || stat.IsDir() {
+			c.JSON(404, gin.H{
+				"message": "file not found",
+			})
+			return
+		}
+
+		http.ServeContent(c.Writer, c.Request, stat.Name(), stat.ModTime(), f)
+	})
+}
+
+// isSignedFile tells whether the request carries a valid signature of the file
+func isSignedFile(c *gin.Context, storagesvc storage.IService) bool {
+	verifier, ok := storagesvc.(storage.Verifier)
+	if !ok || c.Query("signature") == "" {
+		return false
+	}
+
+	return verifier.Verify(c.Param("key"), c.Request.URL.Query()) == nil
+}
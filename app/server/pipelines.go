@@ -0,0 +1,131 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/queue"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func pipelineRoutes(r *gin.Engine, datasvc data.IService) {
+	// List the pipeline definitions
+	r.GET("/pipelines", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": queue.Pipelines,
+		})
+	})
+
+	// Start a pipeline run. Its steps are enqueued as their dependencies finish.
+	r.POST("/pipelines/:name/runs", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		name := c.Param("name")
+		id, err := queue.StartPipeline(name, maskAPIKey(c.GetHeader("api-key")), datasvc)
+		if errors.Is(err, queue.ErrPipelineNotFound) {
+			c.JSON(404, gin.H{
+				"message": fmt.Sprintf("pipeline %s is not defined", name),
+			})
+			return
+		}
+		if errors.Is(err, queue.ErrPipelineRunning) {
+			c.JSON(409, gin.H{
+				"message": fmt.Sprintf("pipeline %s is already running as run %d", name, id),
+				"data":    id,
+			})
+			return
+		}
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("start pipeline produced %s", err.Error()),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": id,
+		})
+	})
+
+	// List the runs of a pipeline with their steps, newest first
+	r.GET("/pipelines/:name/runs", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		filter := data.PipelineRunFilter{
+			Pipeline: c.Param("name"),
+			State:    data.PipelineState(c.Query("state")),
+		}
+
+		page, pageSize, err := queryPaging(c)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		runs, err := datasvc.RetrievePipelineRuns(filter, page, pageSize)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("retrieve pipeline runs produced %s", err.Error()),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": runs,
+		})
+	})
+
+	r.GET("/pipelines/:name/runs/:id", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		id, e := strconv.ParseInt(c.Param("id"), 10, 64)
+		if e != nil {
+			c.JSON(400, gin.H{
+				"message": "pipeline run ID could not be parsed",
+			})
+			return
+		}
+
+		run, err := datasvc.RetrievePipelineRunByID(id)
+		if err != nil || run.Pipeline != c.Param("name") {
+			c.JSON(404, gin.H{
+				"message": fmt.Sprintf("pipeline run %d does not exist", id),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": run,
+		})
+	})
+}
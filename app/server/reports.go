@@ -0,0 +1,186 @@
+package server
+
+import (
+	"encoding/csv"
+	"fmt"
+	"io"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func reportRoutes(r *gin.Engine, datasvc data.IService) {
+	r.GET("/reports/owners", reportHandler(datasvc, "owners", datasvc.RetrieveOwnerTotals))
+	r.GET("/reports/statuses", reportHandler(datasvc, "statuses", datasvc.RetrieveStatusTypeCounts))
+	r.GET("/reports/organized", reportHandler(datasvc, "organized", datasvc.RetrieveOrganizedBreakdown))
+	r.GET("/reports/effects", reportHandler(datasvc, "effects", datasvc.RetrieveEffectProperties))
+	r.GET("/reports/generations", reportHandler(datasvc, "generations", datasvc.RetrieveGenerationCounts))
+	r.GET("/reports/categories", reportHandler(datasvc, "categories", datasvc.RetrieveCategoryCounts))
+}
+
+// reportHandler serves a report as JSON by default or as CSV if the `f` query
+// param is set to `csv`
+func reportHandler[T any](datasvc data.IService, name string, retrieve func() ([]T, error)) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		format := c.Query("f")
+		if format == "" {
+			format = "json"
+		}
+
+		if format != "json" && format != "csv" {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("invalid report format %s", format),
+			})
+			return
+		}
+
+		rows, err := retrieve()
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("retrieve %s report produced %s", name, err.Error()),
+			})
+			return
+		}
+
+		if format == "json" {
+			c.JSON(200, gin.H{
+				"data": rows,
+			})
+			return
+		}
+
+		c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%s.csv", name))
+		c.Header("Content-Type", "text/csv; charset=utf-8")
+		c.Status(200)
+		err = writeCSV(c.Writer, rows)
+		if err != nil {
+			_ = c.Error(err)
+		}
+	}
+}
+
+// writeCSV writes a header row from the struct json tags followed by one
+// row per item
+func writeCSV[T any](w io.Writer, rows []T) error {
+	writer := csv.NewWriter(w)
+
+	t := reflect.TypeOf((*T)(nil)).Elem()
+	fields := csvFields(t)
+	header := []string{}
+	for _, i := range fields {
+		header = append(header, csvColumnName(t.Field(i)))
+	}
+
+	err := writer.Write(header)
+	if err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		v := reflect.ValueOf(row)
+		record := []string{}
+		for _, i := range fields {
+			record = append(record, csvValue(v.Field(i)))
+		}
+
+		err = writer.Write(record)
+		if err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+	return writer.Error()
+}
+
+// csvFields returns the indexes of the fields that become columns. Fields
+// hidden from JSON and fields that do not flatten to a cell (i.e. the files
+// of an entity) are left out.
+func csvFields(t reflect.Type) []int {
+	fields := []int{}
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if !field.IsExported() || field.Tag.Get("json") == "-" || !isCSVCell(field.Type) {
+			continue
+		}
+
+		fields = append(fields, i)
+	}
+
+	return fields
+}
+
+// isCSVCell tells whether values of the type fit in a cell: scalars, times
+// and slices of them, which are joined
+func isCSVCell(t reflect.Type) bool {
+	if t == reflect.TypeOf(time.Time{}) {
+		return true
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer, reflect.Slice, reflect.Array:
+		return isCSVCell(t.Elem())
+	case reflect.Bool, reflect.String,
+		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return true
+	}
+
+	return false
+}
+
+func csvColumnName(field reflect.StructField) string {
+	name := strings.Split(field.Tag.Get("json"), ",")[0]
+	if name == "" {
+		return field.Name
+	}
+
+	return name
+}
+
+func csvValue(v reflect.Value) string {
+	switch value := v.Interface().(type) {
+	case time.Time:
+		if value.IsZero() {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	case *time.Time:
+		if value == nil || value.IsZero() {
+			return ""
+		}
+		return value.Format(time.RFC3339)
+	case float64:
+		return strconv.FormatFloat(value, 'f', -1, 64)
+	}
+
+	if v.Kind() == reflect.Pointer {
+		if v.IsNil() {
+			return ""
+		}
+		return csvValue(v.Elem())
+	}
+
+	if v.Kind() == reflect.Slice || v.Kind() == reflect.Array {
+		items := []string{}
+		for i := 0; i < v.Len(); i++ {
+			items = append(items, csvValue(v.Index(i)))
+		}
+		return strings.Join(items, "; ")
+	}
+
+	return fmt.Sprintf("%v", v.Interface())
+}
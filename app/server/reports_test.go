@@ -0,0 +1,132 @@
+package server
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/fake"
+)
+
+type csvRow struct {
+	Owner     string     `json:"owner"`
+	Total     float64    `json:"total,omitempty"`
+	Labels    []string   `json:"labels"`
+	Shares    [][]int    `json:"shares"`
+	UpdatedAt time.Time  `json:"updatedAt"`
+	DeletedAt *time.Time `json:"deletedAt"`
+	JobID     *int64     `json:"jobId"`
+	Files     []csvFile  `json:"files"`
+	Internal  string     `json:"-"`
+	Untagged  bool
+}
+
+type csvFile struct {
+	Name string `json:"name"`
+}
+
+func TestWriteCSV(t *testing.T) {
+	updatedAt := time.Date(2024, 3, 1, 10, 30, 0, 0, time.UTC)
+	jobID := int64(7)
+	header := "owner,total,labels,shares,updatedAt,deletedAt,jobId,Untagged\n"
+
+	tests := []struct {
+		name string
+		rows []csvRow
+		want string
+	}{
+		{
+			name: "empty result",
+			rows: []csvRow{},
+			want: header,
+		},
+		{
+			name: "nested slices",
+			rows: []csvRow{{Owner: "Khaled", Total: 2.5, Labels: []string{"a", "b"}, Shares: [][]int{{1, 2}, {3}}, UpdatedAt: updatedAt, DeletedAt: &updatedAt, JobID: &jobID, Untagged: true}},
+			want: header + "Khaled,2.5,a; b,1; 2; 3,2024-03-01T10:30:00Z,2024-03-01T10:30:00Z,7,true\n",
+		},
+		{
+			name: "hidden and nested fields left out",
+			rows: []csvRow{{Owner: "Khaled", Files: []csvFile{{Name: "deed.pdf"}}, Internal: "secret"}},
+			want: header + "Khaled,0,,,,,,false\n",
+		},
+		{
+			name: "zero and nil values",
+			rows: []csvRow{{Owner: "Sami, Jr."}},
+			want: header + "\"Sami, Jr.\",0,,,,,,false\n",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := writeCSV(&buf, tt.rows); err != nil {
+				t.Fatal(err)
+			}
+
+			if buf.String() != tt.want {
+				t.Errorf("csv = %q, want %q", buf.String(), tt.want)
+			}
+		})
+	}
+}
+
+func TestReportHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	datasvc := fake.NewData(fake.NewConfig(nil))
+	_ = datasvc.NewAPIKey("k1")
+
+	retrieveErr := error(nil)
+	r := gin.New()
+	r.GET("/report", reportHandler(datasvc, "owners", func() ([]csvRow, error) {
+		return []csvRow{{Owner: "Khaled"}}, retrieveErr
+	}))
+
+	tests := []struct {
+		name       string
+		query      string
+		apiKey     string
+		err        error
+		wantStatus int
+		wantType   string
+		wantBody   string
+	}{
+		{name: "missing API key", wantStatus: 403},
+		{name: "json by default", apiKey: "k1", wantStatus: 200, wantType: "application/json; charset=utf-8", wantBody: `{"data":[{"owner":"Khaled","labels":null,"shares":null,"updatedAt":"0001-01-01T00:00:00Z","deletedAt":null,"jobId":null,"files":null,"Untagged":false}]}`},
+		{name: "csv", query: "?f=csv", apiKey: "k1", wantStatus: 200, wantType: "text/csv; charset=utf-8", wantBody: "owner,total,labels,shares,updatedAt,deletedAt,jobId,Untagged\nKhaled,0,,,,,,false\n"},
+		{name: "unknown format", query: "?f=xml", apiKey: "k1", wantStatus: 400},
+		{name: "failed retrieve", query: "?f=csv", apiKey: "k1", err: errors.New("db down"), wantStatus: 400},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			retrieveErr = tt.err
+			req := httptest.NewRequest(http.MethodGet, "/report"+tt.query, nil)
+			if tt.apiKey != "" {
+				req.Header.Set("api-key", tt.apiKey)
+			}
+			w := httptest.NewRecorder()
+			r.ServeHTTP(w, req)
+
+			if w.Code != tt.wantStatus {
+				t.Fatalf("status = %d, want %d: %s", w.Code, tt.wantStatus, w.Body.String())
+			}
+
+			if tt.wantType != "" && w.Header().Get("Content-Type") != tt.wantType {
+				t.Errorf("content type = %s, want %s", w.Header().Get("Content-Type"), tt.wantType)
+			}
+
+			if tt.query == "?f=csv" && tt.err == nil && w.Header().Get("Content-Disposition") != "attachment; filename=owners.csv" {
+				t.Errorf("unexpected disposition %s", w.Header().Get("Content-Disposition"))
+			}
+
+			if tt.wantBody != "" && w.Body.String() != tt.wantBody {
+				t.Errorf("body = %s, want %s", w.Body.String(), tt.wantBody)
+			}
+		})
+	}
+}
@@ -0,0 +1,211 @@
+package server
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+const (
+	resetTokenTTL = 5 * time.Minute
+)
+
+type resetRequest struct {
+	data.ResetScope
+	DryRun            bool   `json:"dryRun"`
+	ConfirmationToken string `json:"confirmationToken"`
+}
+
+// resetRoutes exposes the factory reset. A reset is done in two steps:
+// the first call returns the row counts and a short-lived confirmation token,
+// the second call repeats the same scope with the token to actually delete.
+// A JSON snapshot of the deleted rows is written to the backup path first.
+func resetRoutes(r *gin.Engine, cfgsvc config.IService, datasvc data.IService) {
+	secret := []byte(cfgsvc.GetResetTokenSecret())
+
+	r.POST("/admins/reset", func(c *gin.Context) {
+		if !isAdmin(c, datasvc) {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key or not alllowed",
+			})
+			return
+		}
+
+		// A per-process secret would fail tokens confirmed on another
+		// replica or after a restart
+		if len(secret) == 0 {
+			c.JSON(503, gin.H{
+				"message": "factory reset is disabled: RESET_TOKEN_SECRET is not set",
+			})
+			return
+		}
+
+		var req resetRequest
+		if err := c.ShouldBindJSON(&req); err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("invalid reset request: %s", err.Error()),
+			})
+			return
+		}
+
+		err := data.ValidateResetScope(req.ResetScope)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		counts, err := datasvc.CountResetRows(req.ResetScope)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("count reset rows produced %s", err.Error()),
+			})
+			return
+		}
+
+		if req.DryRun {
+			c.JSON(200, gin.H{
+				"data": gin.H{
+					"dryRun": true,
+					"counts": counts,
+				},
+			})
+			return
+		}
+
+		apiKey := c.GetHeader("api-key")
+		if req.ConfirmationToken == "" {
+			expiresAt := time.Now().Add(resetTokenTTL)
+			c.JSON(202, gin.H{
+				"message": "repeat the request with the confirmation token to reset",
+				"data": gin.H{
+					"counts":            counts,
+					"confirmationToken": newResetToken(secret, apiKey, req.ResetScope, counts, expiresAt),
+					"expiresAt":         expiresAt.UTC(),
+				},
+			})
+			return
+		}
+
+		err = verifyResetToken(secret, apiKey, req.ResetScope, counts, req.ConfirmationToken)
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": err.Error(),
+			})
+			return
+		}
+
+		err = os.MkdirAll(cfgsvc.GetBackupPath(), 0o755)
+		if err != nil {
+			c.JSON(500, gin.H{
+				"message": fmt.Sprintf("creating backup path produced %s", err.Error()),
+			})
+			return
+		}
+
+		snapshotPath := filepath.Join(cfgsvc.GetBackupPath(),
+			fmt.Sprintf("reset-%s.json", time.Now().UTC().Format("20060102T150405Z")))
+		f, err := os.Create(snapshotPath)
+		if err != nil {
+			c.JSON(500, gin.H{
+				"message": fmt.Sprintf("creating snapshot produced %s", err.Error()),
+			})
+			return
+		}
+
+		deleted, err := datasvc.ResetFactory(req.ResetScope, f)
+		closeErr := f.Close()
+		if err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			// Nothing was deleted, so the snapshot would only be misleading
+			_ = os.Remove(snapshotPath)
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("reset factory produced %s", err.Error()),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": gin.H{
+				"deleted":  deleted,
+				"snapshot": snapshotPath,
+			},
+		})
+	})
+}
+
+// newResetToken signs the key, scope, row counts and expiry so the token
+// cannot be replayed with a different key or a wider scope, nor once more
+// rows would be deleted than were confirmed
+func newResetToken(secret []byte, apiKey string, scope data.ResetScope, counts map[string]int64, expiresAt time.Time) string {
+	expiry := strconv.FormatInt(expiresAt.Unix(), 10)
+	return expiry + "." + resetSignature(secret, apiKey, scope, counts, expiry)
+}
+
+func verifyResetToken(secret []byte, apiKey string, scope data.ResetScope, counts map[string]int64, token string) error {
+	expiry, signature, ok := strings.Cut(token, ".")
+	if !ok {
+		return fmt.Errorf("invalid confirmation token")
+	}
+
+	expiresAt, err := strconv.ParseInt(expiry, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid confirmation token")
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(resetSignature(secret, apiKey, scope, counts, expiry))) {
+		return fmt.Errorf("confirmation token does not match the key, scope or row counts")
+	}
+
+	if time.Now().Unix() > expiresAt {
+		return fmt.Errorf("confirmation token has expired")
+	}
+
+	return nil
+}
+
+func resetSignature(secret []byte, apiKey string, scope data.ResetScope, counts map[string]int64, expiry string) string {
+	entities := []string{}
+	for _, entity := range scope.Entities {
+		entities = append(entities, string(entity))
+	}
+	sort.Strings(entities)
+
+	tables := []string{}
+	for table, count := range counts {
+		tables = append(tables, fmt.Sprintf("%s=%d", table, count))
+	}
+	sort.Strings(tables)
+
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(strings.Join([]string{apiKey, scope.BoardID, strings.Join(entities, ","), strings.Join(tables, ","), expiry}, "|")))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+func isAdmin(c *gin.Context, datasvc data.IService) bool {
+	apiKey := c.GetHeader("api-key")
+	if apiKey == "" {
+		return false
+	}
+
+	isvalid, err := datasvc.IsAdminAPIKeyValid(apiKey)
+	if err != nil {
+		return false
+	}
+
+	return isvalid
+}
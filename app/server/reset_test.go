@@ -0,0 +1,87 @@
+package server
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/fake"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func TestVerifyResetToken(t *testing.T) {
+	secret := []byte("secret")
+	scope := data.ResetScope{Entities: []data.ResetEntity{data.ResetEntityProperties, data.ResetEntityJobs}}
+	counts := map[string]int64{"properties": 2, "attachments": 3, "jobs": 1}
+	token := newResetToken(secret, "k1", scope, counts, time.Now().Add(time.Minute))
+
+	tests := []struct {
+		name    string
+		secret  []byte
+		apiKey  string
+		scope   data.ResetScope
+		counts  map[string]int64
+		token   string
+		wantErr string
+	}{
+		{name: "valid", apiKey: "k1", scope: scope, token: token},
+		{name: "entities in another order", apiKey: "k1", scope: data.ResetScope{Entities: []data.ResetEntity{data.ResetEntityJobs, data.ResetEntityProperties}}, token: token},
+		{name: "expired", apiKey: "k1", scope: scope, token: newResetToken(secret, "k1", scope, counts, time.Now().Add(-time.Minute)), wantErr: "expired"},
+		{name: "extended expiry", apiKey: "k1", scope: scope, token: strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10) + token[strings.Index(token, "."):], wantErr: "does not match"},
+		{name: "wider scope", apiKey: "k1", scope: data.ResetScope{Entities: []data.ResetEntity{data.ResetEntityProperties, data.ResetEntityJobs, data.ResetEntityErrors}}, token: token, wantErr: "does not match"},
+		{name: "fewer entities", apiKey: "k1", scope: data.ResetScope{Entities: []data.ResetEntity{data.ResetEntityProperties}}, token: token, wantErr: "does not match"},
+		{name: "wrong board", apiKey: "k1", scope: data.ResetScope{Entities: scope.Entities, BoardID: "b1"}, token: token, wantErr: "does not match"},
+		{name: "more rows", apiKey: "k1", scope: scope, counts: map[string]int64{"properties": 2, "attachments": 4, "jobs": 1}, token: token, wantErr: "does not match"},
+		{name: "dependent rows left out", apiKey: "k1", scope: scope, counts: map[string]int64{"properties": 2, "jobs": 1}, token: token, wantErr: "does not match"},
+		{name: "wrong key", apiKey: "k2", scope: scope, token: token, wantErr: "does not match"},
+		{name: "other secret", secret: []byte("other"), apiKey: "k1", scope: scope, token: token, wantErr: "does not match"},
+		{name: "malformed", apiKey: "k1", scope: scope, token: "abc", wantErr: "invalid"},
+		{name: "malformed expiry", apiKey: "k1", scope: scope, token: "abc.def", wantErr: "invalid"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := secret
+			if tt.secret != nil {
+				s = tt.secret
+			}
+
+			c := counts
+			if tt.counts != nil {
+				c = tt.counts
+			}
+
+			err := verifyResetToken(s, tt.apiKey, tt.scope, c, tt.token)
+			if tt.wantErr == "" && err != nil {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)) {
+				t.Fatalf("error = %v, want %s", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestResetRequiresSecret(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	cfgsvc := fake.NewConfig(map[string]string{"RESET_TOKEN_SECRET": ""})
+	datasvc := fake.NewData(cfgsvc)
+	_ = datasvc.NewAdminAPIKey("admin")
+
+	r := gin.New()
+	resetRoutes(r, cfgsvc, datasvc)
+
+	req := httptest.NewRequest(http.MethodPost, "/admins/reset", strings.NewReader(`{"entities": ["jobs"]}`))
+	req.Header.Set("api-key", "admin")
+	w := httptest.NewRecorder()
+	r.ServeHTTP(w, req)
+
+	if w.Code != 503 {
+		t.Fatalf("status = %d, want 503: %s", w.Code, w.Body.String())
+	}
+}
@@ -0,0 +1,33 @@
+package server
+
+import (
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/khaledhikmat/tr-extractor/service/data"
+)
+
+func scheduleRoutes(r *gin.Engine, datasvc data.IService) {
+	// List the schedules with their last and next fire times
+	r.GET("/schedules", func(c *gin.Context) {
+		isPermitted := isPermitted(c, datasvc)
+		if !isPermitted {
+			c.JSON(403, gin.H{
+				"message": "Invalid or missing API key",
+			})
+			return
+		}
+
+		schedules, err := datasvc.RetrieveSchedules()
+		if err != nil {
+			c.JSON(400, gin.H{
+				"message": fmt.Sprintf("retrieve schedules produced %s", err.Error()),
+			})
+			return
+		}
+
+		c.JSON(200, gin.H{
+			"data": schedules,
+		})
+	})
+}
@@ -15,6 +15,7 @@ import (
 	"github.com/khaledhikmat/tr-extractor/service/trello"
 	"github.com/mdobak/go-xerrors"
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/metric"
 )
 
@@ -41,6 +42,21 @@ func init() {
 	}
 }
 
+// countInvocations counts every request by route, method and status
+func countInvocations(c *gin.Context) {
+	c.Next()
+
+	route := c.FullPath()
+	if route == "" {
+		route = "unmatched"
+	}
+	invocationCounter.Add(c.Request.Context(), 1, metric.WithAttributes(
+		attribute.String("http.route", route),
+		attribute.String("http.method", c.Request.Method),
+		attribute.Int("http.status_code", c.Writer.Status()),
+	))
+}
+
 func Run(canxCtx context.Context,
 	errorStream chan error,
 	cfgsvc config.IService,
@@ -55,14 +71,32 @@ func Run(canxCtx context.Context,
 	cfg.AllowMethods = []string{"GET", "POST", "PUT", "PATCH", "OPTIONS", "DELETE"}
 	cfg.AllowHeaders = []string{"Origin", "Content-Length", "Content-Type", "Authorization"}
 	r.Use(cors.New(cfg))
+	r.Use(countInvocations)
 
 	// TODO: Add middleware to handle API key authentication
 
 	// Setup home routes
 	// TODO: Add routes
 
+	// The API hands out download links that the attachment routes verify
+	signer := newDownloadSigner(cfgsvc)
+
 	// Setup API routes
-	apiRoutes(canxCtx, r, errorStream, cfgsvc, datasvc, trsvc, storagesvc)
+	apiRoutes(canxCtx, r, errorStream, cfgsvc, datasvc, trsvc, storagesvc, signer)
+
+	// Setup report routes
+	reportRoutes(r, datasvc)
+	resetRoutes(r, cfgsvc, datasvc)
+	errorRoutes(r, datasvc)
+	scheduleRoutes(r, datasvc)
+	pipelineRoutes(r, datasvc)
+	deadLetterRoutes(r, datasvc)
+	eventRoutes(r, datasvc)
+	fileRoutes(r, cfgsvc, datasvc, storagesvc)
+	attachmentRoutes(r, cfgsvc, datasvc, storagesvc, signer)
+
+	// Purge old errors in the background
+	go purgeErrors(canxCtx, errorStream, cfgsvc, datasvc)
 
 	fn := getRunWithCanxFn(r, ":"+cfgsvc.GetAPIPort())
 	return fn(canxCtx, errorStream)
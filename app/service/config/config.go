@@ -2,6 +2,9 @@ package config
 
 import (
 	"os"
+	"strconv"
+	"strings"
+	"time"
 )
 
 type configService struct {
@@ -31,10 +34,48 @@ func (svc *configService) IsOpenTelemetry() bool {
 	return os.Getenv("OPEN_TELEMETRY") == "true"
 }
 
+func (svc *configService) GetDbDriver() string {
+	if os.Getenv("DB_DRIVER") == "" {
+		return "postgres"
+	}
+
+	return os.Getenv("DB_DRIVER")
+}
+
 func (svc *configService) GetDbDSN() string {
 	return os.Getenv("DB_DSN")
 }
 
+// GetDbMaxOpenConns defaults to 1 with the sqlite driver. SQLite allows a
+// single writer so that driver overrides any other value with a warning.
+func (svc *configService) GetDbMaxOpenConns() int {
+	if svc.GetDbDriver() == "sqlite" {
+		return intEnv("DB_MAX_OPEN_CONNS", 1)
+	}
+
+	return intEnv("DB_MAX_OPEN_CONNS", 10)
+}
+
+func (svc *configService) GetDbMaxIdleConns() int {
+	return intEnv("DB_MAX_IDLE_CONNS", 5)
+}
+
+func (svc *configService) GetDbConnMaxLifetime() time.Duration {
+	return durationEnv("DB_CONN_MAX_LIFETIME", 30*time.Minute)
+}
+
+func (svc *configService) GetDbConnMaxIdleTime() time.Duration {
+	return durationEnv("DB_CONN_MAX_IDLE_TIME", 5*time.Minute)
+}
+
+func (svc *configService) GetDbConnectRetries() int {
+	return intEnv("DB_CONNECT_RETRIES", 5)
+}
+
+func (svc *configService) GetDbConnectRetryDelay() time.Duration {
+	return durationEnv("DB_CONNECT_RETRY_DELAY", 2*time.Second)
+}
+
 func (svc *configService) GetTrelloAPIKey() string {
 	return os.Getenv("TRELLO_API_KEY")
 }
@@ -55,10 +96,6 @@ func (svc *configService) GetTrelloBaseURL() string {
 	return os.Getenv("TRELLO_BASE_URL")
 }
 
-func (svc *configService) GetTrelloDownloadPath() string {
-	return os.Getenv("TRELLO_DOWNLOAD_PATH")
-}
-
 func (svc *configService) GetTrelloPropertiesBoardID() string {
 	if os.Getenv("TRELLO_PROPERTIES_BOARD_ID") == "" {
 		return "BXlnOvYt"
@@ -107,6 +144,214 @@ func (svc *configService) GetStorageRegion() string {
 	return os.Getenv("STORAGE_REGION")
 }
 
+// GetStorageEndpoint is the URL of an S3-compatible provider (i.e.
+// `http://localhost:9000` for MinIO). Empty means AWS.
+func (svc *configService) GetStorageEndpoint() string {
+	return strings.TrimSuffix(os.Getenv("STORAGE_ENDPOINT"), "/")
+}
+
+// IsStoragePathStyle puts the bucket in the path of the S3 URLs instead of
+// the host name. MinIO usually needs it.
+func (svc *configService) IsStoragePathStyle() bool {
+	return os.Getenv("STORAGE_PATH_STYLE") == "true"
+}
+
+// GetStorageAccessKeyID is the S3 access key. Empty means the default AWS
+// credential chain.
+func (svc *configService) GetStorageAccessKeyID() string {
+	return os.Getenv("STORAGE_ACCESS_KEY_ID")
+}
+
+func (svc *configService) GetStorageSecretAccessKey() string {
+	return os.Getenv("STORAGE_SECRET_ACCESS_KEY")
+}
+
+// GetStorageClass is the S3 storage class of the uploads (i.e.
+// `STANDARD_IA`). Empty means the bucket default.
+func (svc *configService) GetStorageClass() string {
+	return os.Getenv("STORAGE_CLASS")
+}
+
+// GetStorageSSE is the S3 server-side encryption of the uploads: `AES256`
+// or `aws:kms`. Empty means the bucket default.
+func (svc *configService) GetStorageSSE() string {
+	return os.Getenv("STORAGE_SSE")
+}
+
+// GetStorageSSEKMSKeyID is the KMS key of `aws:kms` encryption. Empty means
+// the AWS managed key.
+func (svc *configService) GetStorageSSEKMSKeyID() string {
+	return os.Getenv("STORAGE_SSE_KMS_KEY_ID")
+}
+
+// GetSignedURLTTL is how long the signed URLs of attachment downloads are
+// valid. Dropbox links always last 4 hours.
+func (svc *configService) GetSignedURLTTL() time.Duration {
+	return durationEnv("STORAGE_SIGNED_URL_TTL", 5*time.Minute)
+}
+
+// GetStorageSigningSecret signs the URLs of the filesystem backend. It must
+// be the same on every replica and the backend does not start without it.
+func (svc *configService) GetStorageSigningSecret() string {
+	return os.Getenv("STORAGE_SIGNING_SECRET")
+}
+
+// GetDownloadURLTTL is how long the download links of attachments handed
+// out by the API are valid
+func (svc *configService) GetDownloadURLTTL() time.Duration {
+	return durationEnv("DOWNLOAD_URL_TTL", time.Hour)
+}
+
+// GetDownloadSigningSecret signs the download links of attachments. It must
+// be the same on every replica. Empty disables attachment downloads.
+func (svc *configService) GetDownloadSigningSecret() string {
+	return os.Getenv("DOWNLOAD_SIGNING_SECRET")
+}
+
+// GetStorageBackend is where attachments are mirrored: `s3`, `dropbox` or
+// `filesystem`
+func (svc *configService) GetStorageBackend() string {
+	if os.Getenv("STORAGE_BACKEND") == "" {
+		return "s3"
+	}
+
+	return os.Getenv("STORAGE_BACKEND")
+}
+
+// GetStorageRoot is the directory the filesystem backend writes under
+func (svc *configService) GetStorageRoot() string {
+	if os.Getenv("STORAGE_ROOT") == "" {
+		return "storage"
+	}
+
+	return os.Getenv("STORAGE_ROOT")
+}
+
+// GetStorageBaseURL is the public URL of this server (i.e.
+// `https://tr.example.com`) the filesystem backend builds the URLs of the
+// files it serves from. Empty means `file://` URLs.
+func (svc *configService) GetStorageBaseURL() string {
+	return strings.TrimSuffix(os.Getenv("STORAGE_BASE_URL"), "/")
+}
+
+func (svc *configService) GetBackupPath() string {
+	if os.Getenv("BACKUP_PATH") == "" {
+		return "backups"
+	}
+
+	return os.Getenv("BACKUP_PATH")
+}
+
+func (svc *configService) GetResetTokenSecret() string {
+	return os.Getenv("RESET_TOKEN_SECRET")
+}
+
+// GetErrorsRetention is how long error records are kept. Zero keeps them forever.
+func (svc *configService) GetErrorsRetention() time.Duration {
+	return durationEnv("ERRORS_RETENTION", 30*24*time.Hour)
+}
+
+// GetQueueWorkers is the number of workers that process jobs of a type.
+// It is read from `QUEUE_WORKERS_<TYPE>` (i.e. `QUEUE_WORKERS_ATTACHMENTS`).
+func (svc *configService) GetQueueWorkers(jobType string) int {
+	return intEnv("QUEUE_WORKERS_"+strings.ToUpper(jobType), 1)
+}
+
+// GetQueuePollInterval is how often idle workers look for queued jobs
+func (svc *configService) GetQueuePollInterval() time.Duration {
+	return durationEnv("QUEUE_POLL_INTERVAL", 2*time.Second)
+}
+
+// GetJobHeartbeatInterval is how often a running job reports it is alive
+func (svc *configService) GetJobHeartbeatInterval() time.Duration {
+	return durationEnv("JOB_HEARTBEAT_INTERVAL", 10*time.Second)
+}
+
+// GetJobHeartbeatTimeout is how long a running job may go without a
+// heartbeat before the reaper considers it abandoned
+func (svc *configService) GetJobHeartbeatTimeout() time.Duration {
+	return durationEnv("JOB_HEARTBEAT_TIMEOUT", time.Minute)
+}
+
+// GetJobMaxAttempts is how many times an abandoned job is requeued before it fails
+func (svc *configService) GetJobMaxAttempts() int {
+	return intEnv("JOB_MAX_ATTEMPTS", 3)
+}
+
+// GetJobProgressInterval is the minimum time between two progress updates of a job
+func (svc *configService) GetJobProgressInterval() time.Duration {
+	return durationEnv("JOB_PROGRESS_INTERVAL", 2*time.Second)
+}
+
+// GetCardRetryAttempts is the number of times a failed card operation
+// (i.e. an upsert or an upload) is tried before it is dead lettered
+func (svc *configService) GetCardRetryAttempts() int {
+	return intEnv("CARD_RETRY_ATTEMPTS", 3)
+}
+
+// GetCardRetryBackoff is the delay before the first retry of a card
+// operation. It doubles with every retry.
+func (svc *configService) GetCardRetryBackoff() time.Duration {
+	return durationEnv("CARD_RETRY_BACKOFF", time.Second)
+}
+
+// GetJobMaxDuration is how long a job of a type may run before the
+// watchdog times it out. It is read from `JOB_MAX_DURATION_<TYPE>` and
+// falls back to the limit the job type registered with.
+func (svc *configService) GetJobMaxDuration(jobType string, def time.Duration) time.Duration {
+	return durationEnv("JOB_MAX_DURATION_"+strings.ToUpper(jobType), def)
+}
+
+// GetCardTimeout is how long a single card operation (i.e. an upsert, a
+// download or an upload) may take before the watchdog times the job out
+func (svc *configService) GetCardTimeout() time.Duration {
+	return durationEnv("CARD_TIMEOUT", 5*time.Minute)
+}
+
+// GetHTTPTimeout bounds every outgoing HTTP request to Trello and storage,
+// including reading the response body
+func (svc *configService) GetHTTPTimeout() time.Duration {
+	return durationEnv("HTTP_TIMEOUT", 2*time.Minute)
+}
+
+// GetUploadPartSize is the size in bytes of the parts attachments are
+// streamed to storage in. Only one part is held in memory at a time. It is
+// read in MiB from `UPLOAD_PART_SIZE_MB` and is at least the 5 MiB minimum
+// of S3 multipart uploads.
+func (svc *configService) GetUploadPartSize() int64 {
+	return max(int64(intEnv("UPLOAD_PART_SIZE_MB", 8)), 5) << 20
+}
+
+// GetSchedule is the cron expression (i.e. `0 6 * * *`) that enqueues jobs
+// of a type. It is read from `SCHEDULE_<TYPE>`. Empty means not scheduled.
+func (svc *configService) GetSchedule(jobType string) string {
+	return os.Getenv("SCHEDULE_" + strings.ToUpper(jobType))
+}
+
+// GetScheduleTimeZone is the IANA time zone of the cron expressions
+func (svc *configService) GetScheduleTimeZone() string {
+	if os.Getenv("SCHEDULE_TIMEZONE") == "" {
+		return "UTC"
+	}
+
+	return os.Getenv("SCHEDULE_TIMEZONE")
+}
+
+// GetScheduleCatchUp is what happens to runs missed while no replica was up:
+// `once` fires a single catch-up run and `skip` drops them
+func (svc *configService) GetScheduleCatchUp() string {
+	if os.Getenv("SCHEDULE_CATCH_UP") == "" {
+		return "once"
+	}
+
+	return os.Getenv("SCHEDULE_CATCH_UP")
+}
+
+// GetSchedulePollInterval is how often due schedules are checked
+func (svc *configService) GetSchedulePollInterval() time.Duration {
+	return durationEnv("SCHEDULE_POLL_INTERVAL", 30*time.Second)
+}
+
 func (svc *configService) GetPropertiesExcelUpdateWebhook() string {
 	if os.Getenv("PROPERTIES_EXCEL_UPDATE_WEBHOOK") == "" {
 		return "https://hook.us2.make.com/bk7ct9twnq3sndfj4kmc7sx2idhjbukf"
@@ -154,3 +399,31 @@ func (svc *configService) GetSupportiveDocsNotionUpdateWebhook() string {
 
 	return os.Getenv("SUPPORTIVE_DOCS_NOTION_UPDATE_WEBHOOK")
 }
+
+// GetPipelineNotifyWebhook is the webhook URL the `notify` job posts to
+// once the steps of a pipeline it depends on are done
+func (svc *configService) GetPipelineNotifyWebhook() string {
+	return os.Getenv("PIPELINE_NOTIFY_WEBHOOK")
+}
+
+// intEnv returns the integer value of an env var or the default if it is
+// missing or invalid
+func intEnv(key string, def int) int {
+	v, err := strconv.Atoi(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+
+	return v
+}
+
+// durationEnv returns the duration value (i.e. `30s`) of an env var or the
+// default if it is missing or invalid
+func durationEnv(key string, def time.Duration) time.Duration {
+	v, err := time.ParseDuration(os.Getenv(key))
+	if err != nil {
+		return def
+	}
+
+	return v
+}
@@ -1,5 +1,7 @@
 package config
 
+import "time"
+
 type IService interface {
 	GetRuntimeEnvironment() string
 	IsProduction() bool
@@ -11,18 +13,60 @@ type IService interface {
 	GetTrelloSupportiveDocsBoardID() string
 	GetTrelloExpensesBoardID() string
 
+	GetDbDriver() string
 	GetDbDSN() string
+	GetDbMaxOpenConns() int
+	GetDbMaxIdleConns() int
+	GetDbConnMaxLifetime() time.Duration
+	GetDbConnMaxIdleTime() time.Duration
+	GetDbConnectRetries() int
+	GetDbConnectRetryDelay() time.Duration
 	GetTrelloAPIKey() string
 	GetTrelloToken() string
 	GetTrelloReadToken() string
 	GetTrelloBaseURL() string
-	GetTrelloDownloadPath() string
 
 	GetDropboxAccessToken() string
 	GetDropboxUploadPath() string
 
 	GetStorageBucket() string
 	GetStorageRegion() string
+	GetStorageBackend() string
+	GetStorageRoot() string
+	GetStorageBaseURL() string
+	GetStorageEndpoint() string
+	IsStoragePathStyle() bool
+	GetStorageAccessKeyID() string
+	GetStorageSecretAccessKey() string
+	GetStorageClass() string
+	GetStorageSSE() string
+	GetStorageSSEKMSKeyID() string
+	GetSignedURLTTL() time.Duration
+	GetStorageSigningSecret() string
+	GetDownloadURLTTL() time.Duration
+	GetDownloadSigningSecret() string
+
+	GetBackupPath() string
+	GetResetTokenSecret() string
+	GetErrorsRetention() time.Duration
+
+	GetQueueWorkers(jobType string) int
+	GetQueuePollInterval() time.Duration
+	GetJobHeartbeatInterval() time.Duration
+	GetJobHeartbeatTimeout() time.Duration
+	GetJobMaxAttempts() int
+	GetJobProgressInterval() time.Duration
+	GetCardRetryAttempts() int
+	GetCardRetryBackoff() time.Duration
+	GetJobMaxDuration(jobType string, def time.Duration) time.Duration
+	GetCardTimeout() time.Duration
+	GetHTTPTimeout() time.Duration
+	GetUploadPartSize() int64
+
+	GetSchedule(jobType string) string
+	GetScheduleTimeZone() string
+	GetScheduleCatchUp() string
+	GetSchedulePollInterval() time.Duration
 
 	GetPropertiesExcelUpdateWebhook() string
 	GetPropertiesNotionUpdateWebhook() string
@@ -32,4 +76,6 @@ type IService interface {
 
 	GetSupportiveDocsExcelUpdateWebhook() string
 	GetSupportiveDocsNotionUpdateWebhook() string
+
+	GetPipelineNotifyWebhook() string
 }
@@ -0,0 +1,46 @@
+package data
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+type apiKey struct {
+	Key     string `db:"key"`
+	IsAdmin bool   `db:"is_admin"`
+}
+
+// newAPIKey stores a key that expires in a year
+func newAPIKey(db *sqlx.DB, insertSQL string, key string) error {
+	now := time.Now().UTC()
+	_, err := db.NamedExec(insertSQL, map[string]interface{}{
+		"key":        key,
+		"started_at": now,
+		"expires_at": now.AddDate(1, 0, 0),
+	})
+	return err
+}
+
+// retrieveAPIKey returns the key and whether it exists and has not expired
+func retrieveAPIKey(db *sqlx.DB, selectSQL string, key string) (apiKey, bool, error) {
+	query, args, err := db.BindNamed(selectSQL, map[string]interface{}{
+		"key": key,
+		"now": time.Now().UTC(),
+	})
+	if err != nil {
+		return apiKey{}, false, err
+	}
+
+	keys := []apiKey{}
+	err = db.Select(&keys, query, args...)
+	if err != nil {
+		return apiKey{}, false, err
+	}
+
+	if len(keys) == 0 {
+		return apiKey{}, false, nil
+	}
+
+	return keys[0], true, nil
+}
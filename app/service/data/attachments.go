@@ -0,0 +1,111 @@
+package data
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// newAttachment inserts or refreshes an attachment by entity, card and
+// Trello attachment ID. The storage key of mirrored attachments is kept.
+func newAttachment(db *sqlx.DB, insertSQL string, att Attachment) (int64, error) {
+	if att.Status == "" {
+		att.Status = AttachmentStatusPending
+	}
+	att.UpdatedAt = time.Now().UTC()
+
+	rows, err := db.NamedQuery(insertSQL, att)
+	if err != nil {
+		return -1, err
+	}
+	defer rows.Close()
+
+	var id int64
+	if rows.Next() {
+		err = rows.Scan(&id)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	return id, nil
+}
+
+func updateAttachment(db *sqlx.DB, updateSQL string, att *Attachment) error {
+	att.UpdatedAt = time.Now().UTC()
+	_, err := db.NamedExec(updateSQL, att)
+	return err
+}
+
+// retrievePendingAttachments returns a page of the attachments that were
+// never mirrored. Failed attachments are left to the dead letter replay so a
+// file that keeps failing is not downloaded again on every run.
+func retrievePendingAttachments(db *sqlx.DB, pageSize int) ([]Attachment, error) {
+	atts := []Attachment{}
+	query := `
+        SELECT * 
+		FROM attachments
+		WHERE status = ? 
+		ORDER BY id
+		LIMIT ?
+    `
+
+	err := db.Select(&atts, db.Rebind(query), AttachmentStatusPending, pageSize)
+	if err != nil {
+		return atts, err
+	}
+
+	return atts, nil
+}
+
+func retrieveAttachmentByID(db *sqlx.DB, id int64) (Attachment, error) {
+	atts := []Attachment{}
+	err := db.Select(&atts, db.Rebind(`SELECT * FROM attachments WHERE id = ?`), id)
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	if len(atts) == 0 {
+		return Attachment{}, fmt.Errorf("Attachment ID %d does not exist", id)
+	}
+
+	return atts[0], nil
+}
+
+// retrieveFiles returns the attachments of the given cards keyed by card ID
+func retrieveFiles(db *sqlx.DB, entityType EntityType, cardIDs []string) (map[string][]Attachment, error) {
+	files := map[string][]Attachment{}
+	if len(cardIDs) == 0 {
+		return files, nil
+	}
+
+	query, args, err := sqlx.In(`
+        SELECT * 
+		FROM attachments
+		WHERE entity_type = ? AND card_id IN (?) 
+		ORDER BY id
+    `, entityType, cardIDs)
+	if err != nil {
+		return files, err
+	}
+
+	atts := []Attachment{}
+	err = db.Select(&atts, db.Rebind(query), args...)
+	if err != nil {
+		return files, err
+	}
+
+	for _, att := range atts {
+		files[att.CardID] = append(files[att.CardID], att)
+	}
+
+	return files, nil
+}
+
+func filesOf(files map[string][]Attachment, cardID string) []Attachment {
+	if atts, ok := files[cardID]; ok {
+		return atts
+	}
+	return []Attachment{}
+}
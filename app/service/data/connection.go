@@ -0,0 +1,120 @@
+package data
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"os"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/mdobak/go-xerrors"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/metric"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+var meter = otel.Meter(fmt.Sprintf("tr.extractor.%s.data", os.Getenv("APP_NAME")))
+
+// connect opens and pings the database, retrying with a linear backoff
+// until the configured number of attempts is exhausted
+func connect(ctx context.Context, cfgsvc config.IService, driver string) (*sqlx.DB, error) {
+	retries := cfgsvc.GetDbConnectRetries()
+	if retries < 1 {
+		retries = 1
+	}
+
+	var lastErr error
+	for attempt := 1; attempt <= retries; attempt++ {
+		db, err := sqlx.ConnectContext(ctx, driver, cfgsvc.GetDbDSN())
+		if err == nil {
+			db.SetMaxOpenConns(cfgsvc.GetDbMaxOpenConns())
+			db.SetMaxIdleConns(cfgsvc.GetDbMaxIdleConns())
+			db.SetConnMaxLifetime(cfgsvc.GetDbConnMaxLifetime())
+			db.SetConnMaxIdleTime(cfgsvc.GetDbConnMaxIdleTime())
+			return db, nil
+		}
+
+		lastErr = err
+		lgr.Logger.Warn(
+			"connecting to database",
+			slog.String("driver", driver),
+			slog.Int("attempt", attempt),
+			slog.Int("retries", retries),
+			slog.Any("error", xerrors.New(err.Error())),
+		)
+
+		if attempt == retries {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(cfgsvc.GetDbConnectRetryDelay() * time.Duration(attempt)):
+		}
+	}
+
+	return nil, fmt.Errorf("connecting to %s database failed after %d attempts: %w", driver, retries, lastErr)
+}
+
+// registerPoolMetrics exports the connection pool stats as observable gauges
+func registerPoolMetrics(db *sqlx.DB, driver string) error {
+	prefix := fmt.Sprintf("tr.extractor.%s.data.pool", os.Getenv("APP_NAME"))
+
+	openConns, err := meter.Int64ObservableGauge(prefix+".open",
+		metric.WithDescription("The number of established connections both in use and idle"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return err
+	}
+
+	inUseConns, err := meter.Int64ObservableGauge(prefix+".in_use",
+		metric.WithDescription("The number of connections currently in use"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return err
+	}
+
+	idleConns, err := meter.Int64ObservableGauge(prefix+".idle",
+		metric.WithDescription("The number of idle connections"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return err
+	}
+
+	waitCount, err := meter.Int64ObservableCounter(prefix+".wait_count",
+		metric.WithDescription("The total number of connections waited for"),
+		metric.WithUnit("1"),
+	)
+	if err != nil {
+		return err
+	}
+
+	waitDuration, err := meter.Float64ObservableCounter(prefix+".wait_duration",
+		metric.WithDescription("The total time blocked waiting for a new connection"),
+		metric.WithUnit("s"),
+	)
+	if err != nil {
+		return err
+	}
+
+	attrs := metric.WithAttributes(attribute.String("driver", driver))
+	_, err = meter.RegisterCallback(func(_ context.Context, o metric.Observer) error {
+		stats := db.Stats()
+		o.ObserveInt64(openConns, int64(stats.OpenConnections), attrs)
+		o.ObserveInt64(inUseConns, int64(stats.InUse), attrs)
+		o.ObserveInt64(idleConns, int64(stats.Idle), attrs)
+		o.ObserveInt64(waitCount, stats.WaitCount, attrs)
+		o.ObserveFloat64(waitDuration, stats.WaitDuration.Seconds(), attrs)
+		return nil
+	}, openConns, inUseConns, idleConns, waitCount, waitDuration)
+
+	return err
+}
@@ -1,24 +1,19 @@
 package data
 
 import (
+	"context"
+	"database/sql"
 	_ "embed"
 	"fmt"
-	"strings"
-	"sync"
+	"io"
 	"time"
 
 	"github.com/jmoiron/sqlx"
-	"github.com/lib/pq"
 	_ "github.com/lib/pq" // Import the PostgreSQL driver
 
 	"github.com/khaledhikmat/tr-extractor/service/config"
 )
 
-var mutex = &sync.Mutex{}
-
-//go:embed sql/reset_factory.sql
-var resetfactorySQL string
-
 //go:embed sql/insertproperty.sql
 var insertpropertySQL string
 
@@ -40,15 +35,30 @@ var updatesupportivedocSQL string
 //go:embed sql/insertattachment.sql
 var insertattachmentSQL string
 
+//go:embed sql/updateattachment.sql
+var updateattachmentSQL string
+
 //go:embed sql/insertjob.sql
 var insertjobSQL string
 
 //go:embed sql/updatejob.sql
 var updatejobSQL string
 
+//go:embed sql/claimjob.sql
+var claimjobSQL string
+
+//go:embed sql/lockjobtype.sql
+var lockjobtypeSQL string
+
+//go:embed sql/lockpipeline.sql
+var lockpipelineSQL string
+
 //go:embed sql/insertapikey.sql
 var insertapikeySQL string
 
+//go:embed sql/selectapikey.sql
+var selectapikeySQL string
+
 //go:embed sql/inserterror.sql
 var inserterrorSQL string
 
@@ -57,852 +67,559 @@ type dataService struct {
 	Db        *sqlx.DB
 }
 
-func New(cfgsvc config.IService) IService {
-	return &dataService{
-		ConfigSvc: cfgsvc,
-	}
-}
-
-func (svc *dataService) ResetFactory() error {
-	err := svc.dbConnection()
+// New connects to Postgres and pings it. The connection is retried per the
+// configured policy so the app does not start without a database.
+func New(ctx context.Context, cfgsvc config.IService) (IService, error) {
+	db, err := connect(ctx, cfgsvc, "postgres")
 	if err != nil {
-		return err
+		return nil, err
 	}
 
-	_, err = svc.Db.Exec(resetfactorySQL)
+	err = registerPoolMetrics(db, "postgres")
 	if err != nil {
-		return err
+		db.Close()
+		return nil, err
 	}
 
-	return nil
+	return &dataService{
+		ConfigSvc: cfgsvc,
+		Db:        db,
+	}, nil
 }
 
-func (svc *dataService) NewProperty(prop Property) (bool, int64, error) {
+func (svc *dataService) Ping(ctx context.Context) error {
 	err := svc.dbConnection()
 	if err != nil {
-		return false, -1, err
+		return err
 	}
 
-	// Make sure that property does not already exist
-	p, err := svc.retrievePropertyByIDs(prop.BoardID, prop.CardID)
-	if err != nil {
-		return false, -1, fmt.Errorf("Error fetching property by ID: %v", err)
-	}
+	return svc.Db.PingContext(ctx)
+}
 
-	// If the property already exists, switch to update the attributes
-	if p.CardID != "" {
-		err = svc.UpdateProperty(&prop)
-		return false, prop.ID, err
+func (svc *dataService) Stats() sql.DBStats {
+	if svc.Db == nil {
+		return sql.DBStats{}
 	}
 
-	// Convert to args so it can be used with the database
-	args := map[string]interface{}{
-		"board_id":     prop.BoardID,
-		"card_id":      prop.CardID,
-		"name":         prop.Name,
-		"location_ar":  prop.LocationAR,
-		"location_en":  prop.LocationEN,
-		"lot":          prop.Lot,
-		"type":         prop.Type,
-		"status":       prop.Status,
-		"owner":        prop.Owner,
-		"area":         prop.Area,
-		"shares":       prop.Shares,
-		"is_organized": prop.Organized,
-		"is_effects":   prop.Effects,
-		"labels":       pq.Array(prop.Labels),
-		"attachments":  pq.Array(prop.Attachments),
-		"comments":     pq.Array(prop.Comments),
-	}
+	return svc.Db.Stats()
+}
 
-	// Execute the insert query using NamedExec or NamedQuery
-	rows, err := svc.Db.NamedQuery(insertpropertySQL, args)
+func (svc *dataService) CountResetRows(scope ResetScope) (map[string]int64, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return false, -1, err
-	}
-	defer rows.Close()
-
-	// Fetch the newly inserted ID if needed
-	if rows.Next() {
-		err = rows.Scan(&prop.ID)
-		if err != nil {
-			return false, -1, err
-		}
+		return map[string]int64{}, err
 	}
 
-	return true, prop.ID, nil
+	return countResetRows(svc.Db, scope)
 }
 
-func (svc *dataService) UpdateProperty(prop *Property) error {
+func (svc *dataService) ResetFactory(scope ResetScope, snapshot io.Writer) (map[string]int64, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return err
+		return map[string]int64{}, err
 	}
 
-	// Make sure the property does exist
-	p, err := svc.retrievePropertyByIDs(prop.BoardID, prop.CardID)
+	return resetRows(svc.Db, scope, snapshot)
+}
+
+func (svc *dataService) NewProperty(prop Property) (UpsertOutcome, int64, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return fmt.Errorf("error fetching property by ID: %v", err)
+		return "", -1, err
 	}
 
-	if p.CardID == "" {
-		return fmt.Errorf("card ID %s does not exist", p.CardID)
-	}
+	return newProperty(svc.Db, insertpropertySQL, updatepropertySQL, prop)
+}
 
-	_, err = svc.Db.Exec(
-		updatepropertySQL,
-		prop.BoardID,
-		prop.CardID,
-		prop.Name,
-		prop.LocationAR,
-		prop.LocationEN,
-		prop.Lot,
-		prop.Type,
-		prop.Status,
-		prop.Owner,
-		prop.Area,
-		prop.Shares,
-		prop.Organized,
-		prop.Effects,
-		pq.Array(prop.Labels),
-		pq.Array(prop.Attachments),
-		pq.Array(prop.Comments),
-		p.ID)
+func (svc *dataService) UpdateProperty(prop *Property) error {
+	err := svc.dbConnection()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return updateProperty(svc.Db, updatepropertySQL, prop)
 }
 
 func (svc *dataService) RetrieveProperties(page, pageSize int, orderBy, orderDir string) ([]Property, error) {
-	props := []Property{}
 	err := svc.dbConnection()
 	if err != nil {
-		return props, err
+		return []Property{}, err
 	}
 
-	if page < 1 {
-		return props, fmt.Errorf("Invalid page number %d", page)
-	}
+	return retrieveProperties(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID(), page, pageSize, orderBy, orderDir)
+}
 
-	if pageSize <= 0 {
-		return props, fmt.Errorf("Invalid page size %d", pageSize)
+func (svc *dataService) NewInheritanceConfinment(prop InheritanceConfinment) (UpsertOutcome, int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return "", -1, err
 	}
 
-	if orderBy != "updated_at" &&
-		orderBy != "area" &&
-		orderBy != "comments" &&
-		orderBy != "attachments" {
-		return props, fmt.Errorf("Invalid order by %s", orderBy)
-	}
+	return newInheritanceConfinment(svc.Db, insertinhconfSQL, updateinhconfSQL, prop)
+}
 
-	if orderDir != "asc" && orderDir != "desc" {
-		return props, fmt.Errorf("Invalid order direction %s", orderDir)
+func (svc *dataService) UpdateInheritanceConfinment(prop *InheritanceConfinment) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
 	}
 
-	boardID := svc.ConfigSvc.GetTrelloPropertiesBoardID()
-
-	// Calculate the offset
-	offset := (page - 1) * pageSize
-
-	query := fmt.Sprintf(`
-        SELECT * 
-		FROM properties 
-		WHERE board_id = $1 
-		ORDER BY %s %s 
-		LIMIT $2 OFFSET $3 
-    `, orderBy, orderDir)
+	return updateInheritanceConfinment(svc.Db, updateinhconfSQL, prop)
+}
 
-	err = svc.Db.Select(&props, query, boardID, pageSize, offset)
+func (svc *dataService) RetrieveInheritanceConfinments(page, pageSize int, orderBy, orderDir string) ([]InheritanceConfinment, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return props, err
+		return []InheritanceConfinment{}, err
 	}
 
-	return props, nil
+	return retrieveInheritanceConfinments(svc.Db, svc.ConfigSvc.GetTrelloInheritanceConfinmentsBoardID(), page, pageSize, orderBy, orderDir)
 }
 
-func (svc *dataService) retrievePropertyByIDs(boardID string, propID string) (Property, error) {
+func (svc *dataService) NewSupportiveDoc(prop SupportiveDoc) (UpsertOutcome, int64, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return Property{}, err
+		return "", -1, err
 	}
 
-	var props []Property
-	query := `
-        SELECT * 
-		FROM properties
-		WHERE board_id = $1 
-		AND card_id = $2 
-		LIMIT 1
-    `
+	return newSupportiveDoc(svc.Db, insertsupportivedocSQL, updatesupportivedocSQL, prop)
+}
 
-	err = svc.Db.Select(&props, query, boardID, propID)
+func (svc *dataService) UpdateSupportiveDoc(prop *SupportiveDoc) error {
+	err := svc.dbConnection()
 	if err != nil {
-		return Property{}, err
-	}
-
-	if len(props) == 0 {
-		return Property{}, nil
+		return err
 	}
 
-	return props[0], nil
+	return updateSupportiveDoc(svc.Db, updatesupportivedocSQL, prop)
 }
 
-func (svc *dataService) RetrievePropertyAttachments(_ int) ([]string, error) {
-	var atts []string
+func (svc *dataService) RetrieveSupportiveDocs(page, pageSize int, orderBy, orderDir string) ([]SupportiveDoc, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return atts, err
+		return []SupportiveDoc{}, err
 	}
 
-	// TODO: The query seems to be returning some properties with empty attachments
-	query := `
-        SELECT location_en, name, attachments 
-		FROM properties
-		WHERE array_length(attachments, 1) > 0 
-    `
+	return retrieveSupportiveDocs(svc.Db, svc.ConfigSvc.GetTrelloSupportiveDocsBoardID(), page, pageSize, orderBy, orderDir)
+}
 
-	rows, err := svc.Db.Query(query)
+func (svc *dataService) NewAttachment(att Attachment) (int64, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return atts, err
+		return -1, err
 	}
-	defer rows.Close()
-
-	var allAtts [][]string // Slice of url slices
-
-	// Iterate over the rows
-	for rows.Next() {
-		var location string
-		var name string
-		var tags []string
-		if err := rows.Scan(&location, &name, pq.Array(&tags)); err != nil {
-			return atts, err
-		}
-		//fmt.Printf("%s-%s tags: %d\n", name, location, len(tags))
-
-		// Add postfix to the attachment URL
-		enhancedTags := []string{}
-		for _, tag := range tags {
-			enhancedTags = append(enhancedTags, fmt.Sprintf("%s|properties|%s_%s", tag, normalizeString(location), normalizeString(name)))
-		}
-		//fmt.Printf("%s-%s enhanced tags: %d\n", name, location, len(enhancedTags))
 
-		allAtts = append(allAtts, enhancedTags)
-	}
+	return newAttachment(svc.Db, insertattachmentSQL, att)
+}
 
-	// Flatten them into a single slice
-	for _, tagSet := range allAtts {
-		atts = append(atts, tagSet...)
+func (svc *dataService) UpdateAttachment(att *Attachment) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
 	}
 
-	return atts, nil
+	return updateAttachment(svc.Db, updateattachmentSQL, att)
 }
 
-func (svc *dataService) NewInheritanceConfinment(prop InheritanceConfinment) (bool, int64, error) {
+func (svc *dataService) RetrievePendingAttachments(pageSize int) ([]Attachment, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return false, -1, err
+		return []Attachment{}, err
 	}
 
-	// Make sure that property does not already exist
-	p, err := svc.retrieveInheritanceConfinmentByIDs(prop.BoardID, prop.CardID)
-	if err != nil {
-		return false, -1, fmt.Errorf("Error fetching inh conf by ID: %v", err)
-	}
+	return retrievePendingAttachments(svc.Db, pageSize)
+}
 
-	// If the property already exists, switch to update the attributes
-	if p.CardID != "" {
-		err = svc.UpdateInheritanceConfinment(&prop)
-		return false, prop.ID, err
+func (svc *dataService) RetrieveAttachmentByID(id int64) (Attachment, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return Attachment{}, err
 	}
 
-	// Convert to args so it can be used with the database
-	args := map[string]interface{}{
-		"board_id":    prop.BoardID,
-		"card_id":     prop.CardID,
-		"name":        prop.Name,
-		"title":       prop.Title,
-		"generation":  prop.Generation,
-		"labels":      pq.Array(prop.Labels),
-		"attachments": pq.Array(prop.Attachments),
-		"comments":    pq.Array(prop.Comments),
-	}
+	return retrieveAttachmentByID(svc.Db, id)
+}
 
-	// Execute the insert query using NamedExec or NamedQuery
-	rows, err := svc.Db.NamedQuery(insertinhconfSQL, args)
+func (svc *dataService) NewJob(job Job) (int64, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return false, -1, err
-	}
-	defer rows.Close()
-
-	// Fetch the newly inserted ID if needed
-	if rows.Next() {
-		err = rows.Scan(&prop.ID)
-		if err != nil {
-			return false, -1, err
-		}
+		return -1, err
 	}
 
-	return true, prop.ID, nil
+	return newJob(svc.Db, insertjobSQL, job)
 }
 
-func (svc *dataService) UpdateInheritanceConfinment(prop *InheritanceConfinment) error {
+func (svc *dataService) UpdateJob(job *Job) error {
 	err := svc.dbConnection()
 	if err != nil {
 		return err
 	}
 
-	// Make sure the property does exist
-	p, err := svc.retrieveInheritanceConfinmentByIDs(prop.BoardID, prop.CardID)
-	if err != nil {
-		return fmt.Errorf("error fetching inh conf by ID: %v", err)
-	}
-
-	if p.CardID == "" {
-		return fmt.Errorf("card ID %s does not exist", p.CardID)
-	}
+	return updateJob(svc.Db, updatejobSQL, job)
+}
 
-	_, err = svc.Db.Exec(
-		updateinhconfSQL,
-		prop.BoardID,
-		prop.CardID,
-		prop.Name,
-		prop.Title,
-		prop.Generation,
-		pq.Array(prop.Labels),
-		pq.Array(prop.Attachments),
-		pq.Array(prop.Comments),
-		p.ID)
+func (svc *dataService) FinishJob(job *Job) error {
+	err := svc.dbConnection()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return finishJob(svc.Db, job)
 }
 
-func (svc *dataService) RetrieveInheritanceConfinments(page, pageSize int, orderBy, orderDir string) ([]InheritanceConfinment, error) {
-	props := []InheritanceConfinment{}
+func (svc *dataService) RetrieveJobByID(id int64) (Job, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return props, err
+		return Job{}, err
 	}
 
-	if page < 1 {
-		return props, fmt.Errorf("Invalid page number %d", page)
-	}
+	return retrieveJobByID(svc.Db, id)
+}
 
-	if pageSize <= 0 {
-		return props, fmt.Errorf("Invalid page size %d", pageSize)
+func (svc *dataService) RetrieveJobs(filter JobFilter, page, pageSize int) ([]Job, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Job{}, err
 	}
 
-	if orderBy != "updated_at" {
-		return props, fmt.Errorf("Invalid order by %s", orderBy)
-	}
+	return retrieveJobs(svc.Db, filter, page, pageSize)
+}
 
-	if orderDir != "asc" && orderDir != "desc" {
-		return props, fmt.Errorf("Invalid order direction %s", orderDir)
+func (svc *dataService) RetrieveJobStats(filter JobFilter) ([]JobStats, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []JobStats{}, err
 	}
 
-	boardID := svc.ConfigSvc.GetTrelloInheritanceConfinmentsBoardID()
-
-	// Calculate the offset
-	offset := (page - 1) * pageSize
-
-	query := fmt.Sprintf(`
-        SELECT * 
-		FROM inheritance_confinments 
-		WHERE board_id = $1 
-		ORDER BY %s %s 
-		LIMIT $2 OFFSET $3 
-    `, orderBy, orderDir)
+	return retrieveJobStats(svc.Db, filter)
+}
 
-	err = svc.Db.Select(&props, query, boardID, pageSize, offset)
+func (svc *dataService) IsPendingJobsByType(jobType JobType) (bool, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return props, err
+		return false, err
 	}
 
-	return props, nil
+	return isPendingJobsByType(svc.Db, jobType)
 }
 
-func (svc *dataService) retrieveInheritanceConfinmentByIDs(boardID string, propID string) (InheritanceConfinment, error) {
+func (svc *dataService) AdmitJob(job Job, limit int) (int64, Job, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return InheritanceConfinment{}, err
+		return -1, Job{}, err
 	}
 
-	var props []InheritanceConfinment
-	query := `
-        SELECT * 
-		FROM inheritance_confinments
-		WHERE board_id = $1 
-		AND card_id = $2 
-		LIMIT 1
-    `
+	return admitJob(svc.Db, lockjobtypeSQL, insertjobSQL, job, limit)
+}
 
-	err = svc.Db.Select(&props, query, boardID, propID)
+func (svc *dataService) ClaimJob(jobType JobType, workerID string) (Job, bool, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return InheritanceConfinment{}, err
+		return Job{}, false, err
 	}
 
-	if len(props) == 0 {
-		return InheritanceConfinment{}, nil
-	}
-
-	return props[0], nil
+	return claimJob(svc.Db, claimjobSQL, jobType, workerID)
 }
 
-func (svc *dataService) RetrieveInheritanceConfinmentAttachments(_ int) ([]string, error) {
-	var atts []string
+func (svc *dataService) HeartbeatJob(id int64, workerID string) (JobState, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return atts, err
+		return "", err
 	}
 
-	// TODO: The query seems to be returning some properties with empty attachments
-	query := `
-        SELECT generation, name, attachments 
-		FROM inheritance_confinments
-		WHERE array_length(attachments, 1) > 0 
-    `
+	return heartbeatJob(svc.Db, id, workerID)
+}
 
-	rows, err := svc.Db.Query(query)
+func (svc *dataService) CancelJob(id int64, cancelledBy, reason string) (Job, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return atts, err
+		return Job{}, err
 	}
-	defer rows.Close()
-
-	var allAtts [][]string // Slice of url slices
-
-	// Iterate over the rows
-	for rows.Next() {
-		var generation int
-		var name string
-		var tags []string
-		if err := rows.Scan(&generation, &name, pq.Array(&tags)); err != nil {
-			return atts, err
-		}
-
-		// Add postfix to the attachment URL
-		enhancedTags := []string{}
-		for _, tag := range tags {
-			enhancedTags = append(enhancedTags, fmt.Sprintf("%s|inheritance_confinments|%d_%s", tag, generation, normalizeString(name)))
-		}
 
-		allAtts = append(allAtts, enhancedTags)
-	}
+	return cancelJob(svc.Db, id, cancelledBy, reason)
+}
 
-	// Flatten them into a single slice
-	for _, tagSet := range allAtts {
-		atts = append(atts, tagSet...)
+func (svc *dataService) UpdateJobProgress(id int64, progress JobProgress) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
 	}
 
-	return atts, nil
+	return updateJobProgress(svc.Db, id, progress)
 }
 
-func (svc *dataService) NewSupportiveDoc(prop SupportiveDoc) (bool, int64, error) {
+func (svc *dataService) ReapStaleJobs(staleBefore time.Time, maxAttempts int) ([]Job, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return false, -1, err
+		return []Job{}, err
 	}
 
-	// Make sure that property does not already exist
-	p, err := svc.retrieveSupportiveDocByIDs(prop.BoardID, prop.CardID)
-	if err != nil {
-		return false, -1, fmt.Errorf("Error fetching inh conf by ID: %v", err)
-	}
+	return reapStaleJobs(svc.Db, staleBefore, maxAttempts)
+}
 
-	// If the property already exists, switch to update the attributes
-	if p.CardID != "" {
-		err = svc.UpdateSupportiveDoc(&prop)
-		return false, prop.ID, err
+func (svc *dataService) RetrieveSchedules() ([]Schedule, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Schedule{}, err
 	}
 
-	// Convert to args so it can be used with the database
-	args := map[string]interface{}{
-		"board_id":    prop.BoardID,
-		"card_id":     prop.CardID,
-		"name":        prop.Name,
-		"title":       prop.Title,
-		"category":    prop.Category,
-		"labels":      pq.Array(prop.Labels),
-		"attachments": pq.Array(prop.Attachments),
-		"comments":    pq.Array(prop.Comments),
-	}
+	return retrieveSchedules(svc.Db)
+}
 
-	// Execute the insert query using NamedExec or NamedQuery
-	rows, err := svc.Db.NamedQuery(insertsupportivedocSQL, args)
+func (svc *dataService) SaveSchedule(schedule Schedule) error {
+	err := svc.dbConnection()
 	if err != nil {
-		return false, -1, err
-	}
-	defer rows.Close()
-
-	// Fetch the newly inserted ID if needed
-	if rows.Next() {
-		err = rows.Scan(&prop.ID)
-		if err != nil {
-			return false, -1, err
-		}
+		return err
 	}
 
-	return true, prop.ID, nil
+	return saveSchedule(svc.Db, schedule)
 }
 
-func (svc *dataService) UpdateSupportiveDoc(prop *SupportiveDoc) error {
+func (svc *dataService) DeleteSchedule(jobType JobType) error {
 	err := svc.dbConnection()
 	if err != nil {
 		return err
 	}
 
-	// Make sure the property does exist
-	p, err := svc.retrieveSupportiveDocByIDs(prop.BoardID, prop.CardID)
+	return deleteSchedule(svc.Db, jobType)
+}
+
+func (svc *dataService) AdvanceSchedule(jobType JobType, due, next time.Time, firedAt *time.Time) (bool, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return fmt.Errorf("error fetching inh conf by ID: %v", err)
+		return false, err
 	}
 
-	if p.CardID == "" {
-		return fmt.Errorf("card ID %s does not exist", p.CardID)
-	}
+	return advanceSchedule(svc.Db, jobType, due, next, firedAt)
+}
 
-	_, err = svc.Db.Exec(
-		updatesupportivedocSQL,
-		prop.BoardID,
-		prop.CardID,
-		prop.Name,
-		prop.Title,
-		prop.Category,
-		pq.Array(prop.Labels),
-		pq.Array(prop.Attachments),
-		pq.Array(prop.Comments),
-		p.ID)
+func (svc *dataService) RetrieveOwnerTotals() ([]OwnerTotal, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return err
+		return []OwnerTotal{}, err
 	}
 
-	return nil
+	return retrieveOwnerTotals(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID())
 }
 
-func (svc *dataService) RetrieveSupportiveDocs(page, pageSize int, orderBy, orderDir string) ([]SupportiveDoc, error) {
-	props := []SupportiveDoc{}
+func (svc *dataService) RetrieveStatusTypeCounts() ([]StatusTypeCount, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return props, err
+		return []StatusTypeCount{}, err
 	}
 
-	if page < 1 {
-		return props, fmt.Errorf("Invalid page number %d", page)
-	}
+	return retrieveStatusTypeCounts(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID())
+}
 
-	if pageSize <= 0 {
-		return props, fmt.Errorf("Invalid page size %d", pageSize)
+func (svc *dataService) RetrieveOrganizedBreakdown() ([]OrganizedBreakdown, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []OrganizedBreakdown{}, err
 	}
 
-	if orderBy != "updated_at" {
-		return props, fmt.Errorf("Invalid order by %s", orderBy)
-	}
+	return retrieveOrganizedBreakdown(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID())
+}
 
-	if orderDir != "asc" && orderDir != "desc" {
-		return props, fmt.Errorf("Invalid order direction %s", orderDir)
+func (svc *dataService) RetrieveEffectProperties() ([]Property, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Property{}, err
 	}
 
-	boardID := svc.ConfigSvc.GetTrelloSupportiveDocsBoardID()
-
-	// Calculate the offset
-	offset := (page - 1) * pageSize
-
-	query := fmt.Sprintf(`
-        SELECT * 
-		FROM supportive_docs 
-		WHERE board_id = $1 
-		ORDER BY %s %s 
-		LIMIT $2 OFFSET $3 
-    `, orderBy, orderDir)
+	return retrieveEffectProperties(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID())
+}
 
-	err = svc.Db.Select(&props, query, boardID, pageSize, offset)
+func (svc *dataService) RetrieveGenerationCounts() ([]GenerationCount, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return props, err
+		return []GenerationCount{}, err
 	}
 
-	return props, nil
+	return retrieveGenerationCounts(svc.Db, svc.ConfigSvc.GetTrelloInheritanceConfinmentsBoardID())
 }
 
-func (svc *dataService) retrieveSupportiveDocByIDs(boardID string, propID string) (SupportiveDoc, error) {
+func (svc *dataService) RetrieveCategoryCounts() ([]CategoryCount, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return SupportiveDoc{}, err
+		return []CategoryCount{}, err
 	}
 
-	var props []SupportiveDoc
-	query := `
-        SELECT * 
-		FROM supportive_docs
-		WHERE board_id = $1 
-		AND card_id = $2 
-		LIMIT 1
-    `
+	return retrieveCategoryCounts(svc.Db, svc.ConfigSvc.GetTrelloSupportiveDocsBoardID())
+}
 
-	err = svc.Db.Select(&props, query, boardID, propID)
+func (svc *dataService) NewPipelineRun(run PipelineRun) (int64, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return SupportiveDoc{}, err
-	}
-
-	if len(props) == 0 {
-		return SupportiveDoc{}, nil
+		return -1, err
 	}
 
-	return props[0], nil
+	return newPipelineRun(svc.Db, lockpipelineSQL, run)
 }
 
-func (svc *dataService) RetrieveSupportiveDocAttachments(_ int) ([]string, error) {
-	var atts []string
+func (svc *dataService) RetrievePipelineRunByID(id int64) (PipelineRun, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return atts, err
+		return PipelineRun{}, err
 	}
 
-	// TODO: The query seems to be returning some properties with empty attachments
-	query := `
-        SELECT category, name, attachments 
-		FROM supportive_docs
-		WHERE array_length(attachments, 1) > 0 
-    `
+	return retrievePipelineRunByID(svc.Db, id)
+}
 
-	rows, err := svc.Db.Query(query)
+func (svc *dataService) RetrievePipelineRuns(filter PipelineRunFilter, page, pageSize int) ([]PipelineRun, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return atts, err
+		return []PipelineRun{}, err
 	}
-	defer rows.Close()
-
-	var allAtts [][]string // Slice of url slices
-
-	// Iterate over the rows
-	for rows.Next() {
-		var category string
-		var name string
-		var tags []string
-		if err := rows.Scan(&category, &name, pq.Array(&tags)); err != nil {
-			return atts, err
-		}
 
-		// Add postfix to the attachment URL
-		enhancedTags := []string{}
-		for _, tag := range tags {
-			enhancedTags = append(enhancedTags, fmt.Sprintf("%s|supportive_docs|%s_%s", tag, normalizeString(category), normalizeString(name)))
-		}
-
-		allAtts = append(allAtts, enhancedTags)
-	}
+	return retrievePipelineRuns(svc.Db, filter, page, pageSize)
+}
 
-	// Flatten them into a single slice
-	for _, tagSet := range allAtts {
-		atts = append(atts, tagSet...)
+func (svc *dataService) StartPipelineStep(runID int64, jobType JobType, job Job) (int64, bool, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return -1, false, err
 	}
 
-	return atts, nil
-}
-
-func normalizeString(input string) string {
-	lower := strings.ToLower(input)
-	normalized := strings.ReplaceAll(lower, " ", "_")
-	return normalized
+	return startPipelineStep(svc.Db, lockjobtypeSQL, insertjobSQL, runID, jobType, job)
 }
 
-func (svc *dataService) IsAttachmentMapped(url string) (bool, error) {
+func (svc *dataService) UpdatePipelineStep(runID int64, jobType JobType, from, to StepState) (bool, error) {
 	err := svc.dbConnection()
 	if err != nil {
 		return false, err
 	}
 
-	var atts []Attachment
-	query := `
-        SELECT * 
-		FROM attachments
-		WHERE trello_url = $1 
-		LIMIT 1
-    `
+	return updatePipelineStep(svc.Db, runID, jobType, from, to)
+}
 
-	err = svc.Db.Select(&atts, query, url)
+func (svc *dataService) FinishPipelineRun(id int64, state PipelineState) (bool, error) {
+	err := svc.dbConnection()
 	if err != nil {
 		return false, err
 	}
 
-	if len(atts) == 0 {
-		return false, nil
-	}
-
-	return true, nil
+	return finishPipelineRun(svc.Db, id, state)
 }
 
-func (svc *dataService) MapAttachment(trelloURL, storageURL string) error {
+func (svc *dataService) SaveDeadLetter(dl DeadLetter) (int64, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return err
+		return -1, err
 	}
 
-	att := Attachment{
-		TrelloURL:  trelloURL,
-		StorageURL: storageURL,
-		UpdatedAt:  time.Now(),
-	}
+	return saveDeadLetter(svc.Db, dl)
+}
 
-	// Execute the insert query using NamedExec or NamedQuery
-	rows, err := svc.Db.NamedQuery(insertattachmentSQL, att)
+func (svc *dataService) RetrieveDeadLetterByID(id int64) (DeadLetter, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return err
-	}
-	defer rows.Close()
-
-	// Fetch the newly inserted ID if needed
-	if rows.Next() {
-		err = rows.Scan(&att.ID)
-		if err != nil {
-			return err
-		}
+		return DeadLetter{}, err
 	}
 
-	return nil
+	return retrieveDeadLetterByID(svc.Db, id)
 }
 
-func (svc *dataService) NewJob(job Job) (int64, error) {
+func (svc *dataService) RetrieveDeadLetters(filter DeadLetterFilter, page, pageSize int) ([]DeadLetter, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return -1, err
+		return []DeadLetter{}, err
 	}
 
-	// Execute the insert query using NamedExec or NamedQuery
-	rows, err := svc.Db.NamedQuery(insertjobSQL, job)
-	if err != nil {
-		return -1, err
-	}
-	defer rows.Close()
+	return retrieveDeadLetters(svc.Db, filter, page, pageSize)
+}
 
-	// Fetch the newly inserted ID if needed
-	if rows.Next() {
-		err = rows.Scan(&job.ID)
-		if err != nil {
-			return -1, err
-		}
+func (svc *dataService) UpdateDeadLetter(dl *DeadLetter) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
 	}
 
-	return job.ID, nil
+	return updateDeadLetter(svc.Db, dl)
 }
 
-func (svc *dataService) UpdateJob(job *Job) error {
+func (svc *dataService) ResolveDeadLetters(entityType EntityType, cardID string, operation DeadLetterOperation, itemKey string) (int64, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return err
+		return 0, err
 	}
 
-	_, err = svc.Db.Exec(updatejobSQL, job.State, job.Cards, job.Errors, job.CompletedAt, job.ID)
+	return resolveDeadLetters(svc.Db, entityType, cardID, operation, itemKey)
+}
+
+func (svc *dataService) NewAPIKey(key string) error {
+	err := svc.dbConnection()
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return newAPIKey(svc.Db, insertapikeySQL, key)
 }
 
-func (svc *dataService) RetrieveJobByID(id int64) (Job, error) {
+func (svc *dataService) IsAPIKeyValid(key string) (bool, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return Job{}, err
+		return false, err
 	}
 
-	var jobs []Job
-	query := `
-        SELECT * FROM jobs 
-		WHERE id = $1 
-		LIMIT 1
-    `
-
-	err = svc.Db.Select(&jobs, query, id)
+	_, ok, err := retrieveAPIKey(svc.Db, selectapikeySQL, key)
 	if err != nil {
-		return Job{}, err
+		return false, err
 	}
 
-	if len(jobs) == 0 {
-		return Job{}, fmt.Errorf("Job ID %d does not exist", id)
+	if !ok {
+		return false, fmt.Errorf("APP KEY %s is not valid", key)
 	}
 
-	return jobs[0], nil
+	return true, nil
 }
 
-func (svc *dataService) IsPendingJobsByType(jobType JobType) (bool, error) {
+func (svc *dataService) IsAdminAPIKeyValid(key string) (bool, error) {
 	err := svc.dbConnection()
 	if err != nil {
 		return false, err
 	}
 
-	var jobs []Job
-	query := `
-        SELECT * FROM jobs 
-		WHERE  type = $1
-		AND state IN ($2, $3) 
-		LIMIT 1
-    `
-
-	err = svc.Db.Select(&jobs, query, jobType, JobStateQueued, JobStateRunning)
+	apiKey, ok, err := retrieveAPIKey(svc.Db, selectapikeySQL, key)
 	if err != nil {
 		return false, err
 	}
 
-	return len(jobs) > 0, nil
+	return ok && apiKey.IsAdmin, nil
 }
 
-func (svc *dataService) NewAPIKey(key string) error {
+func (svc *dataService) NewError(e Error) error {
 	err := svc.dbConnection()
 	if err != nil {
 		return err
 	}
 
-	// Execute the insert query using NamedExec or NamedQuery
-	_, err = svc.Db.Exec(insertapikeySQL, key)
-	if err != nil {
-		return err
-	}
-
-	return nil
+	return newError(svc.Db, inserterrorSQL, e)
 }
 
-func (svc *dataService) IsAPIKeyValid(key string) (bool, error) {
+func (svc *dataService) RetrieveErrors(filter ErrorFilter, page, pageSize int) ([]Error, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return false, err
+		return []Error{}, err
 	}
 
-	var keys []string
-	query := `
-        SELECT key 
-		FROM api_keys 
-		WHERE key = $1
-		AND expires_at > now() 
-		LIMIT 1
-    `
+	return retrieveErrors(svc.Db, filter, page, pageSize)
+}
 
-	err = svc.Db.Select(&keys, query, key)
+func (svc *dataService) RetrieveErrorClassCounts(filter ErrorFilter) ([]ErrorClassCount, error) {
+	err := svc.dbConnection()
 	if err != nil {
-		return false, err
-	}
-
-	if len(keys) == 0 {
-		return false, fmt.Errorf("APP KEY %s is not valid", key)
+		return []ErrorClassCount{}, err
 	}
 
-	return true, nil
+	return retrieveErrorClassCounts(svc.Db, filter)
 }
 
-func (svc *dataService) NewError(source, body string) error {
+func (svc *dataService) PurgeErrors(before time.Time) (int64, error) {
 	err := svc.dbConnection()
 	if err != nil {
-		return err
-	}
-
-	// Execute the insert query using NamedExec or NamedQuery
-	_, err = svc.Db.Exec(inserterrorSQL, source, body)
-	if err != nil {
-		return err
+		return 0, err
 	}
 
-	return nil
+	return purgeErrors(svc.Db, before)
 }
 
 func (svc *dataService) Finalize() {
@@ -912,18 +629,8 @@ func (svc *dataService) Finalize() {
 }
 
 func (svc *dataService) dbConnection() error {
-	var err error
-	if svc.Db != nil {
-		return nil
-	}
-
-	// Allow one thread to access the database at a time
-	mutex.Lock()
-	defer mutex.Unlock()
-
-	svc.Db, err = sqlx.Connect("postgres", svc.ConfigSvc.GetDbDSN())
-	if err != nil {
-		return err
+	if svc.Db == nil {
+		return fmt.Errorf("database is not connected")
 	}
 
 	return nil
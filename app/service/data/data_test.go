@@ -1,6 +1,7 @@
 package data
 
 import (
+	"context"
 	"fmt"
 	"testing"
 
@@ -18,17 +19,21 @@ func TestDataRetrieveAttachments(t *testing.T) {
 	}
 
 	configSvc := config.New()
-	dataSvc := New(configSvc)
+	dataSvc, err := New(context.Background(), configSvc)
+	if err != nil {
+		t.Error(err)
+		return
+	}
 
-	urls, err := dataSvc.RetrievePropertyAttachments(10)
+	atts, err := dataSvc.RetrievePendingAttachments(10)
 	if err != nil {
 		t.Error(err)
 		return
 	}
 
-	fmt.Println("Retrieved attachments:", len(urls))
-	if len(urls) < 20 {
-		t.Error(fmt.Errorf("expected less than urls, got %d", len(urls)))
+	fmt.Println("Retrieved attachments:", len(atts))
+	if len(atts) < 20 {
+		t.Error(fmt.Errorf("expected at least 20 attachments, got %d", len(atts)))
 		return
 	}
 }
@@ -0,0 +1,152 @@
+package data
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// saveDeadLetter records a failed card operation. If the operation already
+// has a pending dead letter, it is refreshed with the latest payload and
+// error and its attempts add up.
+func saveDeadLetter(db *sqlx.DB, dl DeadLetter) (int64, error) {
+	now := time.Now().UTC()
+
+	ids := []int64{}
+	err := db.Select(&ids, db.Rebind(`
+        UPDATE dead_letters
+		SET job_id = ?, payload = ?, error = ?, attempts = attempts + ?, updated_at = ?
+		WHERE entity_type = ?
+		AND card_id = ?
+		AND operation = ?
+		AND item_key = ?
+		AND state = ?
+		RETURNING id
+    `), dl.JobID, dl.Payload, dl.Error, dl.Attempts, now,
+		dl.EntityType, dl.CardID, dl.Operation, dl.ItemKey, DeadLetterStatePending)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(ids) > 0 {
+		return ids[0], nil
+	}
+
+	var id int64
+	err = db.QueryRowx(db.Rebind(`
+        INSERT INTO dead_letters (
+			job_id, entity_type, card_id, item_key, operation, payload, error, attempts, state, created_at, updated_at
+		) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?, ?)
+		RETURNING id
+    `), dl.JobID, dl.EntityType, dl.CardID, dl.ItemKey, dl.Operation, dl.Payload, dl.Error, dl.Attempts,
+		DeadLetterStatePending, now, now).Scan(&id)
+	if err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+func deadLetterWhere(filter DeadLetterFilter) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if filter.JobID != 0 {
+		conditions = append(conditions, "job_id = ?")
+		args = append(args, filter.JobID)
+	}
+
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entity_type = ?")
+		args = append(args, filter.EntityType)
+	}
+
+	if filter.CardID != "" {
+		conditions = append(conditions, "card_id = ?")
+		args = append(args, filter.CardID)
+	}
+
+	if filter.Operation != "" {
+		conditions = append(conditions, "operation = ?")
+		args = append(args, filter.Operation)
+	}
+
+	if filter.State != "" {
+		conditions = append(conditions, "state = ?")
+		args = append(args, filter.State)
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func retrieveDeadLetters(db *sqlx.DB, filter DeadLetterFilter, page, pageSize int) ([]DeadLetter, error) {
+	dls := []DeadLetter{}
+	where, args := deadLetterWhere(filter)
+
+	// Calculate the offset
+	offset := (page - 1) * pageSize
+	args = append(args, pageSize, offset)
+
+	err := db.Select(&dls, db.Rebind(`
+        SELECT *
+		FROM dead_letters`+where+`
+		ORDER BY id
+		LIMIT ? OFFSET ?
+    `), args...)
+	if err != nil {
+		return []DeadLetter{}, err
+	}
+
+	return dls, nil
+}
+
+func retrieveDeadLetterByID(db *sqlx.DB, id int64) (DeadLetter, error) {
+	dls := []DeadLetter{}
+	err := db.Select(&dls, db.Rebind(`SELECT * FROM dead_letters WHERE id = ?`), id)
+	if err != nil {
+		return DeadLetter{}, err
+	}
+
+	if len(dls) == 0 {
+		return DeadLetter{}, fmt.Errorf("Dead letter ID %d does not exist", id)
+	}
+
+	return dls[0], nil
+}
+
+// updateDeadLetter records the outcome of a replay
+func updateDeadLetter(db *sqlx.DB, dl *DeadLetter) error {
+	dl.UpdatedAt = time.Now().UTC()
+	_, err := db.Exec(db.Rebind(`
+        UPDATE dead_letters
+		SET error = ?, attempts = ?, state = ?, updated_at = ?, resolved_at = ?
+		WHERE id = ?
+    `), dl.Error, dl.Attempts, dl.State, dl.UpdatedAt, dl.ResolvedAt, dl.ID)
+	return err
+}
+
+// resolveDeadLetters resolves the pending dead letters of a card operation
+// once a later job succeeded, so a replay cannot overwrite newer content
+func resolveDeadLetters(db *sqlx.DB, entityType EntityType, cardID string, operation DeadLetterOperation, itemKey string) (int64, error) {
+	now := time.Now().UTC()
+	result, err := db.Exec(db.Rebind(`
+        UPDATE dead_letters
+		SET state = ?, updated_at = ?, resolved_at = ?
+		WHERE entity_type = ?
+		AND card_id = ?
+		AND operation = ?
+		AND item_key = ?
+		AND state = ?
+    `), DeadLetterStateResolved, now, now, entityType, cardID, operation, itemKey, DeadLetterStatePending)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
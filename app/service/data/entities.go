@@ -0,0 +1,533 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	"github.com/lib/pq"
+)
+
+// stringArray scans the array columns of either driver: Postgres arrays or
+// JSON text since SQLite has no array type
+type stringArray []string
+
+func (a *stringArray) Scan(src interface{}) error {
+	var b []byte
+	switch v := src.(type) {
+	case nil:
+		*a = nil
+		return nil
+	case string:
+		b = []byte(v)
+	case []byte:
+		b = v
+	default:
+		return fmt.Errorf("cannot scan %T into a string array", src)
+	}
+
+	if len(b) > 0 && b[0] == '[' {
+		return json.Unmarshal(b, (*[]string)(a))
+	}
+
+	var arr pq.StringArray
+	err := arr.Scan(b)
+	if err != nil {
+		return err
+	}
+
+	*a = stringArray(arr)
+	return nil
+}
+
+func (a stringArray) Value() (driver.Value, error) {
+	if a == nil {
+		return "[]", nil
+	}
+
+	b, err := json.Marshal([]string(a))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// arrayValue encodes a string array for the driver of the database
+func arrayValue(db *sqlx.DB, items []string) interface{} {
+	if db.DriverName() == "sqlite" {
+		return stringArray(items)
+	}
+
+	return pq.Array(items)
+}
+
+// Rows shadow the array columns of the models so they scan with either driver
+type propertyRow struct {
+	Property
+	Labels      stringArray `db:"labels"`
+	Attachments stringArray `db:"attachments"`
+	Comments    stringArray `db:"comments"`
+}
+
+func (p propertyRow) toModel() Property {
+	prop := p.Property
+	prop.Labels = pq.StringArray(p.Labels)
+	prop.Attachments = pq.StringArray(p.Attachments)
+	prop.Comments = pq.StringArray(p.Comments)
+	return prop
+}
+
+type inheritanceConfinmentRow struct {
+	InheritanceConfinment
+	Labels      stringArray `db:"labels"`
+	Attachments stringArray `db:"attachments"`
+	Comments    stringArray `db:"comments"`
+}
+
+func (p inheritanceConfinmentRow) toModel() InheritanceConfinment {
+	inh := p.InheritanceConfinment
+	inh.Labels = pq.StringArray(p.Labels)
+	inh.Attachments = pq.StringArray(p.Attachments)
+	inh.Comments = pq.StringArray(p.Comments)
+	return inh
+}
+
+type supportiveDocRow struct {
+	SupportiveDoc
+	Labels      stringArray `db:"labels"`
+	Attachments stringArray `db:"attachments"`
+	Comments    stringArray `db:"comments"`
+}
+
+func (p supportiveDocRow) toModel() SupportiveDoc {
+	doc := p.SupportiveDoc
+	doc.Labels = pq.StringArray(p.Labels)
+	doc.Attachments = pq.StringArray(p.Attachments)
+	doc.Comments = pq.StringArray(p.Comments)
+	return doc
+}
+
+// validatePage checks the paging and ordering of an entity listing against
+// the columns it may be ordered by
+func validatePage(page, pageSize int, orderBy, orderDir string, orderColumns ...string) error {
+	if page < 1 {
+		return fmt.Errorf("Invalid page number %d", page)
+	}
+
+	if pageSize <= 0 {
+		return fmt.Errorf("Invalid page size %d", pageSize)
+	}
+
+	valid := false
+	for _, column := range orderColumns {
+		if orderBy == column {
+			valid = true
+		}
+	}
+
+	if !valid {
+		return fmt.Errorf("Invalid order by %s", orderBy)
+	}
+
+	if orderDir != "asc" && orderDir != "desc" {
+		return fmt.Errorf("Invalid order direction %s", orderDir)
+	}
+
+	return nil
+}
+
+// insertEntity runs a named insert and returns the new ID
+func insertEntity(db *sqlx.DB, insertSQL string, args map[string]interface{}) (int64, error) {
+	rows, err := db.NamedQuery(insertSQL, args)
+	if err != nil {
+		return -1, err
+	}
+	defer rows.Close()
+
+	var id int64
+	if rows.Next() {
+		err = rows.Scan(&id)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	return id, nil
+}
+
+// newProperty inserts the property or, if its card is already stored,
+// updates it when the content changed
+func newProperty(db *sqlx.DB, insertSQL, updateSQL string, prop Property) (UpsertOutcome, int64, error) {
+	// Make sure that property does not already exist
+	p, err := retrievePropertyByIDs(db, prop.BoardID, prop.CardID)
+	if err != nil {
+		return "", -1, fmt.Errorf("Error fetching property by ID: %v", err)
+	}
+
+	// If the property already exists, switch to update the attributes
+	if p.CardID != "" {
+		if p.SameContent(prop) {
+			return UpsertUnchanged, p.ID, nil
+		}
+
+		err = updateProperty(db, updateSQL, &prop)
+		return UpsertUpdated, p.ID, err
+	}
+
+	id, err := insertEntity(db, insertSQL, propertyArgs(db, prop))
+	if err != nil {
+		return "", -1, err
+	}
+
+	return UpsertInserted, id, nil
+}
+
+func updateProperty(db *sqlx.DB, updateSQL string, prop *Property) error {
+	// Make sure the property does exist
+	p, err := retrievePropertyByIDs(db, prop.BoardID, prop.CardID)
+	if err != nil {
+		return fmt.Errorf("error fetching property by ID: %v", err)
+	}
+
+	if p.CardID == "" {
+		return fmt.Errorf("card ID %s does not exist", p.CardID)
+	}
+
+	args := propertyArgs(db, *prop)
+	args["id"] = p.ID
+	_, err = db.NamedExec(updateSQL, args)
+	return err
+}
+
+func propertyArgs(db *sqlx.DB, prop Property) map[string]interface{} {
+	return map[string]interface{}{
+		"board_id":     prop.BoardID,
+		"card_id":      prop.CardID,
+		"name":         prop.Name,
+		"location_ar":  prop.LocationAR,
+		"location_en":  prop.LocationEN,
+		"lot":          prop.Lot,
+		"type":         prop.Type,
+		"status":       prop.Status,
+		"owner":        prop.Owner,
+		"area":         prop.Area,
+		"shares":       prop.Shares,
+		"is_organized": prop.Organized,
+		"is_effects":   prop.Effects,
+		"labels":       arrayValue(db, prop.Labels),
+		"attachments":  arrayValue(db, prop.Attachments),
+		"comments":     arrayValue(db, prop.Comments),
+		"updated_at":   time.Now().UTC(),
+	}
+}
+
+func retrieveProperties(db *sqlx.DB, boardID string, page, pageSize int, orderBy, orderDir string) ([]Property, error) {
+	props := []Property{}
+	err := validatePage(page, pageSize, orderBy, orderDir, "updated_at", "area", "comments", "attachments")
+	if err != nil {
+		return props, err
+	}
+
+	// Calculate the offset
+	offset := (page - 1) * pageSize
+
+	query := fmt.Sprintf(`
+        SELECT *
+		FROM properties
+		WHERE board_id = ?
+		ORDER BY %s %s
+		LIMIT ? OFFSET ?
+    `, orderBy, orderDir)
+
+	var rows []propertyRow
+	err = db.Select(&rows, db.Rebind(query), boardID, pageSize, offset)
+	if err != nil {
+		return props, err
+	}
+
+	cardIDs := []string{}
+	for _, row := range rows {
+		props = append(props, row.toModel())
+		cardIDs = append(cardIDs, row.CardID)
+	}
+
+	files, err := retrieveFiles(db, EntityTypeProperties, cardIDs)
+	if err != nil {
+		return props, err
+	}
+
+	for i := range props {
+		props[i].Files = filesOf(files, props[i].CardID)
+	}
+
+	return props, nil
+}
+
+func retrievePropertyByIDs(db *sqlx.DB, boardID string, cardID string) (Property, error) {
+	var rows []propertyRow
+	query := `
+        SELECT *
+		FROM properties
+		WHERE board_id = ?
+		AND card_id = ?
+		LIMIT 1
+    `
+
+	err := db.Select(&rows, db.Rebind(query), boardID, cardID)
+	if err != nil {
+		return Property{}, err
+	}
+
+	if len(rows) == 0 {
+		return Property{}, nil
+	}
+
+	return rows[0].toModel(), nil
+}
+
+// newInheritanceConfinment inserts the inh conf or, if its card is already
+// stored, updates it when the content changed
+func newInheritanceConfinment(db *sqlx.DB, insertSQL, updateSQL string, inh InheritanceConfinment) (UpsertOutcome, int64, error) {
+	// Make sure that inh conf does not already exist
+	p, err := retrieveInheritanceConfinmentByIDs(db, inh.BoardID, inh.CardID)
+	if err != nil {
+		return "", -1, fmt.Errorf("Error fetching inh conf by ID: %v", err)
+	}
+
+	// If the inh conf already exists, switch to update the attributes
+	if p.CardID != "" {
+		if p.SameContent(inh) {
+			return UpsertUnchanged, p.ID, nil
+		}
+
+		err = updateInheritanceConfinment(db, updateSQL, &inh)
+		return UpsertUpdated, p.ID, err
+	}
+
+	id, err := insertEntity(db, insertSQL, inheritanceConfinmentArgs(db, inh))
+	if err != nil {
+		return "", -1, err
+	}
+
+	return UpsertInserted, id, nil
+}
+
+func updateInheritanceConfinment(db *sqlx.DB, updateSQL string, inh *InheritanceConfinment) error {
+	// Make sure the inh conf does exist
+	p, err := retrieveInheritanceConfinmentByIDs(db, inh.BoardID, inh.CardID)
+	if err != nil {
+		return fmt.Errorf("error fetching inh conf by ID: %v", err)
+	}
+
+	if p.CardID == "" {
+		return fmt.Errorf("card ID %s does not exist", p.CardID)
+	}
+
+	args := inheritanceConfinmentArgs(db, *inh)
+	args["id"] = p.ID
+	_, err = db.NamedExec(updateSQL, args)
+	return err
+}
+
+func inheritanceConfinmentArgs(db *sqlx.DB, inh InheritanceConfinment) map[string]interface{} {
+	return map[string]interface{}{
+		"board_id":    inh.BoardID,
+		"card_id":     inh.CardID,
+		"name":        inh.Name,
+		"title":       inh.Title,
+		"generation":  inh.Generation,
+		"labels":      arrayValue(db, inh.Labels),
+		"attachments": arrayValue(db, inh.Attachments),
+		"comments":    arrayValue(db, inh.Comments),
+		"updated_at":  time.Now().UTC(),
+	}
+}
+
+func retrieveInheritanceConfinments(db *sqlx.DB, boardID string, page, pageSize int, orderBy, orderDir string) ([]InheritanceConfinment, error) {
+	inhs := []InheritanceConfinment{}
+	err := validatePage(page, pageSize, orderBy, orderDir, "updated_at")
+	if err != nil {
+		return inhs, err
+	}
+
+	// Calculate the offset
+	offset := (page - 1) * pageSize
+
+	query := fmt.Sprintf(`
+        SELECT *
+		FROM inheritance_confinments
+		WHERE board_id = ?
+		ORDER BY %s %s
+		LIMIT ? OFFSET ?
+    `, orderBy, orderDir)
+
+	var rows []inheritanceConfinmentRow
+	err = db.Select(&rows, db.Rebind(query), boardID, pageSize, offset)
+	if err != nil {
+		return inhs, err
+	}
+
+	cardIDs := []string{}
+	for _, row := range rows {
+		inhs = append(inhs, row.toModel())
+		cardIDs = append(cardIDs, row.CardID)
+	}
+
+	files, err := retrieveFiles(db, EntityTypeInheritanceConfinments, cardIDs)
+	if err != nil {
+		return inhs, err
+	}
+
+	for i := range inhs {
+		inhs[i].Files = filesOf(files, inhs[i].CardID)
+	}
+
+	return inhs, nil
+}
+
+func retrieveInheritanceConfinmentByIDs(db *sqlx.DB, boardID string, cardID string) (InheritanceConfinment, error) {
+	var rows []inheritanceConfinmentRow
+	query := `
+        SELECT *
+		FROM inheritance_confinments
+		WHERE board_id = ?
+		AND card_id = ?
+		LIMIT 1
+    `
+
+	err := db.Select(&rows, db.Rebind(query), boardID, cardID)
+	if err != nil {
+		return InheritanceConfinment{}, err
+	}
+
+	if len(rows) == 0 {
+		return InheritanceConfinment{}, nil
+	}
+
+	return rows[0].toModel(), nil
+}
+
+// newSupportiveDoc inserts the supportive doc or, if its card is already
+// stored, updates it when the content changed
+func newSupportiveDoc(db *sqlx.DB, insertSQL, updateSQL string, doc SupportiveDoc) (UpsertOutcome, int64, error) {
+	// Make sure that supportive doc does not already exist
+	p, err := retrieveSupportiveDocByIDs(db, doc.BoardID, doc.CardID)
+	if err != nil {
+		return "", -1, fmt.Errorf("Error fetching supportive doc by ID: %v", err)
+	}
+
+	// If the supportive doc already exists, switch to update the attributes
+	if p.CardID != "" {
+		if p.SameContent(doc) {
+			return UpsertUnchanged, p.ID, nil
+		}
+
+		err = updateSupportiveDoc(db, updateSQL, &doc)
+		return UpsertUpdated, p.ID, err
+	}
+
+	id, err := insertEntity(db, insertSQL, supportiveDocArgs(db, doc))
+	if err != nil {
+		return "", -1, err
+	}
+
+	return UpsertInserted, id, nil
+}
+
+func updateSupportiveDoc(db *sqlx.DB, updateSQL string, doc *SupportiveDoc) error {
+	// Make sure the supportive doc does exist
+	p, err := retrieveSupportiveDocByIDs(db, doc.BoardID, doc.CardID)
+	if err != nil {
+		return fmt.Errorf("error fetching supportive doc by ID: %v", err)
+	}
+
+	if p.CardID == "" {
+		return fmt.Errorf("card ID %s does not exist", p.CardID)
+	}
+
+	args := supportiveDocArgs(db, *doc)
+	args["id"] = p.ID
+	_, err = db.NamedExec(updateSQL, args)
+	return err
+}
+
+func supportiveDocArgs(db *sqlx.DB, doc SupportiveDoc) map[string]interface{} {
+	return map[string]interface{}{
+		"board_id":    doc.BoardID,
+		"card_id":     doc.CardID,
+		"name":        doc.Name,
+		"title":       doc.Title,
+		"category":    doc.Category,
+		"labels":      arrayValue(db, doc.Labels),
+		"attachments": arrayValue(db, doc.Attachments),
+		"comments":    arrayValue(db, doc.Comments),
+		"updated_at":  time.Now().UTC(),
+	}
+}
+
+func retrieveSupportiveDocs(db *sqlx.DB, boardID string, page, pageSize int, orderBy, orderDir string) ([]SupportiveDoc, error) {
+	docs := []SupportiveDoc{}
+	err := validatePage(page, pageSize, orderBy, orderDir, "updated_at")
+	if err != nil {
+		return docs, err
+	}
+
+	// Calculate the offset
+	offset := (page - 1) * pageSize
+
+	query := fmt.Sprintf(`
+        SELECT *
+		FROM supportive_docs
+		WHERE board_id = ?
+		ORDER BY %s %s
+		LIMIT ? OFFSET ?
+    `, orderBy, orderDir)
+
+	var rows []supportiveDocRow
+	err = db.Select(&rows, db.Rebind(query), boardID, pageSize, offset)
+	if err != nil {
+		return docs, err
+	}
+
+	cardIDs := []string{}
+	for _, row := range rows {
+		docs = append(docs, row.toModel())
+		cardIDs = append(cardIDs, row.CardID)
+	}
+
+	files, err := retrieveFiles(db, EntityTypeSupportiveDocs, cardIDs)
+	if err != nil {
+		return docs, err
+	}
+
+	for i := range docs {
+		docs[i].Files = filesOf(files, docs[i].CardID)
+	}
+
+	return docs, nil
+}
+
+func retrieveSupportiveDocByIDs(db *sqlx.DB, boardID string, cardID string) (SupportiveDoc, error) {
+	var rows []supportiveDocRow
+	query := `
+        SELECT *
+		FROM supportive_docs
+		WHERE board_id = ?
+		AND card_id = ?
+		LIMIT 1
+    `
+
+	err := db.Select(&rows, db.Rebind(query), boardID, cardID)
+	if err != nil {
+		return SupportiveDoc{}, err
+	}
+
+	if len(rows) == 0 {
+		return SupportiveDoc{}, nil
+	}
+
+	return rows[0].toModel(), nil
+}
@@ -0,0 +1,39 @@
+package data
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestStringArrayScan(t *testing.T) {
+	tests := []struct {
+		name string
+		src  interface{}
+		want stringArray
+	}{
+		{"postgres array", []byte(`{a,"b c"}`), stringArray{"a", "b c"}},
+		{"json text", `["a","b c"]`, stringArray{"a", "b c"}},
+		{"empty postgres array", []byte(`{}`), stringArray{}},
+		{"empty json text", `[]`, stringArray{}},
+		{"null", nil, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got stringArray
+			err := got.Scan(tt.src)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Fatalf("expected %#v, got %#v", tt.want, got)
+			}
+		})
+	}
+
+	var got stringArray
+	if err := got.Scan(42); err == nil {
+		t.Fatal("expected an integer to be rejected")
+	}
+}
@@ -0,0 +1,131 @@
+package data
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// newError fills in the defaults of an error record and inserts it
+func newError(db *sqlx.DB, insertSQL string, e Error) error {
+	if e.Severity == "" {
+		e.Severity = ErrorSeverityError
+	}
+
+	if e.Class == "" {
+		e.Class = ErrorClassInternal
+	}
+	e.OccurredAt = time.Now().UTC()
+
+	rows, err := db.NamedQuery(insertSQL, e)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	return nil
+}
+
+func errorWhere(filter ErrorFilter) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if filter.JobID != 0 {
+		conditions = append(conditions, "job_id = ?")
+		args = append(args, filter.JobID)
+	}
+
+	if filter.CardID != "" {
+		conditions = append(conditions, "card_id = ?")
+		args = append(args, filter.CardID)
+	}
+
+	if filter.EntityType != "" {
+		conditions = append(conditions, "entity_type = ?")
+		args = append(args, filter.EntityType)
+	}
+
+	if filter.Severity != "" {
+		conditions = append(conditions, "severity = ?")
+		args = append(args, filter.Severity)
+	}
+
+	if filter.Class != "" {
+		conditions = append(conditions, "class = ?")
+		args = append(args, filter.Class)
+	}
+
+	if filter.Source != "" {
+		conditions = append(conditions, "source = ?")
+		args = append(args, filter.Source)
+	}
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "occurred_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "occurred_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func retrieveErrors(db *sqlx.DB, filter ErrorFilter, page, pageSize int) ([]Error, error) {
+	errs := []Error{}
+	where, args := errorWhere(filter)
+
+	// Calculate the offset
+	offset := (page - 1) * pageSize
+	args = append(args, pageSize, offset)
+
+	query := db.Rebind(`
+        SELECT * 
+		FROM errors` + where + ` 
+		ORDER BY occurred_at DESC, id DESC 
+		LIMIT ? OFFSET ? 
+    `)
+
+	err := db.Select(&errs, query, args...)
+	if err != nil {
+		return errs, err
+	}
+
+	return errs, nil
+}
+
+func retrieveErrorClassCounts(db *sqlx.DB, filter ErrorFilter) ([]ErrorClassCount, error) {
+	counts := []ErrorClassCount{}
+	where, args := errorWhere(filter)
+
+	query := db.Rebind(`
+        SELECT class, COUNT(*) AS count 
+		FROM errors` + where + ` 
+		GROUP BY class 
+		ORDER BY count DESC
+    `)
+
+	err := db.Select(&counts, query, args...)
+	if err != nil {
+		return counts, err
+	}
+
+	return counts, nil
+}
+
+// purgeErrors deletes the errors that occurred before the cutoff
+func purgeErrors(db *sqlx.DB, before time.Time) (int64, error) {
+	result, err := db.Exec(db.Rebind("DELETE FROM errors WHERE occurred_at < ?"), before.UTC())
+	if err != nil {
+		return 0, err
+	}
+
+	return result.RowsAffected()
+}
@@ -0,0 +1,517 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Finished tells whether a job in this state will not change anymore
+func (s JobState) Finished() bool {
+	return s == JobStateCompleted || s == JobStateCancelled || s == JobStateFailed || s == JobStateTimedOut
+}
+
+// JobOptions are the options of a job as a JSON object. The job registry
+// validates them against the job type when the job is submitted.
+type JobOptions json.RawMessage
+
+func (o JobOptions) MarshalJSON() ([]byte, error) {
+	if len(o) == 0 {
+		return []byte("{}"), nil
+	}
+
+	return o, nil
+}
+
+func (o *JobOptions) UnmarshalJSON(b []byte) error {
+	*o = append((*o)[0:0], b...)
+	return nil
+}
+
+func (o *JobOptions) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*o = nil
+		return nil
+	case string:
+		*o = JobOptions(v)
+		return nil
+	case []byte:
+		*o = append((*o)[0:0], v...)
+		return nil
+	}
+
+	return fmt.Errorf("cannot scan %T into job options", src)
+}
+
+func (o JobOptions) Value() (driver.Value, error) {
+	if len(o) == 0 {
+		return "{}", nil
+	}
+
+	return string(o), nil
+}
+
+// Scan reads a report stored as JSON
+func (r *DryRunReport) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case string:
+		return json.Unmarshal([]byte(v), r)
+	case []byte:
+		return json.Unmarshal(v, r)
+	}
+
+	return fmt.Errorf("cannot scan %T into a dry run report", src)
+}
+
+// Value stores a report as JSON. Jobs that are not dry runs store NULL.
+func (r *DryRunReport) Value() (driver.Value, error) {
+	if r == nil {
+		return nil, nil
+	}
+
+	b, err := json.Marshal(*r)
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+func jobWhere(filter JobFilter, finished bool) (string, []interface{}) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if filter.Type != "" {
+		conditions = append(conditions, "type = ?")
+		args = append(args, filter.Type)
+	}
+
+	if filter.State != "" {
+		conditions = append(conditions, "state = ?")
+		args = append(args, filter.State)
+	}
+
+	if !filter.From.IsZero() {
+		conditions = append(conditions, "started_at >= ?")
+		args = append(args, filter.From.UTC())
+	}
+
+	if !filter.To.IsZero() {
+		conditions = append(conditions, "started_at < ?")
+		args = append(args, filter.To.UTC())
+	}
+
+	if finished {
+		conditions = append(conditions, "completed_at IS NOT NULL")
+	}
+
+	if len(conditions) == 0 {
+		return "", args
+	}
+
+	return " WHERE " + strings.Join(conditions, " AND "), args
+}
+
+func retrieveJobs(db *sqlx.DB, filter JobFilter, page, pageSize int) ([]Job, error) {
+	jobs := []Job{}
+	where, args := jobWhere(filter, false)
+
+	// Calculate the offset
+	offset := (page - 1) * pageSize
+	args = append(args, pageSize, offset)
+
+	query := db.Rebind(`
+        SELECT * 
+		FROM jobs` + where + ` 
+		ORDER BY id DESC 
+		LIMIT ? OFFSET ? 
+    `)
+
+	err := db.Select(&jobs, query, args...)
+	if err != nil {
+		return jobs, err
+	}
+
+	return jobs, nil
+}
+
+func retrieveJobStats(db *sqlx.DB, filter JobFilter) ([]JobStats, error) {
+	jobs := []Job{}
+	where, args := jobWhere(filter, true)
+
+	// Percentiles are not portable across drivers so stats are computed here
+	err := db.Select(&jobs, db.Rebind(`SELECT * FROM jobs`+where), args...)
+	if err != nil {
+		return []JobStats{}, err
+	}
+
+	return NewJobStats(jobs), nil
+}
+
+// NewJobStats summarizes finished jobs by type. A run succeeds if it
+// completed without errors. The p95 duration uses the nearest rank.
+func NewJobStats(jobs []Job) []JobStats {
+	byType := map[JobType][]Job{}
+	for _, job := range jobs {
+		if job.CompletedAt == nil {
+			continue
+		}
+		byType[job.Type] = append(byType[job.Type], job)
+	}
+
+	stats := []JobStats{}
+	for jobType, runs := range byType {
+		s := JobStats{
+			Type: jobType,
+			Runs: int64(len(runs)),
+		}
+
+		durations := []float64{}
+		var totalDuration, totalCards float64
+		for _, job := range runs {
+			if job.State == JobStateCompleted && job.Errors == 0 {
+				s.Succeeded++
+			}
+
+			duration := job.CompletedAt.Sub(job.StartedAt).Seconds()
+			durations = append(durations, duration)
+			totalDuration += duration
+			totalCards += float64(job.Cards)
+		}
+
+		sort.Float64s(durations)
+		rank := int(math.Ceil(0.95*float64(len(durations)))) - 1
+		s.SuccessRate = float64(s.Succeeded) / float64(s.Runs)
+		s.MeanDurationSeconds = totalDuration / float64(s.Runs)
+		s.P95DurationSeconds = durations[rank]
+		s.MeanCards = totalCards / float64(s.Runs)
+		stats = append(stats, s)
+	}
+
+	sort.Slice(stats, func(i, j int) bool {
+		return stats[i].Type < stats[j].Type
+	})
+
+	return stats
+}
+
+var (
+	// ErrJobNotClaimed is returned when a worker heartbeats or finishes a job it no longer owns
+	ErrJobNotClaimed = errors.New("job is not claimed by this worker")
+	// ErrJobNotCancellable is returned when cancelling a job that is neither queued nor running
+	ErrJobNotCancellable = errors.New("job is not queued or running")
+	// ErrJobLimitReached is returned when admitting a job of a type that is at its concurrency limit
+	ErrJobLimitReached = errors.New("job type is at its concurrency limit")
+)
+
+// admitJob inserts the job unless its type already has limit jobs queued or
+// running. The check and the insert are one transaction. lockSQL takes a
+// transaction advisory lock on the type so admissions on every replica are
+// serialized. At the limit, it returns the latest active job of the type.
+func admitJob(db *sqlx.DB, lockSQL, insertSQL string, job Job, limit int) (int64, Job, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return -1, Job{}, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	active, err := activeJobs(tx, lockSQL, job.Type)
+	if err != nil {
+		return -1, Job{}, err
+	}
+
+	if len(active) >= limit {
+		return -1, active[0], ErrJobLimitReached
+	}
+
+	rows, err := tx.NamedQuery(insertSQL, job)
+	if err != nil {
+		return -1, Job{}, err
+	}
+
+	if !rows.Next() {
+		_ = rows.Close()
+		return -1, Job{}, errors.New("new job did not return an ID")
+	}
+
+	err = rows.Scan(&job.ID)
+	_ = rows.Close()
+	if err != nil {
+		return -1, Job{}, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return -1, Job{}, err
+	}
+
+	return job.ID, Job{}, nil
+}
+
+// activeJobs locks the job type for the rest of the transaction and returns
+// its queued or running jobs, latest first. Without lockSQL, it only reads.
+func activeJobs(tx *sqlx.Tx, lockSQL string, jobType JobType) ([]Job, error) {
+	if lockSQL != "" {
+		_, err := tx.Exec(lockSQL, jobType)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	jobs := []Job{}
+	err := tx.Select(&jobs, tx.Rebind(`
+        SELECT * FROM jobs 
+		WHERE type = ? 
+		AND state IN (?, ?, ?) 
+		ORDER BY id DESC
+    `), jobType, JobStateQueued, JobStateRunning, JobStateCancelling)
+	if err != nil {
+		return nil, err
+	}
+
+	return jobs, nil
+}
+
+func newJob(db *sqlx.DB, insertSQL string, job Job) (int64, error) {
+	rows, err := db.NamedQuery(insertSQL, job)
+	if err != nil {
+		return -1, err
+	}
+	defer rows.Close()
+
+	// Fetch the newly inserted ID if needed
+	if rows.Next() {
+		err = rows.Scan(&job.ID)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	return job.ID, nil
+}
+
+func updateJob(db *sqlx.DB, updateSQL string, job *Job) error {
+	_, err := db.Exec(updateSQL, job.State, job.Cards, job.Errors, job.Inserted, job.Updated, job.Unchanged, job.Failed, job.CompletedAt, job.Report, job.ID)
+	return err
+}
+
+func retrieveJobByID(db *sqlx.DB, id int64) (Job, error) {
+	jobs := []Job{}
+	err := db.Select(&jobs, db.Rebind(`SELECT * FROM jobs WHERE id = ? LIMIT 1`), id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if len(jobs) == 0 {
+		return Job{}, fmt.Errorf("Job ID %d does not exist", id)
+	}
+
+	return jobs[0], nil
+}
+
+func isPendingJobsByType(db *sqlx.DB, jobType JobType) (bool, error) {
+	jobs := []Job{}
+	err := db.Select(&jobs, db.Rebind(`
+        SELECT * FROM jobs 
+		WHERE type = ?
+		AND state IN (?, ?, ?) 
+		LIMIT 1
+    `), jobType, JobStateQueued, JobStateRunning, JobStateCancelling)
+	if err != nil {
+		return false, err
+	}
+
+	return len(jobs) > 0, nil
+}
+
+// claimJob moves the oldest queued job of a type to running and assigns it
+// to the worker. The claim SQL differs per driver since only Postgres
+// supports `FOR UPDATE SKIP LOCKED`.
+func claimJob(db *sqlx.DB, claimSQL string, jobType JobType, workerID string) (Job, bool, error) {
+	jobs := []Job{}
+	err := db.Select(&jobs, claimSQL, JobStateRunning, workerID, time.Now().UTC(), jobType, JobStateQueued)
+	if err != nil {
+		return Job{}, false, err
+	}
+
+	if len(jobs) == 0 {
+		return Job{}, false, nil
+	}
+
+	return jobs[0], true, nil
+}
+
+// heartbeatJob returns the job state so the worker learns about a
+// cancellation requested on another replica
+func heartbeatJob(db *sqlx.DB, id int64, workerID string) (JobState, error) {
+	states := []JobState{}
+	err := db.Select(&states, db.Rebind(`
+        UPDATE jobs 
+		SET heartbeat_at = ? 
+		WHERE id = ? 
+		AND worker_id = ? 
+		AND state IN (?, ?) 
+		RETURNING state
+    `), time.Now().UTC(), id, workerID, JobStateRunning, JobStateCancelling)
+	if err != nil {
+		return "", err
+	}
+
+	if len(states) == 0 {
+		return "", ErrJobNotClaimed
+	}
+
+	return states[0], nil
+}
+
+// finishJob writes the final state and counts of a job. Only the worker
+// that holds the claim on the running (or cancelling) job may write it, so
+// a worker the reaper took the job from cannot overwrite the next attempt.
+func finishJob(db *sqlx.DB, job *Job) error {
+	result, err := db.Exec(db.Rebind(`
+        UPDATE jobs 
+		SET 
+			state = ?, 
+			cards = ?, 
+			errors = ?, 
+			inserted = ?, 
+			updated = ?, 
+			unchanged = ?, 
+			failed = ?, 
+			completed_at = ?, 
+			report = ? 
+		WHERE id = ? 
+		AND worker_id = ? 
+		AND state IN (?, ?)
+    `), job.State, job.Cards, job.Errors, job.Inserted, job.Updated, job.Unchanged, job.Failed, job.CompletedAt, job.Report,
+		job.ID, job.WorkerID, JobStateRunning, JobStateCancelling)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+
+	if n == 0 {
+		return ErrJobNotClaimed
+	}
+
+	return nil
+}
+
+// cancelJob cancels a queued job right away. A running job moves to
+// cancelling until its worker stops it at the next card.
+func cancelJob(db *sqlx.DB, id int64, cancelledBy, reason string) (Job, error) {
+	jobs := []Job{}
+	err := db.Select(&jobs, db.Rebind(`
+        UPDATE jobs 
+		SET 
+			state = CASE WHEN state = ? THEN ? ELSE ? END, 
+			completed_at = CASE WHEN state = ? THEN ? ELSE completed_at END, 
+			cancelled_by = ?, 
+			cancel_reason = ? 
+		WHERE id = ? 
+		AND state IN (?, ?) 
+		RETURNING *
+    `), JobStateQueued, JobStateCancelled, JobStateCancelling,
+		JobStateQueued, time.Now().UTC(),
+		cancelledBy, reason, id, JobStateQueued, JobStateRunning)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if len(jobs) > 0 {
+		return jobs[0], nil
+	}
+
+	err = db.Select(&jobs, db.Rebind(`SELECT * FROM jobs WHERE id = ?`), id)
+	if err != nil {
+		return Job{}, err
+	}
+
+	if len(jobs) == 0 {
+		return Job{}, fmt.Errorf("Job ID %d does not exist", id)
+	}
+
+	return jobs[0], ErrJobNotCancellable
+}
+
+func updateJobProgress(db *sqlx.DB, id int64, progress JobProgress) error {
+	_, err := db.Exec(db.Rebind(`
+        UPDATE jobs 
+		SET cards = ?, processed = ?, failed = ?, current_card = ?, progress_at = ? 
+		WHERE id = ?
+    `), progress.Total, progress.Processed, progress.Failed, progress.CurrentCard, time.Now().UTC(), id)
+	return err
+}
+
+// reapStaleJobs requeues running jobs whose heartbeat is older than
+// staleBefore or fails them once they used up their attempts. Stale jobs
+// that were being cancelled are cancelled.
+// Each update re-checks the heartbeat so a job that came back to life
+// in the meantime is left alone.
+func reapStaleJobs(db *sqlx.DB, staleBefore time.Time, maxAttempts int) ([]Job, error) {
+	staleBefore = staleBefore.UTC()
+	stale := []Job{}
+	err := db.Select(&stale, db.Rebind(`
+        SELECT * FROM jobs 
+		WHERE state IN (?, ?) 
+		AND (heartbeat_at IS NULL OR heartbeat_at < ?) 
+		ORDER BY id
+    `), JobStateRunning, JobStateCancelling, staleBefore)
+	if err != nil {
+		return []Job{}, err
+	}
+
+	reaped := []Job{}
+	for _, job := range stale {
+		state := job.State
+		now := time.Now().UTC()
+		switch {
+		case state == JobStateCancelling:
+			job.State = JobStateCancelled
+			job.CompletedAt = &now
+		case job.Attempts >= maxAttempts:
+			job.State = JobStateFailed
+			job.CompletedAt = &now
+		default:
+			job.State = JobStateQueued
+			job.CompletedAt = nil
+		}
+
+		result, err := db.Exec(db.Rebind(`
+            UPDATE jobs 
+			SET state = ?, worker_id = '', completed_at = ? 
+			WHERE id = ? 
+			AND state = ? 
+			AND (heartbeat_at IS NULL OR heartbeat_at < ?)
+        `), job.State, job.CompletedAt, job.ID, state, staleBefore)
+		if err != nil {
+			return reaped, err
+		}
+
+		affected, err := result.RowsAffected()
+		if err != nil {
+			return reaped, err
+		}
+
+		if affected > 0 {
+			job.WorkerID = ""
+			reaped = append(reaped, job)
+		}
+	}
+
+	return reaped, nil
+}
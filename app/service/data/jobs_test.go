@@ -0,0 +1,43 @@
+package data
+
+import (
+	"testing"
+	"time"
+)
+
+func TestNewJobStats(t *testing.T) {
+	start := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	finished := func(jobType JobType, state JobState, seconds int, cards, errors int64) Job {
+		completedAt := start.Add(time.Duration(seconds) * time.Second)
+		return Job{Type: jobType, State: state, Cards: cards, Errors: errors, StartedAt: start, CompletedAt: &completedAt}
+	}
+
+	jobs := []Job{}
+	for i := 1; i <= 20; i++ {
+		jobs = append(jobs, finished(JobTypeProperties, JobStateCompleted, i, 10, 0))
+	}
+	jobs[0].Errors = 1
+	jobs[1].State = JobStateCancelled
+	jobs = append(jobs,
+		finished(JobTypeAttachments, JobStateCompleted, 60, 4, 0),
+		Job{Type: JobTypeAttachments, State: JobStateRunning, StartedAt: start},
+	)
+
+	stats := NewJobStats(jobs)
+	if len(stats) != 2 {
+		t.Fatalf("expected stats for 2 types, got %+v", stats)
+	}
+
+	attachments, properties := stats[0], stats[1]
+	if attachments.Runs != 1 || attachments.SuccessRate != 1 || attachments.P95DurationSeconds != 60 || attachments.MeanCards != 4 {
+		t.Errorf("unexpected attachment stats %+v", attachments)
+	}
+
+	if properties.Runs != 20 || properties.Succeeded != 18 || properties.SuccessRate != 0.9 {
+		t.Errorf("unexpected property success %+v", properties)
+	}
+
+	if properties.MeanDurationSeconds != 10.5 || properties.P95DurationSeconds != 19 || properties.MeanCards != 10 {
+		t.Errorf("unexpected property durations %+v", properties)
+	}
+}
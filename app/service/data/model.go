@@ -25,6 +25,7 @@ type Property struct {
 	Attachments pq.StringArray `json:"attachments" db:"attachments"`
 	Comments    pq.StringArray `json:"comments" db:"comments"`
 	UpdatedAt   time.Time      `json:"updatedAt" db:"updated_at"`
+	Files       []Attachment   `json:"files" db:"-"`
 }
 
 type InheritanceConfinment struct {
@@ -38,6 +39,7 @@ type InheritanceConfinment struct {
 	Attachments pq.StringArray `json:"attachments" db:"attachments"`
 	Comments    pq.StringArray `json:"comments" db:"comments"`
 	UpdatedAt   time.Time      `json:"updatedAt" db:"updated_at"`
+	Files       []Attachment   `json:"files" db:"-"`
 }
 
 type SupportiveDoc struct {
@@ -51,22 +53,58 @@ type SupportiveDoc struct {
 	Attachments pq.StringArray `json:"attachments" db:"attachments"`
 	Comments    pq.StringArray `json:"comments" db:"comments"`
 	UpdatedAt   time.Time      `json:"updatedAt" db:"updated_at"`
+	Files       []Attachment   `json:"files" db:"-"`
 }
 
+// EntityType identifies the Trello board entity an attachment belongs to.
+// It doubles as the storage folder for mirrored attachments.
+type EntityType string
+
+const (
+	EntityTypeProperties             EntityType = "properties"
+	EntityTypeInheritanceConfinments EntityType = "inheritance_confinments"
+	EntityTypeSupportiveDocs         EntityType = "supportive_docs"
+)
+
+type AttachmentStatus string
+
+const (
+	AttachmentStatusPending  AttachmentStatus = "pending"
+	AttachmentStatusMirrored AttachmentStatus = "mirrored"
+	AttachmentStatusFailed   AttachmentStatus = "failed"
+)
+
 type Attachment struct {
-	ID         int64     `json:"id" db:"id"`
-	TrelloURL  string    `json:"trelloUrl" db:"trello_url"`
-	StorageURL string    `json:"storageUrl" db:"storage_url"`
-	UpdatedAt  time.Time `json:"updatedAt" db:"updated_at"`
+	ID                 int64      `json:"id" db:"id"`
+	EntityType         EntityType `json:"entityType" db:"entity_type"`
+	CardID             string     `json:"cardId" db:"card_id"`
+	TrelloAttachmentID string     `json:"trelloAttachmentId" db:"trello_attachment_id"`
+	TrelloURL          string     `json:"trelloUrl" db:"trello_url"`
+	Name               string     `json:"name" db:"name"`
+	MimeType           string     `json:"mimeType" db:"mime_type"`
+	Size               int64      `json:"size" db:"size"`
+	Checksum           string     `json:"checksum" db:"checksum"`
+	StorageKey         string     `json:"storageKey" db:"storage_key"`
+	StorageURL         string     `json:"storageUrl" db:"storage_url"`
+	// DownloadURL is the link the API hands out in place of the storage URL.
+	// It is signed for the attachment and redirects to a short-lived signed
+	// URL of the storage.
+	DownloadURL string           `json:"downloadUrl,omitempty" db:"-"`
+	Status      AttachmentStatus `json:"status" db:"status"`
+	UpdatedAt   time.Time        `json:"updatedAt" db:"updated_at"`
 }
 
 type JobState string
 
 const (
-	JobStateQueued    JobState = "queued"
-	JobStateRunning   JobState = "running"
-	JobStateCancelled JobState = "cancelled"
-	JobStateCompleted JobState = "completed"
+	JobStateQueued     JobState = "queued"
+	JobStateRunning    JobState = "running"
+	JobStateCancelling JobState = "cancelling"
+	JobStateCancelled  JobState = "cancelled"
+	JobStateCompleted  JobState = "completed"
+	JobStateFailed     JobState = "failed"
+	// JobStateTimedOut is a job the watchdog stopped. It keeps the counts it reached.
+	JobStateTimedOut JobState = "timedout"
 )
 
 type JobType string
@@ -76,21 +114,327 @@ const (
 	JobTypeInheitanceConfinments JobType = "inhconfinments"
 	JobTypeSupportiveDocs        JobType = "supportivedocs"
 	JobTypeAttachments           JobType = "attachments"
+	JobTypeNotify                JobType = "notify"
+	JobTypeDeadLetters           JobType = "deadletters"
 )
 
 type Job struct {
-	ID          int64      `json:"id" db:"id"`
-	Type        JobType    `json:"type" db:"type"`
-	State       JobState   `json:"state" db:"state"`
-	Cards       int64      `json:"cards" db:"cards"`
-	Errors      int64      `json:"errors" db:"errors"`
-	StartedAt   time.Time  `json:"startedAt" db:"started_at"`
-	CompletedAt *time.Time `json:"completedAt" db:"completed_at"`
+	ID           int64         `json:"id" db:"id"`
+	Type         JobType       `json:"type" db:"type"`
+	State        JobState      `json:"state" db:"state"`
+	Cards        int64         `json:"cards" db:"cards"`
+	Errors       int64         `json:"errors" db:"errors"`
+	Inserted     int64         `json:"inserted" db:"inserted"`
+	Updated      int64         `json:"updated" db:"updated"`
+	Unchanged    int64         `json:"unchanged" db:"unchanged"`
+	Failed       int64         `json:"failed" db:"failed"`
+	StartedAt    time.Time     `json:"startedAt" db:"started_at"`
+	CompletedAt  *time.Time    `json:"completedAt" db:"completed_at"`
+	PageSize     int           `json:"pageSize" db:"page_size"`
+	Attempts     int           `json:"attempts" db:"attempts"`
+	WorkerID     string        `json:"workerId" db:"worker_id"`
+	HeartbeatAt  *time.Time    `json:"heartbeatAt" db:"heartbeat_at"`
+	CancelledBy  string        `json:"cancelledBy" db:"cancelled_by"`
+	CancelReason string        `json:"cancelReason" db:"cancel_reason"`
+	Processed    int64         `json:"processed" db:"processed"`
+	CurrentCard  string        `json:"currentCard" db:"current_card"`
+	ProgressAt   *time.Time    `json:"progressAt" db:"progress_at"`
+	DryRun       bool          `json:"dryRun" db:"dry_run"`
+	Report       *DryRunReport `json:"report,omitempty" db:"report"`
+	Options      JobOptions    `json:"options" db:"options"`
+}
+
+// JobProgress is what a running job reports. Total is the number of cards
+// discovered so far.
+type JobProgress struct {
+	Total       int64
+	Processed   int64
+	Failed      int64
+	CurrentCard string
+}
+
+type CatchUpPolicy string
+
+const (
+	CatchUpOnce CatchUpPolicy = "once"
+	CatchUpSkip CatchUpPolicy = "skip"
+)
+
+// Schedule fires a job type on a cron expression. The next fire time is
+// stored so replicas agree on it and runs missed during downtime are detected.
+type Schedule struct {
+	JobType     JobType       `json:"jobType" db:"job_type"`
+	Cron        string        `json:"cron" db:"cron"`
+	TimeZone    string        `json:"timeZone" db:"time_zone"`
+	CatchUp     CatchUpPolicy `json:"catchUp" db:"catch_up"`
+	LastFiredAt *time.Time    `json:"lastFiredAt" db:"last_fired_at"`
+	NextFireAt  time.Time     `json:"nextFireAt" db:"next_fire_at"`
+	UpdatedAt   time.Time     `json:"updatedAt" db:"updated_at"`
+}
+
+type PipelineState string
+
+const (
+	PipelineStateRunning   PipelineState = "running"
+	PipelineStateCompleted PipelineState = "completed"
+	PipelineStateFailed    PipelineState = "failed"
+)
+
+type StepState string
+
+const (
+	StepStatePending   StepState = "pending"
+	StepStateRunning   StepState = "running"
+	StepStateCompleted StepState = "completed"
+	StepStateFailed    StepState = "failed"
+	StepStateSkipped   StepState = "skipped"
+)
+
+// FailurePolicy tells what a pipeline does when one of its steps fails
+type FailurePolicy string
+
+const (
+	// FailurePolicyStop skips the pending steps and fails the run
+	FailurePolicyStop FailurePolicy = "stop"
+	// FailurePolicyContinue runs the dependent steps as if the step completed
+	FailurePolicyContinue FailurePolicy = "continue"
+)
+
+// PipelineRun is a single run of a pipeline. The steps are copied from the
+// pipeline definition when the run starts.
+type PipelineRun struct {
+	ID          int64          `json:"id" db:"id"`
+	Pipeline    string         `json:"pipeline" db:"pipeline"`
+	State       PipelineState  `json:"state" db:"state"`
+	TriggeredBy string         `json:"triggeredBy" db:"triggered_by"`
+	StartedAt   time.Time      `json:"startedAt" db:"started_at"`
+	CompletedAt *time.Time     `json:"completedAt" db:"completed_at"`
+	Steps       []PipelineStep `json:"steps" db:"-"`
+}
+
+// PipelineStep runs a job of its type once the steps it depends on finished
+type PipelineStep struct {
+	RunID     int64         `json:"-" db:"run_id"`
+	JobType   JobType       `json:"jobType" db:"job_type"`
+	DependsOn JobTypes      `json:"dependsOn" db:"depends_on"`
+	OnFailure FailurePolicy `json:"onFailure" db:"on_failure"`
+	State     StepState     `json:"state" db:"state"`
+	JobID     *int64        `json:"jobId" db:"job_id"`
+	UpdatedAt time.Time     `json:"updatedAt" db:"updated_at"`
+}
+
+// JobTypes is stored as JSON text so both drivers share the same queries
+type JobTypes []JobType
+
+// PipelineRunFilter narrows pipeline run queries. Zero values do not filter.
+type PipelineRunFilter struct {
+	Pipeline string
+	State    PipelineState
+}
+
+// JobFilter narrows job queries. Zero values do not filter.
+// From and To apply to the start time.
+type JobFilter struct {
+	Type  JobType
+	State JobState
+	From  time.Time
+	To    time.Time
+}
+
+// JobStats summarizes the finished runs of a job type
+type JobStats struct {
+	Type                JobType `json:"type"`
+	Runs                int64   `json:"runs"`
+	Succeeded           int64   `json:"succeeded"`
+	SuccessRate         float64 `json:"successRate"`
+	MeanDurationSeconds float64 `json:"meanDurationSeconds"`
+	P95DurationSeconds  float64 `json:"p95DurationSeconds"`
+	MeanCards           float64 `json:"meanCards"`
+}
+
+// UpsertOutcome tells what an upsert did with a card
+type UpsertOutcome string
+
+const (
+	UpsertInserted  UpsertOutcome = "inserted"
+	UpsertUpdated   UpsertOutcome = "updated"
+	UpsertUnchanged UpsertOutcome = "unchanged"
+)
+
+// FieldDiff is a card field that a sync would change
+type FieldDiff struct {
+	Field string      `json:"field"`
+	Old   interface{} `json:"old"`
+	New   interface{} `json:"new"`
 }
 
+// CardChange is a card that a sync would insert, update or archive.
+// Only updates list the fields that change.
+type CardChange struct {
+	CardID string      `json:"cardId"`
+	Name   string      `json:"name"`
+	Fields []FieldDiff `json:"fields,omitempty"`
+}
+
+// AttachmentUpload is an attachment that a sync would mirror to storage
+type AttachmentUpload struct {
+	EntityType         EntityType `json:"entityType"`
+	CardID             string     `json:"cardId"`
+	TrelloAttachmentID string     `json:"trelloAttachmentId"`
+	Name               string     `json:"name"`
+	StorageKey         string     `json:"storageKey"`
+}
+
+// DryRunReport is what a dry run job found it would do. Archivals are the
+// stored cards that Trello no longer returns.
+type DryRunReport struct {
+	Inserts   []CardChange       `json:"inserts"`
+	Updates   []CardChange       `json:"updates"`
+	Archivals []CardChange       `json:"archivals"`
+	Uploads   []AttachmentUpload `json:"uploads"`
+}
+
+// DeadLetterOperation is the card operation a dead letter replays
+type DeadLetterOperation string
+
+const (
+	// DeadLetterOperationUpsert stores a board card. The payload is the entity.
+	DeadLetterOperationUpsert DeadLetterOperation = "upsert"
+	// DeadLetterOperationMirror copies an attachment to storage. The payload is the attachment.
+	DeadLetterOperationMirror DeadLetterOperation = "mirror"
+)
+
+type DeadLetterState string
+
+const (
+	DeadLetterStatePending  DeadLetterState = "pending"
+	DeadLetterStateResolved DeadLetterState = "resolved"
+)
+
+// DeadLetter is a card operation that still failed after its retries.
+// There is at most one pending dead letter per card operation. ItemKey
+// tells apart the operations of the same card i.e. the Trello attachment ID.
+type DeadLetter struct {
+	ID         int64               `json:"id" db:"id"`
+	JobID      int64               `json:"jobId" db:"job_id"`
+	EntityType EntityType          `json:"entityType" db:"entity_type"`
+	CardID     string              `json:"cardId" db:"card_id"`
+	ItemKey    string              `json:"itemKey" db:"item_key"`
+	Operation  DeadLetterOperation `json:"operation" db:"operation"`
+	Payload    string              `json:"payload" db:"payload"`
+	Error      string              `json:"error" db:"error"`
+	Attempts   int                 `json:"attempts" db:"attempts"`
+	State      DeadLetterState     `json:"state" db:"state"`
+	CreatedAt  time.Time           `json:"createdAt" db:"created_at"`
+	UpdatedAt  time.Time           `json:"updatedAt" db:"updated_at"`
+	ResolvedAt *time.Time          `json:"resolvedAt" db:"resolved_at"`
+}
+
+// DeadLetterFilter narrows dead letter queries. Zero values do not filter.
+type DeadLetterFilter struct {
+	JobID      int64
+	EntityType EntityType
+	CardID     string
+	Operation  DeadLetterOperation
+	State      DeadLetterState
+}
+
+type ErrorSeverity string
+
+const (
+	ErrorSeverityWarning  ErrorSeverity = "warning"
+	ErrorSeverityError    ErrorSeverity = "error"
+	ErrorSeverityCritical ErrorSeverity = "critical"
+)
+
+// ErrorClass tells which dependency an error came from
+type ErrorClass string
+
+const (
+	ErrorClassDatabase ErrorClass = "database"
+	ErrorClassTrello   ErrorClass = "trello"
+	ErrorClassStorage  ErrorClass = "storage"
+	ErrorClassWebhook  ErrorClass = "webhook"
+	ErrorClassInternal ErrorClass = "internal"
+	ErrorClassTimeout  ErrorClass = "timeout"
+)
+
 type Error struct {
-	ID         int64     `json:"id" db:"id"`
-	Source     string    `json:"source" db:"source"`
-	Body       string    `json:"body" db:"body"`
-	OccurredAt time.Time `json:"occurredAt" db:"occurred_at"`
+	ID         int64         `json:"id" db:"id"`
+	Source     string        `json:"source" db:"source"`
+	Body       string        `json:"body" db:"body"`
+	JobID      *int64        `json:"jobId" db:"job_id"`
+	CardID     string        `json:"cardId" db:"card_id"`
+	EntityType EntityType    `json:"entityType" db:"entity_type"`
+	Severity   ErrorSeverity `json:"severity" db:"severity"`
+	Class      ErrorClass    `json:"class" db:"class"`
+	Stack      string        `json:"stack" db:"stack"`
+	OccurredAt time.Time     `json:"occurredAt" db:"occurred_at"`
+}
+
+// ErrorFilter narrows error queries. Zero values do not filter.
+type ErrorFilter struct {
+	JobID      int64
+	CardID     string
+	EntityType EntityType
+	Severity   ErrorSeverity
+	Class      ErrorClass
+	Source     string
+	From       time.Time
+	To         time.Time
+}
+
+type ErrorClassCount struct {
+	Class ErrorClass `json:"class" db:"class"`
+	Count int64      `json:"count" db:"count"`
+}
+
+type OwnerTotal struct {
+	Owner      string  `json:"owner" db:"owner"`
+	Properties int64   `json:"properties" db:"properties"`
+	Area       float64 `json:"area" db:"area"`
+	Shares     float64 `json:"shares" db:"shares"`
+}
+
+type StatusTypeCount struct {
+	Status     string `json:"status" db:"status"`
+	Type       string `json:"type" db:"type"`
+	Properties int64  `json:"properties" db:"properties"`
+}
+
+type OrganizedBreakdown struct {
+	Organized  bool    `json:"organized" db:"is_organized"`
+	Properties int64   `json:"properties" db:"properties"`
+	Area       float64 `json:"area" db:"area"`
+	Shares     float64 `json:"shares" db:"shares"`
+}
+
+type GenerationCount struct {
+	Generation int64 `json:"generation" db:"generation"`
+	Records    int64 `json:"records" db:"records"`
+}
+
+type CategoryCount struct {
+	Category string `json:"category" db:"category"`
+	Docs     int64  `json:"docs" db:"docs"`
+}
+
+type ResetEntity string
+
+const (
+	ResetEntityProperties             ResetEntity = "properties"
+	ResetEntityInheritanceConfinments ResetEntity = "inhconfinments"
+	ResetEntitySupportiveDocs         ResetEntity = "supportivedocs"
+	ResetEntityAttachments            ResetEntity = "attachments"
+	ResetEntityJobs                   ResetEntity = "jobs"
+	ResetEntityErrors                 ResetEntity = "errors"
+	ResetEntityDeadLetters            ResetEntity = "deadletters"
+	ResetEntityPipelines              ResetEntity = "pipelines"
+)
+
+// ResetScope selects what a factory reset removes. If BoardID is set, only
+// rows of that board are removed.
+type ResetScope struct {
+	Entities []ResetEntity `json:"entities"`
+	BoardID  string        `json:"boardId"`
 }
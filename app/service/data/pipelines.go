@@ -0,0 +1,305 @@
+package data
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Finished tells whether a step in this state will not change anymore
+func (s StepState) Finished() bool {
+	return s == StepStateCompleted || s == StepStateFailed || s == StepStateSkipped
+}
+
+func (t *JobTypes) Scan(src interface{}) error {
+	switch v := src.(type) {
+	case nil:
+		*t = JobTypes{}
+		return nil
+	case string:
+		return json.Unmarshal([]byte(v), t)
+	case []byte:
+		return json.Unmarshal(v, t)
+	}
+
+	return fmt.Errorf("cannot scan %T into job types", src)
+}
+
+func (t JobTypes) Value() (driver.Value, error) {
+	if t == nil {
+		t = JobTypes{}
+	}
+
+	b, err := json.Marshal([]JobType(t))
+	if err != nil {
+		return nil, err
+	}
+
+	return string(b), nil
+}
+
+// ErrPipelineRunning is returned when a run is started while another run of
+// the same pipeline is in progress
+var ErrPipelineRunning = errors.New("pipeline is already running")
+
+// newPipelineRun stores the run and its steps together. The check for a run
+// in progress happens under the lock so two replicas cannot both start one.
+func newPipelineRun(db *sqlx.DB, lockSQL string, run PipelineRun) (int64, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return -1, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	if lockSQL != "" {
+		_, err = tx.Exec(lockSQL, run.Pipeline)
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	running := []int64{}
+	err = tx.Select(&running, tx.Rebind(`
+        SELECT id FROM pipeline_runs 
+		WHERE pipeline = ? AND state = ? 
+		ORDER BY id DESC
+    `), run.Pipeline, PipelineStateRunning)
+	if err != nil {
+		return -1, err
+	}
+
+	if len(running) > 0 {
+		return running[0], ErrPipelineRunning
+	}
+
+	var id int64
+	err = tx.QueryRowx(tx.Rebind(`
+        INSERT INTO pipeline_runs (pipeline, state, triggered_by, started_at) 
+		VALUES (?, ?, ?, ?) 
+		RETURNING id
+    `), run.Pipeline, run.State, run.TriggeredBy, run.StartedAt.UTC()).Scan(&id)
+	if err != nil {
+		return -1, err
+	}
+
+	for _, step := range run.Steps {
+		_, err = tx.Exec(tx.Rebind(`
+            INSERT INTO pipeline_steps (run_id, job_type, depends_on, on_failure, state, updated_at) 
+			VALUES (?, ?, ?, ?, ?, ?)
+        `), id, step.JobType, step.DependsOn, step.OnFailure, step.State, time.Now().UTC())
+		if err != nil {
+			return -1, err
+		}
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return -1, err
+	}
+
+	return id, nil
+}
+
+func retrievePipelineRuns(db *sqlx.DB, filter PipelineRunFilter, page, pageSize int) ([]PipelineRun, error) {
+	conditions := []string{}
+	args := []interface{}{}
+
+	if filter.Pipeline != "" {
+		conditions = append(conditions, "pipeline = ?")
+		args = append(args, filter.Pipeline)
+	}
+
+	if filter.State != "" {
+		conditions = append(conditions, "state = ?")
+		args = append(args, filter.State)
+	}
+
+	where := ""
+	if len(conditions) > 0 {
+		where = " WHERE " + strings.Join(conditions, " AND ")
+	}
+
+	// Calculate the offset
+	offset := (page - 1) * pageSize
+	args = append(args, pageSize, offset)
+
+	runs := []PipelineRun{}
+	err := db.Select(&runs, db.Rebind(`
+        SELECT * 
+		FROM pipeline_runs`+where+` 
+		ORDER BY id DESC 
+		LIMIT ? OFFSET ?
+    `), args...)
+	if err != nil {
+		return []PipelineRun{}, err
+	}
+
+	for i := range runs {
+		runs[i].Steps, err = retrievePipelineSteps(db, runs[i].ID)
+		if err != nil {
+			return []PipelineRun{}, err
+		}
+	}
+
+	return runs, nil
+}
+
+func retrievePipelineRunByID(db *sqlx.DB, id int64) (PipelineRun, error) {
+	runs := []PipelineRun{}
+	err := db.Select(&runs, db.Rebind(`SELECT * FROM pipeline_runs WHERE id = ?`), id)
+	if err != nil {
+		return PipelineRun{}, err
+	}
+
+	if len(runs) == 0 {
+		return PipelineRun{}, fmt.Errorf("Pipeline run ID %d does not exist", id)
+	}
+
+	runs[0].Steps, err = retrievePipelineSteps(db, id)
+	if err != nil {
+		return PipelineRun{}, err
+	}
+
+	return runs[0], nil
+}
+
+// retrievePipelineSteps returns the steps in the order they were defined
+func retrievePipelineSteps(db *sqlx.DB, runID int64) ([]PipelineStep, error) {
+	steps := []PipelineStep{}
+	err := db.Select(&steps, db.Rebind(`
+        SELECT run_id, job_type, depends_on, on_failure, state, job_id, updated_at 
+		FROM pipeline_steps 
+		WHERE run_id = ? 
+		ORDER BY id
+    `), runID)
+	if err != nil {
+		return []PipelineStep{}, err
+	}
+
+	return steps, nil
+}
+
+// startPipelineStep moves a pending step to running and enqueues its job
+// in the same transaction. When several replicas find the step ready,
+// only the first one enqueues a job. The step stays pending while another
+// job of its type is queued or running. The SQL differs per driver.
+func startPipelineStep(db *sqlx.DB, lockSQL, insertJobSQL string, runID int64, jobType JobType, job Job) (int64, bool, error) {
+	tx, err := db.Beginx()
+	if err != nil {
+		return -1, false, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	result, err := tx.Exec(tx.Rebind(`
+        UPDATE pipeline_steps 
+		SET state = ?, updated_at = ? 
+		WHERE run_id = ? 
+		AND job_type = ? 
+		AND state = ?
+    `), StepStateRunning, time.Now().UTC(), runID, jobType, StepStatePending)
+	if err != nil {
+		return -1, false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return -1, false, err
+	}
+
+	if affected == 0 {
+		return -1, false, nil
+	}
+
+	// Wait for a job of the same type that was admitted in the meantime
+	active, err := activeJobs(tx, lockSQL, jobType)
+	if err != nil {
+		return -1, false, err
+	}
+	if len(active) > 0 {
+		return -1, false, nil
+	}
+
+	rows, err := tx.NamedQuery(insertJobSQL, job)
+	if err != nil {
+		return -1, false, err
+	}
+
+	if !rows.Next() {
+		_ = rows.Close()
+		return -1, false, errors.New("new job did not return an ID")
+	}
+
+	err = rows.Scan(&job.ID)
+	_ = rows.Close()
+	if err != nil {
+		return -1, false, err
+	}
+
+	_, err = tx.Exec(tx.Rebind(`
+        UPDATE pipeline_steps 
+		SET job_id = ? 
+		WHERE run_id = ? 
+		AND job_type = ?
+    `), job.ID, runID, jobType)
+	if err != nil {
+		return -1, false, err
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return -1, false, err
+	}
+
+	return job.ID, true, nil
+}
+
+// updatePipelineStep moves a step from one state to another. It only
+// succeeds if the step is still in the from state.
+func updatePipelineStep(db *sqlx.DB, runID int64, jobType JobType, from, to StepState) (bool, error) {
+	result, err := db.Exec(db.Rebind(`
+        UPDATE pipeline_steps 
+		SET state = ?, updated_at = ? 
+		WHERE run_id = ? 
+		AND job_type = ? 
+		AND state = ?
+    `), to, time.Now().UTC(), runID, jobType, from)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
+
+// finishPipelineRun completes or fails a running pipeline run
+func finishPipelineRun(db *sqlx.DB, id int64, state PipelineState) (bool, error) {
+	result, err := db.Exec(db.Rebind(`
+        UPDATE pipeline_runs 
+		SET state = ?, completed_at = ? 
+		WHERE id = ? 
+		AND state = ?
+    `), state, time.Now().UTC(), id, PipelineStateRunning)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
@@ -0,0 +1,118 @@
+package data
+
+import (
+	"github.com/jmoiron/sqlx"
+)
+
+func retrieveOwnerTotals(db *sqlx.DB, boardID string) ([]OwnerTotal, error) {
+	totals := []OwnerTotal{}
+	query := `
+        SELECT owner, COUNT(*) AS properties, COALESCE(SUM(area), 0) AS area, COALESCE(SUM(shares), 0) AS shares
+		FROM properties
+		WHERE board_id = ?
+		GROUP BY owner
+		ORDER BY area DESC
+    `
+
+	err := db.Select(&totals, db.Rebind(query), boardID)
+	if err != nil {
+		return totals, err
+	}
+
+	return totals, nil
+}
+
+func retrieveStatusTypeCounts(db *sqlx.DB, boardID string) ([]StatusTypeCount, error) {
+	counts := []StatusTypeCount{}
+	query := `
+        SELECT status, type, COUNT(*) AS properties
+		FROM properties
+		WHERE board_id = ?
+		GROUP BY status, type
+		ORDER BY status, type
+    `
+
+	err := db.Select(&counts, db.Rebind(query), boardID)
+	if err != nil {
+		return counts, err
+	}
+
+	return counts, nil
+}
+
+func retrieveOrganizedBreakdown(db *sqlx.DB, boardID string) ([]OrganizedBreakdown, error) {
+	breakdown := []OrganizedBreakdown{}
+	query := `
+        SELECT is_organized, COUNT(*) AS properties, COALESCE(SUM(area), 0) AS area, COALESCE(SUM(shares), 0) AS shares
+		FROM properties
+		WHERE board_id = ?
+		GROUP BY is_organized
+		ORDER BY is_organized DESC
+    `
+
+	err := db.Select(&breakdown, db.Rebind(query), boardID)
+	if err != nil {
+		return breakdown, err
+	}
+
+	return breakdown, nil
+}
+
+func retrieveEffectProperties(db *sqlx.DB, boardID string) ([]Property, error) {
+	props := []Property{}
+	query := `
+        SELECT *
+		FROM properties
+		WHERE board_id = ?
+		AND is_effects = TRUE
+		ORDER BY location_en, name
+    `
+
+	var rows []propertyRow
+	err := db.Select(&rows, db.Rebind(query), boardID)
+	if err != nil {
+		return props, err
+	}
+
+	for _, row := range rows {
+		props = append(props, row.toModel())
+	}
+
+	return props, nil
+}
+
+func retrieveGenerationCounts(db *sqlx.DB, boardID string) ([]GenerationCount, error) {
+	counts := []GenerationCount{}
+	query := `
+        SELECT generation, COUNT(*) AS records
+		FROM inheritance_confinments
+		WHERE board_id = ?
+		GROUP BY generation
+		ORDER BY generation
+    `
+
+	err := db.Select(&counts, db.Rebind(query), boardID)
+	if err != nil {
+		return counts, err
+	}
+
+	return counts, nil
+}
+
+func retrieveCategoryCounts(db *sqlx.DB, boardID string) ([]CategoryCount, error) {
+	counts := []CategoryCount{}
+	query := `
+        SELECT category, COUNT(*) AS docs
+		FROM supportive_docs
+		WHERE board_id = ?
+		GROUP BY category
+		ORDER BY category
+    `
+
+	err := db.Select(&counts, db.Rebind(query), boardID)
+	if err != nil {
+		return counts, err
+	}
+
+	return counts, nil
+}
@@ -0,0 +1,268 @@
+package data
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// resetTables maps the entity types that can be reset to their tables
+var resetTables = map[ResetEntity]string{
+	ResetEntityProperties:             "properties",
+	ResetEntityInheritanceConfinments: "inheritance_confinments",
+	ResetEntitySupportiveDocs:         "supportive_docs",
+	ResetEntityAttachments:            "attachments",
+	ResetEntityJobs:                   "jobs",
+	ResetEntityErrors:                 "errors",
+	ResetEntityDeadLetters:            "dead_letters",
+	ResetEntityPipelines:              "pipeline_runs",
+}
+
+// resetDependent is a table whose rows go with the rows of another table.
+// Where selects them from the parent rows in scope, which it gets as `%s`.
+type resetDependent struct {
+	Table string
+	Where string
+}
+
+// resetDependents maps a table to the tables whose rows are removed with it.
+// Schedules and API keys are configuration and a factory reset keeps them.
+var resetDependents = map[string][]resetDependent{
+	"properties":              {attachmentsOf(EntityTypeProperties)},
+	"inheritance_confinments": {attachmentsOf(EntityTypeInheritanceConfinments)},
+	"supportive_docs":         {attachmentsOf(EntityTypeSupportiveDocs)},
+	"pipeline_runs":           {{Table: "pipeline_steps", Where: " WHERE run_id IN (SELECT id FROM pipeline_runs%s)"}},
+}
+
+// attachmentsOf selects the attachments of the cards of an entity. The
+// entity type is also the name of its table.
+func attachmentsOf(entityType EntityType) resetDependent {
+	return resetDependent{
+		Table: "attachments",
+		Where: fmt.Sprintf(" WHERE entity_type = '%s' AND card_id IN (SELECT card_id FROM %s%%s)", entityType, entityType),
+	}
+}
+
+// boardTables are the tables that carry a board ID
+var boardTables = map[string]bool{
+	"properties":              true,
+	"inheritance_confinments": true,
+	"supportive_docs":         true,
+}
+
+type resetSnapshot struct {
+	TakenAt time.Time                           `json:"takenAt"`
+	Scope   ResetScope                          `json:"scope"`
+	Tables  map[string][]map[string]interface{} `json:"tables"`
+}
+
+// ValidateResetScope makes sure the scope names known entities and that a
+// board filter is only used with board entities
+func ValidateResetScope(scope ResetScope) error {
+	if len(scope.Entities) == 0 {
+		return fmt.Errorf("reset scope must name at least one entity")
+	}
+
+	for _, entity := range scope.Entities {
+		table, ok := resetTables[entity]
+		if !ok {
+			return fmt.Errorf("unknown reset entity %s", entity)
+		}
+
+		if scope.BoardID != "" && !boardTables[table] {
+			return fmt.Errorf("reset entity %s cannot be scoped by board", entity)
+		}
+	}
+
+	return nil
+}
+
+func resetWhere(scope ResetScope) (string, []interface{}) {
+	if scope.BoardID == "" {
+		return "", nil
+	}
+
+	return " WHERE board_id = $1", []interface{}{scope.BoardID}
+}
+
+// ResetTable returns the table of an entity that can be reset
+func ResetTable(entity ResetEntity) string {
+	return resetTables[entity]
+}
+
+// countResetRows returns the number of rows each table would lose, the
+// dependent rows of the entities in scope included
+func countResetRows(db *sqlx.DB, scope ResetScope) (map[string]int64, error) {
+	counts := map[string]int64{}
+	err := ValidateResetScope(scope)
+	if err != nil {
+		return counts, err
+	}
+
+	where, args := resetWhere(scope)
+	for _, entity := range scope.Entities {
+		var count int64
+		err = db.Get(&count, "SELECT COUNT(*) FROM "+resetTables[entity]+where, args...)
+		if err != nil {
+			return counts, err
+		}
+
+		counts[resetTables[entity]] += count
+	}
+
+	for _, dependent := range resetDependentsOf(scope, where) {
+		var count int64
+		err = db.Get(&count, "SELECT COUNT(*) FROM "+dependent.Table+dependent.Where, args...)
+		if err != nil {
+			return counts, err
+		}
+
+		counts[dependent.Table] += count
+	}
+
+	return counts, nil
+}
+
+// resetRows writes a JSON snapshot of the rows in scope and deletes them.
+// Both happen in the same transaction so the snapshot matches what was deleted.
+// It returns the number of rows deleted from each table.
+func resetRows(db *sqlx.DB, scope ResetScope, snapshot io.Writer) (map[string]int64, error) {
+	counts := map[string]int64{}
+	err := ValidateResetScope(scope)
+	if err != nil {
+		return counts, err
+	}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		return counts, err
+	}
+	defer func() {
+		_ = tx.Rollback()
+	}()
+
+	where, args := resetWhere(scope)
+	snap := resetSnapshot{
+		TakenAt: time.Now().UTC(),
+		Scope:   scope,
+		Tables:  map[string][]map[string]interface{}{},
+	}
+
+	dependents := resetDependentsOf(scope, where)
+	for _, dependent := range dependents {
+		records, err := snapshotRows(tx, dependent.Table, dependent.Where, args)
+		if err != nil {
+			return counts, err
+		}
+
+		snap.Tables[dependent.Table] = append(snap.Tables[dependent.Table], records...)
+	}
+
+	for _, entity := range scope.Entities {
+		table := resetTables[entity]
+		records, err := snapshotRows(tx, table, where, args)
+		if err != nil {
+			return counts, err
+		}
+
+		snap.Tables[table] = records
+	}
+
+	err = json.NewEncoder(snapshot).Encode(snap)
+	if err != nil {
+		return counts, fmt.Errorf("writing reset snapshot: %w", err)
+	}
+
+	// Dependents go first since they are selected by their parent rows
+	for _, dependent := range dependents {
+		result, err := tx.Exec("DELETE FROM "+dependent.Table+dependent.Where, args...)
+		if err != nil {
+			return counts, err
+		}
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return counts, err
+		}
+
+		counts[dependent.Table] += deleted
+	}
+
+	for _, entity := range scope.Entities {
+		result, err := tx.Exec("DELETE FROM "+resetTables[entity]+where, args...)
+		if err != nil {
+			return counts, err
+		}
+
+		deleted, err := result.RowsAffected()
+		if err != nil {
+			return counts, err
+		}
+
+		counts[resetTables[entity]] += deleted
+	}
+
+	err = tx.Commit()
+	if err != nil {
+		return counts, err
+	}
+
+	return counts, nil
+}
+
+// resetDependentsOf returns the dependent rows of the tables in scope. A
+// table that is reset itself is left out since all its rows go anyway.
+func resetDependentsOf(scope ResetScope, where string) []resetDependent {
+	inScope := map[string]bool{}
+	for _, entity := range scope.Entities {
+		inScope[resetTables[entity]] = true
+	}
+
+	dependents := []resetDependent{}
+	for _, entity := range scope.Entities {
+		for _, dependent := range resetDependents[resetTables[entity]] {
+			if inScope[dependent.Table] {
+				continue
+			}
+
+			dependents = append(dependents, resetDependent{
+				Table: dependent.Table,
+				Where: fmt.Sprintf(dependent.Where, where),
+			})
+		}
+	}
+
+	return dependents
+}
+
+// snapshotRows reads the rows of a table as JSON-friendly maps
+func snapshotRows(tx *sqlx.Tx, table, where string, args []interface{}) ([]map[string]interface{}, error) {
+	rows, err := tx.Queryx("SELECT * FROM "+table+where, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	records := []map[string]interface{}{}
+	for rows.Next() {
+		record := map[string]interface{}{}
+		err = rows.MapScan(record)
+		if err != nil {
+			return nil, err
+		}
+
+		// Drivers return arrays and numerics as bytes which JSON would base64
+		for k, v := range record {
+			if b, ok := v.([]byte); ok {
+				record[k] = string(b)
+			}
+		}
+
+		records = append(records, record)
+	}
+
+	return records, rows.Err()
+}
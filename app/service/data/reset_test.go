@@ -0,0 +1,27 @@
+package data
+
+import "testing"
+
+func TestValidateResetScope(t *testing.T) {
+	tests := []struct {
+		name    string
+		scope   ResetScope
+		wantErr bool
+	}{
+		{name: "no entities", scope: ResetScope{}, wantErr: true},
+		{name: "unknown entity", scope: ResetScope{Entities: []ResetEntity{"owners"}}, wantErr: true},
+		{name: "every entity", scope: ResetScope{Entities: []ResetEntity{ResetEntityProperties, ResetEntityInheritanceConfinments, ResetEntitySupportiveDocs, ResetEntityAttachments, ResetEntityJobs, ResetEntityErrors, ResetEntityDeadLetters, ResetEntityPipelines}}},
+		{name: "board entities by board", scope: ResetScope{Entities: []ResetEntity{ResetEntityProperties, ResetEntitySupportiveDocs}, BoardID: "b1"}},
+		{name: "jobs by board", scope: ResetScope{Entities: []ResetEntity{ResetEntityProperties, ResetEntityJobs}, BoardID: "b1"}, wantErr: true},
+		{name: "pipelines by board", scope: ResetScope{Entities: []ResetEntity{ResetEntityPipelines}, BoardID: "b1"}, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := ValidateResetScope(tt.scope)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+		})
+	}
+}
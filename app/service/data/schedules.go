@@ -0,0 +1,65 @@
+package data
+
+import (
+	"time"
+
+	"github.com/jmoiron/sqlx"
+)
+
+func retrieveSchedules(db *sqlx.DB) ([]Schedule, error) {
+	schedules := []Schedule{}
+	err := db.Select(&schedules, `SELECT * FROM schedules ORDER BY next_fire_at`)
+	if err != nil {
+		return []Schedule{}, err
+	}
+
+	return schedules, nil
+}
+
+// saveSchedule inserts or redefines a schedule. The last fire time is kept.
+func saveSchedule(db *sqlx.DB, schedule Schedule) error {
+	_, err := db.Exec(db.Rebind(`
+        INSERT INTO schedules (job_type, cron, time_zone, catch_up, next_fire_at, updated_at) 
+		VALUES (?, ?, ?, ?, ?, ?) 
+		ON CONFLICT (job_type) DO UPDATE SET 
+			cron = EXCLUDED.cron, 
+			time_zone = EXCLUDED.time_zone, 
+			catch_up = EXCLUDED.catch_up, 
+			next_fire_at = EXCLUDED.next_fire_at, 
+			updated_at = EXCLUDED.updated_at
+    `), schedule.JobType, schedule.Cron, schedule.TimeZone, schedule.CatchUp, schedule.NextFireAt.UTC(), time.Now().UTC())
+	return err
+}
+
+func deleteSchedule(db *sqlx.DB, jobType JobType) error {
+	_, err := db.Exec(db.Rebind(`DELETE FROM schedules WHERE job_type = ?`), jobType)
+	return err
+}
+
+// advanceSchedule moves a schedule from its due time to the next one.
+// It only succeeds if the schedule is still due at that time, so when
+// several replicas see the same due schedule exactly one of them fires it.
+// A nil firedAt advances without recording a fire (i.e. a skipped run).
+func advanceSchedule(db *sqlx.DB, jobType JobType, due, next time.Time, firedAt *time.Time) (bool, error) {
+	if firedAt != nil {
+		utc := firedAt.UTC()
+		firedAt = &utc
+	}
+
+	result, err := db.Exec(db.Rebind(`
+        UPDATE schedules 
+		SET next_fire_at = ?, last_fired_at = COALESCE(?, last_fired_at), updated_at = ? 
+		WHERE job_type = ? 
+		AND next_fire_at = ?
+    `), next.UTC(), firedAt, time.Now().UTC(), jobType, due.UTC())
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected > 0, nil
+}
@@ -0,0 +1,15 @@
+UPDATE jobs 
+SET 
+    state = $1, 
+    worker_id = $2, 
+    heartbeat_at = $3, 
+    attempts = attempts + 1
+WHERE id = (
+    SELECT id FROM jobs 
+    WHERE type = $4 
+    AND state = $5 
+    ORDER BY id 
+    LIMIT 1 
+    FOR UPDATE SKIP LOCKED
+)
+RETURNING *
@@ -1,6 +1,6 @@
 INSERT INTO errors (
-    source, body, occurred_at
+    source, body, job_id, card_id, entity_type, severity, class, stack, occurred_at
 ) VALUES (
-    $1, $2, NOW()
+    :source, :body, :job_id, :card_id, :entity_type, :severity, :class, :stack, NOW()
 )
 RETURNING id
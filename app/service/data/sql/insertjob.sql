@@ -1,6 +1,6 @@
 INSERT INTO jobs (
-    type, state, cards, errors, started_at, completed_at
+    type, state, cards, errors, started_at, completed_at, page_size, dry_run, options
 ) VALUES (
-    :type, :state, :cards, :errors, :started_at, :completed_at
+    :type, :state, :cards, :errors, :started_at, :completed_at, :page_size, :dry_run, :options
 )
 RETURNING id
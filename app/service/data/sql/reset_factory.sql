@@ -1 +0,0 @@
-TRUNCATE properties, jobs, errors;
\ No newline at end of file
@@ -0,0 +1,5 @@
+SELECT key, is_admin
+FROM api_keys
+WHERE key = :key
+AND expires_at > NOW()
+LIMIT 1
@@ -0,0 +1,6 @@
+INSERT INTO api_keys (
+    key, started_at, expires_at
+) VALUES (
+    :key, :started_at, :expires_at
+)
+RETURNING id
@@ -0,0 +1,12 @@
+INSERT INTO attachments (
+    entity_type, card_id, trello_attachment_id, trello_url, name, mime_type, size, storage_key, status, updated_at
+) VALUES (
+    :entity_type, :card_id, :trello_attachment_id, :trello_url, :name, :mime_type, :size, :storage_key, :status, :updated_at
+)
+ON CONFLICT (entity_type, card_id, trello_attachment_id) DO UPDATE SET
+    trello_url = excluded.trello_url,
+    name = excluded.name,
+    mime_type = excluded.mime_type,
+    storage_key = CASE WHEN attachments.status = 'mirrored' THEN attachments.storage_key ELSE excluded.storage_key END,
+    updated_at = excluded.updated_at
+RETURNING id
@@ -0,0 +1,6 @@
+INSERT INTO errors (
+    source, body, job_id, card_id, entity_type, severity, class, stack, occurred_at
+) VALUES (
+    :source, :body, :job_id, :card_id, :entity_type, :severity, :class, :stack, :occurred_at
+)
+RETURNING id
@@ -0,0 +1,170 @@
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    key TEXT NOT NULL,
+    started_at TIMESTAMP NOT NULL,
+    expires_at TIMESTAMP NOT NULL,
+    is_admin BOOLEAN NOT NULL DEFAULT FALSE
+);
+
+CREATE TABLE IF NOT EXISTS attachments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    entity_type TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    trello_attachment_id TEXT NOT NULL,
+    trello_url TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    mime_type TEXT NOT NULL DEFAULT '',
+    size INTEGER NOT NULL DEFAULT 0,
+    checksum TEXT NOT NULL DEFAULT '',
+    storage_key TEXT NOT NULL DEFAULT '',
+    storage_url TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending',
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (entity_type, card_id, trello_attachment_id)
+);
+
+CREATE INDEX IF NOT EXISTS attachments_status_idx ON attachments (status);
+
+CREATE TABLE IF NOT EXISTS errors (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    occurred_at TIMESTAMP NOT NULL,
+    source TEXT NOT NULL,
+    body TEXT NOT NULL,
+    job_id INTEGER,
+    card_id TEXT NOT NULL DEFAULT '',
+    entity_type TEXT NOT NULL DEFAULT '',
+    severity TEXT NOT NULL DEFAULT 'error',
+    class TEXT NOT NULL DEFAULT 'internal',
+    stack TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS errors_job_id_idx ON errors (job_id);
+CREATE INDEX IF NOT EXISTS errors_occurred_at_idx ON errors (occurred_at);
+
+CREATE TABLE IF NOT EXISTS inheritance_confinments (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    board_id TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    title TEXT NOT NULL,
+    generation INTEGER NOT NULL,
+    labels TEXT,
+    attachments TEXT,
+    comments TEXT,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS jobs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    type TEXT NOT NULL,
+    state TEXT NOT NULL,
+    cards INTEGER NOT NULL,
+    errors INTEGER NOT NULL,
+    inserted INTEGER NOT NULL DEFAULT 0,
+    updated INTEGER NOT NULL DEFAULT 0,
+    unchanged INTEGER NOT NULL DEFAULT 0,
+    failed INTEGER NOT NULL DEFAULT 0,
+    started_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP,
+    page_size INTEGER NOT NULL DEFAULT 50,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    worker_id TEXT NOT NULL DEFAULT '',
+    heartbeat_at TIMESTAMP,
+    cancelled_by TEXT NOT NULL DEFAULT '',
+    cancel_reason TEXT NOT NULL DEFAULT '',
+    processed INTEGER NOT NULL DEFAULT 0,
+    current_card TEXT NOT NULL DEFAULT '',
+    progress_at TIMESTAMP,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    report TEXT,
+    options TEXT NOT NULL DEFAULT '{}'
+);
+
+CREATE INDEX IF NOT EXISTS jobs_type_started_at_idx ON jobs (type, started_at);
+CREATE INDEX IF NOT EXISTS jobs_state_type_idx ON jobs (state, type);
+
+CREATE TABLE IF NOT EXISTS schedules (
+    job_type TEXT PRIMARY KEY,
+    cron TEXT NOT NULL,
+    time_zone TEXT NOT NULL,
+    catch_up TEXT NOT NULL,
+    last_fired_at TIMESTAMP,
+    next_fire_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS pipeline_runs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    pipeline TEXT NOT NULL,
+    state TEXT NOT NULL,
+    triggered_by TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS pipeline_runs_state_idx ON pipeline_runs (state);
+
+CREATE TABLE IF NOT EXISTS pipeline_steps (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    run_id INTEGER NOT NULL REFERENCES pipeline_runs (id) ON DELETE CASCADE,
+    job_type TEXT NOT NULL,
+    depends_on TEXT NOT NULL DEFAULT '[]',
+    on_failure TEXT NOT NULL,
+    state TEXT NOT NULL,
+    job_id INTEGER,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (run_id, job_type)
+);
+
+CREATE TABLE IF NOT EXISTS dead_letters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    job_id INTEGER NOT NULL,
+    entity_type TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    item_key TEXT NOT NULL DEFAULT '',
+    operation TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    error TEXT NOT NULL,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    state TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS dead_letters_card_idx ON dead_letters (entity_type, card_id, operation, item_key, state);
+CREATE INDEX IF NOT EXISTS dead_letters_state_idx ON dead_letters (state);
+
+CREATE TABLE IF NOT EXISTS properties (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    board_id TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    location_ar TEXT NOT NULL,
+    location_en TEXT NOT NULL,
+    lot TEXT NOT NULL,
+    type TEXT NOT NULL,
+    status TEXT NOT NULL,
+    owner TEXT NOT NULL,
+    area REAL NOT NULL,
+    shares REAL NOT NULL,
+    is_organized BOOLEAN NOT NULL,
+    is_effects BOOLEAN NOT NULL,
+    labels TEXT,
+    attachments TEXT,
+    comments TEXT,
+    updated_at TIMESTAMP NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS supportive_docs (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    board_id TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    name TEXT NOT NULL,
+    title TEXT NOT NULL,
+    category TEXT NOT NULL,
+    labels TEXT,
+    attachments TEXT,
+    comments TEXT,
+    updated_at TIMESTAMP NOT NULL
+);
@@ -0,0 +1,11 @@
+UPDATE inheritance_confinments SET
+    board_id = :board_id,
+    card_id = :card_id,
+    name = :name,
+    title = :title,
+    generation = :generation,
+    labels = :labels,
+    attachments = :attachments,
+    comments = :comments,
+    updated_at = :updated_at
+WHERE id = :id
@@ -0,0 +1,19 @@
+UPDATE properties SET
+    board_id = :board_id,
+    card_id = :card_id,
+    name = :name,
+    location_ar = :location_ar,
+    location_en = :location_en,
+    lot = :lot,
+    type = :type,
+    status = :status,
+    owner = :owner,
+    area = :area,
+    shares = :shares,
+    is_organized = :is_organized,
+    is_effects = :is_effects,
+    labels = :labels,
+    attachments = :attachments,
+    comments = :comments,
+    updated_at = :updated_at
+WHERE id = :id
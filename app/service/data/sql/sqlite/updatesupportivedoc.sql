@@ -0,0 +1,11 @@
+UPDATE supportive_docs SET
+    board_id = :board_id,
+    card_id = :card_id,
+    name = :name,
+    title = :title,
+    category = :category,
+    labels = :labels,
+    attachments = :attachments,
+    comments = :comments,
+    updated_at = :updated_at
+WHERE id = :id
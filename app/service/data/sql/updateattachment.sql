@@ -0,0 +1,9 @@
+UPDATE attachments SET
+    size = :size,
+    mime_type = :mime_type,
+    checksum = :checksum,
+    storage_key = :storage_key,
+    storage_url = :storage_url,
+    status = :status,
+    updated_at = :updated_at
+WHERE id = :id
@@ -1,11 +1,11 @@
 UPDATE inheritance_confinments SET
-    board_id = $1,
-    card_id = $2,
-    name = $3,
-    title = $4,
-    generation = $5,
-    labels = $6,
-    attachments = $7,
-    comments = $8,
+    board_id = :board_id,
+    card_id = :card_id,
+    name = :name,
+    title = :title,
+    generation = :generation,
+    labels = :labels,
+    attachments = :attachments,
+    comments = :comments,
     updated_at = NOW()
-WHERE id = $9;
\ No newline at end of file
+WHERE id = :id
@@ -3,5 +3,10 @@ SET
     state = $1, 
     cards = $2, 
     errors = $3, 
-    completed_at = $4
-WHERE id = $5
+    inserted = $4, 
+    updated = $5, 
+    unchanged = $6, 
+    failed = $7, 
+    completed_at = $8, 
+    report = $9
+WHERE id = $10
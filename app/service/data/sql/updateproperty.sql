@@ -1,19 +1,19 @@
 UPDATE properties SET
-    board_id = $1,
-    card_id = $2,
-    name = $3,
-    location_ar = $4,
-    location_en = $5,
-    lot = $6,
-    type = $7,
-    status = $8,
-    owner = $9,
-    area = $10,
-    shares = $11,
-    is_organized = $12,
-    is_effects = $13,
-    labels = $14,
-    attachments = $15,
-    comments = $16,
+    board_id = :board_id,
+    card_id = :card_id,
+    name = :name,
+    location_ar = :location_ar,
+    location_en = :location_en,
+    lot = :lot,
+    type = :type,
+    status = :status,
+    owner = :owner,
+    area = :area,
+    shares = :shares,
+    is_organized = :is_organized,
+    is_effects = :is_effects,
+    labels = :labels,
+    attachments = :attachments,
+    comments = :comments,
     updated_at = NOW()
-WHERE id = $17;
\ No newline at end of file
+WHERE id = :id
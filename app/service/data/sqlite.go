@@ -0,0 +1,653 @@
+package data
+
+import (
+	"context"
+	"database/sql"
+	_ "embed"
+	"fmt"
+	"io"
+	"log/slog"
+	"time"
+
+	"github.com/jmoiron/sqlx"
+	_ "modernc.org/sqlite" // Import the pure-Go SQLite driver
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+//go:embed sql/sqlite/schema.sql
+var sqliteSchemaSQL string
+
+//go:embed sql/sqlite/insertproperty.sql
+var sqliteInsertpropertySQL string
+
+//go:embed sql/sqlite/updateproperty.sql
+var sqliteUpdatepropertySQL string
+
+//go:embed sql/sqlite/insertinhconf.sql
+var sqliteInsertinhconfSQL string
+
+//go:embed sql/sqlite/updateinhconf.sql
+var sqliteUpdateinhconfSQL string
+
+//go:embed sql/sqlite/insertsupportivedoc.sql
+var sqliteInsertsupportivedocSQL string
+
+//go:embed sql/sqlite/updatesupportivedoc.sql
+var sqliteUpdatesupportivedocSQL string
+
+//go:embed sql/sqlite/insertattachment.sql
+var sqliteInsertattachmentSQL string
+
+//go:embed sql/sqlite/updateattachment.sql
+var sqliteUpdateattachmentSQL string
+
+//go:embed sql/sqlite/insertjob.sql
+var sqliteInsertjobSQL string
+
+//go:embed sql/sqlite/updatejob.sql
+var sqliteUpdatejobSQL string
+
+//go:embed sql/sqlite/claimjob.sql
+var sqliteClaimjobSQL string
+
+//go:embed sql/sqlite/insertapikey.sql
+var sqliteInsertapikeySQL string
+
+//go:embed sql/sqlite/selectapikey.sql
+var sqliteSelectapikeySQL string
+
+//go:embed sql/sqlite/inserterror.sql
+var sqliteInserterrorSQL string
+
+type sqliteService struct {
+	ConfigSvc config.IService
+	Db        *sqlx.DB
+}
+
+// NewSQLite opens the SQLite database file and creates the schema if needed
+func NewSQLite(ctx context.Context, cfgsvc config.IService) (IService, error) {
+	db, err := connect(ctx, cfgsvc, "sqlite")
+	if err != nil {
+		return nil, err
+	}
+
+	// SQLite allows a single writer so serialize access through one connection
+	if cfgsvc.GetDbMaxOpenConns() != 1 {
+		lgr.Logger.Warn(
+			"ignoring DB_MAX_OPEN_CONNS since the sqlite driver uses one connection",
+			slog.Int("max_open_conns", cfgsvc.GetDbMaxOpenConns()),
+		)
+	}
+	db.SetMaxOpenConns(1)
+
+	// Create the schema if this is a fresh database file
+	_, err = db.ExecContext(ctx, sqliteSchemaSQL)
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	err = registerPoolMetrics(db, "sqlite")
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	return &sqliteService{
+		ConfigSvc: cfgsvc,
+		Db:        db,
+	}, nil
+}
+
+func (svc *sqliteService) Ping(ctx context.Context) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return svc.Db.PingContext(ctx)
+}
+
+func (svc *sqliteService) Stats() sql.DBStats {
+	if svc.Db == nil {
+		return sql.DBStats{}
+	}
+
+	return svc.Db.Stats()
+}
+
+func (svc *sqliteService) CountResetRows(scope ResetScope) (map[string]int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return map[string]int64{}, err
+	}
+
+	return countResetRows(svc.Db, scope)
+}
+
+func (svc *sqliteService) ResetFactory(scope ResetScope, snapshot io.Writer) (map[string]int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return map[string]int64{}, err
+	}
+
+	return resetRows(svc.Db, scope, snapshot)
+}
+
+func (svc *sqliteService) NewProperty(prop Property) (UpsertOutcome, int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return "", -1, err
+	}
+
+	return newProperty(svc.Db, sqliteInsertpropertySQL, sqliteUpdatepropertySQL, prop)
+}
+
+func (svc *sqliteService) UpdateProperty(prop *Property) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return updateProperty(svc.Db, sqliteUpdatepropertySQL, prop)
+}
+
+func (svc *sqliteService) RetrieveProperties(page, pageSize int, orderBy, orderDir string) ([]Property, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Property{}, err
+	}
+
+	return retrieveProperties(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID(), page, pageSize, orderBy, orderDir)
+}
+
+func (svc *sqliteService) NewInheritanceConfinment(prop InheritanceConfinment) (UpsertOutcome, int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return "", -1, err
+	}
+
+	return newInheritanceConfinment(svc.Db, sqliteInsertinhconfSQL, sqliteUpdateinhconfSQL, prop)
+}
+
+func (svc *sqliteService) UpdateInheritanceConfinment(prop *InheritanceConfinment) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return updateInheritanceConfinment(svc.Db, sqliteUpdateinhconfSQL, prop)
+}
+
+func (svc *sqliteService) RetrieveInheritanceConfinments(page, pageSize int, orderBy, orderDir string) ([]InheritanceConfinment, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []InheritanceConfinment{}, err
+	}
+
+	return retrieveInheritanceConfinments(svc.Db, svc.ConfigSvc.GetTrelloInheritanceConfinmentsBoardID(), page, pageSize, orderBy, orderDir)
+}
+
+func (svc *sqliteService) NewSupportiveDoc(prop SupportiveDoc) (UpsertOutcome, int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return "", -1, err
+	}
+
+	return newSupportiveDoc(svc.Db, sqliteInsertsupportivedocSQL, sqliteUpdatesupportivedocSQL, prop)
+}
+
+func (svc *sqliteService) UpdateSupportiveDoc(prop *SupportiveDoc) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return updateSupportiveDoc(svc.Db, sqliteUpdatesupportivedocSQL, prop)
+}
+
+func (svc *sqliteService) RetrieveSupportiveDocs(page, pageSize int, orderBy, orderDir string) ([]SupportiveDoc, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []SupportiveDoc{}, err
+	}
+
+	return retrieveSupportiveDocs(svc.Db, svc.ConfigSvc.GetTrelloSupportiveDocsBoardID(), page, pageSize, orderBy, orderDir)
+}
+
+func (svc *sqliteService) NewAttachment(att Attachment) (int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return -1, err
+	}
+
+	return newAttachment(svc.Db, sqliteInsertattachmentSQL, att)
+}
+
+func (svc *sqliteService) UpdateAttachment(att *Attachment) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return updateAttachment(svc.Db, sqliteUpdateattachmentSQL, att)
+}
+
+func (svc *sqliteService) RetrievePendingAttachments(pageSize int) ([]Attachment, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Attachment{}, err
+	}
+
+	return retrievePendingAttachments(svc.Db, pageSize)
+}
+
+func (svc *sqliteService) RetrieveAttachmentByID(id int64) (Attachment, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return Attachment{}, err
+	}
+
+	return retrieveAttachmentByID(svc.Db, id)
+}
+
+func (svc *sqliteService) NewJob(job Job) (int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return -1, err
+	}
+
+	return newJob(svc.Db, sqliteInsertjobSQL, job)
+}
+
+func (svc *sqliteService) UpdateJob(job *Job) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return updateJob(svc.Db, sqliteUpdatejobSQL, job)
+}
+
+func (svc *sqliteService) FinishJob(job *Job) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return finishJob(svc.Db, job)
+}
+
+func (svc *sqliteService) RetrieveJobByID(id int64) (Job, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return Job{}, err
+	}
+
+	return retrieveJobByID(svc.Db, id)
+}
+
+func (svc *sqliteService) RetrieveJobs(filter JobFilter, page, pageSize int) ([]Job, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Job{}, err
+	}
+
+	return retrieveJobs(svc.Db, filter, page, pageSize)
+}
+
+func (svc *sqliteService) RetrieveJobStats(filter JobFilter) ([]JobStats, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []JobStats{}, err
+	}
+
+	return retrieveJobStats(svc.Db, filter)
+}
+
+func (svc *sqliteService) IsPendingJobsByType(jobType JobType) (bool, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return false, err
+	}
+
+	return isPendingJobsByType(svc.Db, jobType)
+}
+
+// AdmitJob needs no lock since SQLite serializes access through one connection
+func (svc *sqliteService) AdmitJob(job Job, limit int) (int64, Job, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return -1, Job{}, err
+	}
+
+	return admitJob(svc.Db, "", sqliteInsertjobSQL, job, limit)
+}
+
+func (svc *sqliteService) ClaimJob(jobType JobType, workerID string) (Job, bool, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return Job{}, false, err
+	}
+
+	return claimJob(svc.Db, sqliteClaimjobSQL, jobType, workerID)
+}
+
+func (svc *sqliteService) HeartbeatJob(id int64, workerID string) (JobState, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return "", err
+	}
+
+	return heartbeatJob(svc.Db, id, workerID)
+}
+
+func (svc *sqliteService) CancelJob(id int64, cancelledBy, reason string) (Job, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return Job{}, err
+	}
+
+	return cancelJob(svc.Db, id, cancelledBy, reason)
+}
+
+func (svc *sqliteService) UpdateJobProgress(id int64, progress JobProgress) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return updateJobProgress(svc.Db, id, progress)
+}
+
+func (svc *sqliteService) ReapStaleJobs(staleBefore time.Time, maxAttempts int) ([]Job, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Job{}, err
+	}
+
+	return reapStaleJobs(svc.Db, staleBefore, maxAttempts)
+}
+
+func (svc *sqliteService) RetrieveSchedules() ([]Schedule, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Schedule{}, err
+	}
+
+	return retrieveSchedules(svc.Db)
+}
+
+func (svc *sqliteService) SaveSchedule(schedule Schedule) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return saveSchedule(svc.Db, schedule)
+}
+
+func (svc *sqliteService) DeleteSchedule(jobType JobType) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return deleteSchedule(svc.Db, jobType)
+}
+
+func (svc *sqliteService) AdvanceSchedule(jobType JobType, due, next time.Time, firedAt *time.Time) (bool, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return false, err
+	}
+
+	return advanceSchedule(svc.Db, jobType, due, next, firedAt)
+}
+
+func (svc *sqliteService) RetrieveOwnerTotals() ([]OwnerTotal, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []OwnerTotal{}, err
+	}
+
+	return retrieveOwnerTotals(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID())
+}
+
+func (svc *sqliteService) RetrieveStatusTypeCounts() ([]StatusTypeCount, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []StatusTypeCount{}, err
+	}
+
+	return retrieveStatusTypeCounts(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID())
+}
+
+func (svc *sqliteService) RetrieveOrganizedBreakdown() ([]OrganizedBreakdown, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []OrganizedBreakdown{}, err
+	}
+
+	return retrieveOrganizedBreakdown(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID())
+}
+
+func (svc *sqliteService) RetrieveEffectProperties() ([]Property, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Property{}, err
+	}
+
+	return retrieveEffectProperties(svc.Db, svc.ConfigSvc.GetTrelloPropertiesBoardID())
+}
+
+func (svc *sqliteService) RetrieveGenerationCounts() ([]GenerationCount, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []GenerationCount{}, err
+	}
+
+	return retrieveGenerationCounts(svc.Db, svc.ConfigSvc.GetTrelloInheritanceConfinmentsBoardID())
+}
+
+func (svc *sqliteService) RetrieveCategoryCounts() ([]CategoryCount, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []CategoryCount{}, err
+	}
+
+	return retrieveCategoryCounts(svc.Db, svc.ConfigSvc.GetTrelloSupportiveDocsBoardID())
+}
+
+// NewPipelineRun needs no lock since SQLite serializes access through one connection
+func (svc *sqliteService) NewPipelineRun(run PipelineRun) (int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return -1, err
+	}
+
+	return newPipelineRun(svc.Db, "", run)
+}
+
+func (svc *sqliteService) RetrievePipelineRunByID(id int64) (PipelineRun, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return PipelineRun{}, err
+	}
+
+	return retrievePipelineRunByID(svc.Db, id)
+}
+
+func (svc *sqliteService) RetrievePipelineRuns(filter PipelineRunFilter, page, pageSize int) ([]PipelineRun, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []PipelineRun{}, err
+	}
+
+	return retrievePipelineRuns(svc.Db, filter, page, pageSize)
+}
+
+func (svc *sqliteService) StartPipelineStep(runID int64, jobType JobType, job Job) (int64, bool, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return -1, false, err
+	}
+
+	return startPipelineStep(svc.Db, "", sqliteInsertjobSQL, runID, jobType, job)
+}
+
+func (svc *sqliteService) UpdatePipelineStep(runID int64, jobType JobType, from, to StepState) (bool, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return false, err
+	}
+
+	return updatePipelineStep(svc.Db, runID, jobType, from, to)
+}
+
+func (svc *sqliteService) FinishPipelineRun(id int64, state PipelineState) (bool, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return false, err
+	}
+
+	return finishPipelineRun(svc.Db, id, state)
+}
+
+func (svc *sqliteService) SaveDeadLetter(dl DeadLetter) (int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return -1, err
+	}
+
+	return saveDeadLetter(svc.Db, dl)
+}
+
+func (svc *sqliteService) RetrieveDeadLetterByID(id int64) (DeadLetter, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return DeadLetter{}, err
+	}
+
+	return retrieveDeadLetterByID(svc.Db, id)
+}
+
+func (svc *sqliteService) RetrieveDeadLetters(filter DeadLetterFilter, page, pageSize int) ([]DeadLetter, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []DeadLetter{}, err
+	}
+
+	return retrieveDeadLetters(svc.Db, filter, page, pageSize)
+}
+
+func (svc *sqliteService) UpdateDeadLetter(dl *DeadLetter) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return updateDeadLetter(svc.Db, dl)
+}
+
+func (svc *sqliteService) ResolveDeadLetters(entityType EntityType, cardID string, operation DeadLetterOperation, itemKey string) (int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return 0, err
+	}
+
+	return resolveDeadLetters(svc.Db, entityType, cardID, operation, itemKey)
+}
+
+func (svc *sqliteService) NewAPIKey(key string) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return newAPIKey(svc.Db, sqliteInsertapikeySQL, key)
+}
+
+func (svc *sqliteService) IsAPIKeyValid(key string) (bool, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return false, err
+	}
+
+	_, ok, err := retrieveAPIKey(svc.Db, sqliteSelectapikeySQL, key)
+	if err != nil {
+		return false, err
+	}
+
+	if !ok {
+		return false, fmt.Errorf("APP KEY %s is not valid", key)
+	}
+
+	return true, nil
+}
+
+func (svc *sqliteService) IsAdminAPIKeyValid(key string) (bool, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return false, err
+	}
+
+	apiKey, ok, err := retrieveAPIKey(svc.Db, sqliteSelectapikeySQL, key)
+	if err != nil {
+		return false, err
+	}
+
+	return ok && apiKey.IsAdmin, nil
+}
+
+func (svc *sqliteService) NewError(e Error) error {
+	err := svc.dbConnection()
+	if err != nil {
+		return err
+	}
+
+	return newError(svc.Db, sqliteInserterrorSQL, e)
+}
+
+func (svc *sqliteService) RetrieveErrors(filter ErrorFilter, page, pageSize int) ([]Error, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []Error{}, err
+	}
+
+	return retrieveErrors(svc.Db, filter, page, pageSize)
+}
+
+func (svc *sqliteService) RetrieveErrorClassCounts(filter ErrorFilter) ([]ErrorClassCount, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return []ErrorClassCount{}, err
+	}
+
+	return retrieveErrorClassCounts(svc.Db, filter)
+}
+
+func (svc *sqliteService) PurgeErrors(before time.Time) (int64, error) {
+	err := svc.dbConnection()
+	if err != nil {
+		return 0, err
+	}
+
+	return purgeErrors(svc.Db, before)
+}
+
+func (svc *sqliteService) Finalize() {
+	if svc.Db != nil {
+		svc.Db.Close()
+	}
+}
+
+func (svc *sqliteService) dbConnection() error {
+	if svc.Db == nil {
+		return fmt.Errorf("database is not connected")
+	}
+
+	return nil
+}
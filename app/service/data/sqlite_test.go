@@ -0,0 +1,1024 @@
+package data
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+)
+
+func TestSQLitePropertyRoundTrip(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	cfgsvc := config.New()
+	datasvc, err := NewSQLite(context.Background(), cfgsvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	prop := Property{
+		BoardID:     cfgsvc.GetTrelloPropertiesBoardID(),
+		CardID:      "card-1",
+		Name:        "Lot 7",
+		Owner:       "Family",
+		Area:        120.5,
+		Shares:      24,
+		Effects:     true,
+		Labels:      []string{"a", "b"},
+		Attachments: []string{"https://trello.com/1/cards/abc/attachments/def/download/deed.pdf"},
+	}
+
+	outcome, id, err := datasvc.NewProperty(prop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if outcome != UpsertInserted {
+		t.Fatalf("expected the property to be inserted, got %s", outcome)
+	}
+
+	outcome, _, err = datasvc.NewProperty(prop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if outcome != UpsertUnchanged {
+		t.Fatalf("expected the property to be unchanged, got %s", outcome)
+	}
+
+	prop.Area = 130
+	outcome, updatedID, err := datasvc.NewProperty(prop)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if outcome != UpsertUpdated || updatedID != id {
+		t.Fatalf("expected property %d to be updated, got %s on %d", id, outcome, updatedID)
+	}
+
+	props, err := datasvc.RetrieveProperties(1, 10, "updated_at", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(props) != 1 || props[0].Area != 130 || len(props[0].Labels) != 2 {
+		t.Fatalf("unexpected properties %+v", props)
+	}
+
+	totals, err := datasvc.RetrieveOwnerTotals()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(totals) != 1 || totals[0].Shares != 24 {
+		t.Fatalf("unexpected owner totals %+v", totals)
+	}
+
+	att := Attachment{
+		EntityType:         EntityTypeProperties,
+		CardID:             "card-1",
+		TrelloAttachmentID: "def",
+		TrelloURL:          prop.Attachments[0],
+		Name:               "deed.pdf",
+		StorageKey:         "properties/def-deed.pdf",
+	}
+
+	// Syncing the same Trello attachment twice must not duplicate it
+	for i := 0; i < 2; i++ {
+		_, err = datasvc.NewAttachment(att)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	atts, err := datasvc.RetrievePendingAttachments(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(atts) != 1 || atts[0].Status != AttachmentStatusPending {
+		t.Fatalf("expected 1 pending attachment, got %+v", atts)
+	}
+
+	atts[0].Status = AttachmentStatusMirrored
+	atts[0].StorageURL = "https://bucket/properties/def-deed.pdf"
+	err = datasvc.UpdateAttachment(&atts[0])
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	atts, err = datasvc.RetrievePendingAttachments(10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(atts) != 0 {
+		t.Fatalf("expected no pending attachments, got %d", len(atts))
+	}
+
+	// Failed attachments are left to the dead letter replay and pages are capped
+	for _, id := range []string{"f1", "p1", "p2"} {
+		attID, err := datasvc.NewAttachment(Attachment{EntityType: EntityTypeProperties, CardID: "card-2", TrelloAttachmentID: id})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if id == "f1" {
+			err = datasvc.UpdateAttachment(&Attachment{ID: attID, EntityType: EntityTypeProperties, CardID: "card-2", TrelloAttachmentID: id, Status: AttachmentStatusFailed})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	atts, err = datasvc.RetrievePendingAttachments(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(atts) != 1 || atts[0].TrelloAttachmentID != "p1" {
+		t.Fatalf("expected the first pending attachment, got %+v", atts)
+	}
+
+	props, err = datasvc.RetrieveProperties(1, 10, "updated_at", "desc")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(props[0].Files) != 1 || props[0].Files[0].StorageURL != "https://bucket/properties/def-deed.pdf" {
+		t.Fatalf("unexpected property files %+v", props[0].Files)
+	}
+}
+
+func TestSQLiteJobRoundTrip(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := datasvc.NewJob(Job{
+		Type:      JobTypeProperties,
+		State:     JobStateQueued,
+		StartedAt: time.Now(),
+		Options:   JobOptions(`{"pageSize":20}`),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	pending, err := datasvc.IsPendingJobsByType(JobTypeProperties)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !pending {
+		t.Fatal("expected a pending job")
+	}
+
+	job, err := datasvc.RetrieveJobByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(job.Options) != `{"pageSize":20}` {
+		t.Fatalf("unexpected options %s", job.Options)
+	}
+
+	now := time.Now()
+	job.State = JobStateCompleted
+	job.Cards = 3
+	job.Inserted = 1
+	job.Unchanged = 2
+	job.CompletedAt = &now
+	err = datasvc.UpdateJob(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err = datasvc.RetrieveJobByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.State != JobStateCompleted || job.Cards != 3 || job.Unchanged != 2 || job.CompletedAt == nil {
+		t.Fatalf("unexpected job %+v", job)
+	}
+
+	jobs, err := datasvc.RetrieveJobs(JobFilter{Type: JobTypeProperties, State: JobStateCompleted}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 1 || jobs[0].ID != id {
+		t.Fatalf("unexpected jobs %+v", jobs)
+	}
+
+	jobs, err = datasvc.RetrieveJobs(JobFilter{Type: JobTypeAttachments}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 0 {
+		t.Fatalf("expected no attachment jobs, got %+v", jobs)
+	}
+
+	stats, err := datasvc.RetrieveJobStats(JobFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(stats) != 1 || stats[0].Runs != 1 || stats[0].MeanCards != 3 {
+		t.Fatalf("unexpected job stats %+v", stats)
+	}
+}
+
+func TestSQLiteDryRunReport(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := datasvc.NewJob(Job{
+		Type:      JobTypeProperties,
+		State:     JobStateQueued,
+		StartedAt: time.Now(),
+		DryRun:    true,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := datasvc.RetrieveJobByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !job.DryRun || job.Report != nil {
+		t.Fatalf("expected a dry run without a report, got %+v", job)
+	}
+
+	now := time.Now()
+	job.State = JobStateCompleted
+	job.CompletedAt = &now
+	job.Report = &DryRunReport{
+		Inserts:   []CardChange{{CardID: "a", Name: "Lot 1"}},
+		Updates:   []CardChange{{CardID: "b", Name: "Lot 2", Fields: []FieldDiff{{Field: "area", Old: 100.0, New: 120.0}}}},
+		Archivals: []CardChange{},
+		Uploads:   []AttachmentUpload{{EntityType: EntityTypeProperties, CardID: "a", TrelloAttachmentID: "att", StorageKey: "properties/att-lot_1.pdf"}},
+	}
+	err = datasvc.UpdateJob(&job)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err = datasvc.RetrieveJobByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report := job.Report
+	if report == nil || len(report.Inserts) != 1 || len(report.Updates) != 1 || len(report.Uploads) != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+
+	diff := report.Updates[0].Fields[0]
+	if diff.Field != "area" || diff.Old != 100.0 || diff.New != 120.0 {
+		t.Fatalf("unexpected field diff %+v", diff)
+	}
+}
+
+func TestSQLiteJobQueue(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, err := datasvc.NewJob(Job{
+		Type:      JobTypeProperties,
+		State:     JobStateQueued,
+		StartedAt: time.Now(),
+		PageSize:  25,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, ok, err := datasvc.ClaimJob(JobTypeProperties, "worker-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || job.ID != id || job.State != JobStateRunning || job.Attempts != 1 || job.PageSize != 25 || job.HeartbeatAt == nil {
+		t.Fatalf("unexpected claimed job %+v", job)
+	}
+
+	_, ok, err = datasvc.ClaimJob(JobTypeProperties, "worker-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if ok {
+		t.Fatal("expected the job to be claimed only once")
+	}
+
+	state, err := datasvc.HeartbeatJob(id, "worker-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != JobStateRunning {
+		t.Fatalf("expected the job to be running, got %s", state)
+	}
+
+	_, err = datasvc.HeartbeatJob(id, "worker-2")
+	if !errors.Is(err, ErrJobNotClaimed) {
+		t.Fatalf("expected a heartbeat from another worker to be rejected, got %v", err)
+	}
+
+	// A fresh heartbeat is not stale
+	reaped, err := datasvc.ReapStaleJobs(time.Now().Add(-time.Minute), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reaped) != 0 {
+		t.Fatalf("expected no stale jobs, got %+v", reaped)
+	}
+
+	reaped, err = datasvc.ReapStaleJobs(time.Now().Add(time.Minute), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reaped) != 1 || reaped[0].State != JobStateQueued {
+		t.Fatalf("expected the job to be requeued, got %+v", reaped)
+	}
+
+	job, ok, err = datasvc.ClaimJob(JobTypeProperties, "worker-2")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !ok || job.Attempts != 2 || job.WorkerID != "worker-2" {
+		t.Fatalf("unexpected reclaimed job %+v", job)
+	}
+
+	// The worker the job was taken from cannot write it
+	stale := job
+	stale.WorkerID = "worker-1"
+	stale.State = JobStateCompleted
+	err = datasvc.FinishJob(&stale)
+	if !errors.Is(err, ErrJobNotClaimed) {
+		t.Fatalf("expected the stale worker to be rejected, got %v", err)
+	}
+
+	job, err = datasvc.RetrieveJobByID(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.State != JobStateRunning || job.WorkerID != "worker-2" {
+		t.Fatalf("expected the job to still run on worker-2, got %+v", job)
+	}
+
+	reaped, err = datasvc.ReapStaleJobs(time.Now().Add(time.Minute), 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reaped) != 1 || reaped[0].State != JobStateFailed {
+		t.Fatalf("expected the job to fail after 2 attempts, got %+v", reaped)
+	}
+
+	pending, err := datasvc.IsPendingJobsByType(JobTypeProperties)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if pending {
+		t.Fatal("expected a failed job to no longer block its type")
+	}
+}
+
+func TestSQLiteCancelJob(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	queued, _ := datasvc.NewJob(Job{Type: JobTypeProperties, State: JobStateQueued, StartedAt: time.Now()})
+	running, _ := datasvc.NewJob(Job{Type: JobTypeAttachments, State: JobStateQueued, StartedAt: time.Now()})
+	_, _, err = datasvc.ClaimJob(JobTypeAttachments, "worker-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := datasvc.CancelJob(queued, "ops", "wrong board")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.State != JobStateCancelled || job.CompletedAt == nil || job.CancelledBy != "ops" || job.CancelReason != "wrong board" {
+		t.Fatalf("expected the queued job to be cancelled right away, got %+v", job)
+	}
+
+	job, err = datasvc.CancelJob(running, "ops", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if job.State != JobStateCancelling || job.CompletedAt != nil {
+		t.Fatalf("expected the running job to be cancelling, got %+v", job)
+	}
+
+	state, err := datasvc.HeartbeatJob(running, "worker-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if state != JobStateCancelling {
+		t.Fatalf("expected the worker to learn about the cancellation, got %s", state)
+	}
+
+	_, err = datasvc.CancelJob(running, "ops", "")
+	if !errors.Is(err, ErrJobNotCancellable) {
+		t.Fatalf("expected a cancelling job to not be cancellable, got %v", err)
+	}
+
+	// The worker died before it could stop the job
+	reaped, err := datasvc.ReapStaleJobs(time.Now().Add(time.Minute), 3)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(reaped) != 1 || reaped[0].State != JobStateCancelled {
+		t.Fatalf("expected the stale cancelling job to be cancelled, got %+v", reaped)
+	}
+
+	_, err = datasvc.CancelJob(999, "ops", "")
+	if err == nil || errors.Is(err, ErrJobNotCancellable) {
+		t.Fatalf("expected a missing job error, got %v", err)
+	}
+}
+
+func TestSQLiteAdmitJob(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Concurrent admissions of the same type only let one job in
+	var wg sync.WaitGroup
+	var admitted atomic.Int32
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, _, err := datasvc.AdmitJob(Job{Type: JobTypeProperties, State: JobStateQueued, StartedAt: time.Now()}, 1)
+			if err == nil {
+				admitted.Add(1)
+			} else if !errors.Is(err, ErrJobLimitReached) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if admitted.Load() != 1 {
+		t.Fatalf("expected a single job to be admitted, got %d", admitted.Load())
+	}
+
+	_, active, err := datasvc.AdmitJob(Job{Type: JobTypeProperties, State: JobStateQueued, StartedAt: time.Now()}, 1)
+	if !errors.Is(err, ErrJobLimitReached) || active.ID == 0 || active.State != JobStateQueued {
+		t.Fatalf("expected the active job, got %+v and %v", active, err)
+	}
+
+	// Another type and a higher limit are admitted
+	_, _, err = datasvc.AdmitJob(Job{Type: JobTypeAttachments, State: JobStateQueued, StartedAt: time.Now()}, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	id, _, err := datasvc.AdmitJob(Job{Type: JobTypeProperties, State: JobStateQueued, StartedAt: time.Now()}, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, active, err = datasvc.AdmitJob(Job{Type: JobTypeProperties, State: JobStateQueued, StartedAt: time.Now()}, 2)
+	if !errors.Is(err, ErrJobLimitReached) || active.ID != id {
+		t.Fatalf("expected the latest active job %d, got %+v and %v", id, active, err)
+	}
+}
+
+func TestSQLiteSchedules(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	due := time.Date(2025, 3, 1, 6, 0, 0, 0, time.UTC)
+	err = datasvc.SaveSchedule(Schedule{JobType: JobTypeAttachments, Cron: "0 6 * * *", TimeZone: "UTC", CatchUp: CatchUpOnce, NextFireAt: due})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	next := due.Add(24 * time.Hour)
+	firedAt := due.Add(time.Second)
+	advanced, err := datasvc.AdvanceSchedule(JobTypeAttachments, due, next, &firedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !advanced {
+		t.Fatal("expected the schedule to advance")
+	}
+
+	// A second replica with the same due time loses
+	advanced, err = datasvc.AdvanceSchedule(JobTypeAttachments, due, next, &firedAt)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if advanced {
+		t.Fatal("expected the schedule to advance only once")
+	}
+
+	// Redefining the schedule keeps its last fire time
+	err = datasvc.SaveSchedule(Schedule{JobType: JobTypeAttachments, Cron: "0 5 * * *", TimeZone: "UTC", CatchUp: CatchUpSkip, NextFireAt: next.Add(-time.Hour)})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, err := datasvc.RetrieveSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(schedules) != 1 || schedules[0].Cron != "0 5 * * *" || schedules[0].LastFiredAt == nil || !schedules[0].LastFiredAt.Equal(firedAt) {
+		t.Fatalf("unexpected schedules %+v", schedules)
+	}
+
+	err = datasvc.DeleteSchedule(JobTypeAttachments)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	schedules, err = datasvc.RetrieveSchedules()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(schedules) != 0 {
+		t.Fatalf("expected no schedules, got %+v", schedules)
+	}
+}
+
+func TestSQLitePipelineRuns(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	runID, err := datasvc.NewPipelineRun(PipelineRun{
+		Pipeline:    "daily",
+		State:       PipelineStateRunning,
+		TriggeredBy: "ops",
+		StartedAt:   time.Now(),
+		Steps: []PipelineStep{
+			{JobType: JobTypeProperties, DependsOn: JobTypes{}, OnFailure: FailurePolicyStop, State: StepStatePending},
+			{JobType: JobTypeAttachments, DependsOn: JobTypes{JobTypeProperties}, OnFailure: FailurePolicyContinue, State: StepStatePending},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The pipeline cannot be started again while the run is in progress
+	running, err := datasvc.NewPipelineRun(PipelineRun{Pipeline: "daily", State: PipelineStateRunning, StartedAt: time.Now()})
+	if !errors.Is(err, ErrPipelineRunning) || running != runID {
+		t.Fatalf("expected run %d to be in progress, got %d and %v", runID, running, err)
+	}
+
+	jobID, started, err := datasvc.StartPipelineStep(runID, JobTypeProperties, Job{Type: JobTypeProperties, State: JobStateQueued, StartedAt: time.Now(), PageSize: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !started {
+		t.Fatal("expected the step to start")
+	}
+
+	// A second replica does not enqueue another job
+	_, started, err = datasvc.StartPipelineStep(runID, JobTypeProperties, Job{Type: JobTypeProperties, State: JobStateQueued, StartedAt: time.Now(), PageSize: 50})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if started {
+		t.Fatal("expected the step to start only once")
+	}
+
+	jobs, err := datasvc.RetrieveJobs(JobFilter{Type: JobTypeProperties}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(jobs) != 1 || jobs[0].ID != jobID {
+		t.Fatalf("expected a single job, got %+v", jobs)
+	}
+
+	updated, err := datasvc.UpdatePipelineStep(runID, JobTypeProperties, StepStateRunning, StepStateCompleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !updated {
+		t.Fatal("expected the step to complete")
+	}
+
+	run, err := datasvc.RetrievePipelineRunByID(runID)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(run.Steps) != 2 || run.Steps[0].State != StepStateCompleted || run.Steps[0].JobID == nil || *run.Steps[0].JobID != jobID {
+		t.Fatalf("unexpected steps %+v", run.Steps)
+	}
+
+	if len(run.Steps[1].DependsOn) != 1 || run.Steps[1].DependsOn[0] != JobTypeProperties || run.Steps[1].State != StepStatePending {
+		t.Fatalf("unexpected dependent step %+v", run.Steps[1])
+	}
+
+	finished, err := datasvc.FinishPipelineRun(runID, PipelineStateCompleted)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if !finished {
+		t.Fatal("expected the run to finish")
+	}
+
+	runs, err := datasvc.RetrievePipelineRuns(PipelineRunFilter{Pipeline: "daily", State: PipelineStateRunning}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 0 {
+		t.Fatalf("expected no running runs, got %+v", runs)
+	}
+
+	runs, err = datasvc.RetrievePipelineRuns(PipelineRunFilter{Pipeline: "daily"}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(runs) != 1 || runs[0].State != PipelineStateCompleted || runs[0].CompletedAt == nil || len(runs[0].Steps) != 2 {
+		t.Fatalf("unexpected runs %+v", runs)
+	}
+}
+
+func TestSQLiteDeadLetters(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dl := DeadLetter{
+		JobID:      1,
+		EntityType: EntityTypeProperties,
+		CardID:     "card",
+		Operation:  DeadLetterOperationUpsert,
+		Payload:    `{"cardId":"card"}`,
+		Error:      "db down",
+		Attempts:   3,
+	}
+
+	first, err := datasvc.SaveDeadLetter(dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The next failing job refreshes the pending dead letter
+	dl.JobID = 2
+	dl.Error = "db still down"
+	second, err := datasvc.SaveDeadLetter(dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if second != first {
+		t.Fatalf("expected dead letter %d to be refreshed, got %d", first, second)
+	}
+
+	saved, err := datasvc.RetrieveDeadLetterByID(first)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if saved.JobID != 2 || saved.Error != "db still down" || saved.Attempts != 6 || saved.State != DeadLetterStatePending {
+		t.Fatalf("unexpected dead letter %+v", saved)
+	}
+
+	resolved, err := datasvc.ResolveDeadLetters(EntityTypeProperties, "card", DeadLetterOperationUpsert, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if resolved != 1 {
+		t.Fatalf("expected one resolved dead letter, got %d", resolved)
+	}
+
+	dls, err := datasvc.RetrieveDeadLetters(DeadLetterFilter{State: DeadLetterStatePending}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dls) != 0 {
+		t.Fatalf("expected no pending dead letters, got %+v", dls)
+	}
+
+	// Once resolved, a new failure opens a new dead letter
+	third, err := datasvc.SaveDeadLetter(dl)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if third == first {
+		t.Fatal("expected a new dead letter")
+	}
+
+	saved, err = datasvc.RetrieveDeadLetterByID(third)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	saved.Attempts++
+	saved.Error = "still failing"
+	if err := datasvc.UpdateDeadLetter(&saved); err != nil {
+		t.Fatal(err)
+	}
+
+	dls, err = datasvc.RetrieveDeadLetters(DeadLetterFilter{JobID: 2, EntityType: EntityTypeProperties, CardID: "card"}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(dls) != 2 || dls[0].State != DeadLetterStateResolved || dls[0].ResolvedAt == nil || dls[1].Attempts != 4 || dls[1].Error != "still failing" {
+		t.Fatalf("unexpected dead letters %+v", dls)
+	}
+
+	if _, err := datasvc.RetrieveDeadLetterByID(100); err == nil {
+		t.Fatal("expected a missing dead letter")
+	}
+}
+
+func TestSQLiteResetFactoryByBoard(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	cfgsvc := config.New()
+	datasvc, err := NewSQLite(context.Background(), cfgsvc)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, boardID := range []string{"board-1", "board-1", "board-2"} {
+		cardID := fmt.Sprintf("%s-card-%d", boardID, i)
+		_, _, err = datasvc.NewProperty(Property{BoardID: boardID, CardID: cardID})
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		_, err = datasvc.NewAttachment(Attachment{EntityType: EntityTypeProperties, CardID: cardID, TrelloAttachmentID: "a", StorageKey: "properties/" + cardID})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// An inheritance confinment on the same card ID keeps its attachment
+	_, err = datasvc.NewAttachment(Attachment{EntityType: EntityTypeInheritanceConfinments, CardID: "board-1-card-0", TrelloAttachmentID: "a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	scope := ResetScope{Entities: []ResetEntity{ResetEntityProperties}, BoardID: "board-1"}
+	counts, err := datasvc.CountResetRows(scope)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The attachments of the cards are counted with them
+	if len(counts) != 2 || counts["properties"] != 2 || counts["attachments"] != 2 {
+		t.Fatalf("expected 2 properties and 2 attachments to reset, got %v", counts)
+	}
+
+	var snapshot bytes.Buffer
+	deleted, err := datasvc.ResetFactory(scope, &snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deleted) != 2 || deleted["properties"] != 2 || deleted["attachments"] != 2 || !strings.Contains(snapshot.String(), "board-1") {
+		t.Fatalf("unexpected reset %v %s", deleted, snapshot.String())
+	}
+
+	// The attachments of the deleted cards go with them
+	if !strings.Contains(snapshot.String(), `"storage_key":"properties/board-1-card-1"`) {
+		t.Fatalf("expected the attachments in the snapshot %s", snapshot.String())
+	}
+
+	var attachments []string
+	err = datasvc.(*sqliteService).Db.Select(&attachments, "SELECT entity_type || ':' || card_id FROM attachments ORDER BY id")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if strings.Join(attachments, ",") != "properties:board-2-card-2,inheritance_confinments:board-1-card-0" {
+		t.Fatalf("unexpected attachments left %v", attachments)
+	}
+
+	counts, err = datasvc.CountResetRows(ResetScope{Entities: []ResetEntity{ResetEntityProperties}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if counts["properties"] != 1 || counts["attachments"] != 1 {
+		t.Fatalf("expected the other board to survive, got %v", counts)
+	}
+
+	_, err = datasvc.CountResetRows(ResetScope{Entities: []ResetEntity{ResetEntityJobs}, BoardID: "board-1"})
+	if err == nil {
+		t.Fatal("expected jobs to reject a board scope")
+	}
+}
+
+func TestSQLiteResetFactoryPipelines(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	_, err = datasvc.NewPipelineRun(PipelineRun{
+		Pipeline:  "daily",
+		State:     PipelineStateRunning,
+		StartedAt: time.Now(),
+		Steps: []PipelineStep{
+			{JobType: JobTypeProperties, DependsOn: JobTypes{}, OnFailure: FailurePolicyStop, State: StepStatePending},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var snapshot bytes.Buffer
+	deleted, err := datasvc.ResetFactory(ResetScope{Entities: []ResetEntity{ResetEntityPipelines, ResetEntityDeadLetters}}, &snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The steps go with their runs and are in the snapshot
+	if deleted["pipeline_runs"] != 1 || deleted["pipeline_steps"] != 1 || !strings.Contains(snapshot.String(), `"pipeline_steps":[{`) {
+		t.Fatalf("unexpected reset %v %s", deleted, snapshot.String())
+	}
+
+	var steps int
+	err = datasvc.(*sqliteService).Db.Get(&steps, "SELECT COUNT(*) FROM pipeline_steps")
+	if err != nil || steps != 0 {
+		t.Fatalf("expected the steps to be deleted, got %d: %v", steps, err)
+	}
+}
+
+func TestSQLiteErrors(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	jobID := int64(7)
+	records := []Error{
+		{Source: "job", Body: "trello down", JobID: &jobID, Class: ErrorClassTrello, Severity: ErrorSeverityCritical},
+		{Source: "job", Body: "insert failed", JobID: &jobID, CardID: "card-1", EntityType: EntityTypeProperties, Class: ErrorClassDatabase},
+		{Source: "job", Body: "insert failed", JobID: &jobID, CardID: "card-2", EntityType: EntityTypeProperties, Class: ErrorClassDatabase},
+		{Source: "main", Body: "unknown"},
+	}
+	for _, record := range records {
+		err = datasvc.NewError(record)
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	errs, err := datasvc.RetrieveErrors(ErrorFilter{JobID: jobID}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 3 {
+		t.Fatalf("expected 3 job errors, got %d", len(errs))
+	}
+
+	errs, err = datasvc.RetrieveErrors(ErrorFilter{}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(errs) != 4 || errs[0].Class != ErrorClassInternal || errs[0].Severity != ErrorSeverityError {
+		t.Fatalf("expected the newest error first with defaults, got %+v", errs)
+	}
+
+	counts, err := datasvc.RetrieveErrorClassCounts(ErrorFilter{Source: "job"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(counts) != 2 || counts[0].Class != ErrorClassDatabase || counts[0].Count != 2 {
+		t.Fatalf("unexpected class counts %+v", counts)
+	}
+
+	purged, err := datasvc.PurgeErrors(time.Now().Add(time.Hour))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if purged != 4 {
+		t.Fatalf("expected 4 purged errors, got %d", purged)
+	}
+}
+
+func TestSQLiteAPIKeys(t *testing.T) {
+	t.Setenv("DB_DRIVER", "sqlite")
+	t.Setenv("DB_DSN", "file::memory:")
+
+	datasvc, err := NewSQLite(context.Background(), config.New())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = datasvc.NewAPIKey("key-1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	valid, err := datasvc.IsAPIKeyValid("key-1")
+	if err != nil || !valid {
+		t.Fatalf("expected the new key to be valid: %v", err)
+	}
+
+	admin, err := datasvc.IsAdminAPIKeyValid("key-1")
+	if err != nil || admin {
+		t.Fatalf("expected the new key not to be an admin key: %v", err)
+	}
+
+	_, err = datasvc.(*sqliteService).Db.Exec("UPDATE api_keys SET is_admin = TRUE")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	admin, err = datasvc.IsAdminAPIKeyValid("key-1")
+	if err != nil || !admin {
+		t.Fatalf("expected an admin key: %v", err)
+	}
+
+	valid, err = datasvc.IsAPIKeyValid("key-2")
+	if err == nil || valid {
+		t.Fatal("expected an unknown key to be invalid")
+	}
+}
@@ -1,32 +1,81 @@
 package data
 
+import (
+	"context"
+	"database/sql"
+	"io"
+	"time"
+)
+
 type IService interface {
-	ResetFactory() error
+	Ping(ctx context.Context) error
+	Stats() sql.DBStats
+	Finalize()
+
+	CountResetRows(scope ResetScope) (map[string]int64, error)
+	ResetFactory(scope ResetScope, snapshot io.Writer) (map[string]int64, error)
 
-	NewProperty(prop Property) (bool, int64, error)
+	NewProperty(prop Property) (UpsertOutcome, int64, error)
 	UpdateProperty(prop *Property) error
 	RetrieveProperties(page, pageSize int, orderBy, orderDir string) ([]Property, error)
-	RetrievePropertyAttachments(pageSize int) ([]string, error)
 
-	NewInheritanceConfinment(inh InheritanceConfinment) (bool, int64, error)
+	NewInheritanceConfinment(inh InheritanceConfinment) (UpsertOutcome, int64, error)
 	UpdateInheritanceConfinment(inh *InheritanceConfinment) error
 	RetrieveInheritanceConfinments(page, pageSize int, orderBy, orderDir string) ([]InheritanceConfinment, error)
-	RetrieveInheritanceConfinmentAttachments(pageSize int) ([]string, error)
 
-	NewSupportiveDoc(inh SupportiveDoc) (bool, int64, error)
+	NewSupportiveDoc(inh SupportiveDoc) (UpsertOutcome, int64, error)
 	UpdateSupportiveDoc(inh *SupportiveDoc) error
 	RetrieveSupportiveDocs(page, pageSize int, orderBy, orderDir string) ([]SupportiveDoc, error)
-	RetrieveSupportiveDocAttachments(pageSize int) ([]string, error)
 
-	IsAttachmentMapped(url string) (bool, error)
-	MapAttachment(trelloURL, storageURL string) error
+	NewAttachment(att Attachment) (int64, error)
+	UpdateAttachment(att *Attachment) error
+	RetrievePendingAttachments(pageSize int) ([]Attachment, error)
+	RetrieveAttachmentByID(id int64) (Attachment, error)
 
 	NewJob(job Job) (int64, error)
 	UpdateJob(job *Job) error
+	FinishJob(job *Job) error
 	RetrieveJobByID(id int64) (Job, error)
+	RetrieveJobs(filter JobFilter, page, pageSize int) ([]Job, error)
+	RetrieveJobStats(filter JobFilter) ([]JobStats, error)
 	IsPendingJobsByType(jobType JobType) (bool, error)
+	AdmitJob(job Job, limit int) (int64, Job, error)
+	ClaimJob(jobType JobType, workerID string) (Job, bool, error)
+	HeartbeatJob(id int64, workerID string) (JobState, error)
+	CancelJob(id int64, cancelledBy, reason string) (Job, error)
+	UpdateJobProgress(id int64, progress JobProgress) error
+	ReapStaleJobs(staleBefore time.Time, maxAttempts int) ([]Job, error)
+
+	RetrieveSchedules() ([]Schedule, error)
+	SaveSchedule(schedule Schedule) error
+	DeleteSchedule(jobType JobType) error
+	AdvanceSchedule(jobType JobType, due, next time.Time, firedAt *time.Time) (bool, error)
+
+	NewPipelineRun(run PipelineRun) (int64, error)
+	RetrievePipelineRunByID(id int64) (PipelineRun, error)
+	RetrievePipelineRuns(filter PipelineRunFilter, page, pageSize int) ([]PipelineRun, error)
+	StartPipelineStep(runID int64, jobType JobType, job Job) (int64, bool, error)
+	UpdatePipelineStep(runID int64, jobType JobType, from, to StepState) (bool, error)
+	FinishPipelineRun(id int64, state PipelineState) (bool, error)
+
+	SaveDeadLetter(dl DeadLetter) (int64, error)
+	RetrieveDeadLetterByID(id int64) (DeadLetter, error)
+	RetrieveDeadLetters(filter DeadLetterFilter, page, pageSize int) ([]DeadLetter, error)
+	UpdateDeadLetter(dl *DeadLetter) error
+	ResolveDeadLetters(entityType EntityType, cardID string, operation DeadLetterOperation, itemKey string) (int64, error)
+
+	RetrieveOwnerTotals() ([]OwnerTotal, error)
+	RetrieveStatusTypeCounts() ([]StatusTypeCount, error)
+	RetrieveOrganizedBreakdown() ([]OrganizedBreakdown, error)
+	RetrieveEffectProperties() ([]Property, error)
+	RetrieveGenerationCounts() ([]GenerationCount, error)
+	RetrieveCategoryCounts() ([]CategoryCount, error)
 
 	NewAPIKey(key string) error
 	IsAPIKeyValid(key string) (bool, error)
-	NewError(source, body string) error
+	IsAdminAPIKeyValid(key string) (bool, error)
+	NewError(e Error) error
+	RetrieveErrors(filter ErrorFilter, page, pageSize int) ([]Error, error)
+	RetrieveErrorClassCounts(filter ErrorFilter) ([]ErrorClassCount, error)
+	PurgeErrors(before time.Time) (int64, error)
 }
@@ -0,0 +1,105 @@
+package data
+
+import (
+	"reflect"
+	"strings"
+	"time"
+)
+
+// SameContent tells whether two properties carry the same card content.
+// IDs, timestamps and files are ignored and empty arrays equal nil ones.
+func (p Property) SameContent(other Property) bool {
+	return reflect.DeepEqual(p.content(), other.content())
+}
+
+// Diff lists the content fields that change from p to other
+func (p Property) Diff(other Property) []FieldDiff {
+	return diffContent(p.content(), other.content())
+}
+
+func (p Property) content() Property {
+	p.ID = 0
+	p.UpdatedAt = time.Time{}
+	p.Files = nil
+	p.Labels = nilIfEmpty(p.Labels)
+	p.Attachments = nilIfEmpty(p.Attachments)
+	p.Comments = nilIfEmpty(p.Comments)
+	return p
+}
+
+// SameContent tells whether two inheritance confinments carry the same card content
+func (p InheritanceConfinment) SameContent(other InheritanceConfinment) bool {
+	return reflect.DeepEqual(p.content(), other.content())
+}
+
+// Diff lists the content fields that change from p to other
+func (p InheritanceConfinment) Diff(other InheritanceConfinment) []FieldDiff {
+	return diffContent(p.content(), other.content())
+}
+
+func (p InheritanceConfinment) content() InheritanceConfinment {
+	p.ID = 0
+	p.UpdatedAt = time.Time{}
+	p.Files = nil
+	p.Labels = nilIfEmpty(p.Labels)
+	p.Attachments = nilIfEmpty(p.Attachments)
+	p.Comments = nilIfEmpty(p.Comments)
+	return p
+}
+
+// SameContent tells whether two supportive docs carry the same card content
+func (p SupportiveDoc) SameContent(other SupportiveDoc) bool {
+	return reflect.DeepEqual(p.content(), other.content())
+}
+
+// Diff lists the content fields that change from p to other
+func (p SupportiveDoc) Diff(other SupportiveDoc) []FieldDiff {
+	return diffContent(p.content(), other.content())
+}
+
+func (p SupportiveDoc) content() SupportiveDoc {
+	p.ID = 0
+	p.UpdatedAt = time.Time{}
+	p.Files = nil
+	p.Labels = nilIfEmpty(p.Labels)
+	p.Attachments = nilIfEmpty(p.Attachments)
+	p.Comments = nilIfEmpty(p.Comments)
+	return p
+}
+
+// diffContent compares two structs of the same type field by field and
+// names the fields by their JSON tag
+func diffContent(old, updated interface{}) []FieldDiff {
+	diffs := []FieldDiff{}
+	ov := reflect.ValueOf(old)
+	uv := reflect.ValueOf(updated)
+
+	for i := 0; i < ov.NumField(); i++ {
+		before := ov.Field(i).Interface()
+		after := uv.Field(i).Interface()
+		if reflect.DeepEqual(before, after) {
+			continue
+		}
+
+		field := ov.Type().Field(i)
+		name, _, _ := strings.Cut(field.Tag.Get("json"), ",")
+		if name == "" {
+			name = field.Name
+		}
+
+		diffs = append(diffs, FieldDiff{
+			Field: name,
+			Old:   before,
+			New:   after,
+		})
+	}
+
+	return diffs
+}
+
+func nilIfEmpty[T ~[]string](items T) T {
+	if len(items) == 0 {
+		return nil
+	}
+	return items
+}
@@ -0,0 +1,45 @@
+package data
+
+import (
+	"testing"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+func TestPropertyDiff(t *testing.T) {
+	stored := Property{
+		ID:        1,
+		CardID:    "a",
+		Name:      "Lot 1",
+		Area:      100,
+		Labels:    pq.StringArray{},
+		UpdatedAt: time.Now(),
+		Files:     []Attachment{{ID: 1}},
+	}
+
+	incoming := stored
+	incoming.ID = 0
+	incoming.UpdatedAt = time.Time{}
+	incoming.Files = nil
+	incoming.Labels = nil
+
+	if diffs := stored.Diff(incoming); len(diffs) != 0 || !stored.SameContent(incoming) {
+		t.Fatalf("expected no content change, got %+v", diffs)
+	}
+
+	incoming.Area = 120
+	incoming.Owner = "Family"
+	diffs := stored.Diff(incoming)
+	if len(diffs) != 2 || stored.SameContent(incoming) {
+		t.Fatalf("expected 2 changed fields, got %+v", diffs)
+	}
+
+	if diffs[0].Field != "owner" || diffs[0].Old != "" || diffs[0].New != "Family" {
+		t.Fatalf("unexpected owner diff %+v", diffs[0])
+	}
+
+	if diffs[1].Field != "area" || diffs[1].Old != 100.0 || diffs[1].New != 120.0 {
+		t.Fatalf("unexpected area diff %+v", diffs[1])
+	}
+}
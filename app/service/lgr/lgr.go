@@ -1,6 +1,7 @@
 package lgr
 
 import (
+	"encoding/json"
 	"log/slog"
 	"os"
 	"path/filepath"
@@ -105,6 +106,22 @@ func marshalStack(err error) []stackFrame {
 	return s
 }
 
+// Stack returns the stack frames of the error as JSON so it can be stored.
+// It is empty if the error does not carry a stack trace.
+func Stack(err error) string {
+	frames := marshalStack(err)
+	if frames == nil {
+		return ""
+	}
+
+	b, e := json.Marshal(frames)
+	if e != nil {
+		return ""
+	}
+
+	return string(b)
+}
+
 // fmtErr returns a slog.Value with keys `msg` and `trace`. If the error
 // does not implement interface { StackTrace() errors.StackTrace }, the `trace`
 // key is omitted.
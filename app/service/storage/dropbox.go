@@ -2,77 +2,289 @@ package storage
 
 import (
 	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
 	"encoding/json"
 	"fmt"
+	"hash"
 	"io"
 	"net/http"
-	"os"
+	"path"
+	"strings"
+	"time"
+	"unicode/utf16"
+	"unicode/utf8"
 
 	"github.com/khaledhikmat/tr-extractor/service/config"
 )
 
 type dropboxService struct {
 	CfgSvc config.IService
+	// Client bounds every Dropbox request so a hung upload cannot stall a job
+	Client *http.Client
+	// ContentURL is the base URL of the Dropbox content endpoints
+	ContentURL string
+	// APIURL is the base URL of the Dropbox RPC endpoints
+	APIURL string
 }
 
 func NewDropbox(cfgsvc config.IService) IService {
 	return &dropboxService{
-		CfgSvc: cfgsvc,
+		CfgSvc:     cfgsvc,
+		Client:     &http.Client{Timeout: cfgsvc.GetHTTPTimeout()},
+		ContentURL: "https://content.dropboxapi.com/2/",
+		APIURL:     "https://api.dropboxapi.com/2/",
 	}
 }
 
-func (svc *dropboxService) Upload(filePath, folder, identifier string) (string, error) {
-	dropboxPath := fmt.Sprintf("%s%s#%s", svc.CfgSvc.GetDropboxUploadPath(), folder, identifier)
-	fmt.Printf("Uploading to Dropbox: %s\n", dropboxPath)
+type dropboxCursor struct {
+	SessionID string `json:"session_id"`
+	Offset    int64  `json:"offset"`
+}
+
+type dropboxCommit struct {
+	Path       string `json:"path"`
+	Mode       string `json:"mode"`
+	AutoRename bool   `json:"autorename"`
+}
+
+type dropboxMetadata struct {
+	ContentHash string `json:"content_hash"`
+}
+
+func (svc *dropboxService) Upload(body io.Reader, size int64, folder, identifier string) (string, error) {
+	dropboxPath := svc.path(folder, identifier)
+	fmt.Printf("Uploading to Dropbox: %s (%d bytes)\n", dropboxPath, size)
 	// if 0 == 0 {
 	// 	return filePath, nil
 	// }
 
-	defer func() {
-		// Delete the local file
-		_ = os.Remove(filePath)
-	}()
+	commit := dropboxCommit{
+		Path:       "/" + dropboxPath,
+		Mode:       "add",
+		AutoRename: true,
+	}
+	hasher := newDropboxContentHash()
+	buf := make([]byte, svc.CfgSvc.GetUploadPartSize())
 
-	f, err := os.Open(filePath)
+	part, last, err := readPart(body, buf)
 	if err != nil {
 		return "", err
 	}
-	defer f.Close()
+	hasher.Write(part)
+
+	var metadata dropboxMetadata
+	if last {
+		// A file that fits in one part goes in a single request
+		err = svc.call("files/upload", commit, part, &metadata)
+	} else {
+		metadata, err = svc.uploadSession(commit, body, buf, part, hasher)
+	}
+	if err != nil {
+		fmt.Printf("Uploading to Dropbox failed: %s\n", err)
+		return "", fmt.Errorf("failed to upload to Dropbox: %w", err)
+	}
+
+	// Dropbox hashes what it stored the same way
+	contentHash := hasher.Sum()
+	if metadata.ContentHash != "" && metadata.ContentHash != contentHash {
+		return "", fmt.Errorf("failed to upload to Dropbox: content hash %s does not match %s", metadata.ContentHash, contentHash)
+	}
+
+	// Now create a shared link
+	// sharedURL, err := svc.createDropboxShareLink(dropboxPath)
+	// if err != nil {
+	// 	return "", err
+	// }
+
+	// return sharedURL, nil
+	return dropboxPath, nil
+}
+
+// path is where an object is uploaded to, relative to the Dropbox root
+func (svc *dropboxService) path(folder, identifier string) string {
+	return fmt.Sprintf("%s%s#%s", svc.CfgSvc.GetDropboxUploadPath(), folder, identifier)
+}
 
-	body, err := io.ReadAll(f)
+// SignedURL returns a temporary link to the file. Dropbox decides how long
+// it lasts (4 hours) so the ttl is not used.
+func (svc *dropboxService) SignedURL(key string, _ time.Duration) (string, error) {
+	folder, identifier := path.Split(key)
+	jsonBody, err := json.Marshal(map[string]string{
+		"path": "/" + svc.path(strings.TrimSuffix(folder, "/"), identifier),
+	})
 	if err != nil {
 		return "", err
 	}
 
-	req, err := http.NewRequest("POST", "https://content.dropboxapi.com/2/files/upload", bytes.NewReader(body))
+	req, err := http.NewRequest("POST", svc.APIURL+"files/get_temporary_link", bytes.NewReader(jsonBody))
 	if err != nil {
 		return "", err
 	}
 
 	req.Header.Set("Authorization", "Bearer "+svc.CfgSvc.GetDropboxAccessToken())
-	req.Header.Set("Content-Type", "application/octet-stream")
-	req.Header.Set("Dropbox-API-Arg", fmt.Sprintf(`{"path":"/%s","mode":"add","autorename":true}`, dropboxPath))
+	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := svc.Client.Do(req)
 	if err != nil {
 		return "", err
 	}
 	defer resp.Body.Close()
 
+	responseBody, _ := io.ReadAll(resp.Body)
 	if resp.StatusCode != 200 {
-		responseBody, _ := io.ReadAll(resp.Body)
-		fmt.Printf("Uploading to Dropbox failed: %s\n", responseBody)
-		return "", fmt.Errorf("failed to upload to Dropbox: %s", responseBody)
+		return "", fmt.Errorf("files/get_temporary_link: %s", responseBody)
 	}
 
-	// Now create a shared link
-	// sharedURL, err := svc.createDropboxShareLink(dropboxPath)
-	// if err != nil {
-	// 	return "", err
-	// }
+	var link struct {
+		Link string `json:"link"`
+	}
+	err = json.Unmarshal(responseBody, &link)
+	if err != nil {
+		return "", err
+	}
 
-	// return sharedURL, nil
-	return dropboxPath, nil
+	return link.Link, nil
+}
+
+// uploadSession uploads the body one part at a time in an upload session,
+// starting with the part already read. The last part finishes the session.
+func (svc *dropboxService) uploadSession(commit dropboxCommit, body io.Reader, buf, part []byte, hasher *dropboxContentHash) (dropboxMetadata, error) {
+	var metadata dropboxMetadata
+
+	var started struct {
+		SessionID string `json:"session_id"`
+	}
+	err := svc.call("files/upload_session/start", map[string]interface{}{"close": false}, part, &started)
+	if err != nil {
+		return metadata, err
+	}
+	cursor := dropboxCursor{SessionID: started.SessionID, Offset: int64(len(part))}
+
+	for {
+		part, last, err := readPart(body, buf)
+		if err != nil {
+			return metadata, err
+		}
+		hasher.Write(part)
+
+		if last {
+			err = svc.call("files/upload_session/finish", map[string]interface{}{
+				"cursor": cursor,
+				"commit": commit,
+			}, part, &metadata)
+			return metadata, err
+		}
+
+		err = svc.call("files/upload_session/append_v2", map[string]interface{}{
+			"cursor": cursor,
+			"close":  false,
+		}, part, nil)
+		if err != nil {
+			return metadata, err
+		}
+		cursor.Offset += int64(len(part))
+	}
+}
+
+// call posts a part to a Dropbox content endpoint with its arguments in the
+// `Dropbox-API-Arg` header and decodes the response into result
+func (svc *dropboxService) call(endpoint string, arg interface{}, part []byte, result interface{}) error {
+	jsonArg, err := json.Marshal(arg)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("POST", svc.ContentURL+endpoint, bytes.NewReader(part))
+	if err != nil {
+		return err
+	}
+
+	req.Header.Set("Authorization", "Bearer "+svc.CfgSvc.GetDropboxAccessToken())
+	req.Header.Set("Content-Type", "application/octet-stream")
+	req.Header.Set("Dropbox-API-Arg", asciiJSON(jsonArg))
+
+	resp, err := svc.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	responseBody, _ := io.ReadAll(resp.Body)
+	if resp.StatusCode != 200 {
+		return fmt.Errorf("%s: %s", endpoint, responseBody)
+	}
+
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(responseBody, result)
+}
+
+// asciiJSON escapes the non-ASCII characters of a JSON document since HTTP
+// headers must be ASCII. Names of cards are often in Arabic.
+func asciiJSON(b []byte) string {
+	var sb strings.Builder
+	for _, r := range string(b) {
+		if r < utf8.RuneSelf {
+			sb.WriteRune(r)
+			continue
+		}
+
+		r1, r2 := utf16.EncodeRune(r)
+		if r1 == utf8.RuneError {
+			fmt.Fprintf(&sb, "\\u%04x", r)
+			continue
+		}
+		fmt.Fprintf(&sb, "\\u%04x\\u%04x", r1, r2)
+	}
+
+	return sb.String()
+}
+
+// dropboxBlockSize is the block size of the Dropbox content hash
+const dropboxBlockSize = 4 << 20
+
+// dropboxContentHash computes the Dropbox content hash while streaming: the
+// SHA-256 of the concatenated SHA-256 hashes of every 4 MiB block.
+type dropboxContentHash struct {
+	overall hash.Hash
+	block   hash.Hash
+	filled  int
+}
+
+func newDropboxContentHash() *dropboxContentHash {
+	return &dropboxContentHash{
+		overall: sha256.New(),
+		block:   sha256.New(),
+	}
+}
+
+func (h *dropboxContentHash) Write(p []byte) {
+	for len(p) > 0 {
+		n := min(len(p), dropboxBlockSize-h.filled)
+		h.block.Write(p[:n])
+		h.filled += n
+		p = p[n:]
+
+		if h.filled == dropboxBlockSize {
+			h.overall.Write(h.block.Sum(nil))
+			h.block.Reset()
+			h.filled = 0
+		}
+	}
+}
+
+// Sum hashes the last partial block. Call it once the whole body is written.
+func (h *dropboxContentHash) Sum() string {
+	if h.filled > 0 {
+		h.overall.Write(h.block.Sum(nil))
+		h.block.Reset()
+		h.filled = 0
+	}
+
+	return hex.EncodeToString(h.overall.Sum(nil))
 }
 
 func (svc *dropboxService) createDropboxShareLink(path string) (string, error) {
@@ -92,7 +304,7 @@ func (svc *dropboxService) createDropboxShareLink(path string) (string, error) {
 	req.Header.Set("Authorization", "Bearer "+svc.CfgSvc.GetDropboxAccessToken())
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := http.DefaultClient.Do(req)
+	resp, err := svc.Client.Do(req)
 	if err != nil {
 		return "", err
 	}
@@ -0,0 +1,165 @@
+package storage
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// dropboxServer records the calls and the uploaded bytes of a Dropbox fake
+type dropboxServer struct {
+	mutex   sync.Mutex
+	calls   []string
+	args    []string
+	content bytes.Buffer
+	badHash bool
+}
+
+func (s *dropboxServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.calls = append(s.calls, strings.TrimPrefix(r.URL.Path, "/2/"))
+	s.args = append(s.args, r.Header.Get("Dropbox-API-Arg"))
+	b, _ := io.ReadAll(r.Body)
+	s.content.Write(b)
+
+	switch r.URL.Path {
+	case "/2/files/upload_session/start":
+		_, _ = w.Write([]byte(`{"session_id": "s1"}`))
+	case "/2/files/upload_session/append_v2":
+		_, _ = w.Write([]byte(`null`))
+	case "/2/files/get_temporary_link":
+		var arg struct {
+			Path string `json:"path"`
+		}
+		_ = json.Unmarshal(b, &arg)
+		if arg.Path != "/tr/properties#a1.pdf" {
+			w.WriteHeader(409)
+			_, _ = w.Write([]byte(`{"error_summary": "path/not_found/"}`))
+			return
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"link": "https://dl.dropboxusercontent.com/apitl/1/a1"})
+	default:
+		// The content hash of a body under one block is the hash of its hash
+		block := sha256.Sum256(s.content.Bytes())
+		sum := sha256.Sum256(block[:])
+		contentHash := hex.EncodeToString(sum[:])
+		if s.badHash {
+			contentHash = "bad"
+		}
+		_ = json.NewEncoder(w).Encode(map[string]string{"content_hash": contentHash})
+	}
+}
+
+func TestDropboxUpload(t *testing.T) {
+	tests := []struct {
+		name      string
+		content   string
+		badHash   bool
+		wantCalls []string
+		wantErr   bool
+	}{
+		{
+			name:      "single request",
+			content:   "dee",
+			wantCalls: []string{"files/upload"},
+		},
+		{
+			name:      "upload session",
+			content:   "deed of lot 7",
+			wantCalls: []string{"files/upload_session/start", "files/upload_session/append_v2", "files/upload_session/append_v2", "files/upload_session/finish"},
+		},
+		{
+			name:      "exact parts",
+			content:   "deedlot7",
+			wantCalls: []string{"files/upload_session/start", "files/upload_session/append_v2", "files/upload_session/finish"},
+		},
+		{
+			name:      "content hash mismatch",
+			content:   "deed",
+			badHash:   true,
+			wantCalls: []string{"files/upload_session/start", "files/upload_session/finish"},
+			wantErr:   true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &dropboxServer{badHash: tt.badHash}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			svc := &dropboxService{
+				CfgSvc:     testConfig{partSize: 4},
+				Client:     ts.Client(),
+				ContentURL: ts.URL + "/2/",
+			}
+
+			path, err := svc.Upload(strings.NewReader(tt.content), int64(len(tt.content)), "properties", "a1-سوق.pdf")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if strings.Join(server.calls, ",") != strings.Join(tt.wantCalls, ",") {
+				t.Fatalf("calls = %v, want %v", server.calls, tt.wantCalls)
+			}
+
+			if server.content.String() != tt.content {
+				t.Fatalf("uploaded %q, want %q", server.content.String(), tt.content)
+			}
+
+			if tt.wantErr {
+				return
+			}
+
+			if path != "tr/properties#a1-سوق.pdf" {
+				t.Errorf("path = %s", path)
+			}
+
+			// Headers must be ASCII but still decode to the Arabic name
+			last := server.args[len(server.args)-1]
+			var arg struct {
+				Path   string `json:"path"`
+				Commit struct {
+					Path string `json:"path"`
+				} `json:"commit"`
+			}
+			if err := json.Unmarshal([]byte(last), &arg); err != nil || strings.ContainsFunc(last, func(r rune) bool { return r > 127 }) {
+				t.Fatalf("unexpected argument %s: %v", last, err)
+			}
+			if arg.Path != "/"+path && arg.Commit.Path != "/"+path {
+				t.Errorf("argument %s does not carry the path", last)
+			}
+		})
+	}
+}
+
+func TestDropboxSignedURL(t *testing.T) {
+	ts := httptest.NewServer(&dropboxServer{})
+	defer ts.Close()
+
+	svc := &dropboxService{
+		CfgSvc: testConfig{},
+		Client: ts.Client(),
+		APIURL: ts.URL + "/2/",
+	}
+
+	// The key maps to the path the file was uploaded to
+	link, err := svc.SignedURL("properties/a1.pdf", time.Minute)
+	if err != nil || link != "https://dl.dropboxusercontent.com/apitl/1/a1" {
+		t.Fatalf("unexpected link %s: %v", link, err)
+	}
+
+	if _, err := svc.SignedURL("properties/a2.pdf", time.Minute); err == nil || !strings.Contains(err.Error(), "not_found") {
+		t.Fatalf("expected a missing file to fail, got %v", err)
+	}
+}
@@ -0,0 +1,182 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+	"github.com/khaledhikmat/tr-extractor/service/lgr"
+)
+
+// FilesRoute is where the server serves the files of the filesystem backend
+const FilesRoute = "/files"
+
+type filesystemService struct {
+	CfgSvc config.IService
+	// Root is the absolute directory the files are written under
+	Root string
+	// Secret signs the URLs of the files
+	Secret []byte
+}
+
+// NewFilesystem creates the root directory and a backend that writes under
+// it. It needs no credentials so it suits offline development and tests.
+func NewFilesystem(cfgsvc config.IService) (IService, error) {
+	root, err := filepath.Abs(cfgsvc.GetStorageRoot())
+	if err != nil {
+		return nil, err
+	}
+
+	err = os.MkdirAll(root, 0o755)
+	if err != nil {
+		return nil, err
+	}
+
+	// A per-process secret would fail URLs signed on another replica or
+	// before a restart
+	secret := []byte(cfgsvc.GetStorageSigningSecret())
+	if len(secret) == 0 {
+		return nil, errors.New("the filesystem backend needs STORAGE_SIGNING_SECRET")
+	}
+
+	return &filesystemService{
+		CfgSvc: cfgsvc,
+		Root:   root,
+		Secret: secret,
+	}, nil
+}
+
+func (svc *filesystemService) Upload(body io.Reader, size int64, folder, identifier string) (string, error) {
+	key := path.Join(folder, identifier)
+	lgr.Logger.Info("Filesystem.Upload",
+		slog.Int64("size", size),
+		slog.String("root", svc.Root),
+		slog.String("key", key),
+	)
+
+	filePath, err := svc.filePath(key)
+	if err != nil {
+		return "", err
+	}
+
+	err = os.MkdirAll(filepath.Dir(filePath), 0o755)
+	if err != nil {
+		return "", err
+	}
+
+	// Write next to the file and rename so a failed upload leaves no partial file
+	out, err := os.CreateTemp(filepath.Dir(filePath), "."+filepath.Base(filePath)+".*")
+	if err != nil {
+		return "", err
+	}
+	defer os.Remove(out.Name())
+
+	written, err := io.Copy(out, body)
+	if err == nil && size >= 0 && written != size {
+		err = fmt.Errorf("wrote %d bytes, expected %d", written, size)
+	}
+	if closeErr := out.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return "", err
+	}
+
+	// WARNING: if the file already exists, it will be overwritten
+	err = os.Rename(out.Name(), filePath)
+	if err != nil {
+		return "", err
+	}
+
+	return svc.url(key, filePath), nil
+}
+
+// SignedURL returns the URL the server serves the file from with an expiry
+// and a signature so it can be downloaded without an API key. Without a base
+// URL, it is the `file://` URL.
+func (svc *filesystemService) SignedURL(key string, ttl time.Duration) (string, error) {
+	filePath, err := svc.filePath(key)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = os.Stat(filePath)
+	if err != nil {
+		return "", err
+	}
+
+	if svc.CfgSvc.GetStorageBaseURL() == "" {
+		return svc.url(key, filePath), nil
+	}
+
+	expires := strconv.FormatInt(time.Now().Add(ttl).Unix(), 10)
+	query := url.Values{
+		"expires":   {expires},
+		"signature": {svc.sign(key, expires)},
+	}
+
+	return svc.url(key, filePath) + "?" + query.Encode(), nil
+}
+
+// Verify checks that the query of a signed URL was signed for the key and
+// has not expired
+func (svc *filesystemService) Verify(key string, query url.Values) error {
+	expires := query.Get("expires")
+	unix, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid expiry %s", expires)
+	}
+
+	if time.Now().Unix() > unix {
+		return errors.New("signed URL expired")
+	}
+
+	signature, err := hex.DecodeString(query.Get("signature"))
+	if err != nil || !hmac.Equal(signature, svc.mac(key, expires)) {
+		return errors.New("invalid signature")
+	}
+
+	return nil
+}
+
+func (svc *filesystemService) sign(key, expires string) string {
+	return hex.EncodeToString(svc.mac(key, expires))
+}
+
+func (svc *filesystemService) mac(key, expires string) []byte {
+	mac := hmac.New(sha256.New, svc.Secret)
+	mac.Write([]byte(strings.TrimPrefix(key, "/") + "\n" + expires))
+	return mac.Sum(nil)
+}
+
+// filePath is where the file of a key is written
+func (svc *filesystemService) filePath(key string) (string, error) {
+	// Keys come from Trello names so they must not escape the root
+	if !filepath.IsLocal(filepath.FromSlash(key)) {
+		return "", fmt.Errorf("invalid storage key %s", key)
+	}
+
+	return filepath.Join(svc.Root, filepath.FromSlash(key)), nil
+}
+
+// url returns the URL the server serves the file from or a `file://` URL if
+// there is no base URL
+func (svc *filesystemService) url(key, filePath string) string {
+	if baseURL := svc.CfgSvc.GetStorageBaseURL(); baseURL != "" {
+		return baseURL + FilesRoute + "/" + (&url.URL{Path: key}).EscapedPath()
+	}
+
+	return (&url.URL{Scheme: "file", Path: filepath.ToSlash(filePath)}).String()
+}
@@ -0,0 +1,172 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestFilesystemUpload(t *testing.T) {
+	root := t.TempDir()
+
+	tests := []struct {
+		name       string
+		baseURL    string
+		folder     string
+		identifier string
+		body       io.Reader
+		size       int64
+		wantURL    string
+		wantErr    bool
+	}{
+		{
+			name:       "file URL",
+			folder:     "properties",
+			identifier: "a1-old_town_lot_7.pdf",
+			body:       strings.NewReader("deed"),
+			size:       4,
+			wantURL:    "file://" + filepath.ToSlash(root) + "/properties/a1-old_town_lot_7.pdf",
+		},
+		{
+			name:       "served URL",
+			baseURL:    "https://tr.example.com",
+			folder:     "supportivedocs",
+			identifier: "a2-court letter.pdf",
+			body:       strings.NewReader("letter"),
+			size:       -1,
+			wantURL:    "https://tr.example.com/files/supportivedocs/a2-court%20letter.pdf",
+		},
+		{
+			name:       "key outside the root",
+			folder:     "..",
+			identifier: "a3.pdf",
+			body:       strings.NewReader("deed"),
+			size:       4,
+			wantErr:    true,
+		},
+		{
+			name:       "short body",
+			folder:     "properties",
+			identifier: "a4.pdf",
+			body:       strings.NewReader("dee"),
+			size:       4,
+			wantErr:    true,
+		},
+		{
+			name:       "broken body",
+			folder:     "properties",
+			identifier: "a5.pdf",
+			body:       io.MultiReader(strings.NewReader("de"), errReader{}),
+			size:       -1,
+			wantErr:    true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			svc, err := NewFilesystem(testConfig{root: root, baseURL: tt.baseURL, secret: "secret"})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			url, err := svc.Upload(tt.body, tt.size, tt.folder, tt.identifier)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if url != tt.wantURL {
+				t.Errorf("url = %s, want %s", url, tt.wantURL)
+			}
+		})
+	}
+
+	content, err := os.ReadFile(filepath.Join(root, "properties", "a1-old_town_lot_7.pdf"))
+	if err != nil || string(content) != "deed" {
+		t.Fatalf("unexpected content %q: %v", content, err)
+	}
+
+	// Failed uploads leave nothing behind
+	entries, _ := os.ReadDir(filepath.Join(root, "properties"))
+	if len(entries) != 1 {
+		t.Errorf("expected only the uploaded file, got %d entries", len(entries))
+	}
+	if _, err := os.Stat(filepath.Join(filepath.Dir(root), "a3.pdf")); err == nil {
+		t.Error("expected nothing to be written outside the root")
+	}
+}
+
+func TestFilesystemSignedURL(t *testing.T) {
+	root := t.TempDir()
+	svc, err := NewFilesystem(testConfig{root: root, baseURL: "https://tr.example.com", secret: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := svc.Upload(strings.NewReader("deed"), 4, "properties", "a1 lot.pdf"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := svc.SignedURL("properties/a1 lot.pdf", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil || u.Host != "tr.example.com" || u.Path != "/files/properties/a1 lot.pdf" {
+		t.Fatalf("unexpected signed URL %s: %v", signed, err)
+	}
+
+	// The server passes the key of the route with a leading slash
+	verifier := svc.(Verifier)
+	valid := u.Query()
+	if err := verifier.Verify("/properties/a1 lot.pdf", valid); err != nil {
+		t.Fatalf("expected the signature to verify: %v", err)
+	}
+
+	if err := verifier.Verify("/properties/a2.pdf", valid); err == nil {
+		t.Error("expected the signature of another file to fail")
+	}
+
+	tampered := u.Query()
+	tampered.Set("expires", strconv.FormatInt(time.Now().Add(time.Hour).Unix(), 10))
+	if err := verifier.Verify("/properties/a1 lot.pdf", tampered); err == nil {
+		t.Error("expected an extended expiry to fail")
+	}
+
+	expired, _ := svc.SignedURL("properties/a1 lot.pdf", -time.Minute)
+	u, _ = url.Parse(expired)
+	if err := verifier.Verify("/properties/a1 lot.pdf", u.Query()); err == nil {
+		t.Error("expected an expired URL to fail")
+	}
+
+	if _, err := svc.SignedURL("properties/a2.pdf", time.Minute); err == nil {
+		t.Error("expected a missing file to fail")
+	}
+
+	// Another replica with the same secret verifies the URL
+	replica, _ := NewFilesystem(testConfig{root: root, baseURL: "https://tr.example.com", secret: "secret"})
+	if err := replica.(Verifier).Verify("/properties/a1 lot.pdf", valid); err != nil {
+		t.Errorf("expected another replica to verify the URL: %v", err)
+	}
+
+	other, _ := NewFilesystem(testConfig{root: root, baseURL: "https://tr.example.com", secret: "other"})
+	if err := other.(Verifier).Verify("/properties/a1 lot.pdf", valid); err == nil {
+		t.Error("expected another secret to fail")
+	}
+
+	if _, err := NewFilesystem(testConfig{root: root}); err == nil {
+		t.Error("expected the backend to need a secret")
+	}
+}
+
+type errReader struct{}
+
+func (errReader) Read([]byte) (int, error) {
+	return 0, errors.New("connection reset")
+}
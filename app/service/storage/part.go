@@ -0,0 +1,21 @@
+package storage
+
+import (
+	"errors"
+	"io"
+)
+
+// readPart fills the buffer from the body. It returns the bytes read and
+// whether the body is exhausted, so a body that fits in one part can be
+// uploaded in a single request.
+func readPart(body io.Reader, buf []byte) ([]byte, bool, error) {
+	n, err := io.ReadFull(body, buf)
+	if errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) {
+		return buf[:n], true, nil
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return buf[:n], false, nil
+}
@@ -1,14 +1,21 @@
 package storage
 
 import (
+	"bytes"
 	"context"
 	"fmt"
+	"io"
 	"log/slog"
-	"os"
+	"net/url"
+	"path"
+	"time"
 
+	"github.com/aws/aws-sdk-go-v2/aws"
+	awshttp "github.com/aws/aws-sdk-go-v2/aws/transport/http"
 	awsconfig "github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
 	"github.com/aws/aws-sdk-go-v2/service/s3"
-	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
 	"github.com/khaledhikmat/tr-extractor/service/config"
 	"github.com/khaledhikmat/tr-extractor/service/lgr"
 )
@@ -19,64 +26,205 @@ type s3Service struct {
 	Client    *s3.Client
 }
 
-func NewS3(ctx context.Context, cfgsvc config.IService) IService {
+func NewS3(ctx context.Context, cfgsvc config.IService) (IService, error) {
 	s := &s3Service{
 		ConfigSvc: cfgsvc,
 		Ctx:       ctx,
 	}
 	err := s.makeS3Client(ctx)
 	if err != nil {
-		panic(err)
+		return nil, err
 	}
 
-	return s
+	return s, nil
 }
 
-func (svc *s3Service) Upload(filePath, folder, identifier string) (string, error) {
+func (svc *s3Service) Upload(body io.Reader, size int64, folder, identifier string) (string, error) {
 	bucketName := svc.ConfigSvc.GetStorageBucket()
 	keyName := fmt.Sprintf("%s/%s", folder, identifier)
 	lgr.Logger.Info("S3.Upload",
-		slog.String("filePath", filePath),
+		slog.Int64("size", size),
 		slog.String("folder", folder),
 		slog.String("identifier", identifier),
 		slog.String("bucket", bucketName),
 		slog.String("key", keyName),
 	)
 
-	file, err := os.Open(filePath)
+	buf := make([]byte, svc.ConfigSvc.GetUploadPartSize())
+	part, last, err := readPart(body, buf)
 	if err != nil {
 		return "", err
 	}
-	defer file.Close()
-
-	defer func() {
-		// Delete the local file
-		_ = os.Remove(filePath)
-	}()
 
 	// WARNING: if the file already exists in S3, it will be overwritten
-	_, err = svc.Client.PutObject(svc.Ctx, &s3.PutObjectInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(keyName),
-		Body:   file,
-	})
+	if last {
+		// A file that fits in one part goes in a single request
+		_, err = svc.Client.PutObject(svc.Ctx, &s3.PutObjectInput{
+			Bucket:               aws.String(bucketName),
+			Key:                  aws.String(keyName),
+			Body:                 bytes.NewReader(part),
+			ChecksumAlgorithm:    types.ChecksumAlgorithmSha256,
+			StorageClass:         types.StorageClass(svc.ConfigSvc.GetStorageClass()),
+			ServerSideEncryption: types.ServerSideEncryption(svc.ConfigSvc.GetStorageSSE()),
+			SSEKMSKeyId:          svc.kmsKeyID(),
+		})
+	} else {
+		err = svc.uploadMultipart(bucketName, keyName, body, buf, part)
+	}
 	if err != nil {
 		return "", err
 	}
 
-	// URL must be generated from the bucket name and the folder
-	return fmt.Sprintf("https://%s.s3.%s.amazonaws.com/%s", bucketName, svc.ConfigSvc.GetStorageRegion(), keyName), nil
+	return objectURL(svc.ConfigSvc.GetStorageEndpoint(), svc.ConfigSvc.GetStorageRegion(), bucketName, keyName, svc.ConfigSvc.IsStoragePathStyle()), nil
+}
+
+// SignedURL presigns a GET of the object so a private bucket can be
+// downloaded from without credentials
+func (svc *s3Service) SignedURL(key string, ttl time.Duration) (string, error) {
+	req, err := s3.NewPresignClient(svc.Client).PresignGetObject(svc.Ctx, &s3.GetObjectInput{
+		Bucket: aws.String(svc.ConfigSvc.GetStorageBucket()),
+		Key:    aws.String(key),
+	}, s3.WithPresignExpires(ttl))
+	if err != nil {
+		return "", err
+	}
+
+	return req.URL, nil
+}
+
+// objectURL builds the URL of an object from the endpoint, or from the AWS
+// region if there is none, the same way the client addresses it
+func objectURL(endpoint, region, bucketName, keyName string, pathStyle bool) string {
+	if endpoint == "" {
+		endpoint = fmt.Sprintf("https://s3.%s.amazonaws.com", region)
+	}
+
+	u, err := url.Parse(endpoint)
+	if err != nil {
+		return fmt.Sprintf("%s/%s/%s", endpoint, bucketName, keyName)
+	}
+
+	if pathStyle {
+		u.Path = path.Join("/", u.Path, bucketName, keyName)
+	} else {
+		u.Host = bucketName + "." + u.Host
+		u.Path = path.Join("/", u.Path, keyName)
+	}
+
+	return u.String()
+}
+
+func (svc *s3Service) kmsKeyID() *string {
+	if svc.ConfigSvc.GetStorageSSEKMSKeyID() == "" {
+		return nil
+	}
+
+	return aws.String(svc.ConfigSvc.GetStorageSSEKMSKeyID())
+}
+
+// uploadMultipart uploads the body one part at a time, starting with the
+// part already read. S3 verifies the SHA-256 checksum of every part. The
+// upload is aborted on failure so no orphaned parts are billed.
+func (svc *s3Service) uploadMultipart(bucketName, keyName string, body io.Reader, buf, part []byte) error {
+	created, err := svc.Client.CreateMultipartUpload(svc.Ctx, &s3.CreateMultipartUploadInput{
+		Bucket:               aws.String(bucketName),
+		Key:                  aws.String(keyName),
+		ChecksumAlgorithm:    types.ChecksumAlgorithmSha256,
+		StorageClass:         types.StorageClass(svc.ConfigSvc.GetStorageClass()),
+		ServerSideEncryption: types.ServerSideEncryption(svc.ConfigSvc.GetStorageSSE()),
+		SSEKMSKeyId:          svc.kmsKeyID(),
+	})
+	if err != nil {
+		return err
+	}
+
+	completed := []types.CompletedPart{}
+	for last := false; !last || len(part) > 0; {
+		if len(part) > 0 {
+			number := aws.Int32(int32(len(completed) + 1))
+			uploaded, err := svc.Client.UploadPart(svc.Ctx, &s3.UploadPartInput{
+				Bucket:            aws.String(bucketName),
+				Key:               aws.String(keyName),
+				UploadId:          created.UploadId,
+				PartNumber:        number,
+				Body:              bytes.NewReader(part),
+				ChecksumAlgorithm: types.ChecksumAlgorithmSha256,
+			})
+			if err != nil {
+				return svc.abortMultipart(bucketName, keyName, created.UploadId, err)
+			}
+
+			completed = append(completed, types.CompletedPart{
+				ETag:           uploaded.ETag,
+				ChecksumSHA256: uploaded.ChecksumSHA256,
+				PartNumber:     number,
+			})
+		}
+		if last {
+			break
+		}
+
+		part, last, err = readPart(body, buf)
+		if err != nil {
+			return svc.abortMultipart(bucketName, keyName, created.UploadId, err)
+		}
+	}
+
+	_, err = svc.Client.CompleteMultipartUpload(svc.Ctx, &s3.CompleteMultipartUploadInput{
+		Bucket:          aws.String(bucketName),
+		Key:             aws.String(keyName),
+		UploadId:        created.UploadId,
+		MultipartUpload: &types.CompletedMultipartUpload{Parts: completed},
+	})
+	if err != nil {
+		return svc.abortMultipart(bucketName, keyName, created.UploadId, err)
+	}
+
+	return nil
+}
+
+func (svc *s3Service) abortMultipart(bucketName, keyName string, uploadID *string, cause error) error {
+	_, err := svc.Client.AbortMultipartUpload(svc.Ctx, &s3.AbortMultipartUploadInput{
+		Bucket:   aws.String(bucketName),
+		Key:      aws.String(keyName),
+		UploadId: uploadID,
+	})
+	if err != nil {
+		lgr.Logger.Error("S3.abortMultipart",
+			slog.String("key", keyName),
+			slog.Any("error", err),
+		)
+	}
+
+	return cause
 }
 
 func (svc *s3Service) makeS3Client(ctx context.Context) error {
-	cfg, err := awsconfig.LoadDefaultConfig(ctx,
+	options := []func(*awsconfig.LoadOptions) error{
 		awsconfig.WithRegion(svc.ConfigSvc.GetStorageRegion()),
-	)
+		// Bound every request so a hung upload cannot stall a job
+		awsconfig.WithHTTPClient(awshttp.NewBuildableClient().WithTimeout(svc.ConfigSvc.GetHTTPTimeout())),
+	}
 
+	// Providers other than AWS usually come with a key pair
+	if svc.ConfigSvc.GetStorageAccessKeyID() != "" {
+		options = append(options, awsconfig.WithCredentialsProvider(credentials.NewStaticCredentialsProvider(
+			svc.ConfigSvc.GetStorageAccessKeyID(),
+			svc.ConfigSvc.GetStorageSecretAccessKey(),
+			"",
+		)))
+	}
+
+	cfg, err := awsconfig.LoadDefaultConfig(ctx, options...)
 	if err != nil {
 		return err
 	}
 
-	svc.Client = s3.NewFromConfig(cfg)
+	svc.Client = s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if svc.ConfigSvc.GetStorageEndpoint() != "" {
+			o.BaseEndpoint = aws.String(svc.ConfigSvc.GetStorageEndpoint())
+		}
+		o.UsePathStyle = svc.ConfigSvc.IsStoragePathStyle()
+	})
 	return nil
 }
@@ -0,0 +1,226 @@
+package storage
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+)
+
+func TestObjectURL(t *testing.T) {
+	tests := []struct {
+		name      string
+		endpoint  string
+		pathStyle bool
+		want      string
+	}{
+		{name: "aws", want: "https://deeds.s3.me-south-1.amazonaws.com/properties/a1-old%20town.pdf"},
+		{name: "aws path style", pathStyle: true, want: "https://s3.me-south-1.amazonaws.com/deeds/properties/a1-old%20town.pdf"},
+		{name: "minio", endpoint: "http://localhost:9000", pathStyle: true, want: "http://localhost:9000/deeds/properties/a1-old%20town.pdf"},
+		{name: "r2", endpoint: "https://acct.r2.cloudflarestorage.com", want: "https://deeds.acct.r2.cloudflarestorage.com/properties/a1-old%20town.pdf"},
+		{name: "endpoint with a path", endpoint: "https://gateway.example.com/s3", pathStyle: true, want: "https://gateway.example.com/s3/deeds/properties/a1-old%20town.pdf"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := objectURL(tt.endpoint, "me-south-1", "deeds", "properties/a1-old town.pdf", tt.pathStyle)
+			if got != tt.want {
+				t.Errorf("url = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+// s3Server is an S3-compatible fake that keeps the objects and the headers
+// of the requests it received
+type s3Server struct {
+	mutex    sync.Mutex
+	requests []string
+	headers  []http.Header
+	objects  map[string][]byte
+	parts    map[string][][]byte
+	aborted  bool
+	failPart bool
+}
+
+func (s *s3Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	query := r.URL.Query()
+	s.headers = append(s.headers, r.Header.Clone())
+
+	switch {
+	case r.Method == "PUT" && query.Has("partNumber"):
+		s.requests = append(s.requests, "UploadPart")
+		if s.failPart {
+			w.WriteHeader(500)
+			return
+		}
+		s.parts[r.URL.Path] = append(s.parts[r.URL.Path], decodeChunks(r, body))
+		w.Header().Set("ETag", fmt.Sprintf(`"%s"`, query.Get("partNumber")))
+	case r.Method == "PUT":
+		s.requests = append(s.requests, "PutObject")
+		s.objects[r.URL.Path] = decodeChunks(r, body)
+		w.Header().Set("ETag", `"1"`)
+	case r.Method == "POST" && query.Has("uploads"):
+		s.requests = append(s.requests, "CreateMultipartUpload")
+		fmt.Fprint(w, `<InitiateMultipartUploadResult><Bucket>deeds</Bucket><UploadId>u1</UploadId></InitiateMultipartUploadResult>`)
+	case r.Method == "POST" && query.Has("uploadId"):
+		s.requests = append(s.requests, "CompleteMultipartUpload")
+		s.objects[r.URL.Path] = bytes.Join(s.parts[r.URL.Path], nil)
+		fmt.Fprint(w, `<CompleteMultipartUploadResult><Bucket>deeds</Bucket><ETag>"3"</ETag></CompleteMultipartUploadResult>`)
+	case r.Method == "DELETE":
+		s.requests = append(s.requests, "AbortMultipartUpload")
+		s.aborted = true
+		w.WriteHeader(204)
+	}
+}
+
+// decodeChunks strips the aws-chunked encoding the SDK uses to send
+// checksums as trailers
+func decodeChunks(r *http.Request, body []byte) []byte {
+	if !strings.Contains(r.Header.Get("Content-Encoding"), "aws-chunked") {
+		return body
+	}
+
+	var content []byte
+	for {
+		line, rest, _ := bytes.Cut(body, []byte("\r\n"))
+		var n int
+		fmt.Sscanf(string(line), "%x", &n)
+		if n == 0 {
+			return content
+		}
+		content = append(content, rest[:n]...)
+		body = rest[n+2:]
+	}
+}
+
+func TestS3Upload(t *testing.T) {
+	tests := []struct {
+		name         string
+		content      string
+		failPart     bool
+		wantRequests string
+		wantErr      bool
+	}{
+		{
+			name:         "single request",
+			content:      "dee",
+			wantRequests: "PutObject",
+		},
+		{
+			name:         "multipart upload",
+			content:      "deed of lot 7",
+			wantRequests: "CreateMultipartUpload,UploadPart,UploadPart,UploadPart,UploadPart,CompleteMultipartUpload",
+		},
+		{
+			name:         "aborts a failed upload",
+			content:      "deed of lot 7",
+			failPart:     true,
+			wantRequests: "CreateMultipartUpload,UploadPart,AbortMultipartUpload",
+			wantErr:      true,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			server := &s3Server{objects: map[string][]byte{}, parts: map[string][][]byte{}, failPart: tt.failPart}
+			ts := httptest.NewServer(server)
+			defer ts.Close()
+
+			cfg := testConfig{
+				bucket:       "deeds",
+				endpoint:     ts.URL,
+				pathStyle:    true,
+				storageClass: "STANDARD_IA",
+				sse:          "AES256",
+				partSize:     4,
+			}
+			svc, err := NewS3(context.Background(), cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			// Retries would hide the failed part
+			svc.(*s3Service).Client = newS3ClientWithoutRetries(t, svc.(*s3Service))
+
+			url, err := svc.Upload(strings.NewReader(tt.content), int64(len(tt.content)), "properties", "a1.pdf")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("unexpected error %v", err)
+			}
+
+			if requests := strings.Join(server.requests, ","); requests != tt.wantRequests {
+				t.Fatalf("requests = %s, want %s", requests, tt.wantRequests)
+			}
+
+			// Every request is signed with the static credentials
+			for _, header := range server.headers {
+				if !strings.Contains(header.Get("Authorization"), "Credential=minio/") {
+					t.Fatalf("unexpected authorization %s", header.Get("Authorization"))
+				}
+			}
+
+			if tt.wantErr {
+				if !server.aborted {
+					t.Error("expected the multipart upload to be aborted")
+				}
+				return
+			}
+
+			if url != ts.URL+"/deeds/properties/a1.pdf" {
+				t.Errorf("url = %s", url)
+			}
+
+			if content := string(server.objects["/deeds/properties/a1.pdf"]); content != tt.content {
+				t.Errorf("stored %q, want %q", content, tt.content)
+			}
+
+			// The object settings go with the request that creates the object
+			first := server.headers[0]
+			if first.Get("X-Amz-Storage-Class") != "STANDARD_IA" || first.Get("X-Amz-Server-Side-Encryption") != "AES256" {
+				t.Errorf("unexpected object headers %v", first)
+			}
+		})
+	}
+}
+
+func TestS3SignedURL(t *testing.T) {
+	svc, err := NewS3(context.Background(), testConfig{bucket: "deeds", endpoint: "http://localhost:9000", pathStyle: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := svc.SignedURL("properties/a1-old town.pdf", 5*time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	u, err := url.Parse(signed)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	query := u.Query()
+	if u.Host != "localhost:9000" || u.Path != "/deeds/properties/a1-old town.pdf" || query.Get("X-Amz-Expires") != "300" || query.Get("X-Amz-Signature") == "" || !strings.HasPrefix(query.Get("X-Amz-Credential"), "minio/") {
+		t.Fatalf("unexpected signed URL %s", signed)
+	}
+}
+
+func newS3ClientWithoutRetries(t *testing.T, svc *s3Service) *s3.Client {
+	t.Helper()
+	return s3.New(svc.Client.Options(), func(o *s3.Options) {
+		o.Retryer = aws.NopRetryer{}
+	})
+}
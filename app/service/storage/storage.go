@@ -0,0 +1,22 @@
+package storage
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+)
+
+// New creates the backend selected by `STORAGE_BACKEND`
+func New(ctx context.Context, cfgsvc config.IService) (IService, error) {
+	switch cfgsvc.GetStorageBackend() {
+	case "s3":
+		return NewS3(ctx, cfgsvc)
+	case "dropbox":
+		return NewDropbox(cfgsvc), nil
+	case "filesystem":
+		return NewFilesystem(cfgsvc)
+	}
+
+	return nil, fmt.Errorf("unknown storage backend %s", cfgsvc.GetStorageBackend())
+}
@@ -0,0 +1,60 @@
+package storage
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/khaledhikmat/tr-extractor/service/config"
+)
+
+// testConfig overrides the settings the storage backends read
+type testConfig struct {
+	config.IService
+	backend  string
+	root     string
+	baseURL  string
+	secret   string
+	partSize int64
+	// S3
+	bucket       string
+	endpoint     string
+	pathStyle    bool
+	storageClass string
+	sse          string
+}
+
+func (c testConfig) GetStorageBackend() string     { return c.backend }
+func (c testConfig) GetStorageRoot() string        { return c.root }
+func (c testConfig) GetStorageBaseURL() string     { return c.baseURL }
+func (c testConfig) GetUploadPartSize() int64      { return c.partSize }
+func (c testConfig) GetDropboxUploadPath() string  { return "tr/" }
+func (c testConfig) GetDropboxAccessToken() string { return "token" }
+func (c testConfig) GetHTTPTimeout() time.Duration { return 5 * time.Second }
+
+func TestNew(t *testing.T) {
+	svc, err := New(context.Background(), testConfig{backend: "filesystem", root: t.TempDir(), secret: "secret"})
+	if _, ok := svc.(*filesystemService); !ok || err != nil {
+		t.Fatalf("expected the filesystem backend, got %T: %v", svc, err)
+	}
+
+	svc, err = New(context.Background(), testConfig{backend: "dropbox"})
+	if _, ok := svc.(*dropboxService); !ok || err != nil {
+		t.Fatalf("expected the Dropbox backend, got %T: %v", svc, err)
+	}
+
+	if _, err = New(context.Background(), testConfig{backend: "gcs"}); err == nil {
+		t.Fatal("expected an unknown backend to fail")
+	}
+}
+
+func (c testConfig) GetStorageBucket() string          { return c.bucket }
+func (c testConfig) GetStorageRegion() string          { return "us-east-1" }
+func (c testConfig) GetStorageEndpoint() string        { return c.endpoint }
+func (c testConfig) IsStoragePathStyle() bool          { return c.pathStyle }
+func (c testConfig) GetStorageAccessKeyID() string     { return "minio" }
+func (c testConfig) GetStorageSecretAccessKey() string { return "minio123" }
+func (c testConfig) GetStorageClass() string           { return c.storageClass }
+func (c testConfig) GetStorageSSE() string             { return c.sse }
+func (c testConfig) GetStorageSSEKMSKeyID() string     { return "" }
+func (c testConfig) GetStorageSigningSecret() string   { return c.secret }
@@ -1,5 +1,22 @@
 package storage
 
+import (
+	"io"
+	"net/url"
+	"time"
+)
+
 type IService interface {
-	Upload(filePath, folder, indentifier string) (string, error)
+	// Upload streams the body to storage under `folder/identifier`. The size
+	// is -1 when it is not known up front.
+	Upload(body io.Reader, size int64, folder, indentifier string) (string, error)
+	// SignedURL returns a URL that downloads the object with the given key
+	// without credentials until the ttl runs out.
+	SignedURL(key string, ttl time.Duration) (string, error)
+}
+
+// Verifier is implemented by the backends whose files this server serves.
+// It checks the signature of a URL returned by SignedURL.
+type Verifier interface {
+	Verify(key string, query url.Values) error
 }
@@ -0,0 +1,142 @@
+package trello
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// CardFilter narrows a board sync to some of its cards. Every set criterion
+// must match. A zero filter selects the whole board.
+type CardFilter struct {
+	// Cards are card IDs or short links
+	Cards []string
+	// Label is a label name or ID
+	Label string
+	// List is a list name or ID
+	List string
+}
+
+// IsZero tells whether the filter selects the whole board
+func (f CardFilter) IsZero() bool {
+	return len(f.Cards) == 0 && f.Label == "" && f.List == ""
+}
+
+// cardRef is what a filter matches a card on
+type cardRef struct {
+	ID        string
+	ShortLink string
+	IDList    string
+	Labels    []TRLabel
+}
+
+type boardCard interface {
+	ref() cardRef
+}
+
+func (c TRProperty) ref() cardRef {
+	return cardRef{ID: c.ID, ShortLink: c.ShortLink, IDList: c.IDList, Labels: c.Labels}
+}
+
+func (c TRInheritanceConfinement) ref() cardRef {
+	return cardRef{ID: c.ID, ShortLink: c.ShortLink, IDList: c.IDList, Labels: c.Labels}
+}
+
+func (c TRSupportiveDoc) ref() cardRef {
+	return cardRef{ID: c.ID, ShortLink: c.ShortLink, IDList: c.IDList, Labels: c.Labels}
+}
+
+// FilterCards returns the cards of a board that match the filter. The list
+// criterion is resolved against the lists of the board. It fails when a
+// requested card or list is not on the board so a typo does not look like
+// a sync of nothing.
+func FilterCards[T boardCard](cards []T, filter CardFilter, lists []TRList) ([]T, error) {
+	if filter.IsZero() {
+		return cards, nil
+	}
+
+	listID := ""
+	if filter.List != "" {
+		for _, list := range lists {
+			if list.ID == filter.List || strings.EqualFold(list.Name, filter.List) {
+				listID = list.ID
+				break
+			}
+		}
+		if listID == "" {
+			return nil, fmt.Errorf("list %s is not on the board", filter.List)
+		}
+	}
+
+	found := map[string]bool{}
+	results := []T{}
+	for _, card := range cards {
+		ref := card.ref()
+		if len(filter.Cards) > 0 {
+			requested := ""
+			for _, c := range filter.Cards {
+				if c == ref.ID || c == ref.ShortLink {
+					requested = c
+					break
+				}
+			}
+			if requested == "" {
+				continue
+			}
+			found[requested] = true
+		}
+
+		if listID != "" && ref.IDList != listID {
+			continue
+		}
+
+		if filter.Label != "" && !hasLabel(ref.Labels, filter.Label) {
+			continue
+		}
+
+		results = append(results, card)
+	}
+
+	missing := []string{}
+	for _, c := range filter.Cards {
+		if !found[c] {
+			missing = append(missing, c)
+		}
+	}
+	if len(missing) > 0 {
+		return nil, fmt.Errorf("cards %s are not on the board", strings.Join(missing, ", "))
+	}
+
+	return results, nil
+}
+
+func hasLabel(labels []TRLabel, label string) bool {
+	for _, l := range labels {
+		if l.ID == label || strings.EqualFold(l.Name, label) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// fetchBoardCards fetches the cards of a board that match the filter. The
+// card list is one request, so only the matching cards are enriched.
+func fetchBoardCards[T boardCard](client *http.Client, baseURL, apiKey, token, boardID string, filter CardFilter) ([]T, error) {
+	searchURL := fmt.Sprintf("%s/boards/%s/cards?key=%s&token=%s", baseURL, boardID, apiKey, token)
+	cards, err := fetchTrelloEntities[T](client, searchURL)
+	if err != nil || filter.IsZero() {
+		return cards, err
+	}
+
+	lists := []TRList{}
+	if filter.List != "" {
+		listsURL := fmt.Sprintf("%s/boards/%s/lists?key=%s&token=%s", baseURL, boardID, apiKey, token)
+		lists, err = fetchTrelloEntities[TRList](client, listsURL)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	return FilterCards(cards, filter, lists)
+}
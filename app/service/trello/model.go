@@ -33,10 +33,17 @@ type TRField struct {
 }
 
 type TRAttachment struct {
-	ID   string    `json:"id"`
-	Name string    `json:"name"`
-	URL  string    `json:"url"`
-	Date time.Time `json:"date"`
+	ID       string    `json:"id"`
+	Name     string    `json:"name"`
+	URL      string    `json:"url"`
+	MimeType string    `json:"mimeType"`
+	Bytes    int64     `json:"bytes"`
+	Date     time.Time `json:"date"`
+}
+
+type TRList struct {
+	ID   string `json:"id"`
+	Name string `json:"name"`
 }
 
 type TRComment struct {
@@ -47,6 +54,8 @@ type TRComment struct {
 
 type TRProperty struct {
 	ID               string         `json:"id"`
+	ShortLink        string         `json:"shortLink"`
+	IDList           string         `json:"idList"`
 	Name             string         `json:"name"`
 	LocationAR       string         `json:"locationAR"`
 	LocationEN       string         `json:"locationEN"`
@@ -68,6 +77,8 @@ type TRProperty struct {
 
 type TRInheritanceConfinement struct {
 	ID               string         `json:"id"`
+	ShortLink        string         `json:"shortLink"`
+	IDList           string         `json:"idList"`
 	Name             string         `json:"name"`
 	Title            string         `json:"title"`
 	Generation       int64          `json:"generation"`
@@ -81,6 +92,8 @@ type TRInheritanceConfinement struct {
 
 type TRSupportiveDoc struct {
 	ID               string         `json:"id"`
+	ShortLink        string         `json:"shortLink"`
+	IDList           string         `json:"idList"`
 	Name             string         `json:"name"`
 	Title            string         `json:"title"`
 	Category         string         `json:"category"`
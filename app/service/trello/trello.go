@@ -1,13 +1,12 @@
 package trello
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
 	"io/ioutil"
 	"net/http"
-	"os"
-	"path/filepath"
 	"regexp"
 	"strconv"
 
@@ -16,33 +15,40 @@ import (
 
 type trelloService struct {
 	CfgSvc config.IService
+	// Client bounds every Trello request so a hung call cannot stall a job
+	Client *http.Client
+	// DownloadClient only bounds the response headers of attachment downloads
+	DownloadClient *http.Client
 }
 
 func New(cfgsvc config.IService) IService {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.ResponseHeaderTimeout = cfgsvc.GetHTTPTimeout()
+
 	return &trelloService{
-		CfgSvc: cfgsvc,
+		CfgSvc:         cfgsvc,
+		Client:         &http.Client{Timeout: cfgsvc.GetHTTPTimeout()},
+		DownloadClient: &http.Client{Transport: transport},
 	}
 }
 
-func (svc *trelloService) RetrieveProperties(_ int) ([]TRProperty, error) {
+func (svc *trelloService) RetrieveProperties(_ int, filter CardFilter) ([]TRProperty, error) {
 	var results []TRProperty
 
 	boardID := svc.CfgSvc.GetTrelloPropertiesBoardID()
 
-	customFieldDefs, err := fetchCustomFieldDefs(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), boardID)
+	customFieldDefs, err := fetchCustomFieldDefs(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), boardID)
 	if err != nil {
 		return results, err
 	}
 
-	searchURL := fmt.Sprintf("%s/boards/%s/cards?key=%s&token=%s",
-		svc.CfgSvc.GetTrelloBaseURL(), boardID, svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken())
-	props, err := fetchTrelloEntities[TRProperty](searchURL)
+	props, err := fetchBoardCards[TRProperty](svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), boardID, filter)
 	if err != nil {
 		return results, err
 	}
 
 	for _, prop := range props {
-		customFields, err := fetchCustomFields(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), prop.ID)
+		customFields, err := fetchCustomFields(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), prop.ID)
 		if err != nil {
 			return results, err
 		}
@@ -112,13 +118,13 @@ func (svc *trelloService) RetrieveProperties(_ int) ([]TRProperty, error) {
 			}
 		}
 
-		attachments, err := fetchAttachments(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), prop.ID)
+		attachments, err := fetchAttachments(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), prop.ID)
 		if err != nil {
 			return results, err
 		}
 		prop.Attachments = append(prop.Attachments, attachments...)
 
-		comments, err := fetchComments(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), prop.ID)
+		comments, err := fetchComments(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), prop.ID)
 		if err != nil {
 			return results, err
 		}
@@ -130,25 +136,23 @@ func (svc *trelloService) RetrieveProperties(_ int) ([]TRProperty, error) {
 	return results, nil
 }
 
-func (svc *trelloService) RetrieveInheritanceConfinments(_ int) ([]TRInheritanceConfinement, error) {
+func (svc *trelloService) RetrieveInheritanceConfinments(_ int, filter CardFilter) ([]TRInheritanceConfinement, error) {
 	var results []TRInheritanceConfinement
 
 	boardID := svc.CfgSvc.GetTrelloInheritanceConfinmentsBoardID()
 
-	customFieldDefs, err := fetchCustomFieldDefs(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), boardID)
+	customFieldDefs, err := fetchCustomFieldDefs(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), boardID)
 	if err != nil {
 		return results, err
 	}
 
-	searchURL := fmt.Sprintf("%s/boards/%s/cards?key=%s&token=%s",
-		svc.CfgSvc.GetTrelloBaseURL(), boardID, svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken())
-	entities, err := fetchTrelloEntities[TRInheritanceConfinement](searchURL)
+	entities, err := fetchBoardCards[TRInheritanceConfinement](svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), boardID, filter)
 	if err != nil {
 		return results, err
 	}
 
 	for _, entity := range entities {
-		customFields, err := fetchCustomFields(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
+		customFields, err := fetchCustomFields(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
 		if err != nil {
 			return results, err
 		}
@@ -194,13 +198,13 @@ func (svc *trelloService) RetrieveInheritanceConfinments(_ int) ([]TRInheritance
 			entity.Title = entity.Name
 		}
 
-		attachments, err := fetchAttachments(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
+		attachments, err := fetchAttachments(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
 		if err != nil {
 			return results, err
 		}
 		entity.Attachments = append(entity.Attachments, attachments...)
 
-		comments, err := fetchComments(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
+		comments, err := fetchComments(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
 		if err != nil {
 			return results, err
 		}
@@ -212,25 +216,23 @@ func (svc *trelloService) RetrieveInheritanceConfinments(_ int) ([]TRInheritance
 	return results, nil
 }
 
-func (svc *trelloService) RetrieveSupportiveDocs(_ int) ([]TRSupportiveDoc, error) {
+func (svc *trelloService) RetrieveSupportiveDocs(_ int, filter CardFilter) ([]TRSupportiveDoc, error) {
 	var results []TRSupportiveDoc
 
 	boardID := svc.CfgSvc.GetTrelloSupportiveDocsBoardID()
 
-	customFieldDefs, err := fetchCustomFieldDefs(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), boardID)
+	customFieldDefs, err := fetchCustomFieldDefs(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), boardID)
 	if err != nil {
 		return results, err
 	}
 
-	searchURL := fmt.Sprintf("%s/boards/%s/cards?key=%s&token=%s",
-		svc.CfgSvc.GetTrelloBaseURL(), boardID, svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken())
-	entities, err := fetchTrelloEntities[TRSupportiveDoc](searchURL)
+	entities, err := fetchBoardCards[TRSupportiveDoc](svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), boardID, filter)
 	if err != nil {
 		return results, err
 	}
 
 	for _, entity := range entities {
-		customFields, err := fetchCustomFields(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
+		customFields, err := fetchCustomFields(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
 		if err != nil {
 			return results, err
 		}
@@ -272,13 +274,13 @@ func (svc *trelloService) RetrieveSupportiveDocs(_ int) ([]TRSupportiveDoc, erro
 			entity.Title = entity.Name
 		}
 
-		attachments, err := fetchAttachments(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
+		attachments, err := fetchAttachments(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
 		if err != nil {
 			return results, err
 		}
 		entity.Attachments = append(entity.Attachments, attachments...)
 
-		comments, err := fetchComments(svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
+		comments, err := fetchComments(svc.Client, svc.CfgSvc.GetTrelloBaseURL(), svc.CfgSvc.GetTrelloAPIKey(), svc.CfgSvc.GetTrelloToken(), entity.ID)
 		if err != nil {
 			return results, err
 		}
@@ -290,53 +292,42 @@ func (svc *trelloService) RetrieveSupportiveDocs(_ int) ([]TRSupportiveDoc, erro
 	return results, nil
 }
 
-func (svc *trelloService) DownloadAttachment(url string) (string, string, string, error) {
+// DownloadAttachment opens the contents of an attachment. The caller reads
+// and closes the body. The size is -1 when Trello does not send it. Only the
+// response headers are bounded by the HTTP timeout since the body is read
+// while it is uploaded, so cancel the context to stop a stalled transfer.
+func (svc *trelloService) DownloadAttachment(ctx context.Context, url string) (io.ReadCloser, int64, error) {
 	// Extract the card ID and attachment ID from the URL
-	cardID, attachmentID, extension, err := extractTrelloIDsAndExt(url)
+	cardID, attachmentID, _, err := extractTrelloIDsAndExt(url)
 	if err != nil {
-		return "", "", "", err
+		return nil, 0, err
 	}
 
 	baseURL := svc.CfgSvc.GetTrelloBaseURL()
 	apiKey := svc.CfgSvc.GetTrelloAPIKey()
 	token := svc.CfgSvc.GetTrelloReadToken()
 
-	filename := fmt.Sprintf("%s%s", attachmentID, extension)
 	downloadURL := fmt.Sprintf("%s/cards/%s/attachments/%s/download", baseURL, cardID, attachmentID)
-	client := &http.Client{}
-
-	req, err := http.NewRequest("GET", downloadURL, nil)
+	req, err := http.NewRequestWithContext(ctx, "GET", downloadURL, nil)
 	if err != nil {
-		return "", "", "", err
+		return nil, 0, err
 	}
 
 	authHeader := fmt.Sprintf(`OAuth oauth_consumer_key="%s", oauth_token="%s"`, apiKey, token)
 	req.Header.Set("Authorization", authHeader)
 
-	resp, err := client.Do(req)
+	resp, err := svc.DownloadClient.Do(req)
 	if err != nil {
-		return "", "", "", fmt.Errorf("request error: %w", err)
+		return nil, 0, fmt.Errorf("request error: %w", err)
 	}
-	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
+		defer resp.Body.Close()
 		body, _ := io.ReadAll(resp.Body)
-		return "", "", "", fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
-	}
-
-	localPath := filepath.Join(svc.CfgSvc.GetTrelloDownloadPath(), filename)
-	out, err := os.Create(localPath)
-	if err != nil {
-		return "", "", "", err
-	}
-	defer out.Close()
-
-	_, err = io.Copy(out, resp.Body)
-	if err != nil {
-		return "", "", "", err
+		return nil, 0, fmt.Errorf("API error %d: %s", resp.StatusCode, string(body))
 	}
 
-	return localPath, attachmentID, extension, nil
+	return resp.Body, resp.ContentLength, nil
 }
 
 func extractTrelloIDsAndExt(url string) (cardID, attachmentID, extension string, err error) {
@@ -351,9 +342,9 @@ func extractTrelloIDsAndExt(url string) (cardID, attachmentID, extension string,
 	return matches[1], matches[2], matches[3], nil
 }
 
-func fetchTrelloEntities[T any](url string) ([]T, error) {
+func fetchTrelloEntities[T any](client *http.Client, url string) ([]T, error) {
 	var props []T
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return props, err
 	}
@@ -371,9 +362,9 @@ func fetchTrelloEntities[T any](url string) ([]T, error) {
 	return props, nil
 }
 
-func fetchCustomFieldDefs(baseURL, apiKey, token, boardID string) (map[string]trCustomFieldDef, error) {
+func fetchCustomFieldDefs(client *http.Client, baseURL, apiKey, token, boardID string) (map[string]trCustomFieldDef, error) {
 	url := fmt.Sprintf("%s/boards/%s/customFields?key=%s&token=%s", baseURL, boardID, apiKey, token)
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return nil, err
 	}
@@ -391,10 +382,10 @@ func fetchCustomFieldDefs(baseURL, apiKey, token, boardID string) (map[string]tr
 	return defMap, nil
 }
 
-func fetchCustomFields(baseURL, apiKey, token, cardID string) ([]trCustomFieldItem, error) {
+func fetchCustomFields(client *http.Client, baseURL, apiKey, token, cardID string) ([]trCustomFieldItem, error) {
 	var fields []trCustomFieldItem
 	url := fmt.Sprintf("%s/cards/%s/customFieldItems?key=%s&token=%s", baseURL, cardID, apiKey, token)
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return fields, err
 	}
@@ -405,10 +396,10 @@ func fetchCustomFields(baseURL, apiKey, token, cardID string) ([]trCustomFieldIt
 	return fields, nil
 }
 
-func fetchAttachments(baseURL, apiKey, token, cardID string) ([]TRAttachment, error) {
+func fetchAttachments(client *http.Client, baseURL, apiKey, token, cardID string) ([]TRAttachment, error) {
 	var attachments []TRAttachment
 	url := fmt.Sprintf("%s/cards/%s/attachments?key=%s&token=%s", baseURL, cardID, apiKey, token)
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return attachments, err
 	}
@@ -419,10 +410,10 @@ func fetchAttachments(baseURL, apiKey, token, cardID string) ([]TRAttachment, er
 	return attachments, nil
 }
 
-func fetchComments(baseURL, apiKey, token, cardID string) ([]TRComment, error) {
+func fetchComments(client *http.Client, baseURL, apiKey, token, cardID string) ([]TRComment, error) {
 	var comments []TRComment
 	url := fmt.Sprintf("%s/cards/%s/actions?filter=commentCard&key=%s&token=%s", baseURL, cardID, apiKey, token)
-	resp, err := http.Get(url)
+	resp, err := client.Get(url)
 	if err != nil {
 		return comments, err
 	}
@@ -1,8 +1,13 @@
 package trello
 
+import (
+	"context"
+	"io"
+)
+
 type IService interface {
-	RetrieveProperties(max int) ([]TRProperty, error)
-	RetrieveInheritanceConfinments(max int) ([]TRInheritanceConfinement, error)
-	RetrieveSupportiveDocs(max int) ([]TRSupportiveDoc, error)
-	DownloadAttachment(url string) (string, string, string, error)
+	RetrieveProperties(max int, filter CardFilter) ([]TRProperty, error)
+	RetrieveInheritanceConfinments(max int, filter CardFilter) ([]TRInheritanceConfinement, error)
+	RetrieveSupportiveDocs(max int, filter CardFilter) ([]TRSupportiveDoc, error)
+	DownloadAttachment(ctx context.Context, url string) (io.ReadCloser, int64, error)
 }
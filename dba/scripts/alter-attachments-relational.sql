@@ -0,0 +1,56 @@
+-- Replaces the trello_url -> storage_url mapping table with one row per
+-- entity attachment. Existing mappings are carried over as mirrored rows.
+ALTER TABLE attachments RENAME TO attachments_legacy;
+
+CREATE TABLE attachments (
+    id SERIAL PRIMARY KEY,
+    entity_type TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    trello_attachment_id TEXT NOT NULL,
+    trello_url TEXT NOT NULL,
+    name TEXT NOT NULL DEFAULT '',
+    mime_type TEXT NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    checksum TEXT NOT NULL DEFAULT '',
+    storage_key TEXT NOT NULL DEFAULT '',
+    storage_url TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending',
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (entity_type, card_id, trello_attachment_id)
+);
+
+CREATE INDEX attachments_status_idx ON attachments (status);
+
+-- Trello URLs look like https://trello.com/1/cards/<card>/attachments/<attachment>/download/<name>
+INSERT INTO attachments (entity_type, card_id, trello_attachment_id, trello_url, name, storage_key, storage_url, status, updated_at)
+SELECT 'properties', p.card_id, split_part(u.url, '/', 8), u.url, split_part(u.url, '/', 10),
+    'properties/' || split_part(u.url, '/', 8) || '-' || lower(replace(p.location_en, ' ', '_')) || '_' || lower(replace(p.name, ' ', '_')) || COALESCE(substring(u.url from '\.[^./]*$'), ''),
+    COALESCE(l.storage_url, ''), CASE WHEN l.id IS NULL THEN 'pending' ELSE 'mirrored' END, now()
+FROM properties p
+CROSS JOIN LATERAL unnest(p.attachments) AS u(url)
+LEFT JOIN attachments_legacy l ON l.trello_url = u.url
+WHERE u.url <> ''
+ON CONFLICT DO NOTHING;
+
+INSERT INTO attachments (entity_type, card_id, trello_attachment_id, trello_url, name, storage_key, storage_url, status, updated_at)
+SELECT 'inheritance_confinments', i.card_id, split_part(u.url, '/', 8), u.url, split_part(u.url, '/', 10),
+    'inheritance_confinments/' || split_part(u.url, '/', 8) || '-' || i.generation || '_' || lower(replace(i.name, ' ', '_')) || COALESCE(substring(u.url from '\.[^./]*$'), ''),
+    COALESCE(l.storage_url, ''), CASE WHEN l.id IS NULL THEN 'pending' ELSE 'mirrored' END, now()
+FROM inheritance_confinments i
+CROSS JOIN LATERAL unnest(i.attachments) AS u(url)
+LEFT JOIN attachments_legacy l ON l.trello_url = u.url
+WHERE u.url <> ''
+ON CONFLICT DO NOTHING;
+
+INSERT INTO attachments (entity_type, card_id, trello_attachment_id, trello_url, name, storage_key, storage_url, status, updated_at)
+SELECT 'supportive_docs', d.card_id, split_part(u.url, '/', 8), u.url, split_part(u.url, '/', 10),
+    'supportive_docs/' || split_part(u.url, '/', 8) || '-' || lower(replace(d.category, ' ', '_')) || '_' || lower(replace(d.name, ' ', '_')) || COALESCE(substring(u.url from '\.[^./]*$'), ''),
+    COALESCE(l.storage_url, ''), CASE WHEN l.id IS NULL THEN 'pending' ELSE 'mirrored' END, now()
+FROM supportive_docs d
+CROSS JOIN LATERAL unnest(d.attachments) AS u(url)
+LEFT JOIN attachments_legacy l ON l.trello_url = u.url
+WHERE u.url <> ''
+ON CONFLICT DO NOTHING;
+
+-- Once the migrated rows are verified:
+-- DROP TABLE attachments_legacy;
@@ -0,0 +1,10 @@
+ALTER TABLE errors
+    ADD COLUMN job_id INTEGER,
+    ADD COLUMN card_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN entity_type TEXT NOT NULL DEFAULT '',
+    ADD COLUMN severity TEXT NOT NULL DEFAULT 'error',
+    ADD COLUMN class TEXT NOT NULL DEFAULT 'internal',
+    ADD COLUMN stack TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX errors_job_id_idx ON errors (job_id);
+CREATE INDEX errors_occurred_at_idx ON errors (occurred_at);
@@ -0,0 +1,3 @@
+ALTER TABLE jobs
+    ADD COLUMN cancelled_by TEXT NOT NULL DEFAULT '',
+    ADD COLUMN cancel_reason TEXT NOT NULL DEFAULT '';
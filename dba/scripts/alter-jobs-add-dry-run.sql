@@ -0,0 +1,3 @@
+ALTER TABLE jobs
+    ADD COLUMN dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    ADD COLUMN report JSONB;
@@ -0,0 +1,2 @@
+ALTER TABLE jobs
+    ADD COLUMN options JSONB NOT NULL DEFAULT '{}';
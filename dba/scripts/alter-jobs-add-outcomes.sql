@@ -0,0 +1,7 @@
+ALTER TABLE jobs
+    ADD COLUMN inserted BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN updated BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN unchanged BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN failed BIGINT NOT NULL DEFAULT 0;
+
+CREATE INDEX jobs_type_started_at_idx ON jobs (type, started_at);
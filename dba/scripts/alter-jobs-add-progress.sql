@@ -0,0 +1,4 @@
+ALTER TABLE jobs
+    ADD COLUMN processed BIGINT NOT NULL DEFAULT 0,
+    ADD COLUMN current_card TEXT NOT NULL DEFAULT '',
+    ADD COLUMN progress_at TIMESTAMP;
@@ -0,0 +1,8 @@
+ALTER TABLE jobs
+    ADD COLUMN page_size INT NOT NULL DEFAULT 50,
+    ADD COLUMN attempts INT NOT NULL DEFAULT 0,
+    ADD COLUMN worker_id TEXT NOT NULL DEFAULT '',
+    ADD COLUMN heartbeat_at TIMESTAMP;
+
+-- Running jobs without a heartbeat are picked up by the reaper
+CREATE INDEX jobs_state_type_idx ON jobs (state, type);
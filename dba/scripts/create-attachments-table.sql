@@ -1,6 +1,18 @@
 CREATE TABLE attachments (
     id SERIAL PRIMARY KEY,
+    entity_type TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    trello_attachment_id TEXT NOT NULL,
     trello_url TEXT NOT NULL,
-    storage_url TEXT NOT NULL,
-    updated_at TIMESTAMP NOT NULL
+    name TEXT NOT NULL DEFAULT '',
+    mime_type TEXT NOT NULL DEFAULT '',
+    size BIGINT NOT NULL DEFAULT 0,
+    checksum TEXT NOT NULL DEFAULT '',
+    storage_key TEXT NOT NULL DEFAULT '',
+    storage_url TEXT NOT NULL DEFAULT '',
+    status TEXT NOT NULL DEFAULT 'pending',
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (entity_type, card_id, trello_attachment_id)
 );
+
+CREATE INDEX attachments_status_idx ON attachments (status);
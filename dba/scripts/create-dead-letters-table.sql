@@ -0,0 +1,18 @@
+CREATE TABLE dead_letters (
+    id SERIAL PRIMARY KEY,
+    job_id INT NOT NULL,
+    entity_type TEXT NOT NULL,
+    card_id TEXT NOT NULL,
+    item_key TEXT NOT NULL DEFAULT '',
+    operation TEXT NOT NULL,
+    payload TEXT NOT NULL,
+    error TEXT NOT NULL,
+    attempts INT NOT NULL DEFAULT 0,
+    state TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    resolved_at TIMESTAMP
+);
+
+CREATE INDEX dead_letters_card_idx ON dead_letters (entity_type, card_id, operation, item_key, state);
+CREATE INDEX dead_letters_state_idx ON dead_letters (state);
@@ -2,5 +2,14 @@ CREATE TABLE errors (
     id SERIAL PRIMARY KEY,
     occurred_at TIMESTAMP NOT NULL,
     source TEXT NOT NULL,
-    body TEXT NOT NULL
+    body TEXT NOT NULL,
+    job_id INTEGER,
+    card_id TEXT NOT NULL DEFAULT '',
+    entity_type TEXT NOT NULL DEFAULT '',
+    severity TEXT NOT NULL DEFAULT 'error',
+    class TEXT NOT NULL DEFAULT 'internal',
+    stack TEXT NOT NULL DEFAULT ''
 );
+
+CREATE INDEX errors_job_id_idx ON errors (job_id);
+CREATE INDEX errors_occurred_at_idx ON errors (occurred_at);
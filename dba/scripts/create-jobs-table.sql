@@ -4,6 +4,25 @@ CREATE TABLE jobs (
     state TEXT NOT NULL,
     cards BIGINT NOT NULL,
     errors BIGINT NOT NULL,
+    inserted BIGINT NOT NULL DEFAULT 0,
+    updated BIGINT NOT NULL DEFAULT 0,
+    unchanged BIGINT NOT NULL DEFAULT 0,
+    failed BIGINT NOT NULL DEFAULT 0,
     started_at TIMESTAMP NOT NULL,
-    completed_at TIMESTAMP
+    completed_at TIMESTAMP,
+    page_size INT NOT NULL DEFAULT 50,
+    attempts INT NOT NULL DEFAULT 0,
+    worker_id TEXT NOT NULL DEFAULT '',
+    heartbeat_at TIMESTAMP,
+    cancelled_by TEXT NOT NULL DEFAULT '',
+    cancel_reason TEXT NOT NULL DEFAULT '',
+    processed BIGINT NOT NULL DEFAULT 0,
+    current_card TEXT NOT NULL DEFAULT '',
+    progress_at TIMESTAMP,
+    dry_run BOOLEAN NOT NULL DEFAULT FALSE,
+    report JSONB,
+    options JSONB NOT NULL DEFAULT '{}'
 );
+
+CREATE INDEX jobs_type_started_at_idx ON jobs (type, started_at);
+CREATE INDEX jobs_state_type_idx ON jobs (state, type);
@@ -0,0 +1,22 @@
+CREATE TABLE pipeline_runs (
+    id SERIAL PRIMARY KEY,
+    pipeline TEXT NOT NULL,
+    state TEXT NOT NULL,
+    triggered_by TEXT NOT NULL DEFAULT '',
+    started_at TIMESTAMP NOT NULL,
+    completed_at TIMESTAMP
+);
+
+CREATE INDEX pipeline_runs_state_idx ON pipeline_runs (state);
+
+CREATE TABLE pipeline_steps (
+    id SERIAL PRIMARY KEY,
+    run_id INT NOT NULL REFERENCES pipeline_runs (id) ON DELETE CASCADE,
+    job_type TEXT NOT NULL,
+    depends_on TEXT NOT NULL DEFAULT '[]',
+    on_failure TEXT NOT NULL,
+    state TEXT NOT NULL,
+    job_id INT,
+    updated_at TIMESTAMP NOT NULL,
+    UNIQUE (run_id, job_type)
+);
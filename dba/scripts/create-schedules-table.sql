@@ -0,0 +1,9 @@
+CREATE TABLE schedules (
+    job_type TEXT PRIMARY KEY,
+    cron TEXT NOT NULL,
+    time_zone TEXT NOT NULL,
+    catch_up TEXT NOT NULL,
+    last_fired_at TIMESTAMP,
+    next_fire_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL
+);